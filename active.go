@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	log "github.com/sirupsen/logrus"
+)
+
+type activeState struct {
+	Schedules []string `json:"schedules"`
+	Pinned    string   `json:"pinned,omitempty"`
+}
+
+func currentActive() *activeState {
+	scheduleMu.RLock()
+	defer scheduleMu.RUnlock()
+	return &activeState{Schedules: activeSchedules, Pinned: pinnedSchedule}
+}
+
+func getActiveHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, currentActive())
+}
+
+// postActiveHandler pins a schedule until it's unpinned by
+// deleteActiveHandler, ignoring the date windows.
+func postActiveHandler(w http.ResponseWriter, r *http.Request) {
+	body := struct {
+		Name string `json:"name"`
+	}{}
+	err := json.NewDecoder(io.LimitReader(r.Body, 1000000)).Decode(&body)
+	if err != nil || body.Name == "" {
+		writeError(w, http.StatusBadRequest, `expected {"name": "<schedule>"}`)
+		return
+	}
+	scheduleMu.Lock()
+	if findSchedule(loadedSchedules, body.Name) == nil {
+		scheduleMu.Unlock()
+		writeError(w, http.StatusNotFound, fmt.Sprintf("schedule not found: %s", body.Name))
+		return
+	}
+	pinnedSchedule = body.Name
+	scheduleMu.Unlock()
+	log.Warnf("Pinned schedule: %s", body.Name)
+	setActive(w, r)
+}
+
+func deleteActiveHandler(w http.ResponseWriter, r *http.Request) {
+	scheduleMu.Lock()
+	pinnedSchedule = ""
+	scheduleMu.Unlock()
+	log.Warn("Unpinned schedule")
+	setActive(w, r)
+}
+
+// setActive reloads so a pin change takes effect and answers the new state.
+func setActive(w http.ResponseWriter, r *http.Request) {
+	err := reloadSchedule(r.Context())
+	if writeTimeout(w, err) {
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, currentActive())
+}
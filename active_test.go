@@ -0,0 +1,50 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPinSchedule(t *testing.T) {
+	testDir(t)
+	loadSchedule(t, time.Date(2024, 3, 4, 7, 0, 0, 0, time.UTC), `[
+		{"name": "term", "starts": "2024-01-01", "ends": "2024-12-31", "days": [{"name": "Monday", "events": [{"time": "08:00", "sound": "bell.mp3"}]}]},
+		{"name": "summer", "starts": "2024-06-01", "ends": "2024-08-31", "days": [{"name": "Monday", "events": [{"time": "10:00", "sound": "bell.mp3"}]}]}
+	]`)
+	check := func(when string, schedules []string, pinned, bell string) {
+		t.Helper()
+		state := &activeState{}
+		decodeBody(t, apiRequest(t, "GET", "/api/v1/active", ""), state)
+		if !reflect.DeepEqual(state.Schedules, schedules) || state.Pinned != pinned {
+			t.Errorf("%s: active = %+v, want %v pinned %q", when, state, schedules, pinned)
+		}
+		if bells := entriesOf("bell"); len(bells) != 1 || bells[0].Time != bell {
+			t.Errorf("%s: bells = %v, want only %s", when, bells, bell)
+		}
+	}
+	check("by date", []string{"term"}, "", "08:00")
+
+	if rec := apiRequest(t, "POST", "/api/v1/active", `{"name": "winter"}`); rec.Code != http.StatusNotFound {
+		t.Errorf("pin winter = %d, want 404", rec.Code)
+	}
+	if rec := apiRequest(t, "POST", "/api/v1/active", `{}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("pin without a name = %d, want 400", rec.Code)
+	}
+
+	if rec := apiRequest(t, "POST", "/api/v1/active", `{"name": "summer"}`); rec.Code != http.StatusOK {
+		t.Fatalf("pin summer = %d %s, want 200", rec.Code, rec.Body)
+	}
+	check("pinned", []string{"summer"}, "summer", "10:00")
+
+	if rec := apiRequest(t, "POST", "/api/v1/reload", ""); rec.Code != http.StatusOK {
+		t.Fatalf("reload = %d %s, want 200", rec.Code, rec.Body)
+	}
+	check("reloaded while pinned", []string{"summer"}, "summer", "10:00")
+
+	if rec := apiRequest(t, "DELETE", "/api/v1/active", ""); rec.Code != http.StatusOK {
+		t.Fatalf("unpin = %d %s, want 200", rec.Code, rec.Body)
+	}
+	check("unpinned", []string{"term"}, "", "08:00")
+}
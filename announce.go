@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// speakTimeout bounds how long the speech command may take.
+const speakTimeout = 10 * time.Second
+
+// hourWords are the spoken hours of a 12 hour clock by locale, midnight and
+// noon first. Other locales say the digits.
+var hourWords = map[string][]string{
+	"en": {"twelve", "one", "two", "three", "four", "five", "six", "seven", "eight", "nine", "ten", "eleven"},
+	"es": {"doce", "una", "dos", "tres", "cuatro", "cinco", "seis", "siete", "ocho", "nueve", "diez", "once"},
+}
+
+// announcementText is announce.phrase with {hour} replaced by hour, spoken
+// in announce.locale.
+func announcementText(hour int) string {
+	spoken := strconv.Itoa(hour % 12)
+	if words, ok := hourWords[viper.GetString("announce.locale")]; ok {
+		spoken = words[hour%12]
+	} else if hour%12 == 0 {
+		spoken = "12"
+	}
+	return strings.ReplaceAll(viper.GetString("announce.phrase"), "{hour}", spoken)
+}
+
+// speak runs announce.command, which must write a 16 bit WAV of {text}
+// spoken in {locale} to stdout, and returns it as stereo PCM. The command is
+// run directly, not through a shell.
+func speak(text string) (io.Reader, int, error) {
+	args := strings.Fields(viper.GetString("announce.command"))
+	if len(args) == 0 {
+		return nil, 0, fmt.Errorf("announce.command is not set")
+	}
+	for i, arg := range args {
+		arg = strings.ReplaceAll(arg, "{locale}", viper.GetString("announce.locale"))
+		args[i] = strings.ReplaceAll(arg, "{text}", text)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), speakTimeout)
+	defer cancel()
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, 0, fmt.Errorf("speech command failed: %v %s", err, strings.TrimSpace(stderr.String()))
+	}
+	pcm, rate, err := decodeWAV(out)
+	if err != nil {
+		return nil, 0, fmt.Errorf("could not read speech: %v", err)
+	}
+	return bytes.NewReader(pcm), rate, nil
+}
+
+// addAnnouncements registers an announcement on every hour between the
+// first and last timed bell of each of sch's enabled days. Callers must hold
+// scheduleMu.
+func addAnnouncements(sch *schedule) {
+	for _, d := range sch.Days {
+		if !d.isEnabled() {
+			continue
+		}
+		first, last := -1, -1
+		for _, evt := range d.Events {
+			if evt.Cron != "" || len(evt.Time) != 5 {
+				continue
+			}
+			t, err := time.Parse("15:04", evt.Time)
+			if err != nil {
+				continue
+			}
+			minutes := t.Hour()*60 + t.Minute()
+			if first == -1 || minutes < first {
+				first = minutes
+			}
+			if minutes > last {
+				last = minutes
+			}
+		}
+		if first == -1 {
+			continue
+		}
+		dayName := strings.ToUpper(d.Name[0:3])
+		for hour := (first + 59) / 60; hour*60 <= last; hour++ {
+			hour := hour
+			at := fmt.Sprintf("%02d:00", hour)
+			spec, err := eventSpec(sch, dayName, &event{Time: at}, appClock.Now())
+			if err != nil {
+				addScheduleError(sch.Name, dayName, at, "Could not schedule announcement: %v", err)
+				continue
+			}
+			info := &entryInfo{Kind: "announce", Schedule: sch.Name, Day: dayName, Time: at}
+			_, err = addEntry(strings.Join([]string{"announce", spec, sch.Name}, "|"), spec, info, func() {
+				text := announcementText(hour)
+				log.WithFields(log.Fields{"Schedule": sch.Name, "Day": dayName, "Time": at}).Info("Announcing: " + text)
+				err := enqueuePlay(&playJob{Sound: "announcement", Announce: text})
+				if err != nil {
+					log.Errorf("Could not queue announcement: %v", err)
+				}
+			})
+			if err != nil {
+				addScheduleError(sch.Name, dayName, at, "Could not schedule announcement: %s : %v", spec, err)
+			}
+		}
+	}
+}
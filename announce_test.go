@@ -0,0 +1,100 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestAnnouncementText(t *testing.T) {
+	setConfig(t, "announce.phrase", "It is {hour} o'clock")
+	tests := []struct {
+		locale string
+		hour   int
+		want   string
+	}{
+		{"en", 15, "It is three o'clock"},
+		{"en", 0, "It is twelve o'clock"},
+		{"en", 12, "It is twelve o'clock"},
+		{"es", 9, "It is nueve o'clock"},
+		{"fr", 9, "It is 9 o'clock"},
+		{"fr", 12, "It is 12 o'clock"},
+	}
+	for _, tt := range tests {
+		setConfig(t, "announce.locale", tt.locale)
+		if got := announcementText(tt.hour); got != tt.want {
+			t.Errorf("announcementText(%d) in %s = %q, want %q", tt.hour, tt.locale, got, tt.want)
+		}
+	}
+}
+
+func TestHourlyAnnouncements(t *testing.T) {
+	dir := testDir(t)
+	setConfig(t, "announce.enabled", true)
+	setConfig(t, "announce.phrase", "It is {hour} o'clock")
+	setConfig(t, "announce.locale", "en")
+	speech := filepath.Join(dir, "speech.wav")
+	err := os.WriteFile(speech, wavFile(make([]byte, 4800*4), 48000, 2), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	setConfig(t, "announce.command", "cat "+speech)
+	t.Cleanup(func() {
+		silenceMu.Lock()
+		silencedUntil = map[string]time.Time{}
+		silenceMu.Unlock()
+	})
+	player := &recordingPlayer{}
+	useQueue(t, player, 8)
+	clock := loadSchedule(t, time.Date(2024, 3, 4, 7, 0, 0, 0, time.UTC), `[{"name": "term", "starts": "2024-01-01", "ends": "2024-12-31", "days": [
+		{"name": "Monday", "events": [{"time": "08:30", "sound": "bell.mp3"}, {"time": "15:10", "sound": "bell.mp3"}, {"time": "12:00", "sound": "bell.mp3"}]},
+		{"name": "Tuesday", "events": [{"time": "09:00", "sound": "bell.mp3"}]},
+		{"name": "Friday", "enabled": false, "events": [{"time": "08:00", "sound": "bell.mp3"}, {"time": "14:00", "sound": "bell.mp3"}]}
+	]}]`)
+
+	got := []string{}
+	for _, info := range entriesOf("announce") {
+		got = append(got, info.Day+" "+info.Time)
+	}
+	sort.Strings(got)
+	want := []string{"MON 09:00", "MON 10:00", "MON 11:00", "MON 12:00", "MON 13:00", "MON 14:00", "MON 15:00", "TUE 09:00"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("announcements = %v, want %v", got, want)
+	}
+
+	announce := func(at string) {
+		t.Helper()
+		scheduleMu.RLock()
+		defer scheduleMu.RUnlock()
+		for _, entry := range cronService.Entries() {
+			if info := entryMeta[entry.ID]; info != nil && info.Kind == "announce" && info.Day == "MON" && info.Time == at {
+				go entry.Job.Run()
+				return
+			}
+		}
+		t.Fatalf("no announcement at %s", at)
+	}
+
+	clock.Set(time.Date(2024, 3, 4, 10, 0, 0, 0, time.UTC))
+	announce("10:00")
+	waitFor(t, "the announcement", func() bool { return player.count() == 1 })
+	if last := getLastPlayed(); last == nil || last.Sound != "announcement" {
+		t.Errorf("last played = %+v, want the announcement", last)
+	}
+
+	logs := captureLog(t)
+	silenceMu.Lock()
+	silencedUntil[defaultZone] = time.Date(2024, 3, 4, 12, 0, 0, 0, time.UTC)
+	silenceMu.Unlock()
+	clock.Set(time.Date(2024, 3, 4, 11, 0, 0, 0, time.UTC))
+	announce("11:00")
+	waitFor(t, "the silenced announcement", func() bool {
+		return len(logEntries(t, logs, "Silenced, skipping: announcement (zone )")) == 1
+	})
+	if player.count() != 1 {
+		t.Error("announced while silenced")
+	}
+}
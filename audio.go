@@ -0,0 +1,330 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/hajimehoshi/oto/v2"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+const (
+	samplingRate = 44100
+
+	// Number of channels (aka locations) to play sounds from. Either 1 or 2.
+	// 1 is mono sound, and 2 is stereo (most speakers are stereo).
+	numOfChannels = 2
+
+	// Bytes used by a channel to represent one sample. Either 1 or 2 (usually 2).
+	audioBitDepth = 2
+)
+
+// audioPlayer is an audio output. Play blocks until pcm, 16 bit little endian
+// samples at rate with the given number of channels, has been played.
+type audioPlayer interface {
+	Play(ctx context.Context, pcm io.Reader, rate, channels int) error
+}
+
+// audioBackend is the output selected by audio.backend.
+var audioBackend audioPlayer = &otoPlayer{}
+
+// audioReady is set once the audio pipeline is known to work.
+var audioReady atomic.Bool
+
+// audioRetryInterval is how long playback is skipped after the audio output
+// failed before it's tried again.
+const audioRetryInterval = time.Minute
+
+// The last audio failure, cleared by a successful playback.
+var (
+	audioMu       sync.Mutex
+	audioErr      error
+	audioFailedAt time.Time
+)
+
+func setAudioError(err error) {
+	audioMu.Lock()
+	defer audioMu.Unlock()
+	if err != nil && audioErr == nil {
+		log.Errorf("Audio is unavailable, bells won't sound until it recovers: %v", err)
+	}
+	if err == nil && audioErr != nil {
+		log.Info("Audio recovered")
+	}
+	audioErr = err
+	audioFailedAt = time.Now()
+}
+
+// audioStatus is "ok" once audio has worked, "unavailable" after a failure,
+// with the error, and "unknown" before anything was played.
+func audioStatus() (string, error) {
+	audioMu.Lock()
+	defer audioMu.Unlock()
+	if audioErr != nil {
+		return "unavailable", audioErr
+	}
+	if audioReady.Load() {
+		return "ok", nil
+	}
+	return "unknown", nil
+}
+
+// audioRetryDue reports whether playback should be attempted: audio isn't
+// known to be broken, or it failed long enough ago to try again.
+func audioRetryDue() bool {
+	audioMu.Lock()
+	defer audioMu.Unlock()
+	return audioErr == nil || time.Since(audioFailedAt) >= audioRetryInterval
+}
+
+func newAudioPlayer(name string) (audioPlayer, error) {
+	switch name {
+	case "", "oto":
+		return &otoPlayer{}, nil
+	// "null" is still read, quoted, from configs older than "none"
+	case "none", "null":
+		return &nullPlayer{}, nil
+	case "file":
+		return &filePlayer{dir: viper.GetString("audio.file-dir")}, nil
+	case "rtp":
+		return &rtpPlayer{
+			address:     viper.GetString("audio.rtp.address"),
+			payloadType: viper.GetInt("audio.rtp.payload-type"),
+			packetMs:    viper.GetInt("audio.rtp.packet-ms"),
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown audio backend: %s", name)
+	}
+}
+
+func setupAudioBackend() {
+	name := viper.GetString("audio.backend")
+	// an unquoted null in YAML reads as no value, which would pick oto
+	if _, set := viper.GetStringMap("audio")["backend"]; set && name == "" {
+		log.Errorf("audio.backend is set but empty, discarding audio; write none to discard it or oto to play it")
+		audioBackend = &nullPlayer{}
+		return
+	}
+	backend, err := newAudioPlayer(name)
+	if err != nil {
+		log.Errorf("Could not setup audio: %v, using oto", err)
+		backend = &otoPlayer{}
+	}
+	audioBackend = backend
+}
+
+// oto doesn't support more than one context, so it's created once and shared
+// by every playback. A context that failed to open is retried on a later
+// playback, at most every audioRetryInterval by way of audioRetryDue; each
+// attempt leaves an idle oto goroutine behind. Only playback opens it:
+// parsing and reloading the schedule never touch audio, and callers arriving
+// while it opens wait on otoMu instead of opening another.
+var (
+	otoCtx *oto.Context
+	otoMu  sync.Mutex
+	// otoAttempts counts the calls to oto.NewContext.
+	otoAttempts int
+)
+
+func audioContext() (*oto.Context, error) {
+	otoMu.Lock()
+	defer otoMu.Unlock()
+	if otoCtx != nil {
+		return otoCtx, nil
+	}
+	otoAttempts++
+	ctx, readyChan, err := oto.NewContext(samplingRate, numOfChannels, audioBitDepth)
+	if err != nil {
+		return nil, err
+	}
+	// It might take a bit for the hardware audio devices to be ready, so we wait on the channel.
+	<-readyChan
+	// opening the device happens asynchronously, failures show up here
+	err = ctx.Err()
+	if err != nil {
+		return nil, err
+	}
+	otoCtx = ctx
+	return otoCtx, nil
+}
+
+// otoReady reports whether the oto context is open and how many times
+// opening it was attempted.
+func otoReady() (bool, int) {
+	otoMu.Lock()
+	defer otoMu.Unlock()
+	return otoCtx != nil, otoAttempts
+}
+
+// audioBackendName is the audio.backend value for p.
+func audioBackendName(p audioPlayer) string {
+	switch p.(type) {
+	case *otoPlayer:
+		return "oto"
+	case *nullPlayer:
+		return "none"
+	case *filePlayer:
+		return "file"
+	case *rtpPlayer:
+		return "rtp"
+	default:
+		return "unknown"
+	}
+}
+
+// otoPlayer plays on the default sound card.
+type otoPlayer struct{}
+
+func (o *otoPlayer) Play(ctx context.Context, pcm io.Reader, rate, channels int) (err error) {
+	if rate != samplingRate || channels != numOfChannels {
+		log.Warnf("Playing %d Hz %d channel audio on a %d Hz %d channel output", rate, channels, samplingRate, numOfChannels)
+	}
+	otoCtx, err := audioContext()
+	if err != nil {
+		return err
+	}
+
+	// Create a new 'player' that will handle our sound. Paused by default.
+	player := otoCtx.NewPlayer(pcm)
+	defer func() {
+		closeErr := player.Close()
+		if err == nil {
+			err = closeErr
+		}
+	}()
+
+	// Play starts playing the sound and returns without waiting for it (Play() is async).
+	player.Play()
+
+	// We can wait for the sound to finish playing using something like this
+	for player.IsPlaying() {
+		// a device that dies mid playback would otherwise block forever
+		err = otoCtx.Err()
+		if err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Millisecond * 50):
+		}
+	}
+
+	return player.Err()
+}
+
+// nullPlayer discards audio, for machines without sound hardware and for
+// exercising the play path.
+type nullPlayer struct{}
+
+func (n *nullPlayer) Play(ctx context.Context, pcm io.Reader, rate, channels int) error {
+	_, err := io.Copy(io.Discard, pcm)
+	return err
+}
+
+// playPCM plays 16 bit stereo PCM at rate on the configured backend.
+func playPCM(pcm io.Reader, rate int) error {
+	err := audioBackend.Play(context.Background(), pcm, rate, numOfChannels)
+	setAudioError(err)
+	if err != nil {
+		return err
+	}
+	audioReady.Store(true)
+	return nil
+}
+
+// withPrebuffer puts audio.prebuffer-ms of silence ahead of pcm, 16 bit
+// stereo at rate, so a device that wakes up as playback starts doesn't clip
+// the start of the sound.
+func withPrebuffer(pcm io.Reader, rate int) io.Reader {
+	prebuffer := time.Duration(viper.GetInt("audio.prebuffer-ms")) * time.Millisecond
+	if prebuffer <= 0 {
+		return pcm
+	}
+	return io.MultiReader(bytes.NewReader(silence(rate, prebuffer)), pcm)
+}
+
+// silence returns d of 16 bit stereo silence at rate.
+func silence(rate int, d time.Duration) []byte {
+	frames := int(int64(rate) * int64(d) / int64(time.Second))
+	return make([]byte, frames*numOfChannels*audioBitDepth)
+}
+
+// audioSelfTestTimeout bounds how long startup waits on the self-test.
+const audioSelfTestTimeout = 5 * time.Second
+
+// audioSelfTest plays a short silent buffer so a missing or misconfigured
+// device shows up at boot instead of at the first bell. A device that takes
+// too long to open is reported as unavailable and left to finish opening in
+// the background.
+func audioSelfTest() error {
+	done := make(chan error, 1)
+	go func() {
+		done <- playPCM(bytes.NewReader(silence(samplingRate, 100*time.Millisecond)), samplingRate)
+	}()
+	var err error
+	select {
+	case err = <-done:
+	case <-time.After(audioSelfTestTimeout):
+		err = errors.New("audio self-test timed out")
+		setAudioError(err)
+	}
+	if err != nil {
+		audioReady.Store(false)
+		log.Errorf("Audio self-test failed, the API keeps working without sound: %v", err)
+		return err
+	}
+	log.Info("Audio self-test passed")
+	return nil
+}
+
+// startSoundWait is how long playOnStart waits to report how the start
+// sound went.
+const startSoundWait = 2 * time.Minute
+
+// playOnStart queues audio.play-on-start, if set, so an install can be
+// checked by ear, and logs whether it played. It's skipped when the
+// self-test found audio unavailable.
+func playOnStart() {
+	sound := viper.GetString("audio.play-on-start")
+	if sound == "" {
+		return
+	}
+	if _, err := audioStatus(); err != nil {
+		log.Warnf("Audio unavailable, skipping start sound: %s", sound)
+		return
+	}
+	err := checkSoundFile(soundsDir(), sound)
+	if err != nil {
+		log.Errorf("Invalid start sound: %s : %v", sound, err)
+		return
+	}
+	job := &playJob{Sound: sound, Done: make(chan error, 1)}
+	err = enqueuePlay(job)
+	if err != nil {
+		log.Errorf("Could not queue start sound: %s : %v", sound, err)
+		return
+	}
+	log.Infof("Queued start sound: %s", sound)
+	go func() {
+		timeout := time.NewTimer(startSoundWait)
+		defer timeout.Stop()
+		select {
+		case err := <-job.Done:
+			if err != nil {
+				log.Errorf("Start sound did not play: %s : %v", sound, err)
+				return
+			}
+			log.Infof("Start sound played: %s", sound)
+		case <-timeout.C:
+			log.Warnf("Start sound still not played after %s: %s", startSoundWait, sound)
+		}
+	}()
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// failingPlayer is an audio backend whose every playback fails with err.
+type failingPlayer struct {
+	err error
+}
+
+func (f *failingPlayer) Play(ctx context.Context, pcm io.Reader, rate, channels int) error {
+	return f.err
+}
+
+func TestAudioSelfTest(t *testing.T) {
+	backend := &recordingPlayer{}
+	useBackend(t, backend)
+	err := audioSelfTest()
+	if err != nil {
+		t.Fatalf("self-test = %v, want passed", err)
+	}
+	if status, _ := audioStatus(); status != "ok" || !audioReady.Load() {
+		t.Errorf("status = %s, ready = %v, want ok and ready", status, audioReady.Load())
+	}
+	if backend.count() != 1 {
+		t.Fatalf("played %d buffers, want 1", backend.count())
+	}
+	played := backend.played[0]
+	// 100ms of 16 bit stereo
+	if len(played) != samplingRate/10*4 {
+		t.Errorf("played %d bytes, want 100ms", len(played))
+	}
+	for _, b := range played {
+		if b != 0 {
+			t.Fatal("self-test buffer isn't silent")
+		}
+	}
+}
+
+func TestAudioSelfTestFails(t *testing.T) {
+	broken := errors.New("no such device")
+	useBackend(t, &failingPlayer{err: broken})
+	audioReady.Store(true)
+	err := audioSelfTest()
+	if !errors.Is(err, broken) {
+		t.Fatalf("self-test = %v, want %v", err, broken)
+	}
+	status, statusErr := audioStatus()
+	if status != "unavailable" || !errors.Is(statusErr, broken) || audioReady.Load() {
+		t.Errorf("status = %s %v, ready = %v, want unavailable with the error", status, statusErr, audioReady.Load())
+	}
+}
+
+func TestSetupAudioBackend(t *testing.T) {
+	tests := []struct {
+		config string
+		want   string
+	}{
+		{"", "oto"},
+		{"audio:\n  backend: oto\n", "oto"},
+		{"audio:\n  backend: none\n", "none"},
+		{"audio:\n  backend: \"null\"\n", "none"},
+		// an unquoted null is no value, which mustn't fall back to oto
+		{"audio:\n  backend: null\n", "none"},
+		{"audio:\n  backend:\n", "none"},
+		{"audio:\n  backend: file\n  file-dir: recordings\n", "file"},
+		{"audio:\n  backend: rtp\n  rtp:\n    address: 127.0.0.1:5004\n", "rtp"},
+		{"audio:\n  backend: speakers\n", "oto"},
+	}
+	for _, tt := range tests {
+		viper.Reset()
+		viper.SetConfigType("yaml")
+		err := viper.ReadConfig(strings.NewReader(tt.config))
+		if err != nil {
+			t.Fatal(err)
+		}
+		useBackend(t, nil)
+		setupAudioBackend()
+		if got := audioBackendName(audioBackend); got != tt.want {
+			t.Errorf("%q selects %s, want %s", tt.config, got, tt.want)
+		}
+	}
+	viper.Reset()
+}
+
+func TestReloadLeavesAudio(t *testing.T) {
+	testDir(t)
+	// the sound card backend, which only opens its context to play
+	useBackend(t, &otoPlayer{})
+	ready, attempts := otoReady()
+	loadSchedule(t, time.Date(2024, 3, 4, 7, 0, 0, 0, time.UTC), mondayBells)
+	for i := 0; i < 5; i++ {
+		if err := reloadSchedule(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if rec := apiRequest(t, "POST", "/api/v1/reload", ""); rec.Code != http.StatusOK {
+		t.Fatalf("reload = %d %s, want 200", rec.Code, rec.Body)
+	}
+	if gotReady, got := otoReady(); gotReady != ready || got != attempts {
+		t.Errorf("after reloading, oto context open %v after %d attempts, want %v after %d", gotReady, got, ready, attempts)
+	}
+}
+
+func TestPrebuffer(t *testing.T) {
+	pcm := make([]byte, 4*480)
+	for i := range pcm {
+		pcm[i] = byte(i%255 + 1)
+	}
+	tests := []struct {
+		prebufferMs int
+		silent      int
+	}{
+		{50, samplingRate / 20 * 4},
+		{0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(strconv.Itoa(tt.prebufferMs), func(t *testing.T) {
+			setConfig(t, "audio.prebuffer-ms", tt.prebufferMs)
+			// only the sound card is kept warm, this one plays just the job
+			setConfig(t, "audio.keep-warm-ms", 1000)
+			player := &recordingPlayer{}
+			useQueue(t, player, 4)
+			job := &playJob{Sound: "tone", PCM: pcm, Done: make(chan error, 1)}
+			if err := enqueuePlay(job); err != nil {
+				t.Fatal(err)
+			}
+			if err := <-job.Done; err != nil {
+				t.Fatal(err)
+			}
+			time.Sleep(50 * time.Millisecond)
+			player.mu.Lock()
+			defer player.mu.Unlock()
+			if len(player.played) != 1 {
+				t.Fatalf("played %d times, want once", len(player.played))
+			}
+			played := player.played[0]
+			want := append(make([]byte, tt.silent), pcm...)
+			if !bytes.Equal(played, want) {
+				t.Errorf("played %d bytes, want %d of silence then the %d of the sound", len(played), tt.silent, len(pcm))
+			}
+		})
+	}
+}
+
+func TestNullBackendPlaysScheduledBell(t *testing.T) {
+	testDir(t)
+	useQueue(t, &nullPlayer{}, 8)
+	clock := loadSchedule(t, time.Date(2024, 3, 4, 7, 0, 0, 0, time.UTC), mondayBells)
+
+	clock.Set(time.Date(2024, 3, 4, 8, 0, 0, 0, time.UTC))
+	runBell(t, "term", "08:00")
+	waitFor(t, "the bell to play", func() bool { return getLastPlayed() != nil })
+	played := getLastPlayed()
+	if played.Sound != "bell.mp3" || played.Error != "" || !played.At.Equal(clock.Now()) {
+		t.Errorf("last played = %+v, want bell.mp3 played at 08:00", played)
+	}
+	if status, err := audioStatus(); status != "ok" {
+		t.Errorf("audio status = %s %v, want ok", status, err)
+	}
+}
+
+// flakyPlayer fails with err while it's set and counts its playbacks.
+type flakyPlayer struct {
+	mu    sync.Mutex
+	err   error
+	calls int
+}
+
+func (f *flakyPlayer) Play(ctx context.Context, pcm io.Reader, rate, channels int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls++
+	return f.err
+}
+
+func (f *flakyPlayer) set(err error) {
+	f.mu.Lock()
+	f.err = err
+	f.mu.Unlock()
+}
+
+func (f *flakyPlayer) count() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls
+}
+
+func TestServesWithoutAudio(t *testing.T) {
+	testDir(t)
+	broken := errors.New("no such device")
+	backend := &flakyPlayer{err: broken}
+	useQueue(t, backend, 8)
+	loadSchedule(t, time.Date(2024, 3, 4, 7, 0, 0, 0, time.UTC), mondayBells)
+	play := func() error {
+		t.Helper()
+		job := &playJob{Sound: "bell.mp3", Done: make(chan error, 1), skipDedup: true}
+		if err := enqueuePlay(job); err != nil {
+			t.Fatal(err)
+		}
+		return <-job.Done
+	}
+
+	if err := audioSelfTest(); err == nil {
+		t.Fatal("self-test passed on a broken backend")
+	}
+	state := &health{}
+	rec := apiRequest(t, "GET", "/api/v1/healthz", "")
+	decodeBody(t, rec, state)
+	if rec.Code != http.StatusOK || state.Status != "degraded" || state.Audio != "unavailable" || state.AudioError != broken.Error() {
+		t.Errorf("healthz = %d %+v, want 200, degraded with the audio error", rec.Code, state)
+	}
+	for _, target := range []string{"/api/v1/cron", "/api/v1/stats", "/api/v1/sounds"} {
+		if rec := apiRequest(t, "GET", target, ""); rec.Code != http.StatusOK {
+			t.Errorf("GET %s without audio = %d, want 200", target, rec.Code)
+		}
+	}
+	if rec := apiRequest(t, "POST", "/api/v1/reload", ""); rec.Code != http.StatusOK {
+		t.Errorf("reload without audio = %d, want 200", rec.Code)
+	}
+
+	// bells are skipped without trying the device until the retry is due
+	if err := play(); err == nil || err.Error() != "audio unavailable" || backend.count() != 1 {
+		t.Errorf("play = %v after %d tries, want skipped", err, backend.count())
+	}
+
+	backend.set(nil)
+	audioMu.Lock()
+	audioFailedAt = audioFailedAt.Add(-audioRetryInterval)
+	audioMu.Unlock()
+	if err := play(); err != nil || backend.count() != 2 {
+		t.Errorf("play once the retry is due = %v, want played", err)
+	}
+	state = &health{}
+	decodeBody(t, apiRequest(t, "GET", "/api/v1/healthz", ""), state)
+	if state.Status != "ok" || state.Audio != "ok" {
+		t.Errorf("healthz = %+v after recovering, want ok", state)
+	}
+}
+
+func TestPlayOnStart(t *testing.T) {
+	tests := []struct {
+		name    string
+		sound   string
+		broken  bool
+		fails   bool
+		played  int
+		message string
+		outcome string
+	}{
+		{"configured", "bell.mp3", false, false, 1, "Queued start sound: bell.mp3", "Start sound played: bell.mp3"},
+		{"not configured", "", false, false, 0, "", ""},
+		{"audio failed", "bell.mp3", true, false, 0, "Audio unavailable, skipping start sound: bell.mp3", ""},
+		{"playback failed", "bell.mp3", false, true, 1, "Queued start sound: bell.mp3", "Start sound did not play: bell.mp3 : no such device"},
+		{"missing sound", "missing.mp3", false, false, 0, "Invalid start sound: missing.mp3 : sound not found: missing.mp3", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testDir(t)
+			setConfig(t, "audio.play-on-start", tt.sound)
+			backend := &flakyPlayer{}
+			if tt.broken {
+				backend.set(errors.New("no such device"))
+			}
+			useQueue(t, backend, 8)
+			audioSelfTest()
+			if tt.fails {
+				backend.set(errors.New("no such device"))
+			}
+			logs := captureLog(t)
+
+			playOnStart()
+			if tt.message != "" && len(logEntries(t, logs, tt.message)) != 1 {
+				t.Errorf("%q not logged:\n%s", tt.message, logs)
+			}
+			if tt.outcome != "" {
+				waitFor(t, "the start sound's outcome", func() bool { return len(logEntries(t, logs, tt.outcome)) == 1 })
+			}
+			time.Sleep(20 * time.Millisecond)
+			// the self-test plays once on its own
+			if got := backend.count() - 1; got != tt.played {
+				t.Errorf("played %d sounds, want %d", got, tt.played)
+			}
+		})
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// calendarSound maps calendar events titled Title to a bell playing Sound.
+type calendarSound struct {
+	Title string `mapstructure:"title"`
+	Sound string `mapstructure:"sound"`
+}
+
+// lastCalendar is the last feed read from calendar.url, used while it can't
+// be fetched.
+var (
+	lastCalendar   []byte
+	lastCalendarMu sync.Mutex
+)
+
+// calendarSchedules turns the events of the iCalendar feed at calendar.url
+// over the next calendar.days into one dated schedule per day, named
+// "calendar-<date>", so each day with bells in the calendar replaces the
+// default schedule. They're kept apart as generatedSchedules. Titles are matched to sounds by calendar.sounds, ignoring
+// case; other events are left out. The feed is read again on every parse.
+func calendarSchedules(ctx context.Context, now time.Time) []*schedule {
+	url := viper.GetString("calendar.url")
+	if url == "" {
+		return nil
+	}
+	loc := globalLocation()
+	tzName := viper.GetString("calendar.timezone")
+	if tzName != "" {
+		tz, err := time.LoadLocation(tzName)
+		if err != nil {
+			log.Errorf("Could not load calendar.timezone: %s : %v", tzName, err)
+			return nil
+		}
+		loc = tz
+	}
+
+	feed, err := fetchCalendar(ctx, url)
+	lastCalendarMu.Lock()
+	if err != nil {
+		if lastCalendar == nil {
+			lastCalendarMu.Unlock()
+			log.Errorf("Could not fetch calendar: %v", err)
+			return nil
+		}
+		log.Warnf("Could not fetch calendar, using the last copy: %v", err)
+		feed = lastCalendar
+	}
+	lastCalendar = feed
+	lastCalendarMu.Unlock()
+
+	events, err := parseICS(feed, loc)
+	if err != nil {
+		log.Errorf("Could not parse calendar: %v", err)
+		return nil
+	}
+	days := viper.GetInt("calendar.days")
+	if days < 1 {
+		days = 1
+	}
+	today := now.In(loc)
+	from := time.Date(today.Year(), today.Month(), today.Day(), 0, 0, 0, 0, loc)
+	occurrences, problems := icsOccurrences(events, from, from.AddDate(0, 0, days))
+	for _, p := range problems {
+		log.Warnf("Calendar: skipping %v", p)
+	}
+	return calendarToSchedules(occurrences, calendarSounds(), loc, tzName)
+}
+
+func calendarSounds() map[string]string {
+	configured := []*calendarSound{}
+	err := viper.UnmarshalKey("calendar.sounds", &configured)
+	if err != nil {
+		log.Errorf("Could not parse calendar.sounds: %v", err)
+	}
+	sounds := map[string]string{}
+	for _, s := range configured {
+		sounds[strings.ToLower(strings.TrimSpace(s.Title))] = s.Sound
+	}
+	return sounds
+}
+
+// calendarToSchedules groups the occurrences with a sound by day, in loc.
+func calendarToSchedules(occurrences []*icsOccurrence, sounds map[string]string, loc *time.Location, tzName string) []*schedule {
+	byDate := map[string]*schedule{}
+	generated := []*schedule{}
+	for _, o := range occurrences {
+		sound, ok := sounds[strings.ToLower(strings.TrimSpace(o.Summary))]
+		if !ok {
+			log.Debugf("Calendar: no sound for %q", o.Summary)
+			continue
+		}
+		at := o.At.In(loc)
+		date := at.Format("2006-01-02")
+		sch, ok := byDate[date]
+		if !ok {
+			sch = &schedule{
+				Name:   "calendar-" + date,
+				Label:  "Calendar " + date,
+				Starts: date,
+				// to midnight, so bells in the last minute still ring
+				Ends:     at.AddDate(0, 0, 1).Format("2006-01-02"),
+				Timezone: tzName,
+				Days:     []*day{{Name: at.Weekday().String()}},
+			}
+			byDate[date] = sch
+			generated = append(generated, sch)
+		}
+		sch.Days[0].Events = append(sch.Days[0].Events, &event{
+			Time:   at.Format("15:04"),
+			Second: at.Second(),
+			Sound:  sound,
+			Label:  o.Summary,
+		})
+	}
+	return generated
+}
+
+func fetchCalendar(ctx context.Context, url string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, viper.GetDuration("schedule.fetch-timeout"))
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxRemoteSchedule))
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// bellCalendar is a week of bells as a Google Calendar feed has them: a
+// recurring passing period with one day skipped and one moved, a lunch bell
+// given in UTC and events that aren't bells.
+const bellCalendar = "BEGIN:VCALENDAR\r\n" +
+	"VERSION:2.0\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:passing\r\n" +
+	"SUMMARY:Passing\r\n" +
+	"  period\r\n" +
+	"DTSTART;TZID=America/New_York:20240304T101500\r\n" +
+	"RRULE:FREQ=WEEKLY;BYDAY=MO,WE,FR\r\n" +
+	"EXDATE;TZID=America/New_York:20240306T101500\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:passing\r\n" +
+	"SUMMARY:Passing period\r\n" +
+	"RECURRENCE-ID;TZID=America/New_York:20240308T101500\r\n" +
+	"DTSTART;TZID=America/New_York:20240308T103000\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:lunch\r\n" +
+	"SUMMARY:lunch\r\n" +
+	"DTSTART:20240305T170000Z\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:night\r\n" +
+	"SUMMARY:Lunch\r\n" +
+	"DTSTART;TZID=America/New_York:20240307T235930\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:assembly\r\n" +
+	"SUMMARY:Lunch\r\n" +
+	"STATUS:CANCELLED\r\n" +
+	"DTSTART;TZID=America/New_York:20240304T120000\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:holiday\r\n" +
+	"SUMMARY:Lunch\r\n" +
+	"DTSTART;VALUE=DATE:20240305\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:staff\r\n" +
+	"SUMMARY:Staff meeting\r\n" +
+	"DTSTART;TZID=America/New_York:20240305T150000\r\n" +
+	"END:VEVENT\r\n" +
+	"END:VCALENDAR\r\n"
+
+func TestICSOccurrences(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	events, err := parseICS([]byte(bellCalendar), ny)
+	if err != nil {
+		t.Fatal(err)
+	}
+	from := time.Date(2024, 3, 4, 0, 0, 0, 0, ny)
+	occurrences, problems := icsOccurrences(events, from, from.AddDate(0, 0, 14))
+	got := []string{}
+	for _, o := range occurrences {
+		got = append(got, o.Summary+" "+o.At.In(ny).Format("Mon 01-02 15:04:05"))
+	}
+	// the second week is past the DST change, still 10:15 in New York
+	want := []string{
+		"Passing period Mon 03-04 10:15:00",
+		"lunch Tue 03-05 12:00:00",
+		"Staff meeting Tue 03-05 15:00:00",
+		"Lunch Thu 03-07 23:59:30",
+		"Passing period Fri 03-08 10:30:00",
+		"Passing period Mon 03-11 10:15:00",
+		"Passing period Wed 03-13 10:15:00",
+		"Passing period Fri 03-15 10:15:00",
+	}
+	if len(problems) != 0 || !reflect.DeepEqual(got, want) {
+		t.Errorf("occurrences = %q, problems %v, want %q", got, problems, want)
+	}
+
+	tests := []struct {
+		rule, want string
+	}{
+		{"FREQ=HOURLY", `unsupported FREQ "HOURLY"`},
+		{"FREQ=DAILY;BYMONTH=3", "unsupported RRULE BYMONTH"},
+		{"FREQ=DAILY;BYDAY=MO", "BYDAY is only supported on weekly rules"},
+	}
+	for _, tt := range tests {
+		evt := &icsEvent{Summary: "Bell", Start: from, RRule: tt.rule}
+		if _, err := evt.occurrences(from, from.AddDate(0, 0, 7)); err == nil || err.Error() != tt.want {
+			t.Errorf("RRULE %s = %v, want %q", tt.rule, err, tt.want)
+		}
+	}
+	daily := &icsEvent{Start: from.Add(8 * time.Hour), RRule: "FREQ=DAILY;INTERVAL=2;COUNT=3"}
+	times, _ := daily.occurrences(from, from.AddDate(0, 0, 14))
+	if len(times) != 3 || times[2].Day() != 8 {
+		t.Errorf("every other day 3 times = %v, want the 4th, 6th and 8th", times)
+	}
+}
+
+// useCalendar serves bellCalendar as calendar.url, a week of it in New York
+// with its passing periods and lunches as bells, until down is set.
+func useCalendar(t *testing.T) (down *atomic.Bool) {
+	t.Helper()
+	down = &atomic.Bool{}
+	feed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if down.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte(bellCalendar))
+	}))
+	t.Cleanup(feed.Close)
+	t.Cleanup(func() {
+		lastCalendarMu.Lock()
+		lastCalendar = nil
+		lastCalendarMu.Unlock()
+	})
+	setConfig(t, "app.timezone", "America/New_York")
+	setConfig(t, "schedule.fetch-timeout", time.Second)
+	setConfig(t, "calendar.url", feed.URL)
+	setConfig(t, "calendar.days", 7)
+	setConfig(t, "calendar.timezone", "America/New_York")
+	setConfig(t, "calendar.sounds", []map[string]interface{}{
+		{"title": "Passing period", "sound": "bell.mp3"},
+		{"title": "LUNCH", "sound": "bell.mp3"},
+	})
+	return down
+}
+
+func TestCalendarSchedules(t *testing.T) {
+	testDir(t)
+	down := useCalendar(t)
+	ny, _ := time.LoadLocation("America/New_York")
+	doc := `[{"name": "holidays", "default": true, "days": [{"name": "Monday", "events": [{"time": "09:00", "sound": "bell.mp3"}]}]}]`
+	clock := loadSchedule(t, time.Date(2024, 3, 4, 7, 0, 0, 0, ny), doc)
+
+	// the calendar's day replaces the default schedule
+	if got := active(); !reflect.DeepEqual(got, []string{"calendar-2024-03-04"}) {
+		t.Errorf("active = %q, want the calendar's Monday", got)
+	}
+	if bells := entriesOf("bell"); len(bells) != 1 || bells[0].Time != "10:15" || bells[0].Label != "Passing period" {
+		t.Errorf("bells = %+v, want the 10:15 passing period", bells)
+	}
+	// generated, not part of the document
+	schedules := []*schedule{}
+	decodeBody(t, apiRequest(t, "GET", "/api/v1/schedules", ""), &schedules)
+	if len(schedules) != 1 || schedules[0].Name != "holidays" {
+		t.Errorf("schedules = %d, want only the document's holidays", len(schedules))
+	}
+	scheduleMu.RLock()
+	names := []string{}
+	for _, sch := range generatedSchedules {
+		names = append(names, sch.Name+" "+sch.Starts+" "+sch.Ends)
+	}
+	scheduleMu.RUnlock()
+	want := []string{
+		"calendar-2024-03-04 2024-03-04 2024-03-05",
+		"calendar-2024-03-05 2024-03-05 2024-03-06",
+		"calendar-2024-03-07 2024-03-07 2024-03-08",
+		"calendar-2024-03-08 2024-03-08 2024-03-09",
+	}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("generated = %q, want %q", names, want)
+	}
+
+	// a bell in the day's last minute still rings, from the last copy while
+	// the feed is down
+	down.Store(true)
+	clock.Set(time.Date(2024, 3, 7, 23, 59, 0, 0, ny))
+	if rec := apiRequest(t, "POST", "/api/v1/reload", ""); rec.Code != http.StatusOK {
+		t.Fatalf("reload = %d %s", rec.Code, rec.Body)
+	}
+	if bells := entriesOf("bell"); len(bells) != 1 || bells[0].Schedule != "calendar-2024-03-07" || bells[0].Time != "23:59" {
+		t.Errorf("bells = %+v, want the 23:59:30 bell", bells)
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// lastFired is when each bell last rang, by bellFiredKey. It outlives the
+// cron entries, whose Prev a reparse that registers the bell anew, or a full
+// rebuild, starts from zero.
+var (
+	lastFired   = map[string]time.Time{}
+	lastFiredMu sync.Mutex
+)
+
+// bellFiredKey names a bell by its schedule, day, spec and zone, which stay
+// the same when only its sound or volume changes.
+func bellFiredKey(schedule, dayName, spec, zone string) string {
+	return strings.Join([]string{schedule, dayName, spec, zone}, "|")
+}
+
+func markFired(key string, at time.Time) {
+	lastFiredMu.Lock()
+	defer lastFiredMu.Unlock()
+	lastFired[key] = at
+}
+
+func firedAt(key string) time.Time {
+	lastFiredMu.Lock()
+	defer lastFiredMu.Unlock()
+	return lastFired[key]
+}
+
+// catchUpBells rings the bells that were due within schedule.catch-up-grace
+// before now, so a restart or reload a few seconds late doesn't drop the bell
+// it just missed. A bell cron already rang is left alone, and the same sound
+// queued again on a zone is dropped by audio.dedup-window-ms. Callers must
+// hold scheduleMu.
+func catchUpBells(now time.Time) {
+	grace := viper.GetDuration("schedule.catch-up-grace")
+	if grace <= 0 {
+		return
+	}
+	since := now.Add(-grace).In(globalLocation())
+	type missedBell struct {
+		due   time.Time
+		entry cron.Entry
+	}
+	missed := []*missedBell{}
+	for id, info := range entryMeta {
+		if info.Kind != "bell" {
+			continue
+		}
+		entry := cronService.Entry(id)
+		if entry.Schedule == nil {
+			continue
+		}
+		due := entry.Schedule.Next(since.Add(-time.Nanosecond))
+		if due.IsZero() || due.After(now) || !firedAt(info.fired).Before(due) {
+			continue
+		}
+		missed = append(missed, &missedBell{due: due, entry: entry})
+	}
+	sort.Slice(missed, func(i, j int) bool {
+		return missed[i].due.Before(missed[j].due)
+	})
+	for _, m := range missed {
+		info := entryMeta[m.entry.ID]
+		log.WithFields(log.Fields{
+			"Schedule": info.Schedule,
+			"Day":      info.Day,
+			"Time":     info.Time,
+			"Sound":    info.Sound,
+			"Due":      m.due.Format(time.RFC3339),
+		}).Warn("Catching up missed bell")
+		go m.entry.Job.Run()
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+// forgetFired clears when bells last rang, which other tests ringing the same
+// bell leave behind, for the length of the test.
+func forgetFired(t *testing.T) {
+	lastFiredMu.Lock()
+	lastFired = map[string]time.Time{}
+	lastFiredMu.Unlock()
+	t.Cleanup(func() {
+		lastFiredMu.Lock()
+		lastFired = map[string]time.Time{}
+		lastFiredMu.Unlock()
+	})
+}
+
+func TestCatchUpBells(t *testing.T) {
+	tests := []struct {
+		name  string
+		grace time.Duration
+		at    time.Time
+		rings int
+	}{
+		{"just missed", 10 * time.Second, time.Date(2024, 3, 4, 8, 0, 5, 0, time.UTC), 1},
+		{"right on time", 10 * time.Second, time.Date(2024, 3, 4, 8, 0, 0, 0, time.UTC), 1},
+		{"outside the grace", 10 * time.Second, time.Date(2024, 3, 4, 8, 0, 30, 0, time.UTC), 0},
+		{"not yet due", 10 * time.Second, time.Date(2024, 3, 4, 7, 59, 55, 0, time.UTC), 0},
+		{"grace off", 0, time.Date(2024, 3, 4, 8, 0, 5, 0, time.UTC), 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testDir(t)
+			setConfig(t, "app.timezone", "UTC")
+			setConfig(t, "schedule.catch-up-grace", tt.grace)
+			forgetFired(t)
+			buf := captureLog(t)
+			loadSchedule(t, tt.at, mondayBells)
+			if tt.rings > 0 {
+				waitFor(t, "the missed bell", func() bool { return len(logEntries(t, buf, "Bell fired")) > 0 })
+			} else {
+				time.Sleep(20 * time.Millisecond)
+			}
+			if got := logEntries(t, buf, "Catching up missed bell"); len(got) != tt.rings {
+				t.Errorf("caught up %d bells at %s, want %d", len(got), tt.at.Format("15:04:05"), tt.rings)
+			}
+			if got := logEntries(t, buf, "Bell fired"); len(got) != tt.rings {
+				t.Errorf("rang %d bells, want %d", len(got), tt.rings)
+			}
+		})
+	}
+}
+
+func TestCatchUpOnce(t *testing.T) {
+	testDir(t)
+	setConfig(t, "app.timezone", "UTC")
+	setConfig(t, "schedule.catch-up-grace", 10*time.Second)
+	forgetFired(t)
+	buf := captureLog(t)
+	clock := loadSchedule(t, time.Date(2024, 3, 4, 8, 0, 3, 0, time.UTC), mondayBells)
+	waitFor(t, "the missed bell", func() bool { return len(logEntries(t, buf, "Bell fired")) > 0 })
+
+	// reloading within the grace doesn't ring it again, even once a volume
+	// change has registered the bell anew
+	for _, doc := range []string{mondayBells, strings.Replace(mondayBells, `"sound": "bell.mp3"`, `"sound": "bell.mp3", "volume": 0.5`, 1)} {
+		clock.Set(clock.Now().Add(2 * time.Second))
+		writeFile(t, scheduleFile, doc)
+		if err := parseSchedule(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	time.Sleep(20 * time.Millisecond)
+	if got := logEntries(t, buf, "Bell fired"); len(got) != 1 {
+		t.Errorf("rang %d times across reloads, want once", len(got))
+	}
+}
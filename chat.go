@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// chatNotifier posts a readable message to a Slack or Discord incoming
+// webhook instead of the raw notification.
+type chatNotifier struct {
+	platform string
+	name     string
+	url      string
+	client   *http.Client
+	timeout  time.Duration
+}
+
+func (c *chatNotifier) Name() string {
+	return c.name
+}
+
+func (c *chatNotifier) Timeout() time.Duration {
+	return c.timeout
+}
+
+func (c *chatNotifier) Notify(ctx context.Context, n *notification) error {
+	text := notificationText(n)
+	var payload interface{}
+	switch c.platform {
+	case "slack":
+		payload = map[string]string{"text": text}
+	case "discord":
+		payload = map[string]string{"content": text}
+	default:
+		return fmt.Errorf("unknown chat platform: %s", c.platform)
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return postJSON(ctx, c.client, c.url, body)
+}
+
+// notificationText is n as a one line message, e.g.
+// "🔔 Bell rang: passing period at 10:15 (schedule fall, sound chime.mp3)".
+func notificationText(n *notification) string {
+	switch n.Event {
+	case "bell":
+		what := n.Label
+		if what == "" {
+			what = n.Sound
+		}
+		text := "🔔 Bell rang: " + what
+		if n.Time != "" {
+			text += " at " + n.Time
+		}
+		details := []string{}
+		if n.Schedule != "" {
+			details = append(details, "schedule "+n.Schedule)
+		}
+		if n.Sound != "" {
+			details = append(details, "sound "+n.Sound)
+		}
+		if len(details) > 0 {
+			text += " (" + strings.Join(details, ", ") + ")"
+		}
+		return text
+	case "test":
+		return "🔔 Test notification from bell"
+	default:
+		if n.Message != "" {
+			return "🔔 " + n.Message
+		}
+		return "🔔 " + n.Event
+	}
+}
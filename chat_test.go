@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// chatHook is an incoming webhook recording the JSON bodies posted to it.
+type chatHook struct {
+	mu     sync.Mutex
+	bodies []map[string]interface{}
+}
+
+func (h *chatHook) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body := map[string]interface{}{}
+	json.NewDecoder(r.Body).Decode(&body)
+	h.mu.Lock()
+	h.bodies = append(h.bodies, body)
+	h.mu.Unlock()
+}
+
+func (h *chatHook) posted() []map[string]interface{} {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]map[string]interface{}{}, h.bodies...)
+}
+
+// useChatHooks configures one channel per platform posting to a fresh hook.
+func useChatHooks(t *testing.T, platforms ...string) map[string]*chatHook {
+	t.Helper()
+	hooks := map[string]*chatHook{}
+	for _, platform := range platforms {
+		hook := &chatHook{}
+		srv := httptest.NewServer(hook)
+		t.Cleanup(srv.Close)
+		hooks[platform] = hook
+		setConfig(t, "notifications."+platform, []map[string]interface{}{{"url": srv.URL}})
+	}
+	setConfig(t, "notifications.timeout-ms", 1000)
+	setupNotifiers()
+	t.Cleanup(func() {
+		notifiersMu.Lock()
+		notifiers, notifySlots = nil, nil
+		notifiersMu.Unlock()
+	})
+	return hooks
+}
+
+func TestChatPayloads(t *testing.T) {
+	hooks := useChatHooks(t, "slack", "discord")
+	bell := &notification{Event: "bell", Schedule: "fall", Time: "10:15", Sound: "chime.mp3", Label: "passing period"}
+	results := dispatchNotification(bell)
+	if len(results) != 2 || results[0].Channel != "slack-0" || results[1].Channel != "discord-0" {
+		t.Fatalf("results = %+v, want slack-0 then discord-0", results)
+	}
+	for _, r := range results {
+		if !r.Success {
+			t.Errorf("%s failed: %s", r.Channel, r.Error)
+		}
+	}
+	text := "🔔 Bell rang: passing period at 10:15 (schedule fall, sound chime.mp3)"
+	if got := hooks["slack"].posted(); !reflect.DeepEqual(got, []map[string]interface{}{{"text": text}}) {
+		t.Errorf("slack got %v, want only the text", got)
+	}
+	if got := hooks["discord"].posted(); !reflect.DeepEqual(got, []map[string]interface{}{{"content": text}}) {
+		t.Errorf("discord got %v, want only the content", got)
+	}
+}
+
+func TestChatPlatformsApart(t *testing.T) {
+	for _, platform := range []string{"slack", "discord"} {
+		t.Run(platform, func(t *testing.T) {
+			hooks := useChatHooks(t, platform)
+			results := dispatchNotification(&notification{Event: "test", Test: true})
+			if len(results) != 1 || results[0].Channel != platform+"-0" || !results[0].Success {
+				t.Errorf("results = %+v, want %s-0 alone", results, platform)
+			}
+			if got := hooks[platform].posted(); len(got) != 1 {
+				t.Errorf("%s got %v, want one message", platform, got)
+			}
+		})
+	}
+}
+
+func TestNotificationText(t *testing.T) {
+	tests := []struct {
+		n    *notification
+		want string
+	}{
+		{&notification{Event: "bell", Schedule: "fall", Time: "10:15", Sound: "chime.mp3", Label: "passing period"},
+			"🔔 Bell rang: passing period at 10:15 (schedule fall, sound chime.mp3)"},
+		{&notification{Event: "bell", Sound: "chime.mp3"}, "🔔 Bell rang: chime.mp3 (sound chime.mp3)"},
+		{&notification{Event: "test", Message: "ignored"}, "🔔 Test notification from bell"},
+		{&notification{Event: "no-bells", Message: "No bells today"}, "🔔 No bells today"},
+		{&notification{Event: "reload"}, "🔔 reload"},
+	}
+	for _, tt := range tests {
+		if got := notificationText(tt.n); got != tt.want {
+			t.Errorf("notificationText(%+v) = %q, want %q", tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestMaintenanceSkipsBell(t *testing.T) {
+	testDir(t)
+	ch := &stubNotifier{name: "chat"}
+	useNotifiers(t, ch)
+	player := &recordingPlayer{}
+	useQueue(t, player, 4)
+	loadSchedule(t, time.Date(2024, 3, 4, 7, 0, 0, 0, time.UTC), mondayBells)
+	maintenanceMode.Store(true)
+	t.Cleanup(func() { maintenanceMode.Store(false) })
+	buf := captureLog(t)
+
+	runBell(t, "term", "08:00")
+	time.Sleep(20 * time.Millisecond)
+	if got := logEntries(t, buf, "Bell fired"); len(got) != 0 {
+		t.Errorf("logged %v, want no bell fired in maintenance", got)
+	}
+	if got := logEntries(t, buf, "Maintenance mode, skipping bell"); len(got) != 1 {
+		t.Errorf("logged %d skips, want 1", len(got))
+	}
+	if sent := ch.sent(); len(sent) != 0 || player.count() != 0 {
+		t.Errorf("sent %+v and played %d, want nothing", sent, player.count())
+	}
+}
@@ -0,0 +1,18 @@
+package main
+
+import "time"
+
+// clock is where scheduling logic gets the current time from, so date
+// windows and time of day rules can be evaluated at any moment.
+type clock interface {
+	Now() time.Time
+}
+
+// appClock is the clock used by the scheduler.
+var appClock clock = realClock{}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
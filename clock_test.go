@@ -0,0 +1,87 @@
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock is a clock stopped at a given time until set or advanced.
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func newFakeClock(now time.Time) *fakeClock {
+	return &fakeClock{now: now}
+}
+
+func (f *fakeClock) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+func (f *fakeClock) Set(now time.Time) {
+	f.mu.Lock()
+	f.now = now
+	f.mu.Unlock()
+}
+
+func (f *fakeClock) Advance(d time.Duration) {
+	f.mu.Lock()
+	f.now = f.now.Add(d)
+	f.mu.Unlock()
+}
+
+func TestScheduleWindow(t *testing.T) {
+	const march = `[{"name": "march", "starts": "2024-03-01 07:00", "ends": "2024-03-29", "days": [{"name": "Monday", "events": [{"time": "08:00", "sound": "bell.mp3"}]}]}]`
+	tests := []struct {
+		name   string
+		now    time.Time
+		active bool
+	}{
+		{"before", time.Date(2024, 2, 26, 8, 0, 0, 0, time.UTC), false},
+		{"just before it starts", time.Date(2024, 3, 1, 6, 59, 59, 0, time.UTC), false},
+		{"as it starts", time.Date(2024, 3, 1, 7, 0, 0, 0, time.UTC), true},
+		{"inside", time.Date(2024, 3, 11, 8, 0, 0, 0, time.UTC), true},
+		{"as it ends", time.Date(2024, 3, 29, 0, 0, 0, 0, time.UTC), true},
+		{"after", time.Date(2024, 4, 1, 8, 0, 0, 0, time.UTC), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testDir(t)
+			loadSchedule(t, tt.now, march)
+			if got := len(active()) == 1; got != tt.active {
+				t.Errorf("active at %s = %v, want %v", tt.now, got, tt.active)
+			}
+			if got := len(entriesOf("bell")) == 1; got != tt.active {
+				t.Errorf("bell registered at %s = %v, want %v", tt.now, got, tt.active)
+			}
+		})
+	}
+}
+
+func TestScheduleWindowFollowsClock(t *testing.T) {
+	testDir(t)
+	clock := loadSchedule(t, time.Date(2024, 2, 26, 8, 0, 0, 0, time.UTC), `[{"name": "march", "starts": "2024-03-01", "ends": "2024-03-29", "days": [{"name": "Monday", "events": [{"time": "08:00", "sound": "bell.mp3"}]}]}]`)
+	steps := []struct {
+		advance time.Duration
+		active  bool
+	}{
+		{0, false},
+		{7 * 24 * time.Hour, true},
+		{7 * 24 * time.Hour, true},
+		{28 * 24 * time.Hour, false},
+	}
+	for _, step := range steps {
+		clock.Advance(step.advance)
+		err := parseSchedule(t.Context())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := len(active()) == 1; got != step.active {
+			t.Errorf("active on %s = %v, want %v", clock.Now().Format("2006-01-02"), got, step.active)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// configCandidates are the config files looked for in the working directory
+// when -config isn't given. The first one found wins.
+var configCandidates = []string{"bell.yaml", "bell.yml", "bell.toml", "bell.json"}
+
+// configFile returns the config file to load: path when set, otherwise the
+// first of configCandidates that exists. Its format comes from the extension.
+func configFile(path string) (string, error) {
+	if path == "" {
+		for _, candidate := range configCandidates {
+			_, err := os.Stat(candidate)
+			if err == nil {
+				path = candidate
+				break
+			}
+		}
+		if path == "" {
+			return "", fmt.Errorf("no config file found, looked for %s", strings.Join(configCandidates, ", "))
+		}
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml", ".toml", ".json":
+		return path, nil
+	default:
+		return "", fmt.Errorf("unsupported config format: %s", path)
+	}
+}
+
+// runtimeConfig is the subset of settings safe to show in the UI. Fields are
+// picked one by one so credentials added to bell.yaml never leak here.
+type runtimeConfig struct {
+	Timezone        string   `json:"timezone"`
+	SoundsDir       string   `json:"soundsDir"`
+	AudioBackend    string   `json:"audioBackend"`
+	AudioOffsetMs   int      `json:"audioOffsetMs"`
+	QueueSize       int      `json:"queueSize"`
+	DailyReparse    bool     `json:"dailyReparse"`
+	Zones           []string `json:"zones"`
+	ActiveSchedules int      `json:"activeSchedules"`
+}
+
+func getConfigHandler(w http.ResponseWriter, r *http.Request) {
+	scheduleMu.RLock()
+	active := len(activeSchedules)
+	scheduleMu.RUnlock()
+
+	zoneNames := []string{}
+	for name := range zones() {
+		zoneNames = append(zoneNames, name)
+	}
+	sort.Strings(zoneNames)
+
+	writeJSON(w, http.StatusOK, &runtimeConfig{
+		Timezone:        globalLocation().String(),
+		SoundsDir:       soundsDir(),
+		AudioBackend:    viper.GetString("audio.backend"),
+		AudioOffsetMs:   viper.GetInt("audio.offset-ms"),
+		QueueSize:       viper.GetInt("audio.queue-size"),
+		DailyReparse:    viper.GetBool("schedule.daily-reparse"),
+		Zones:           zoneNames,
+		ActiveSchedules: active,
+	})
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+type cronEntry struct {
+	ID   cron.EntryID `json:"id"`
+	Next *time.Time   `json:"next"`
+	Prev *time.Time   `json:"prev"`
+	*entryInfo
+}
+
+func getCronHandler(w http.ResponseWriter, r *http.Request) {
+	scheduleMu.RLock()
+	defer scheduleMu.RUnlock()
+
+	entries := []*cronEntry{}
+	if cronService == nil {
+		writeJSON(w, http.StatusOK, entries)
+		return
+	}
+	for _, e := range cronService.Entries() {
+		entry := &cronEntry{
+			ID:        e.ID,
+			entryInfo: entryMeta[e.ID],
+		}
+		if !e.Next.IsZero() {
+			next := e.Next
+			entry.Next = &next
+		}
+		if !e.Prev.IsZero() {
+			prev := e.Prev
+			entry.Prev = &prev
+		}
+		entries = append(entries, entry)
+	}
+	writeJSON(w, http.StatusOK, entries)
+}
+
+// nextBellEntry returns the bell cron will fire next, or nil. Callers must
+// hold scheduleMu.
+func nextBellEntry() *cronEntry {
+	var next *cronEntry
+	if cronService == nil {
+		return nil
+	}
+	for _, e := range cronService.Entries() {
+		info := entryMeta[e.ID]
+		if info == nil || info.Kind != "bell" || e.Next.IsZero() {
+			continue
+		}
+		if next == nil || e.Next.Before(*next.Next) {
+			t := e.Next
+			next = &cronEntry{ID: e.ID, Next: &t, entryInfo: info}
+		}
+	}
+	return next
+}
+
+func getNextBellHandler(w http.ResponseWriter, r *http.Request) {
+	scheduleMu.RLock()
+	next := nextBellEntry()
+	scheduleMu.RUnlock()
+
+	if next == nil {
+		writeError(w, http.StatusNotFound, "no bells scheduled")
+		return
+	}
+	writeJSON(w, http.StatusOK, next)
+}
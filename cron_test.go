@@ -0,0 +1,52 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestGetCronEntries(t *testing.T) {
+	testDir(t)
+	rec := apiRequest(t, "GET", "/api/v1/cron", "")
+	if rec.Code != http.StatusOK || rec.Body.String() != "[]" {
+		t.Fatalf("before a schedule loads = %d %s, want 200 []", rec.Code, rec.Body)
+	}
+
+	loadSchedule(t, time.Date(2024, 3, 4, 7, 0, 0, 0, time.UTC), `[{"name": "term", "starts": "2024-01-01", "ends": "2024-12-31", "days": [{"name": "Monday", "events": [
+		{"time": "08:00", "sound": "bell.mp3"},
+		{"time": "12:00", "sound": "bell.mp3", "label": "Lunch"}
+	]}]}]`)
+	rec = apiRequest(t, "GET", "/api/v1/cron", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+	entries := []struct {
+		ID       int        `json:"id"`
+		Next     *time.Time `json:"next"`
+		Prev     *time.Time `json:"prev"`
+		Kind     string     `json:"kind"`
+		Schedule string     `json:"schedule"`
+		Day      string     `json:"day"`
+		Time     string     `json:"time"`
+		Sound    string     `json:"sound"`
+		Label    string     `json:"label"`
+	}{}
+	decodeBody(t, rec, &entries)
+	if len(entries) != 2 {
+		t.Fatalf("entries = %s, want the 2 bells", rec.Body)
+	}
+	times := map[string]string{}
+	for _, e := range entries {
+		if e.ID == 0 || e.Kind != "bell" || e.Schedule != "term" || e.Day != "MON" || e.Sound != "bell.mp3" {
+			t.Errorf("entry = %+v, want a bell of term on MON playing bell.mp3", e)
+		}
+		if e.Next == nil || e.Next.Weekday() != time.Monday || e.Prev != nil {
+			t.Errorf("entry %s next = %v prev = %v, want a Monday and no previous fire", e.Time, e.Next, e.Prev)
+		}
+		times[e.Time] = e.Label
+	}
+	if len(times) != 2 || times["12:00"] != "Lunch" {
+		t.Errorf("times = %v, want 08:00 and 12:00 labelled Lunch", times)
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import "net/http"
+
+// diagnostics gathers what's needed to work out why bells don't sound.
+type diagnostics struct {
+	Backend string `json:"backend"`
+	// ContextReady is whether the oto context is open, after ContextAttempts
+	// tries to open it.
+	ContextReady    bool              `json:"contextReady"`
+	ContextAttempts int               `json:"contextAttempts"`
+	Device          string            `json:"device"`
+	ZoneDevices     map[string]string `json:"zoneDevices"`
+	SampleRate      int               `json:"sampleRate"`
+	Channels        int               `json:"channels"`
+	BitDepth        int               `json:"bitDepth"`
+	Audio           string            `json:"audio"`
+	AudioError      string            `json:"audioError,omitempty"`
+	LastPlayed      *playRecord       `json:"lastPlayed"`
+}
+
+func getDiagnosticsHandler(w http.ResponseWriter, r *http.Request) {
+	ready, attempts := otoReady()
+	result := &diagnostics{
+		Backend:         audioBackendName(audioBackend),
+		ContextReady:    ready,
+		ContextAttempts: attempts,
+		// oto can't pick a device, see the zone warning at startup
+		Device:      "default",
+		ZoneDevices: map[string]string{},
+		SampleRate:  samplingRate,
+		Channels:    numOfChannels,
+		BitDepth:    audioBitDepth * 8,
+		LastPlayed:  getLastPlayed(),
+	}
+	for name, z := range zones() {
+		result.ZoneDevices[name] = z.Device
+	}
+	audio, err := audioStatus()
+	result.Audio = audio
+	if err != nil {
+		result.AudioError = err.Error()
+	}
+	writeJSON(w, http.StatusOK, result)
+}
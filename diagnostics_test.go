@@ -0,0 +1,48 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestDiagnostics(t *testing.T) {
+	testDir(t)
+	setConfig(t, "zones", map[string]interface{}{"gym": map[string]interface{}{"device": "hw:1"}})
+	backend := &flakyPlayer{}
+	useQueue(t, backend, 4)
+	play := func() {
+		t.Helper()
+		job := &playJob{Sound: "bell.mp3", Done: make(chan error, 1), skipDedup: true}
+		if err := enqueuePlay(job); err != nil {
+			t.Fatal(err)
+		}
+		<-job.Done
+	}
+	diagnose := func() *diagnostics {
+		t.Helper()
+		rec := apiRequest(t, "GET", "/api/v1/diagnostics", "")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("diagnostics = %d, want 200", rec.Code)
+		}
+		result := &diagnostics{}
+		decodeBody(t, rec, result)
+		return result
+	}
+
+	play()
+	got := diagnose()
+	if got.SampleRate != samplingRate || got.Channels != 2 || got.BitDepth != 16 || got.Device != "default" || got.ZoneDevices["gym"] != "hw:1" {
+		t.Errorf("diagnostics = %+v, want 16 bit stereo at %d Hz with the gym device", got, samplingRate)
+	}
+	if got.Audio != "ok" || got.AudioError != "" || got.LastPlayed == nil || got.LastPlayed.Sound != "bell.mp3" || got.LastPlayed.Error != "" {
+		t.Errorf("after a good play: audio %q %q, last played %+v, want ok", got.Audio, got.AudioError, got.LastPlayed)
+	}
+
+	backend.set(errors.New("no such device"))
+	play()
+	got = diagnose()
+	if got.Audio != "unavailable" || got.AudioError != "no such device" || got.LastPlayed == nil || got.LastPlayed.Error != "no such device" {
+		t.Errorf("after a failed play: audio %q %q, last played %+v, want the error", got.Audio, got.AudioError, got.LastPlayed)
+	}
+}
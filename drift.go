@@ -0,0 +1,35 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// driftProbeSpec fires at the start of every minute, so the probe knows when
+// it was due without asking cron.
+const driftProbeSpec = "0 * * * * *"
+
+// checkDrift measures how late the drift probe ran at now and rebuilds the
+// cron service when it's past schedule.drift-threshold-ms, e.g. after the
+// wall clock was stepped. It reports whether a rebuild happened.
+func checkDrift(now time.Time) bool {
+	due := now.Truncate(time.Minute)
+	drift := now.Sub(due)
+	// a probe that ran early shows up as just under a minute late
+	if drift > 30*time.Second {
+		drift -= time.Minute
+	}
+	threshold := time.Duration(viper.GetInt("schedule.drift-threshold-ms")) * time.Millisecond
+
+	fields := log.Fields{"Drift": drift.String(), "Threshold": threshold.String()}
+	if drift.Abs() <= threshold {
+		log.WithFields(fields).Debug("Cron drift")
+		return false
+	}
+	log.WithFields(fields).Warn("Cron drift over threshold, rebuilding schedule")
+	go rebuildSchedule(context.Background())
+	return true
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+func TestCheckDrift(t *testing.T) {
+	testDir(t)
+	setConfig(t, "schedule.drift-check", true)
+	setConfig(t, "schedule.drift-threshold-ms", 2000)
+	loadSchedule(t, time.Date(2024, 3, 4, 7, 0, 0, 0, time.UTC), mondayBells)
+	if !hasEntryKey("drift|" + driftProbeSpec) {
+		t.Fatal("no drift probe registered")
+	}
+	service := func() *cron.Cron {
+		scheduleMu.RLock()
+		defer scheduleMu.RUnlock()
+		return cronService
+	}
+
+	tests := []struct {
+		name    string
+		at      time.Time
+		rebuild bool
+	}{
+		{"on time", time.Date(2024, 3, 4, 8, 0, 0, 500e6, time.UTC), false},
+		{"at the threshold", time.Date(2024, 3, 4, 8, 0, 2, 0, time.UTC), false},
+		{"late", time.Date(2024, 3, 4, 8, 0, 5, 0, time.UTC), true},
+		{"early", time.Date(2024, 3, 4, 7, 59, 55, 0, time.UTC), true},
+	}
+	parsed := func() bool {
+		parseStateMu.Lock()
+		defer parseStateMu.Unlock()
+		return !lastParseAt.IsZero()
+	}
+	for _, tt := range tests {
+		before := service()
+		parseStateMu.Lock()
+		lastParseAt = time.Time{}
+		parseStateMu.Unlock()
+		if got := checkDrift(tt.at); got != tt.rebuild {
+			t.Errorf("%s: checkDrift(%s) = %v, want %v", tt.name, tt.at.Format("15:04:05.000"), got, tt.rebuild)
+		}
+		if !tt.rebuild {
+			continue
+		}
+		waitFor(t, "the rebuild", func() bool { return service() != before && parsed() })
+		if len(entriesOf("bell")) != 1 || !hasEntryKey("drift|"+driftProbeSpec) {
+			t.Errorf("%s: rebuilt schedule lost its entries", tt.name)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxDSTCheckDays bounds how far into a date window DST transitions are
+// looked for.
+const maxDSTCheckDays = 366
+
+// checkDST warns about events whose wall clock time doesn't exist (spring
+// forward) or happens twice (fall back) on a day within [from, to] in loc.
+func checkDST(sch *schedule, from, to time.Time, loc *time.Location) {
+	from = time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, loc)
+	for i := 0; i < maxDSTCheckDays; i++ {
+		date := from.AddDate(0, 0, i)
+		if date.After(to) {
+			return
+		}
+		for _, d := range sch.Days {
+			if !d.isEnabled() || len(d.Name) < 3 || weekdays[date.Weekday()] != strings.ToUpper(d.Name[0:3]) {
+				continue
+			}
+			for _, evt := range d.Events {
+				if evt.Cron != "" || len(evt.Time) != 5 {
+					continue
+				}
+				hour, err := strconv.Atoi(evt.Time[0:2])
+				if err != nil {
+					continue
+				}
+				minute, err := strconv.Atoi(evt.Time[3:])
+				if err != nil {
+					continue
+				}
+				switch dstIssue(date, hour, minute, loc) {
+				case "gap":
+					addWarning("Schedule %s: %s %s does not exist on %s (DST change)", sch.Name, d.Name, evt.Time, date.Format("2006-01-02"))
+				case "overlap":
+					addWarning("Schedule %s: %s %s happens twice on %s (DST change)", sch.Name, d.Name, evt.Time, date.Format("2006-01-02"))
+				}
+			}
+		}
+	}
+}
+
+// dstIssue reports "gap" when hour:minute is skipped on date in loc,
+// "overlap" when it's repeated, and "" otherwise.
+func dstIssue(date time.Time, hour, minute int, loc *time.Location) string {
+	t := time.Date(date.Year(), date.Month(), date.Day(), hour, minute, 0, 0, loc)
+	if t.Hour() != hour || t.Minute() != minute {
+		return "gap"
+	}
+	for _, shift := range []time.Duration{-time.Hour, time.Hour} {
+		other := t.Add(shift)
+		if other.Day() == t.Day() && other.Hour() == hour && other.Minute() == minute {
+			return "overlap"
+		}
+	}
+	return ""
+}
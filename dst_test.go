@@ -0,0 +1,61 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestDSTIssue(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		date         time.Time
+		hour, minute int
+		want         string
+	}{
+		{time.Date(2024, 3, 10, 0, 0, 0, 0, ny), 2, 30, "gap"},
+		{time.Date(2024, 3, 10, 0, 0, 0, 0, ny), 3, 0, ""},
+		{time.Date(2024, 11, 3, 0, 0, 0, 0, ny), 1, 30, "overlap"},
+		{time.Date(2024, 11, 3, 0, 0, 0, 0, ny), 2, 0, ""},
+		{time.Date(2024, 3, 11, 0, 0, 0, 0, ny), 2, 30, ""},
+	}
+	for _, tt := range tests {
+		if got := dstIssue(tt.date, tt.hour, tt.minute, ny); got != tt.want {
+			t.Errorf("dstIssue(%s %02d:%02d) = %q, want %q", tt.date.Format("2006-01-02"), tt.hour, tt.minute, got, tt.want)
+		}
+	}
+}
+
+func TestDSTWarnings(t *testing.T) {
+	testDir(t)
+	loadSchedule(t, time.Date(2024, 3, 1, 7, 0, 0, 0, time.UTC), `[{"name": "east", "timezone": "America/New_York", "starts": "2024-03-01", "ends": "2024-11-30", "days": [{"name": "Sunday", "events": [
+		{"time": "02:30", "sound": "bell.mp3"},
+		{"time": "01:30", "sound": "bell.mp3"},
+		{"time": "09:00", "sound": "bell.mp3"}
+	]}]}]`)
+
+	want := []string{
+		"Schedule east: Sunday 02:30 does not exist on 2024-03-10 (DST change)",
+		"Schedule east: Sunday 01:30 happens twice on 2024-11-03 (DST change)",
+	}
+	if len(parseWarnings) != len(want) {
+		t.Fatalf("warnings = %q, want %q", parseWarnings, want)
+	}
+	for i := range want {
+		if parseWarnings[i] != want[i] {
+			t.Errorf("warning = %q, want %q", parseWarnings[i], want[i])
+		}
+	}
+
+	rec := apiRequest(t, "POST", "/api/v1/reload", "")
+	result := struct {
+		Warnings []string `json:"warnings"`
+	}{}
+	decodeBody(t, rec, &result)
+	if rec.Code != http.StatusOK || len(result.Warnings) != 2 {
+		t.Errorf("reload = %d %s, want the DST warnings", rec.Code, rec.Body)
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// eventsKeepAlive is how often an idle event stream gets a comment, so
+// proxies don't close it.
+const eventsKeepAlive = 30 * time.Second
+
+// eventHub fans notifications out to the clients of /api/v1/events.
+type eventHub struct {
+	mu      sync.Mutex
+	clients map[chan *notification]bool
+	closed  bool
+}
+
+var liveEvents = &eventHub{clients: map[chan *notification]bool{}}
+
+// register adds a client unless max, when positive, are connected already.
+func (h *eventHub) register(max int) (chan *notification, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed || (max > 0 && len(h.clients) >= max) {
+		return nil, false
+	}
+	ch := make(chan *notification, 16)
+	h.clients[ch] = true
+	return ch, true
+}
+
+func (h *eventHub) unregister(ch chan *notification) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.clients[ch] {
+		delete(h.clients, ch)
+		close(ch)
+	}
+}
+
+func (h *eventHub) count() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.clients)
+}
+
+// publish sends n to every client, skipping those too slow to keep up.
+func (h *eventHub) publish(n *notification) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.clients {
+		select {
+		case ch <- n:
+		default:
+			log.Warnf("Event stream client is behind, dropped: %s", n.Event)
+		}
+	}
+}
+
+// close ends every stream, for shutdown not to wait on them.
+func (h *eventHub) close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	for ch := range h.clients {
+		delete(h.clients, ch)
+		close(ch)
+	}
+}
+
+// getEventsHandler streams notifications as server-sent events, one per
+// bell and per notified event, at most app.events.max-clients at once.
+func getEventsHandler(w http.ResponseWriter, r *http.Request) {
+	max := viper.GetInt("app.events.max-clients")
+	ch, ok := liveEvents.register(max)
+	if !ok {
+		log.Warnf("Refused event stream for %s, %d clients connected (app.events.max-clients %d)", getIPAddress(r), liveEvents.count(), max)
+		w.Header().Set("Retry-After", "30")
+		writeError(w, http.StatusServiceUnavailable, "too many event stream clients")
+		return
+	}
+	defer liveEvents.unregister(ch)
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	if rc.Flush() != nil {
+		return
+	}
+	keepAlive := time.NewTicker(eventsKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			_, err := fmt.Fprint(w, ": keep-alive\n\n")
+			if err != nil || rc.Flush() != nil {
+				return
+			}
+		case n, ok := <-ch:
+			if !ok {
+				return
+			}
+			data, err := json.Marshal(n)
+			if err != nil {
+				continue
+			}
+			_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", n.Event, data)
+			if err != nil || rc.Flush() != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// openStream connects to addr's event stream until the test ends or close is
+// called.
+func openStream(t *testing.T, addr string) (resp *http.Response, close func()) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	req, err := http.NewRequestWithContext(ctx, "GET", "http://"+addr+"/api/v1/events", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		cancel()
+		t.Fatal(err)
+	}
+	close = func() {
+		cancel()
+		resp.Body.Close()
+	}
+	t.Cleanup(close)
+	return resp, close
+}
+
+func TestEventStream(t *testing.T) {
+	testDir(t)
+	addr := startServer(t)
+	resp, _ := openStream(t, addr)
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("stream = %d %s, want 200 text/event-stream", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	waitFor(t, "the client", func() bool { return liveEvents.count() == 1 })
+
+	liveEvents.publish(&notification{Event: "bell", Schedule: "term", Time: "08:00"})
+	lines := bufio.NewScanner(resp.Body)
+	got := []string{}
+	for len(got) < 2 && lines.Scan() {
+		got = append(got, lines.Text())
+	}
+	if len(got) != 2 || got[0] != "event: bell" || !strings.HasPrefix(got[1], "data: {") || !strings.Contains(got[1], `"schedule":"term"`) {
+		t.Errorf("stream sent %q, want the bell event", got)
+	}
+}
+
+func TestEventStreamMaxClients(t *testing.T) {
+	testDir(t)
+	setConfig(t, "app.events.max-clients", 2)
+	addr := startServer(t)
+	_, first := openStream(t, addr)
+	openStream(t, addr)
+	waitFor(t, "both clients", func() bool { return liveEvents.count() == 2 })
+
+	resp, _ := openStream(t, addr)
+	if resp.StatusCode != http.StatusServiceUnavailable || resp.Header.Get("Retry-After") == "" {
+		t.Errorf("third stream = %d, Retry-After %q, want 503 with a retry", resp.StatusCode, resp.Header.Get("Retry-After"))
+	}
+
+	// a client leaving makes room
+	first()
+	waitFor(t, "the client to leave", func() bool { return liveEvents.count() == 1 })
+	if resp, _ := openStream(t, addr); resp.StatusCode != http.StatusOK {
+		t.Errorf("stream after one left = %d, want 200", resp.StatusCode)
+	}
+}
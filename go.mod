@@ -1,6 +1,6 @@
 module github.com/jdmr/bell
 
-go 1.19
+go 1.24
 
 require (
 	github.com/gorilla/mux v1.8.0
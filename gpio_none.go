@@ -0,0 +1,10 @@
+//go:build !(gpio && linux)
+
+package main
+
+import "errors"
+
+// openGPIO needs a build with -tags gpio on Linux, e.g. for a Raspberry Pi.
+func openGPIO(pin int, initial bool) (gpioPin, error) {
+	return nil, errors.New("built without GPIO support, rebuild with -tags gpio")
+}
@@ -0,0 +1,66 @@
+//go:build gpio && linux
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+const sysfsGPIO = "/sys/class/gpio"
+
+// sysfsPin drives a pin through the sysfs GPIO interface, numbered as the
+// kernel numbers it (see /sys/kernel/debug/gpio).
+type sysfsPin struct {
+	value *os.File
+}
+
+// openGPIO exports pin as an output starting at initial.
+func openGPIO(pin int, initial bool) (gpioPin, error) {
+	dir := filepath.Join(sysfsGPIO, fmt.Sprintf("gpio%d", pin))
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		err = os.WriteFile(filepath.Join(sysfsGPIO, "export"), []byte(strconv.Itoa(pin)), 0)
+		if err != nil {
+			return nil, fmt.Errorf("could not export: %v", err)
+		}
+	}
+	// "low" and "high" set the direction and level at once, so an active low
+	// relay doesn't click while the pin is set up
+	direction := "low"
+	if initial {
+		direction = "high"
+	}
+	var err error
+	// udev takes a moment to make a newly exported pin writable
+	for i := 0; i < 20; i++ {
+		err = os.WriteFile(filepath.Join(dir, "direction"), []byte(direction), 0)
+		if err == nil {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not set direction: %v", err)
+	}
+	value, err := os.OpenFile(filepath.Join(dir, "value"), os.O_WRONLY, 0)
+	if err != nil {
+		return nil, err
+	}
+	return &sysfsPin{value: value}, nil
+}
+
+func (p *sysfsPin) Set(high bool) error {
+	level := "0"
+	if high {
+		level = "1"
+	}
+	_, err := p.value.WriteAt([]byte(level), 0)
+	return err
+}
+
+func (p *sysfsPin) Close() error {
+	return p.value.Close()
+}
@@ -1,8 +1,211 @@
 package main
 
-import "net/http"
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/spf13/viper"
+)
+
+type health struct {
+	Status      string `json:"status"`
+	Maintenance bool   `json:"maintenance"`
+	Audio       string `json:"audio"`
+	AudioError  string `json:"audioError,omitempty"`
+}
+
+// getHealthzHandler answers 200 while the API works, even without sound,
+// and reports a "degraded" status when audio is unavailable.
 func getHealthzHandler(w http.ResponseWriter, r *http.Request) {
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("OK"))
+	result := &health{Status: "ok"}
+	audio, err := audioStatus()
+	result.Audio = audio
+	if err != nil {
+		result.Status = "degraded"
+		result.AudioError = err.Error()
+	}
+	if maintenanceMode.Load() {
+		result.Status = "maintenance"
+		result.Maintenance = true
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// subsystemHealth is how one part of bell is doing: "ok", "degraded" while
+// it works in part, or "down". Critical ones being down fail the check.
+type subsystemHealth struct {
+	Status   string `json:"status"`
+	Critical bool   `json:"critical"`
+	Detail   string `json:"detail,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+type detailedHealth struct {
+	Status     string                      `json:"status"`
+	Subsystems map[string]*subsystemHealth `json:"subsystems"`
+}
+
+// the last parse of the schedule, and the last that succeeded
+var (
+	parseStateMu  sync.Mutex
+	lastParseAt   time.Time
+	lastParseErr  error
+	lastGoodParse time.Time
+)
+
+// cronRunning is whether the cron service is started.
+var cronRunning atomic.Bool
+
+// lastDeliveries is the last delivery to each notification channel.
+var (
+	lastDeliveries   = map[string]*deliveryResult{}
+	lastDeliveriesMu sync.Mutex
+)
+
+func recordParse(at time.Time, err error) {
+	parseStateMu.Lock()
+	defer parseStateMu.Unlock()
+	lastParseAt, lastParseErr = at, err
+	if err == nil {
+		lastGoodParse = at
+	}
+}
+
+func recordDelivery(result *deliveryResult) {
+	lastDeliveriesMu.Lock()
+	defer lastDeliveriesMu.Unlock()
+	lastDeliveries[result.Channel] = result
+}
+
+func configHealth() *subsystemHealth {
+	// bell doesn't start without its config
+	return &subsystemHealth{Status: "ok", Critical: true, Detail: viper.ConfigFileUsed()}
+}
+
+// scheduleHealth is down until a schedule has been parsed, and degraded when
+// the last reload failed, the one before still running, or parts of it were
+// skipped.
+func scheduleHealth() *subsystemHealth {
+	parseStateMu.Lock()
+	at, err, good := lastParseAt, lastParseErr, lastGoodParse
+	parseStateMu.Unlock()
+	result := &subsystemHealth{Status: "ok", Critical: true}
+	if at.IsZero() {
+		result.Status = "down"
+		result.Detail = "not parsed yet"
+		if clockWaiting.Load() {
+			result.Detail += ", waiting for the clock check"
+		}
+		return result
+	}
+	result.Detail = "last reload " + at.Format(time.RFC3339)
+	if err != nil {
+		result.Error = err.Error()
+		if good.IsZero() {
+			result.Status = "down"
+			return result
+		}
+		result.Status = "degraded"
+		result.Detail += ", running the one parsed " + good.Format(time.RFC3339)
+		return result
+	}
+	scheduleMu.RLock()
+	problems := len(parseErrors)
+	scheduleMu.RUnlock()
+	if problems > 0 {
+		result.Status = "degraded"
+		result.Detail += fmt.Sprintf(", %d errors", problems)
+	}
+	return result
+}
+
+func cronHealth() *subsystemHealth {
+	result := &subsystemHealth{Status: "ok", Critical: true}
+	scheduleMu.RLock()
+	entries := 0
+	if cronService != nil {
+		entries = len(cronService.Entries())
+	}
+	scheduleMu.RUnlock()
+	result.Detail = fmt.Sprintf("%d entries", entries)
+	if !cronRunning.Load() {
+		result.Status = "down"
+		result.Detail = "not running"
+	}
+	return result
+}
+
+// audioHealth is down when the output failed. Before the first sound, it
+// isn't known to work yet and counts as up.
+func audioHealth() *subsystemHealth {
+	result := &subsystemHealth{Status: "ok", Critical: true, Detail: audioBackendName(audioBackend)}
+	audio, err := audioStatus()
+	if err != nil {
+		result.Status = "down"
+		result.Error = err.Error()
+	} else if audio == "unknown" {
+		result.Detail += ", not used yet"
+	}
+	return result
+}
+
+// notificationsHealth is degraded while a channel's last delivery failed.
+// Channels are only tried when something is sent, so one not tried yet
+// counts as reachable.
+func notificationsHealth() *subsystemHealth {
+	notifiersMu.RLock()
+	channels := notifiers
+	notifiersMu.RUnlock()
+	lastDeliveriesMu.Lock()
+	defer lastDeliveriesMu.Unlock()
+	result := &subsystemHealth{Status: "ok", Detail: fmt.Sprintf("%d channels", len(channels))}
+	failing := []string{}
+	for _, ch := range channels {
+		if d, ok := lastDeliveries[ch.Name()]; ok && !d.Success {
+			failing = append(failing, ch.Name()+": "+d.Error)
+		}
+	}
+	if len(failing) > 0 {
+		result.Status = "degraded"
+		result.Error = strings.Join(failing, "; ")
+	}
+	return result
+}
+
+func currentDetailedHealth() *detailedHealth {
+	result := &detailedHealth{
+		Status: "ok",
+		Subsystems: map[string]*subsystemHealth{
+			"config":        configHealth(),
+			"schedule":      scheduleHealth(),
+			"cron":          cronHealth(),
+			"audio":         audioHealth(),
+			"notifications": notificationsHealth(),
+		},
+	}
+	for _, s := range result.Subsystems {
+		switch {
+		case s.Status == "ok":
+		case s.Critical && s.Status == "down":
+			result.Status = "down"
+		case result.Status == "ok":
+			result.Status = "degraded"
+		}
+	}
+	return result
+}
+
+// getDetailedHealthHandler answers 503 when a critical subsystem is down,
+// 200 otherwise, with how each one is doing.
+func getDetailedHealthHandler(w http.ResponseWriter, r *http.Request) {
+	result := currentDetailedHealth()
+	status := http.StatusOK
+	if result.Status == "down" {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, result)
 }
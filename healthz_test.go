@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// forgetHealth clears the parse and delivery history the detailed health
+// check reads, before and after the test.
+func forgetHealth(t *testing.T) {
+	t.Helper()
+	forget := func() {
+		parseStateMu.Lock()
+		lastParseAt, lastParseErr, lastGoodParse = time.Time{}, nil, time.Time{}
+		parseStateMu.Unlock()
+		lastDeliveriesMu.Lock()
+		lastDeliveries = map[string]*deliveryResult{}
+		lastDeliveriesMu.Unlock()
+	}
+	forget()
+	t.Cleanup(forget)
+}
+
+// detailedHealthIs fails the test unless the detailed health check answers
+// code with status overall.
+func detailedHealthIs(t *testing.T, code int, status string) *detailedHealth {
+	t.Helper()
+	rec := apiRequest(t, "GET", "/api/v1/health/detailed", "")
+	result := &detailedHealth{}
+	decodeBody(t, rec, result)
+	if rec.Code != code || result.Status != status {
+		t.Errorf("health = %d %s, want %d %s", rec.Code, rec.Body, code, status)
+	}
+	return result
+}
+
+func TestDetailedHealth(t *testing.T) {
+	testDir(t)
+	forgetHealth(t)
+	useBackend(t, &nullPlayer{})
+	down := &stubNotifier{name: "down", err: errors.New("connection refused")}
+	useNotifiers(t, down)
+
+	// nothing parsed nor running yet
+	result := detailedHealthIs(t, http.StatusServiceUnavailable, "down")
+	if result.Subsystems["schedule"].Status != "down" || result.Subsystems["cron"].Status != "down" {
+		t.Errorf("schedule %+v, cron %+v, want both down", result.Subsystems["schedule"], result.Subsystems["cron"])
+	}
+
+	loadSchedule(t, time.Date(2024, 3, 4, 7, 0, 0, 0, time.UTC), mondayBells)
+	result = detailedHealthIs(t, http.StatusOK, "ok")
+	for name, want := range map[string]string{"config": "ok", "schedule": "ok", "cron": "ok", "audio": "ok", "notifications": "ok"} {
+		if got := result.Subsystems[name]; got == nil || got.Status != want {
+			t.Errorf("%s = %+v, want %s", name, got, want)
+		}
+	}
+
+	// a failing channel isn't critical
+	dispatchNotification(&notification{Event: "test", Test: true})
+	result = detailedHealthIs(t, http.StatusOK, "degraded")
+	if got := result.Subsystems["notifications"]; got.Status != "degraded" || got.Error != "down: connection refused" {
+		t.Errorf("notifications = %+v, want the down channel", got)
+	}
+
+	// a failed reload keeps the last good schedule running
+	writeFile(t, scheduleFile, `[{"name":`)
+	parseSchedule(context.Background())
+	result = detailedHealthIs(t, http.StatusOK, "degraded")
+	if got := result.Subsystems["schedule"]; got.Status != "degraded" || got.Error == "" {
+		t.Errorf("schedule = %+v, want degraded with the error", got)
+	}
+
+	// audio is critical
+	setAudioError(errors.New("no such device"))
+	result = detailedHealthIs(t, http.StatusServiceUnavailable, "down")
+	if got := result.Subsystems["audio"]; got.Status != "down" || got.Error != "no such device" {
+		t.Errorf("audio = %+v, want down", got)
+	}
+}
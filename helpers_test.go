@@ -0,0 +1,318 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// testSound is the shipped sound the tests play, 3.744 s of 48 kHz MP3.
+const testSound = "sounds/378394__deleted-user-7020630__school-bell.mp3"
+
+// testDir moves the test into an empty directory, where the schedule file
+// is read and written, with a sounds folder holding testSound as bell.mp3.
+// Times are in UTC.
+func testDir(t *testing.T) string {
+	t.Helper()
+	sound, err := os.ReadFile(testSound)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	t.Chdir(dir)
+	writeFile(t, "sounds/bell.mp3", string(sound))
+	setConfig(t, "audio.sounds-dir", filepath.Join(dir, "sounds"))
+	setConfig(t, "app.timezone", "UTC")
+	return dir
+}
+
+// writeFile writes content to name, creating its folder.
+func writeFile(t *testing.T, name, content string) {
+	t.Helper()
+	err := os.MkdirAll(filepath.Dir(name), 0o755)
+	if err == nil {
+		err = os.WriteFile(name, []byte(content), 0o644)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// useClock makes appClock a fake one stopped at now for the test.
+func useClock(t *testing.T, now time.Time) *fakeClock {
+	t.Helper()
+	clock := newFakeClock(now)
+	appClock = clock
+	t.Cleanup(func() { appClock = realClock{} })
+	return clock
+}
+
+// loadSchedule writes doc as the schedule file and parses it at now, on a
+// fake clock it returns. The cron service is stopped and the parse state
+// cleared when the test ends.
+func loadSchedule(t *testing.T, now time.Time, doc string) *fakeClock {
+	t.Helper()
+	clock := useClock(t, now)
+	writeFile(t, scheduleFile, doc)
+	t.Cleanup(resetScheduler)
+	err := parseSchedule(context.Background())
+	if err != nil {
+		t.Fatalf("parseSchedule: %v", err)
+	}
+	return clock
+}
+
+// resetScheduler stops the cron service and forgets the last parse.
+func resetScheduler() {
+	scheduleMu.Lock()
+	defer scheduleMu.Unlock()
+	if cronService != nil {
+		cronService.Stop()
+	}
+	if boundaryTimer != nil {
+		boundaryTimer.Stop()
+	}
+	cronService, boundaryTimer = nil, nil
+	cronRunning.Store(false)
+	entryKeys = map[string]cron.EntryID{}
+	entryMeta = map[cron.EntryID]*entryInfo{}
+	parsedKeys = nil
+	loadedSchedules, generatedSchedules, activeSchedules = nil, nil, nil
+	pinnedSchedule = ""
+	parseWarnings, parseErrors = nil, nil
+}
+
+// entriesOf lists the cron entries registered for kind, "bell" say.
+func entriesOf(kind string) []*entryInfo {
+	scheduleMu.RLock()
+	defer scheduleMu.RUnlock()
+	infos := []*entryInfo{}
+	for _, entry := range cronService.Entries() {
+		if info := entryMeta[entry.ID]; info != nil && info.Kind == kind {
+			infos = append(infos, info)
+		}
+	}
+	return infos
+}
+
+// nextFires is when each bell entry fires next after after, by its
+// schedule and time, "term 08:00" say.
+func nextFires(after time.Time) map[string]time.Time {
+	scheduleMu.RLock()
+	defer scheduleMu.RUnlock()
+	fires := map[string]time.Time{}
+	for _, entry := range cronService.Entries() {
+		if info := entryMeta[entry.ID]; info != nil && info.Kind == "bell" {
+			fires[info.Schedule+" "+info.Time] = entry.Schedule.Next(after)
+		}
+	}
+	return fires
+}
+
+// runBell runs the job of the bell entry of schedule at at, "08:00" say, as
+// cron would when it's due.
+func runBell(t *testing.T, schedule, at string) {
+	t.Helper()
+	scheduleMu.RLock()
+	var job cron.Job
+	for _, entry := range cronService.Entries() {
+		if info := entryMeta[entry.ID]; info != nil && info.Kind == "bell" && info.Schedule == schedule && info.Time == at {
+			job = entry.Job
+		}
+	}
+	scheduleMu.RUnlock()
+	if job == nil {
+		t.Fatalf("no bell of %s at %s", schedule, at)
+	}
+	job.Run()
+}
+
+// hasEntryKey reports whether an entry is registered under key.
+func hasEntryKey(key string) bool {
+	scheduleMu.RLock()
+	defer scheduleMu.RUnlock()
+	_, ok := entryKeys[key]
+	return ok
+}
+
+// setConfig sets key for the test. The whole config is reset when it ends,
+// so tests only see the keys they set.
+func setConfig(t *testing.T, key string, value interface{}) {
+	t.Helper()
+	viper.Set(key, value)
+	t.Cleanup(viper.Reset)
+}
+
+// logBuffer collects log lines, safe to read while the log is written.
+type logBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *logBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *logBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// captureLog sends the log, as JSON lines from Info up, to the returned
+// buffer until the test ends.
+func captureLog(t *testing.T) *logBuffer {
+	t.Helper()
+	buf := &logBuffer{}
+	out, formatter, level := log.StandardLogger().Out, log.StandardLogger().Formatter, log.GetLevel()
+	log.SetOutput(buf)
+	log.SetFormatter(&log.JSONFormatter{})
+	log.SetLevel(log.InfoLevel)
+	t.Cleanup(func() {
+		log.SetOutput(out)
+		log.SetFormatter(formatter)
+		log.SetLevel(level)
+	})
+	return buf
+}
+
+// logEntries decodes the lines captureLog collected with message msg.
+func logEntries(t *testing.T, buf *logBuffer, msg string) []map[string]interface{} {
+	t.Helper()
+	entries := []map[string]interface{}{}
+	for _, line := range strings.Split(buf.String(), "\n") {
+		if line == "" {
+			continue
+		}
+		entry := map[string]interface{}{}
+		err := json.Unmarshal([]byte(line), &entry)
+		if err != nil {
+			t.Fatalf("could not decode log line %q: %v", line, err)
+		}
+		if entry["msg"] == msg {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// apiRequest sends a request through the API router.
+func apiRequest(t *testing.T, method, target, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	newRouter().ServeHTTP(rec, req)
+	return rec
+}
+
+// decodeBody decodes the JSON response in rec into v.
+func decodeBody(t *testing.T, rec *httptest.ResponseRecorder, v interface{}) {
+	t.Helper()
+	err := json.Unmarshal(rec.Body.Bytes(), v)
+	if err != nil {
+		t.Fatalf("could not decode response %q: %v", rec.Body.String(), err)
+	}
+}
+
+// recordingPlayer is an audio backend keeping what it plays. With gate set,
+// each playback waits for a value on it first.
+type recordingPlayer struct {
+	mu     sync.Mutex
+	played [][]byte
+	rates  []int
+	gate   chan struct{}
+}
+
+func (p *recordingPlayer) Play(ctx context.Context, pcm io.Reader, rate, channels int) error {
+	if p.gate != nil {
+		select {
+		case <-p.gate:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	data, err := io.ReadAll(pcm)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.played = append(p.played, data)
+	p.rates = append(p.rates, rate)
+	return err
+}
+
+// count is how many playbacks p took.
+func (p *recordingPlayer) count() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.played)
+}
+
+// useBackend plays on backend for the test, from a clean audio status.
+func useBackend(t *testing.T, backend audioPlayer) {
+	t.Helper()
+	audioBackend = backend
+	t.Cleanup(func() {
+		audioBackend = &otoPlayer{}
+		setAudioError(nil)
+		audioReady.Store(false)
+	})
+}
+
+// useQueue starts the play queue on backend for the test, with room for
+// size jobs.
+func useQueue(t *testing.T, backend audioPlayer, size int) {
+	t.Helper()
+	useBackend(t, backend)
+	playQueueClosed = false
+	discardQueue.Store(false)
+	recentPlays = map[string]time.Time{}
+	lastPlayEnd = time.Time{}
+	startPlayQueue(size)
+	done := playQueueDone
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		stopPlayQueue(ctx, false)
+		// the worker reads playQueue, it must be gone before the next test
+		// starts another
+		<-done
+		lastPlayedMu.Lock()
+		lastPlayed = nil
+		lastPlayedMu.Unlock()
+	})
+}
+
+// pcmJob is a job playing d of silence.
+func pcmJob(name string, d time.Duration) *playJob {
+	return &playJob{Sound: name, PCM: silence(samplingRate, d), Done: make(chan error, 1)}
+}
+
+// waitFor fails the test unless cond holds within 5 seconds.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestMain(m *testing.M) {
+	log.SetLevel(log.WarnLevel)
+	os.Exit(m.Run())
+}
@@ -0,0 +1,312 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxOccurrences caps how far a recurring calendar event is expanded.
+const maxOccurrences = 10000
+
+// icsEvent is the part of an iCalendar VEVENT bells care about.
+type icsEvent struct {
+	UID     string
+	Summary string
+	Start   time.Time
+	AllDay  bool
+	RRule   string
+	ExDates []time.Time
+	// RecurrenceID is the occurrence of UID's recurring event this one
+	// replaces.
+	RecurrenceID time.Time
+	Cancelled    bool
+}
+
+// icsOccurrence is one time a calendar event happens.
+type icsOccurrence struct {
+	Summary string
+	At      time.Time
+}
+
+// parseICS reads the events of an iCalendar feed. Times without a TZID, or
+// with one that doesn't load, are in loc.
+func parseICS(data []byte, loc *time.Location) ([]*icsEvent, error) {
+	events := []*icsEvent{}
+	var current *icsEvent
+	for _, line := range unfoldICS(data) {
+		name, params, value := splitICSLine(line)
+		switch {
+		case name == "BEGIN" && value == "VEVENT":
+			current = &icsEvent{}
+		case name == "END" && value == "VEVENT":
+			if current != nil && !current.Start.IsZero() {
+				events = append(events, current)
+			}
+			current = nil
+		case current == nil:
+		case name == "UID":
+			current.UID = value
+		case name == "SUMMARY":
+			current.Summary = unescapeICS(value)
+		case name == "STATUS":
+			current.Cancelled = strings.EqualFold(value, "CANCELLED")
+		case name == "RRULE":
+			current.RRule = value
+		case name == "DTSTART":
+			at, allDay, err := parseICSTime(value, params, loc)
+			if err != nil {
+				return nil, fmt.Errorf("event %s: invalid DTSTART %q: %v", current.UID, value, err)
+			}
+			current.Start, current.AllDay = at, allDay
+		case name == "RECURRENCE-ID":
+			at, _, err := parseICSTime(value, params, loc)
+			if err != nil {
+				return nil, fmt.Errorf("event %s: invalid RECURRENCE-ID %q: %v", current.UID, value, err)
+			}
+			current.RecurrenceID = at
+		case name == "EXDATE":
+			for _, v := range strings.Split(value, ",") {
+				at, _, err := parseICSTime(v, params, loc)
+				if err != nil {
+					return nil, fmt.Errorf("event %s: invalid EXDATE %q: %v", current.UID, v, err)
+				}
+				current.ExDates = append(current.ExDates, at)
+			}
+		}
+	}
+	return events, nil
+}
+
+// unfoldICS splits data into content lines, joining the folded ones.
+func unfoldICS(data []byte) []string {
+	lines := []string{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if len(lines) > 0 && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// splitICSLine splits "NAME;PARAM=VALUE:value".
+func splitICSLine(line string) (string, map[string]string, string) {
+	head, value, _ := strings.Cut(line, ":")
+	parts := strings.Split(head, ";")
+	params := map[string]string{}
+	for _, p := range parts[1:] {
+		k, v, _ := strings.Cut(p, "=")
+		params[strings.ToUpper(k)] = strings.Trim(v, `"`)
+	}
+	return strings.ToUpper(parts[0]), params, value
+}
+
+func unescapeICS(value string) string {
+	return strings.NewReplacer(`\n`, " ", `\N`, " ", `\,`, ",", `\;`, ";", `\\`, `\`).Replace(value)
+}
+
+// parseICSTime reads a DATE or DATE-TIME value, reporting whether it's a
+// date.
+func parseICSTime(value string, params map[string]string, loc *time.Location) (time.Time, bool, error) {
+	if params["VALUE"] == "DATE" || len(value) == 8 {
+		t, err := time.ParseInLocation("20060102", value, loc)
+		return t, true, err
+	}
+	if strings.HasSuffix(value, "Z") {
+		t, err := time.Parse("20060102T150405Z", value)
+		return t, false, err
+	}
+	if tzid := params["TZID"]; tzid != "" {
+		if tz, err := time.LoadLocation(tzid); err == nil {
+			loc = tz
+		}
+	}
+	t, err := time.ParseInLocation("20060102T150405", value, loc)
+	return t, false, err
+}
+
+// occurrences lists when evt happens from from to until, following its
+// RRULE. Daily, weekly (with BYDAY), monthly and yearly rules are
+// understood; INTERVAL, COUNT and UNTIL apply to all of them.
+func (evt *icsEvent) occurrences(from, until time.Time) ([]time.Time, error) {
+	if evt.RRule == "" {
+		if evt.Start.Before(from) || evt.Start.After(until) {
+			return nil, nil
+		}
+		return []time.Time{evt.Start}, nil
+	}
+	rule := map[string]string{}
+	for _, part := range strings.Split(evt.RRule, ";") {
+		k, v, _ := strings.Cut(part, "=")
+		rule[strings.ToUpper(k)] = v
+	}
+	for k := range rule {
+		switch k {
+		case "FREQ", "INTERVAL", "COUNT", "UNTIL", "BYDAY", "WKST":
+		default:
+			return nil, fmt.Errorf("unsupported RRULE %s", k)
+		}
+	}
+	interval := 1
+	if v, ok := rule["INTERVAL"]; ok {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid INTERVAL %q", v)
+		}
+		interval = n
+	}
+	count := 0
+	if v, ok := rule["COUNT"]; ok {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid COUNT %q", v)
+		}
+		count = n
+	}
+	if v, ok := rule["UNTIL"]; ok {
+		end, _, err := parseICSTime(v, nil, evt.Start.Location())
+		if err != nil {
+			return nil, fmt.Errorf("invalid UNTIL %q", v)
+		}
+		if len(v) == 8 {
+			end = end.AddDate(0, 0, 1).Add(-time.Second)
+		}
+		if end.Before(until) {
+			until = end
+		}
+	}
+	var days []time.Weekday
+	if v, ok := rule["BYDAY"]; ok {
+		if rule["FREQ"] != "WEEKLY" {
+			return nil, fmt.Errorf("BYDAY is only supported on weekly rules")
+		}
+		for _, d := range strings.Split(v, ",") {
+			wd, ok := icsWeekdays[d]
+			if !ok {
+				return nil, fmt.Errorf("unsupported BYDAY %q", d)
+			}
+			days = append(days, wd)
+		}
+		sort.Slice(days, func(i, j int) bool {
+			return (days[i]+6)%7 < (days[j]+6)%7
+		})
+	}
+
+	start := evt.Start
+	candidates := func(k int) []time.Time {
+		switch rule["FREQ"] {
+		case "DAILY":
+			return []time.Time{start.AddDate(0, 0, k*interval)}
+		case "WEEKLY":
+			if days == nil {
+				return []time.Time{start.AddDate(0, 0, 7*k*interval)}
+			}
+			// weeks start on Monday
+			monday := start.AddDate(0, 0, -int((start.Weekday()+6)%7)+7*k*interval)
+			week := []time.Time{}
+			for _, d := range days {
+				week = append(week, monday.AddDate(0, 0, int((d+6)%7)))
+			}
+			return week
+		case "MONTHLY":
+			// months without the day, like the 31st, are skipped
+			t := start.AddDate(0, k*interval, 0)
+			if t.Day() != start.Day() {
+				return nil
+			}
+			return []time.Time{t}
+		case "YEARLY":
+			t := start.AddDate(k*interval, 0, 0)
+			if t.Day() != start.Day() {
+				return nil
+			}
+			return []time.Time{t}
+		}
+		return nil
+	}
+	switch rule["FREQ"] {
+	case "DAILY", "WEEKLY", "MONTHLY", "YEARLY":
+	default:
+		return nil, fmt.Errorf("unsupported FREQ %q", rule["FREQ"])
+	}
+
+	result := []time.Time{}
+	seen := 0
+	for k := 0; k < maxOccurrences; k++ {
+		next := candidates(k)
+		if len(next) > 0 && next[0].After(until) {
+			break
+		}
+		for _, t := range next {
+			if t.Before(start) || t.After(until) {
+				continue
+			}
+			seen++
+			if count > 0 && seen > count {
+				return result, nil
+			}
+			if !t.Before(from) && !evt.excluded(t) {
+				result = append(result, t)
+			}
+		}
+	}
+	return result, nil
+}
+
+var icsWeekdays = map[string]time.Weekday{
+	"SU": time.Sunday, "MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday,
+	"TH": time.Thursday, "FR": time.Friday, "SA": time.Saturday,
+}
+
+func (evt *icsEvent) excluded(t time.Time) bool {
+	for _, ex := range evt.ExDates {
+		if ex.Equal(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// icsOccurrences expands events into their occurrences from from to until,
+// in time order. Cancelled events and all-day ones are left out, as are the
+// occurrences an edited copy (RECURRENCE-ID) replaces. Events with a rule
+// that can't be followed are reported and skipped.
+func icsOccurrences(events []*icsEvent, from, until time.Time) ([]*icsOccurrence, []error) {
+	replaced := map[string]bool{}
+	for _, evt := range events {
+		if !evt.RecurrenceID.IsZero() {
+			replaced[evt.UID+"|"+evt.RecurrenceID.UTC().Format(time.RFC3339)] = true
+		}
+	}
+	result := []*icsOccurrence{}
+	problems := []error{}
+	for _, evt := range events {
+		if evt.Cancelled || evt.AllDay {
+			continue
+		}
+		times, err := evt.occurrences(from, until)
+		if err != nil {
+			problems = append(problems, fmt.Errorf("event %q: %v", evt.Summary, err))
+			continue
+		}
+		for _, t := range times {
+			if evt.RecurrenceID.IsZero() && replaced[evt.UID+"|"+t.UTC().Format(time.RFC3339)] {
+				continue
+			}
+			result = append(result, &icsOccurrence{Summary: evt.Summary, At: t})
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].At.Before(result[j].At)
+	})
+	return result, problems
+}
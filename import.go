@@ -0,0 +1,170 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// importMu keeps imports and other edits of the schedule file from
+// interleaving their read, save and reload.
+var importMu sync.Mutex
+
+// checkSchedules validates every schedule in data, active or not, the way
+// parseSchedule would configure it, and lists what it would reject.
+func checkSchedules(data []*schedule) []*scheduleError {
+	problems := []*scheduleError{}
+	add := func(sch, day, at string, err error) {
+		problems = append(problems, &scheduleError{Schedule: sch, Day: day, Time: at, Message: err.Error()})
+	}
+	sounds, _ := themeSounds(currentTheme().Active)
+	names := map[string]bool{}
+	for _, sch := range data {
+		if names[sch.Name] {
+			add(sch.Name, "", "", fmt.Errorf("duplicate schedule name"))
+		}
+		names[sch.Name] = true
+	}
+	expanded, programProblems := expandPrograms(data)
+	problems = append(problems, programProblems...)
+	defaults := 0
+	for _, sch := range expanded {
+		if sch.Default {
+			defaults++
+			if defaults > 1 {
+				add(sch.Name, "", "", fmt.Errorf("more than one default schedule"))
+			}
+			_, err := scheduleLocation(sch)
+			if err != nil {
+				add(sch.Name, "", "", fmt.Errorf("could not load timezone: %v", err))
+			}
+		} else {
+			_, _, _, err := scheduleWindow(sch, appClock.Now())
+			if err != nil {
+				add(sch.Name, "", "", err)
+			}
+		}
+		dir, err := sch.soundsDir()
+		if err != nil {
+			add(sch.Name, "", "", err)
+			continue
+		}
+		for _, d := range sch.Days {
+			if !d.isEnabled() {
+				continue
+			}
+			dayName := strings.ToUpper(d.Name[0:3])
+			for _, evt := range d.Events {
+				evt, _, err := withDefaultSound(evt, d.DefaultSound)
+				evtDir := dir
+				if err == nil {
+					evt = withTheme(evt, sounds)
+					evtDir, err = eventSoundsDir(dir, evt)
+				}
+				if err == nil {
+					_, err = checkEvent(evtDir, evt)
+				}
+				if err == nil {
+					err = checkSoundFiles(evtDir, evt)
+				}
+				if err == nil {
+					var spec string
+					spec, err = eventSpec(sch, dayName, evt, appClock.Now())
+					if err == nil {
+						_, err = cronParser.Parse(spec)
+					}
+				}
+				// a bell skipped for the polar night is still a valid bell
+				if err != nil && !errors.Is(err, errNoSunEvent) {
+					add(sch.Name, dayName, evt.Time, err)
+				}
+			}
+		}
+	}
+	return problems
+}
+
+// postImportSchedulesHandler replaces the whole schedule with the document
+// in the body. Nothing changes unless every schedule in it checks out; a
+// document that still fails to load puts the previous file back.
+func postImportSchedulesHandler(w http.ResponseWriter, r *http.Request) {
+	if viper.GetString("schedule.url") != "" {
+		writeError(w, http.StatusConflict, "the schedule is fetched from schedule.url, import it there")
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxRemoteSchedule))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "could not read body")
+		return
+	}
+	body = scheduleJSON(body)
+	err = validateScheduleJSON(body)
+	if err != nil {
+		var invalid *validationError
+		if errors.As(err, &invalid) {
+			writeJSON(w, http.StatusUnprocessableEntity, map[string]interface{}{
+				"error":      "schedule is invalid",
+				"violations": invalid.Violations,
+			})
+			return
+		}
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	data := []*schedule{}
+	err = json.Unmarshal(body, &data)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	problems := checkSchedules(data)
+	if len(problems) > 0 {
+		writeJSON(w, http.StatusUnprocessableEntity, map[string]interface{}{
+			"error":  "schedule is invalid",
+			"errors": problems,
+		})
+		return
+	}
+
+	importMu.Lock()
+	defer importMu.Unlock()
+	previous, err := os.ReadFile(scheduleFile)
+	if err != nil && !os.IsNotExist(err) {
+		log.Errorf("Could not read schedule: %v", err)
+		writeError(w, http.StatusInternalServerError, "could not read schedule")
+		return
+	}
+	err = saveSchedules(data)
+	if err != nil {
+		log.Errorf("Could not save schedule: %v", err)
+		writeError(w, http.StatusInternalServerError, "could not save schedule")
+		return
+	}
+	err = reloadSchedule(r.Context())
+	if err != nil {
+		log.Errorf("Imported schedule did not load, restoring the previous one: %v", err)
+		if previous != nil {
+			restoreErr := writeScheduleFile(previous)
+			if restoreErr != nil {
+				log.Errorf("Could not restore schedule: %v", restoreErr)
+			}
+		}
+		if writeTimeout(w, err) {
+			return
+		}
+		writeError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	log.Warnf("Imported %d schedules", len(data))
+	scheduleMu.RLock()
+	defer scheduleMu.RUnlock()
+	writeJSON(w, http.StatusOK, &reloadResult{Status: "imported", Warnings: parseWarnings, Errors: parseErrors})
+}
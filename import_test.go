@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+const termTwo = `[{"name": "term2", "starts": "2024-01-01", "ends": "2024-12-31", "days": [{"name": "Tuesday", "events": [
+	{"time": "08:30", "sound": "bell.mp3"},
+	{"time": "10:30", "sound": "bell.mp3"}
+]}]}]`
+
+// scheduleFileIs fails the test unless the schedule file still reads want.
+func scheduleFileIs(t *testing.T, want string) {
+	t.Helper()
+	got, err := os.ReadFile(scheduleFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != want {
+		t.Errorf("schedule file =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestImportSchedules(t *testing.T) {
+	testDir(t)
+	loadSchedule(t, time.Date(2024, 3, 4, 7, 0, 0, 0, time.UTC), mondayBells)
+
+	rec := apiRequest(t, "POST", "/api/v1/schedules/import", termTwo)
+	result := &reloadResult{}
+	decodeBody(t, rec, result)
+	if rec.Code != http.StatusOK || result.Status != "imported" {
+		t.Fatalf("import = %d %s, want 200", rec.Code, rec.Body)
+	}
+	bells := entriesOf("bell")
+	if len(bells) != 2 || bells[0].Schedule != "term2" || bells[1].Schedule != "term2" {
+		t.Errorf("bells = %+v, want term2's two", bells)
+	}
+	data, err := readScheduleFile()
+	if err != nil || len(data) != 1 || data[0].Name != "term2" {
+		t.Errorf("schedule file = %+v, %v, want term2 alone", data, err)
+	}
+}
+
+func TestImportProgram(t *testing.T) {
+	testDir(t)
+	sound, err := os.ReadFile("sounds/bell.mp3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, "sounds/pm/chime.mp3", string(sound))
+	loadSchedule(t, time.Date(2024, 3, 4, 7, 0, 0, 0, time.UTC), mondayBells)
+
+	// the afternoon part's chime is only in its own sounds_dir
+	rec := apiRequest(t, "POST", "/api/v1/schedules/import", programSchedules)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("import = %d %s, want 200", rec.Code, rec.Body)
+	}
+	if got := active(); len(got) != 1 || got[0] != "day" {
+		t.Errorf("active = %q, want the program", got)
+	}
+}
+
+func TestImportRejected(t *testing.T) {
+	testDir(t)
+	loadSchedule(t, time.Date(2024, 3, 4, 7, 0, 0, 0, time.UTC), mondayBells)
+
+	tests := []struct {
+		name, doc string
+		want      []string
+	}{
+		{"bad events", `[
+			{"name": "term2", "starts": "2024-01-01", "ends": "2024-12-31", "days": [{"name": "Tuesday", "events": [
+				{"time": "08:30", "sound": "bell.mp3"},
+				{"time": "09:30", "sound": "missing.mp3"},
+				{"time": "10:30", "sound": "bell.mp3", "zone": "roof"}
+			]}]},
+			{"name": "term2", "starts": "2025-01-01", "ends": "2025-12-31", "days": []}
+		]`, []string{"duplicate schedule name", "sound not found: missing.mp3", "unknown zone: roof"}},
+		{"not a schedule", `[{"name": "term2", "days": "every day"}]`, []string{"violations"}},
+		{"not JSON", `[{"name":`, []string{"error"}},
+	}
+	for _, tt := range tests {
+		rec := apiRequest(t, "POST", "/api/v1/schedules/import", tt.doc)
+		if rec.Code != http.StatusUnprocessableEntity && rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: import = %d, want it rejected", tt.name, rec.Code)
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(rec.Body.String(), want) {
+				t.Errorf("%s: import = %s, want %q in the report", tt.name, rec.Body, want)
+			}
+		}
+		scheduleFileIs(t, mondayBells)
+		if bells := entriesOf("bell"); len(bells) != 1 || bells[0].Schedule != "term" {
+			t.Errorf("%s: bells = %+v, want term's still ringing", tt.name, bells)
+		}
+	}
+
+	setConfig(t, "schedule.url", "http://example.com/schedule.json")
+	if rec := apiRequest(t, "POST", "/api/v1/schedules/import", termTwo); rec.Code != http.StatusConflict {
+		t.Errorf("import with schedule.url = %d, want 409", rec.Code)
+	}
+}
+
+func TestImportRestoresOnFailedLoad(t *testing.T) {
+	testDir(t)
+	loadSchedule(t, time.Date(2024, 3, 4, 7, 0, 0, 0, time.UTC), mondayBells)
+
+	// the document checks out but the reload after saving it is cut short
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req := httptest.NewRequest("POST", "/api/v1/schedules/import", strings.NewReader(termTwo)).WithContext(ctx)
+	rec := httptest.NewRecorder()
+	postImportSchedulesHandler(rec, req)
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("import = %d %s, want 422", rec.Code, rec.Body)
+	}
+	scheduleFileIs(t, mondayBells)
+	if bells := entriesOf("bell"); len(bells) != 1 || bells[0].Schedule != "term" {
+		t.Errorf("bells = %+v, want term's still ringing", bells)
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+
+	"github.com/spf13/viper"
+)
+
+// scheduleJSON returns raw ready for encoding/json. With schedule.jsonc set,
+// comments and trailing commas are allowed and stripped first; otherwise the
+// schedule must be strict JSON.
+func scheduleJSON(raw []byte) []byte {
+	if !viper.GetBool("schedule.jsonc") {
+		return raw
+	}
+	return stripTrailingCommas(stripComments(raw))
+}
+
+// hasComments reports whether raw has comments outside strings, which
+// saving a decoded copy of it would drop.
+func hasComments(raw []byte) bool {
+	return !bytes.Equal(stripComments(raw), raw)
+}
+
+// stripComments blanks out // and /* */ comments outside strings. Newlines
+// are kept so parse errors still point at the right line.
+func stripComments(data []byte) []byte {
+	out := make([]byte, len(data))
+	copy(out, data)
+	inString := false
+	for i := 0; i < len(out); i++ {
+		c := out[i]
+		if inString {
+			if c == '\\' {
+				i++
+			} else if c == '"' {
+				inString = false
+			}
+			continue
+		}
+		switch {
+		case c == '"':
+			inString = true
+		case c == '/' && i+1 < len(out) && out[i+1] == '/':
+			for ; i < len(out) && out[i] != '\n'; i++ {
+				out[i] = ' '
+			}
+		case c == '/' && i+1 < len(out) && out[i+1] == '*':
+			out[i], out[i+1] = ' ', ' '
+			for i += 2; i < len(out); i++ {
+				if out[i] == '*' && i+1 < len(out) && out[i+1] == '/' {
+					out[i], out[i+1] = ' ', ' '
+					i++
+					break
+				}
+				if out[i] != '\n' {
+					out[i] = ' '
+				}
+			}
+		}
+	}
+	return out
+}
+
+// stripTrailingCommas blanks out commas followed only by whitespace and a
+// closing bracket. It expects comments to be gone already.
+func stripTrailingCommas(data []byte) []byte {
+	out := make([]byte, len(data))
+	copy(out, data)
+	inString := false
+	for i := 0; i < len(out); i++ {
+		c := out[i]
+		if inString {
+			if c == '\\' {
+				i++
+			} else if c == '"' {
+				inString = false
+			}
+			continue
+		}
+		if c == '"' {
+			inString = true
+			continue
+		}
+		if c != ',' {
+			continue
+		}
+		j := i + 1
+		for j < len(out) && (out[j] == ' ' || out[j] == '\t' || out[j] == '\n' || out[j] == '\r') {
+			j++
+		}
+		if j < len(out) && (out[j] == '}' || out[j] == ']') {
+			out[i] = ' '
+		}
+	}
+	return out
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestStripComments(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{`{"a": 1} // note`, `{"a": 1}        `},
+		{"{\"a\": /* one */ 1}", "{\"a\":           1}"},
+		{"/* two\nlines */[]", "      \n        []"},
+		{`{"url": "http://host/*x*/"}`, `{"url": "http://host/*x*/"}`},
+		{`{"say": "\"// not a comment"}`, `{"say": "\"// not a comment"}`},
+		{`[1, // no newline`, `[1,              `},
+	}
+	for _, tt := range tests {
+		if got := string(stripComments([]byte(tt.in))); got != tt.want {
+			t.Errorf("stripComments(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestStripTrailingCommas(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{`[1, 2,]`, `[1, 2 ]`},
+		{"{\"a\": 1,\n}", "{\"a\": 1 \n}"},
+		{`[{"a": [1,],},]`, `[{"a": [1 ] } ]`},
+		{`["a,]", 1]`, `["a,]", 1]`},
+	}
+	for _, tt := range tests {
+		got := stripTrailingCommas([]byte(tt.in))
+		if string(got) != tt.want {
+			t.Errorf("stripTrailingCommas(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+		if !json.Valid(got) {
+			t.Errorf("stripTrailingCommas(%q) = %q, not valid JSON", tt.in, got)
+		}
+	}
+}
+
+const commentedSchedule = `// the main term
+[{"name": "term", "starts": "2024-01-01", "ends": "2024-12-31", "days": [
+	{"name": "Monday", "events": [
+		{"time": "08:00", "sound": "bell.mp3"}, /* first period */
+		{"time": "09:00", "sound": "bell.mp3"},
+	]},
+]}]
+`
+
+func TestCommentedSchedule(t *testing.T) {
+	testDir(t)
+	setConfig(t, "schedule.jsonc", true)
+	loadSchedule(t, time.Date(2024, 3, 4, 7, 0, 0, 0, time.UTC), commentedSchedule)
+	if bells := entriesOf("bell"); len(bells) != 2 {
+		t.Errorf("bells = %d, want 2 from the commented schedule", len(bells))
+	}
+}
+
+func TestCommentedScheduleKept(t *testing.T) {
+	testDir(t)
+	setConfig(t, "schedule.jsonc", true)
+	loadSchedule(t, time.Date(2024, 3, 4, 7, 0, 0, 0, time.UTC), commentedSchedule)
+	rec := apiRequest(t, "PUT", "/api/v1/schedules/term/days/MON/enabled", `{"enabled": false}`)
+	if rec.Code != http.StatusConflict {
+		t.Errorf("disable a day = %d %s, want 409", rec.Code, rec.Body)
+	}
+	scheduleFileIs(t, commentedSchedule)
+	if bells := entriesOf("bell"); len(bells) != 2 {
+		t.Errorf("bells = %d, want Monday's 2 still ringing", len(bells))
+	}
+}
+
+func TestCommentedScheduleStrict(t *testing.T) {
+	testDir(t)
+	useClock(t, time.Date(2024, 3, 4, 7, 0, 0, 0, time.UTC))
+	writeFile(t, scheduleFile, commentedSchedule)
+	t.Cleanup(resetScheduler)
+	if err := parseSchedule(context.Background()); err == nil {
+		t.Error("commented schedule parsed with schedule.jsonc off")
+	}
+}
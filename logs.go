@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+const (
+	defaultLogLines = 100
+	maxLogLines     = 1000
+	// logChunk is how much of the log file is read at a time from its end.
+	logChunk = 64 << 10
+)
+
+// requireToken only lets through requests bearing app.api-token. Without a
+// token configured the endpoint stays off.
+func requireToken(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := viper.GetString("app.api-token")
+		if token == "" {
+			writeError(w, http.StatusForbidden, "set app.api-token to enable this endpoint")
+			return
+		}
+		given := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			writeError(w, http.StatusUnauthorized, "invalid token")
+			return
+		}
+		next(w, r)
+	}
+}
+
+// getLogsHandler returns the last lines (default 100, at most 1000) of the
+// current log file, not the rotated ones, as JSON or, with format=text, as
+// plain text.
+func getLogsHandler(w http.ResponseWriter, r *http.Request) {
+	lines := defaultLogLines
+	if value := r.URL.Query().Get("lines"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			writeError(w, http.StatusBadRequest, "lines must be a positive number")
+			return
+		}
+		lines = n
+	}
+	if lines > maxLogLines {
+		lines = maxLogLines
+	}
+	tail, err := tailFile(viper.GetString("log.file"), lines)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "could not read log: "+err.Error())
+		return
+	}
+	if r.URL.Query().Get("format") == "text" {
+		w.Header().Set("Content-Type", "text/plain; charset=UTF-8")
+		for _, line := range tail {
+			io.WriteString(w, line+"\n")
+		}
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string][]string{"lines": tail})
+}
+
+// tailFile returns the last n lines of the file at name, reading backwards
+// from its end so a large log isn't read whole.
+func tailFile(name string, n int) ([]string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	var data []byte
+	offset := info.Size()
+	// one more newline than lines wanted, the first line may be partial
+	for offset > 0 && bytes.Count(data, []byte("\n")) <= n {
+		size := int64(logChunk)
+		if size > offset {
+			size = offset
+		}
+		offset -= size
+		chunk := make([]byte, size)
+		_, err = f.ReadAt(chunk, offset)
+		if err != nil {
+			return nil, err
+		}
+		data = append(chunk, data...)
+	}
+
+	text := strings.TrimRight(string(data), "\n")
+	if text == "" {
+		return []string{}, nil
+	}
+	all := strings.Split(text, "\n")
+	if len(all) > n {
+		all = all[len(all)-n:]
+	}
+	return all, nil
+}
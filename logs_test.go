@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTailFile(t *testing.T) {
+	testDir(t)
+	lines := []string{}
+	// long enough to span several chunks
+	for i := 0; i < 5000; i++ {
+		lines = append(lines, fmt.Sprintf("line %d %s", i, strings.Repeat("x", 40)))
+	}
+	writeFile(t, "bell.log", strings.Join(lines, "\n")+"\n")
+	for _, n := range []int{1, 3, 2000, 9000} {
+		got, err := tailFile("bell.log", n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := lines[max(len(lines)-n, 0):]
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("tailFile(%d) = %d lines from %q, want %d from %q", n, len(got), got[0], len(want), want[0])
+		}
+	}
+
+	writeFile(t, "empty.log", "")
+	if got, err := tailFile("empty.log", 10); err != nil || len(got) != 0 {
+		t.Errorf("tailFile of an empty log = %q, %v, want none", got, err)
+	}
+}
+
+func TestLogsHandler(t *testing.T) {
+	testDir(t)
+	setConfig(t, "log.file", "logs/bell.log")
+	writeFile(t, "logs/bell.log", "one\ntwo\nthree\n")
+	// lumberjack's rotated backup, which isn't read
+	writeFile(t, "logs/bell-2024-03-04T08-00-00.000.log", "old\n")
+	get := func(target, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", target, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		newRouter().ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := get("/api/v1/logs", "secret"); rec.Code != http.StatusForbidden {
+		t.Errorf("logs without a configured token = %d, want 403", rec.Code)
+	}
+	setConfig(t, "app.api-token", "secret")
+	if rec := get("/api/v1/logs", "guess"); rec.Code != http.StatusUnauthorized {
+		t.Errorf("logs with a wrong token = %d, want 401", rec.Code)
+	}
+
+	rec := get("/api/v1/logs?lines=2", "secret")
+	body := struct {
+		Lines []string `json:"lines"`
+	}{}
+	decodeBody(t, rec, &body)
+	if rec.Code != http.StatusOK || !reflect.DeepEqual(body.Lines, []string{"two", "three"}) {
+		t.Errorf("logs = %d %q, want two and three", rec.Code, body.Lines)
+	}
+	rec = get("/api/v1/logs?format=text", "secret")
+	if rec.Body.String() != "one\ntwo\nthree\n" || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/plain") {
+		t.Errorf("text logs = %q, want the current file whole", rec.Body)
+	}
+	if rec := get("/api/v1/logs?lines=0", "secret"); rec.Code != http.StatusBadRequest {
+		t.Errorf("logs?lines=0 = %d, want 400", rec.Code)
+	}
+}
@@ -2,6 +2,9 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
@@ -10,7 +13,9 @@ import (
 	"os"
 	"os/signal"
 	"path"
+	"path/filepath"
 	"runtime"
+	"runtime/debug"
 	"strings"
 	"syscall"
 	"time"
@@ -25,40 +30,90 @@ var isDev *bool
 
 func main() {
 	isDev = flag.Bool("dev", false, "is it running in development mode")
+	configPath := flag.String("config", "", "config file (yaml, yml, toml or json), defaults to bell.yaml, bell.yml, bell.toml or bell.json")
 	flag.Parse()
 
-	viper.SetConfigName("bell")
-	viper.AddConfigPath(".")
-	err := viper.ReadInConfig()
+	configName, err := configFile(*configPath)
 	if err != nil {
-		log.Panicf("Could not load bell.yml configuration file: %v", err)
+		log.Panicf("Could not load configuration file: %v", err)
+	}
+	viper.SetConfigFile(configName)
+	viper.SetDefault("app.shutdown-timeout", 5*time.Second)
+	viper.SetDefault("app.keep-alive", true)
+	viper.SetDefault("app.idle-timeout", 2*time.Minute)
+	viper.SetDefault("app.h2c", false)
+	viper.SetDefault("app.http2.max-concurrent-streams", 250)
+	viper.SetDefault("app.events.max-clients", 8)
+	viper.SetDefault("app.request-timeout", 30*time.Second)
+	viper.SetDefault("log.file", "bell.log")
+	viper.SetDefault("log.max-size", defaultLogMaxSize)
+	viper.SetDefault("log.max-backups", defaultLogMaxBackups)
+	viper.SetDefault("log.max-age", defaultLogMaxAge)
+	viper.SetDefault("log.compress", false)
+	viper.SetDefault("log.static-requests", "debug")
+	viper.SetDefault("log.format", "")
+	viper.SetDefault("schedule.daily-reparse", true)
+	viper.SetDefault("schedule.jsonc", false)
+	viper.SetDefault("schedule.reparse-cron", "1 0 * * *")
+	viper.SetDefault("schedule.fetch-timeout", 10*time.Second)
+	viper.SetDefault("schedule.cache-file", "./schedule.remote.json")
+	viper.SetDefault("schedule.drift-check", false)
+	viper.SetDefault("schedule.catch-up-grace", time.Duration(0))
+	viper.SetDefault("schedule.reload-min-interval", 2*time.Second)
+	viper.SetDefault("schedule.strict-sounds", false)
+	viper.SetDefault("calendar.days", 7)
+	viper.SetDefault("schedule.time-check.max-skew", 30*time.Second)
+	viper.SetDefault("schedule.time-check.retry", 15*time.Second)
+	viper.SetDefault("schedule.time-check.wait", 5*time.Minute)
+	viper.SetDefault("schedule.drift-threshold-ms", 2000)
+	viper.SetDefault("notifications.timeout-ms", 5000)
+	viper.SetDefault("notifications.no-bells", false)
+	viper.SetDefault("notifications.concurrency", 4)
+	viper.SetDefault("audio.sounds-dir", "./sounds")
+	viper.SetDefault("audio.file-dir", "./recordings")
+	viper.SetDefault("audio.default-sound", "")
+	viper.SetDefault("audio.theme", "")
+	viper.SetDefault("audio.rtp.payload-type", 10)
+	viper.SetDefault("audio.rtp.packet-ms", 5)
+	viper.SetDefault("audio.queue-size", 16)
+	viper.SetDefault("audio.drain-on-shutdown", true)
+	viper.SetDefault("audio.dedup-window-ms", 2000)
+	viper.SetDefault("audio.min-gap-ms", 0)
+	viper.SetDefault("audio.prebuffer-ms", 0)
+	viper.SetDefault("audio.keep-warm-ms", 0)
+	viper.SetDefault("audio.overlap", "serialize")
+	viper.SetDefault("audio.mix-window-ms", 50)
+	viper.SetDefault("audio.duck-db", 0)
+	viper.SetDefault("audio.duck-fade-ms", 200)
+	viper.SetDefault("relay.enabled", false)
+	viper.SetDefault("relay.pin", 17)
+	viper.SetDefault("relay.active-high", true)
+	viper.SetDefault("relay.pulse-ms", 3000)
+	viper.SetDefault("announce.enabled", false)
+	viper.SetDefault("weather.url", "https://api.open-meteo.com/v1/forecast?latitude={lat}&longitude={lon}&current=weather_code")
+	viper.SetDefault("weather.cache-minutes", 15)
+	viper.SetDefault("weather.max-age-minutes", 120)
+	viper.SetDefault("weather.timeout-ms", 3000)
+	viper.SetDefault("announce.phrase", "It is {hour} o'clock")
+	viper.SetDefault("announce.locale", "en")
+	viper.SetDefault("announce.command", "espeak-ng -v {locale} --stdout {text}")
+	err = viper.ReadInConfig()
+	if err != nil {
+		log.Panicf("Could not load %s configuration file: %v", configName, err)
 	}
 
 	// Setup logger
-	lumberjackLogrotate := &lumberjack.Logger{
-		Filename:   viper.GetString("log.file"),
-		MaxSize:    viper.GetInt("log.max-size"),    // Max megabytes before log is rotated
-		MaxBackups: viper.GetInt("log.max-backups"), // Max number of old log files to keep
-		MaxAge:     viper.GetInt("log.max-age"),     // Max number of days to retain log files
-		Compress:   false,
-	}
-
-	if *isDev {
-		log.SetReportCaller(true)
-		log.SetFormatter(&log.TextFormatter{
-			ForceColors:     true,
-			FullTimestamp:   true,
-			TimestampFormat: "2006/01/02 15:04:05",
-			CallerPrettyfier: func(f *runtime.Frame) (string, string) {
-				filename := path.Base(f.File)
-				return fmt.Sprintf("%s()", f.Function), fmt.Sprintf("\t%s:%d", filename, f.Line)
-			},
-		})
+	lumberjackLogrotate := newLogRotation()
+	logFileErr := checkLogFile(lumberjackLogrotate.Filename)
+
+	log.SetReportCaller(*isDev)
+	formatter, logFormatErr := logFormatter(*isDev, viper.GetString("log.format"))
+	log.SetFormatter(formatter)
+	if logFileErr != nil {
+		log.SetOutput(os.Stdout)
 	} else {
-		log.SetFormatter(&log.JSONFormatter{})
+		log.SetOutput(io.MultiWriter(os.Stdout, lumberjackLogrotate))
 	}
-	logMultiWriter := io.MultiWriter(os.Stdout, lumberjackLogrotate)
-	log.SetOutput(logMultiWriter)
 	switch viper.GetString("log.level") {
 	case "INFO":
 		log.SetLevel(log.InfoLevel)
@@ -70,104 +125,515 @@ func main() {
 		log.SetLevel(log.WarnLevel)
 	}
 
+	if logFormatErr != nil {
+		log.Warn(logFormatErr)
+	}
+	if logFileErr != nil {
+		log.Warnf("Logging to stdout only: %v", logFileErr)
+	} else {
+		log.WithFields(log.Fields{
+			"File":       lumberjackLogrotate.Filename,
+			"MaxSize":    lumberjackLogrotate.MaxSize,
+			"MaxBackups": lumberjackLogrotate.MaxBackups,
+			"MaxAge":     lumberjackLogrotate.MaxAge,
+			"Compress":   lumberjackLogrotate.Compress,
+		}).Info("Log rotation")
+	}
+
 	log.WithFields(log.Fields{
+		"Version":         version,
+		"Commit":          commit,
 		"Runtime Version": runtime.Version(),
 		"Number of CPUs":  runtime.NumCPU(),
 		"Arch":            runtime.GOARCH,
 	}).Info("Starting bell")
 
-	err = parseSchedule()
-	if err != nil {
-		log.Fatalf("Could not parse schedule: %v", err)
+	loadTrustedProxies()
+	maintenanceMode.Store(viper.GetBool("app.maintenance"))
+	activeTheme = viper.GetString("audio.theme")
+	setupNotifiers()
+	for _, z := range zones() {
+		if z.Device != "" {
+			log.Warnf("Zone %s device %s: the oto output only plays on the default device", z.Name, z.Device)
+		}
 	}
-	// limiter := tollbooth.NewLimiter(1, &limiter.ExpirableOptions{DefaultExpirationTTL: time.Hour})
+	setupAudioBackend()
+	setupRelay()
+	if viper.GetBool("audio.self-test") {
+		audioSelfTest()
+	}
+	startPlayQueue(viper.GetInt("audio.queue-size"))
+	playOnStart()
 
-	r := mux.NewRouter()
-	r.Use(loggingMiddleware)
-	r.HandleFunc("/api/v1/healthz", getHealthzHandler).Methods("GET")
+	// limiter := tollbooth.NewLimiter(1, &limiter.ExpirableOptions{DefaultExpirationTTL: time.Hour})
 
-	r.PathPrefix("/").Handler(http.StripPrefix("/", vueServe(http.Dir("./web/dist"))))
+	r := newRouter()
 
 	addr := viper.GetString("app.addr")
-	srv := &http.Server{
-		Handler: r,
-		Addr:    addr,
-	}
+	srv := newServer(addr, r)
+	srv.RegisterOnShutdown(liveEvents.close)
 	go func() {
-		err = srv.ListenAndServe()
+		err = serve(srv)
 		if err != nil {
 			log.Printf("server stopped: %v", err)
 		}
 	}()
 	log.Infof("bell started on %s", addr)
 
+	// the API answers while the clock is checked, only the bells wait, then
+	// the weather is kept looked up for them
+	go func() {
+		waitForClock()
+		err := parseSchedule(context.Background())
+		if err != nil {
+			log.Fatalf("Could not parse schedule: %v", err)
+		}
+		watchWeather()
+	}()
+
 	done := make(chan os.Signal, 1)
 	signal.Notify(done, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
 
 	<-done
 	log.Print("Server Stopped")
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer func() {
-		log.Println("Closing")
-		if cronService != nil {
-			log.Printf("Stopping cron service")
-			cronService.Stop()
+	shutdown(srv)
+	log.Print("Server shutdown gracefully")
+}
+
+// shutdown stops cron, then srv, then the play queue, all within
+// app.shutdown-timeout. Connections and queued sounds still open when it's
+// up are closed and discarded.
+func shutdown(srv *http.Server) {
+	shutdownTimeout := viper.GetDuration("app.shutdown-timeout")
+	if shutdownTimeout <= 0 {
+		shutdownTimeout = 5 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	// stop scheduling new bells first, then HTTP, then finish the queue
+	if cronService != nil {
+		log.Printf("Stopping cron service")
+		cronService.Stop()
+		cronRunning.Store(false)
+	}
+	if boundaryTimer != nil {
+		boundaryTimer.Stop()
+	}
+
+	err := srv.Shutdown(ctx)
+	if errors.Is(err, context.DeadlineExceeded) {
+		log.Warnf("Shutdown timeout of %s reached, closing open connections", shutdownTimeout)
+		srv.Close()
+	} else if err != nil {
+		log.Errorf("Server Shutdown Failed: %v", err)
+	}
+
+	stopPlayQueue(ctx, viper.GetBool("audio.drain-on-shutdown"))
+	closeRelay()
+}
+
+// logFormatter builds the formatter for format, "json" or "text", or when
+// it's empty the one -dev picks: colored text with the caller, JSON without
+// it. dev only adds the colors and caller to text.
+func logFormatter(dev bool, format string) (log.Formatter, error) {
+	var err error
+	switch format {
+	case "json", "text":
+	case "":
+		format = "json"
+		if dev {
+			format = "text"
 		}
+	default:
+		err = fmt.Errorf("unknown log.format %q, using json", format)
+		format = "json"
+	}
+	if format == "json" {
+		return &log.JSONFormatter{}, err
+	}
+	text := &log.TextFormatter{
+		FullTimestamp:   true,
+		TimestampFormat: "2006/01/02 15:04:05",
+	}
+	if dev {
+		text.ForceColors = true
+		text.CallerPrettyfier = func(f *runtime.Frame) (string, string) {
+			filename := path.Base(f.File)
+			return fmt.Sprintf("%s()", f.Function), fmt.Sprintf("\t%s:%d", filename, f.Line)
+		}
+	}
+	return text, err
+}
 
-		cancel()
-	}()
+const (
+	defaultLogMaxSize    = 5
+	defaultLogMaxBackups = 90
+	defaultLogMaxAge     = 60
+)
+
+// newLogRotation builds the log rotation from the log.* settings. lumberjack
+// treats a zero max-size as 100MB, so non positive sizes and negative counts
+// fall back to the defaults. Zero max-backups or max-age keep everything.
+func newLogRotation() *lumberjack.Logger {
+	maxSize := viper.GetInt("log.max-size")
+	if maxSize <= 0 {
+		log.Warnf("Invalid log.max-size %d, using %d", maxSize, defaultLogMaxSize)
+		maxSize = defaultLogMaxSize
+	}
+	maxBackups := viper.GetInt("log.max-backups")
+	if maxBackups < 0 {
+		log.Warnf("Invalid log.max-backups %d, using %d", maxBackups, defaultLogMaxBackups)
+		maxBackups = defaultLogMaxBackups
+	}
+	maxAge := viper.GetInt("log.max-age")
+	if maxAge < 0 {
+		log.Warnf("Invalid log.max-age %d, using %d", maxAge, defaultLogMaxAge)
+		maxAge = defaultLogMaxAge
+	}
+	return &lumberjack.Logger{
+		Filename:   viper.GetString("log.file"),
+		MaxSize:    maxSize,    // Max megabytes before log is rotated
+		MaxBackups: maxBackups, // Max number of old log files to keep
+		MaxAge:     maxAge,     // Max number of days to retain log files
+		Compress:   viper.GetBool("log.compress"),
+	}
+}
 
-	err = srv.Shutdown(ctx)
+// checkLogFile makes sure the log file can be written, creating its
+// directory if needed. lumberjack would otherwise pick a file in the temp
+// directory for an empty name, or drop every line of an unwritable one.
+func checkLogFile(name string) error {
+	if name == "" {
+		return errors.New("log.file is empty")
+	}
+	err := os.MkdirAll(filepath.Dir(name), 0o755)
 	if err != nil {
-		log.Fatalf("Server Shutdown Failed: %v", err)
+		return fmt.Errorf("could not create log directory: %v", err)
 	}
-	log.Print("Server shutdown gracefully")
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return fmt.Errorf("could not open log file: %v", err)
+	}
+	return f.Close()
 }
 
+// newRouter wires the API routes and the web UI.
+func newRouter() *mux.Router {
+	r := mux.NewRouter()
+	r.Use(requestIDMiddleware)
+	r.Use(loggingMiddleware)
+	r.Use(recoveryMiddleware)
+	r.Use(timeoutMiddleware)
+	r.Use(maintenanceMiddleware)
+	r.HandleFunc("/api/v1/healthz", getHealthzHandler).Methods("GET")
+	r.HandleFunc("/api/v1/health/detailed", getDetailedHealthHandler).Methods("GET")
+	r.HandleFunc("/api/v1/version", getVersionHandler).Methods("GET")
+	r.HandleFunc("/api/v1/openapi.json", getOpenAPIHandler).Methods("GET")
+	r.HandleFunc("/api/v1/config", getConfigHandler).Methods("GET")
+	r.HandleFunc(maintenancePath, getMaintenanceHandler).Methods("GET")
+	r.HandleFunc(maintenancePath, putMaintenanceHandler).Methods("PUT")
+	r.HandleFunc("/api/v1/sounds", getSoundsHandler).Methods("GET")
+	r.HandleFunc("/api/v1/sounds/rescan", postSoundsRescanHandler).Methods("POST")
+	r.HandleFunc("/api/v1/cron", getCronHandler).Methods("GET")
+	r.HandleFunc("/api/v1/next", getNextBellHandler).Methods("GET")
+	r.HandleFunc("/api/v1/stats", getStatsHandler).Methods("GET")
+	r.HandleFunc("/api/v1/whatsplaying", getWhatsPlayingHandler).Methods("GET")
+	r.HandleFunc("/api/v1/events", getEventsHandler).Methods("GET")
+	r.HandleFunc("/api/v1/diagnostics", getDiagnosticsHandler).Methods("GET")
+	r.HandleFunc("/api/v1/weekday/{day}", getWeekdayHandler).Methods("GET")
+	r.HandleFunc("/api/v1/theme", getThemeHandler).Methods("GET")
+	r.HandleFunc("/api/v1/simulate", getSimulateHandler).Methods("GET")
+	r.HandleFunc("/api/v1/theme", postThemeHandler).Methods("POST")
+	r.HandleFunc("/api/v1/logs", requireToken(getLogsHandler)).Methods("GET")
+	r.HandleFunc("/api/v1/schedules", getSchedulesHandler).Methods("GET")
+	r.HandleFunc("/api/v1/schedules/import", postImportSchedulesHandler).Methods("POST")
+	r.HandleFunc("/api/v1/schedules/export", getExportSchedulesHandler).Methods("GET")
+	r.HandleFunc("/api/v1/active", getActiveHandler).Methods("GET")
+	r.HandleFunc("/api/v1/active", postActiveHandler).Methods("POST")
+	r.HandleFunc("/api/v1/active", deleteActiveHandler).Methods("DELETE")
+	r.HandleFunc("/api/v1/schedules/{name}/days/{day}/enabled", putDayEnabledHandler).Methods("PUT")
+	r.HandleFunc("/api/v1/reload", postReloadHandler).Methods("POST")
+	r.HandleFunc("/api/v1/preview-schedule", postPreviewScheduleHandler).Methods("POST")
+	r.HandleFunc("/api/v1/snooze", postSnoozeHandler).Methods("POST")
+	r.HandleFunc("/api/v1/silence-until", getSilenceHandler).Methods("GET")
+	r.HandleFunc("/api/v1/silence-until", postSilenceHandler).Methods("POST")
+	r.HandleFunc("/api/v1/play", postPlayHandler).Methods("POST")
+	r.HandleFunc("/api/v1/ring-test", postRingTestHandler).Methods("POST")
+	r.HandleFunc("/api/v1/rehearse", postRehearseHandler).Methods("POST")
+	r.HandleFunc("/api/v1/rehearse", deleteRehearseHandler).Methods("DELETE")
+	r.HandleFunc("/api/v1/test-webhook", postTestWebhookHandler).Methods("POST")
+	checkOpenAPI(r)
+
+	r.PathPrefix("/").Handler(http.StripPrefix("/", vueServe(http.Dir("./web/dist"))))
+	return r
+}
+
+// loggingMiddleware logs every API call. Requests for the web app's files
+// are logged as log.static-requests says: at "info", at "debug" or "off".
 func loggingMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
 		start := time.Now()
-		next.ServeHTTP(response, request)
+		recorder := &statusRecorder{ResponseWriter: response, status: http.StatusOK}
+		next.ServeHTTP(recorder, request)
+		level := log.InfoLevel
+		if !strings.HasPrefix(request.URL.Path, "/api/") {
+			mode := viper.GetString("log.static-requests")
+			if mode == "off" {
+				return
+			}
+			if mode != "info" {
+				level = log.DebugLevel
+			}
+		}
 		log.WithFields(log.Fields{
-			"IP":     getIPAddress(request),
-			"Method": request.Method,
-			"URI":    request.RequestURI,
-			"Cost":   time.Since(start).String(),
-		}).Info("Handler called")
+			"RequestID": getRequestID(request.Context()),
+			"IP":        getIPAddress(request),
+			"Peer":      remoteAddrIP(request.RemoteAddr),
+			"Method":    request.Method,
+			"URI":       request.RequestURI,
+			"Status":    recorder.status,
+			"Bytes":     recorder.bytes,
+			"Cost":      time.Since(start).String(),
+		}).Log(level, "Handler called")
+	})
+}
+
+// recoveryMiddleware turns a handler panic into a 500 instead of taking the
+// server down. It runs inside loggingMiddleware so the request is still logged.
+func recoveryMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		defer func() {
+			if err := recover(); err != nil {
+				log.WithFields(log.Fields{
+					"RequestID": getRequestID(request.Context()),
+					"URI":       request.RequestURI,
+					"Stack":     string(debug.Stack()),
+				}).Errorf("Handler panic: %v", err)
+				writeError(response, http.StatusInternalServerError, "internal server error")
+			}
+		}()
+		next.ServeHTTP(response, request)
 	})
 }
 
+// untimedPaths stream for as long as the client stays, so they get no
+// app.request-timeout.
+var untimedPaths = map[string]bool{
+	"/api/v1/events": true,
+}
+
+// timeoutMiddleware gives each request app.request-timeout to finish. The
+// deadline is on the request context, for handlers to give up on slow work
+// like fetching schedule.url, and on reading the body, for a client that
+// stalls mid upload. A handler that runs out of time without answering gets
+// a 504.
+func timeoutMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		timeout := viper.GetDuration("app.request-timeout")
+		if timeout <= 0 || untimedPaths[request.URL.Path] {
+			next.ServeHTTP(response, request)
+			return
+		}
+		ctx, cancel := context.WithTimeout(request.Context(), timeout)
+		defer cancel()
+		deadline, _ := ctx.Deadline()
+		// not every connection supports it, the context still applies
+		_ = http.NewResponseController(response).SetReadDeadline(deadline)
+
+		recorder := &statusRecorder{ResponseWriter: response, status: http.StatusOK}
+		next.ServeHTTP(recorder, request.WithContext(ctx))
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) && !recorder.wroteHeader {
+			log.WithFields(log.Fields{
+				"RequestID": getRequestID(request.Context()),
+				"URI":       request.RequestURI,
+			}).Warnf("Request timed out after %s", timeout)
+			writeTimeout(recorder, ctx.Err())
+		}
+	})
+}
+
+// statusRecorder captures the status code and body size a handler writes.
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	bytes       int
+	wroteHeader bool
+}
+
+func (s *statusRecorder) WriteHeader(code int) {
+	if !s.wroteHeader {
+		s.status = code
+		s.wroteHeader = true
+	}
+	s.ResponseWriter.WriteHeader(code)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	s.wroteHeader = true
+	n, err := s.ResponseWriter.Write(b)
+	s.bytes += n
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the connection, e.g. to flush
+// the event stream.
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+type contextKey string
+
+const requestIDKey contextKey = "requestID"
+
+// requestIDMiddleware reuses the caller's X-Request-ID or generates one, so a
+// UI action can be matched with its server-side log line.
+func requestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		id := strings.TrimSpace(request.Header.Get("X-Request-ID"))
+		if id == "" {
+			id = newUUID()
+		}
+		response.Header().Set("X-Request-ID", id)
+		ctx := context.WithValue(request.Context(), requestIDKey, id)
+		next.ServeHTTP(response, request.WithContext(ctx))
+	})
+}
+
+func getRequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// newUUID returns a random (version 4) UUID.
+func newUUID() string {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		log.Errorf("Could not generate request id: %v", err)
+		return fmt.Sprintf("%d", time.Now().UnixNano())
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
 func getIPAddress(r *http.Request) string {
-	// for _, h := range []string{"X-Forwarded-For", "X-Real-Ip"} {
-	for _, h := range []string{"X-Forwarded-For"} {
-		addresses := strings.Split(r.Header.Get(h), ",")
-		for i := 0; i < len(addresses); i++ {
-			ip := strings.TrimSpace(addresses[i])
-			// header can contain spaces too, strip those out.
-			realIP := net.ParseIP(ip)
-			if !realIP.IsGlobalUnicast() {
-				// bad address, go to next
-				continue
+	remoteIP := remoteAddrIP(r.RemoteAddr)
+	// only a proxy on this host reaches the unix socket
+	_, overSocket := r.Context().Value(http.LocalAddrContextKey).(*net.UnixAddr)
+	if !overSocket && !isTrustedProxy(remoteIP) {
+		return remoteIP
+	}
+
+	// walk the proxy chain from the nearest hop, skipping our own proxies
+	addresses := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+	for i := len(addresses) - 1; i >= 0; i-- {
+		// header can contain spaces too, strip those out.
+		ip := strings.TrimSpace(addresses[i])
+		realIP := net.ParseIP(ip)
+		if !realIP.IsGlobalUnicast() {
+			// bad address, go to next
+			continue
+		}
+		if isTrustedProxy(ip) {
+			continue
+		}
+		return ip
+	}
+
+	ip := strings.TrimSpace(r.Header.Get("X-Real-Ip"))
+	if net.ParseIP(ip).IsGlobalUnicast() {
+		return ip
+	}
+
+	return remoteIP
+}
+
+// remoteAddrIP strips the port from a RemoteAddr such as "1.2.3.4:5678" or
+// "[::1]:5678", also accepting a bare or bracketed address without one.
+// IPv4-mapped IPv6 addresses come back as IPv4. Anything that isn't an IP is
+// returned as is so it still shows up in the logs.
+func remoteAddrIP(remoteAddr string) string {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = strings.TrimSuffix(strings.TrimPrefix(remoteAddr, "["), "]")
+	}
+	// keep the zone of a link-local address, fe80::1%eth0
+	address, zone, hasZone := strings.Cut(host, "%")
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return remoteAddr
+	}
+	if hasZone {
+		return ip.String() + "%" + zone
+	}
+	return ip.String()
+}
+
+var trustedProxies []*net.IPNet
+
+// loadTrustedProxies parses app.trusted-proxies, a list of IPs or CIDRs whose
+// X-Forwarded-For and X-Real-Ip headers are honored.
+func loadTrustedProxies() {
+	trustedProxies = nil
+	for _, entry := range viper.GetStringSlice("app.trusted-proxies") {
+		if !strings.Contains(entry, "/") {
+			if strings.Contains(entry, ":") {
+				entry += "/128"
+			} else {
+				entry += "/32"
 			}
-			return ip
 		}
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			log.Errorf("Could not parse trusted proxy: %s : %v", entry, err)
+			continue
+		}
+		trustedProxies = append(trustedProxies, network)
 	}
-	return "localhost"
 }
 
-// func writeJSON(w http.ResponseWriter, httpStatusCode int, obj interface{}) {
-// 	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
-// 	result, err := json.Marshal(obj)
-// 	if err != nil {
-// 		log.Printf("Could not marshal result: %v", err)
-// 		w.WriteHeader(http.StatusInternalServerError)
-// 		w.Write([]byte("Could not marshal result: " + err.Error()))
-// 		return
-// 	}
-// 	w.WriteHeader(httpStatusCode)
-// 	w.Write(result)
-// }
+func isTrustedProxy(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, network := range trustedProxies {
+		if network.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+func writeJSON(w http.ResponseWriter, httpStatusCode int, obj interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	result, err := json.Marshal(obj)
+	if err != nil {
+		log.Printf("Could not marshal result: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte("Could not marshal result: " + err.Error()))
+		return
+	}
+	w.WriteHeader(httpStatusCode)
+	w.Write(result)
+}
+
+func writeError(w http.ResponseWriter, httpStatusCode int, message string) {
+	writeJSON(w, httpStatusCode, map[string]string{"error": message})
+}
+
+// writeTimeout answers 504 when err is the request running out of time, see
+// timeoutMiddleware, and reports whether it did.
+func writeTimeout(w http.ResponseWriter, err error) bool {
+	if !errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	writeError(w, http.StatusGatewayTimeout, "request timed out")
+	return true
+}
 
 // func writeJSONBlob(w http.ResponseWriter, httpStatusCode int, obj []byte) {
 // 	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
@@ -228,11 +694,14 @@ func getIPAddress(r *http.Request) string {
 // }
 
 func vueServe(fs http.FileSystem) http.Handler {
-	log.Printf("creating file handler")
+	log.Debugf("creating file handler")
 	fsh := http.FileServer(fs)
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		log.Printf("Opening: %s", path.Clean(r.URL.Path))
-		_, err := fs.Open(path.Clean(r.URL.Path))
+		log.Debugf("Opening: %s", path.Clean(r.URL.Path))
+		f, err := fs.Open(path.Clean(r.URL.Path))
+		if err == nil {
+			f.Close()
+		}
 		if os.IsNotExist(err) {
 			index, err := os.ReadFile("./web/dist/index.html")
 			if err != nil {
@@ -240,8 +709,8 @@ func vueServe(fs http.FileSystem) http.Handler {
 				w.WriteHeader(http.StatusNotFound)
 				return
 			}
-			w.WriteHeader(http.StatusOK)
 			w.Header().Set("Content-Type", "text/html; charset=UTF-8")
+			w.WriteHeader(http.StatusOK)
 			w.Write(index)
 			return
 		}
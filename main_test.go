@@ -0,0 +1,450 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+func requestIDHandler() http.Handler {
+	return requestIDMiddleware(loggingMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(getRequestID(r.Context())))
+	})))
+}
+
+func TestRequestIDGenerated(t *testing.T) {
+	logs := captureLog(t)
+	rec := httptest.NewRecorder()
+	requestIDHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/api/v1/healthz", nil))
+
+	id := rec.Header().Get("X-Request-ID")
+	if !uuidPattern.MatchString(id) {
+		t.Fatalf("X-Request-ID = %q, want a v4 UUID", id)
+	}
+	if rec.Body.String() != id {
+		t.Errorf("request context id = %q, want %q", rec.Body.String(), id)
+	}
+	entries := logEntries(t, logs, "Handler called")
+	if len(entries) != 1 || entries[0]["RequestID"] != id {
+		t.Errorf("log entries = %v, want one with RequestID %s", entries, id)
+	}
+}
+
+func TestRequestIDPreserved(t *testing.T) {
+	logs := captureLog(t)
+	req := httptest.NewRequest("GET", "/api/v1/healthz", nil)
+	req.Header.Set("X-Request-ID", " ui-42 ")
+	rec := httptest.NewRecorder()
+	requestIDHandler().ServeHTTP(rec, req)
+
+	if got := rec.Header().Get("X-Request-ID"); got != "ui-42" {
+		t.Errorf("X-Request-ID = %q, want ui-42", got)
+	}
+	if rec.Body.String() != "ui-42" {
+		t.Errorf("request context id = %q, want ui-42", rec.Body.String())
+	}
+	entries := logEntries(t, logs, "Handler called")
+	if len(entries) != 1 || entries[0]["RequestID"] != "ui-42" {
+		t.Errorf("log entries = %v, want one with RequestID ui-42", entries)
+	}
+}
+
+func TestGetIPAddress(t *testing.T) {
+	setConfig(t, "app.trusted-proxies", []string{"10.0.0.1", "fd00::/8"})
+	loadTrustedProxies()
+	t.Cleanup(func() { trustedProxies = nil })
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  string
+		realIP     string
+		want       string
+	}{
+		{"forwarded for", "10.0.0.1:4000", "203.0.113.7", "", "203.0.113.7"},
+		{"nearest untrusted hop", "10.0.0.1:4000", "198.51.100.1, 203.0.113.7, 10.0.0.1", "", "203.0.113.7"},
+		{"real ip", "10.0.0.1:4000", "", "203.0.113.8", "203.0.113.8"},
+		{"forwarded for wins over real ip", "10.0.0.1:4000", "203.0.113.7", "203.0.113.8", "203.0.113.7"},
+		{"private client", "10.0.0.1:4000", "192.168.1.20", "", "192.168.1.20"},
+		{"trusted ipv6 proxy", "[fd00::5]:4000", "", "192.168.1.21", "192.168.1.21"},
+		{"no usable header", "10.0.0.1:4000", "unknown", "", "10.0.0.1"},
+		{"untrusted direct connection", "203.0.113.9:4000", "192.168.1.20", "192.168.1.21", "203.0.113.9"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.forwarded != "" {
+				req.Header.Set("X-Forwarded-For", tt.forwarded)
+			}
+			if tt.realIP != "" {
+				req.Header.Set("X-Real-Ip", tt.realIP)
+			}
+			if got := getIPAddress(req); got != tt.want {
+				t.Errorf("getIPAddress() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetIPAddressOverSocket(t *testing.T) {
+	// the proxy in front of a unix socket is trusted without being listed
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "@"
+	req.Header.Set("X-Forwarded-For", "203.0.113.7")
+	if got := getIPAddress(req); got == "203.0.113.7" {
+		t.Errorf("getIPAddress over TCP = %q, want the header ignored", got)
+	}
+	req = req.WithContext(context.WithValue(req.Context(), http.LocalAddrContextKey, &net.UnixAddr{Name: "/run/bell.sock", Net: "unix"}))
+	if got := getIPAddress(req); got != "203.0.113.7" {
+		t.Errorf("getIPAddress over the socket = %q, want 203.0.113.7", got)
+	}
+}
+
+func TestNewLogRotation(t *testing.T) {
+	tests := []struct {
+		name                        string
+		settings                    map[string]interface{}
+		maxSize, maxBackups, maxAge int
+		compress                    bool
+	}{
+		{"defaults", map[string]interface{}{"log.max-size": defaultLogMaxSize, "log.max-backups": defaultLogMaxBackups, "log.max-age": defaultLogMaxAge}, 5, 90, 60, false},
+		{"invalid values", map[string]interface{}{"log.max-size": 0, "log.max-backups": -1, "log.max-age": -3}, 5, 90, 60, false},
+		{"keep everything", map[string]interface{}{"log.max-size": 10, "log.max-backups": 0, "log.max-age": 0}, 10, 0, 0, false},
+		{"compressed", map[string]interface{}{"log.max-size": 1, "log.max-backups": 3, "log.max-age": 7, "log.compress": true}, 1, 3, 7, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setConfig(t, "log.file", "logs/bell.log")
+			for key, value := range tt.settings {
+				setConfig(t, key, value)
+			}
+			got := newLogRotation()
+			if got.Filename != "logs/bell.log" || got.MaxSize != tt.maxSize || got.MaxBackups != tt.maxBackups || got.MaxAge != tt.maxAge || got.Compress != tt.compress {
+				t.Errorf("rotation = %s %d MB, %d backups, %d days, compress %v, want logs/bell.log %d MB, %d backups, %d days, compress %v",
+					got.Filename, got.MaxSize, got.MaxBackups, got.MaxAge, got.Compress, tt.maxSize, tt.maxBackups, tt.maxAge, tt.compress)
+			}
+		})
+	}
+}
+
+func TestLogFormatter(t *testing.T) {
+	tests := []struct {
+		dev    bool
+		format string
+		json   bool
+		err    bool
+	}{
+		{false, "", true, false},
+		{true, "", false, false},
+		{true, "json", true, false},
+		{false, "text", false, false},
+		{true, "text", false, false},
+		{false, "xml", true, true},
+	}
+	for _, tt := range tests {
+		formatter, err := logFormatter(tt.dev, tt.format)
+		if (err != nil) != tt.err {
+			t.Errorf("dev %v, log.format %q: err = %v, want an error %v", tt.dev, tt.format, err, tt.err)
+		}
+		_, isJSON := formatter.(*log.JSONFormatter)
+		if isJSON != tt.json {
+			t.Errorf("dev %v, log.format %q: formatter %T, want json %v", tt.dev, tt.format, formatter, tt.json)
+		}
+		// -dev only adds colors and the caller to text
+		if text, ok := formatter.(*log.TextFormatter); ok && (text.ForceColors != tt.dev || (text.CallerPrettyfier != nil) != tt.dev) {
+			t.Errorf("dev %v, log.format %q: colors %v, caller %v, want them only with -dev", tt.dev, tt.format, text.ForceColors, text.CallerPrettyfier != nil)
+		}
+	}
+}
+
+func TestCheckLogFile(t *testing.T) {
+	testDir(t)
+	writeFile(t, "notadir", "")
+	if err := os.Mkdir("taken.log", 0o755); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		err  string
+	}{
+		{"logs/nested/bell.log", ""},
+		{"", "log.file is empty"},
+		{"notadir/bell.log", "could not create log directory"},
+		{"taken.log", "could not open log file"},
+	}
+	for _, tt := range tests {
+		err := checkLogFile(tt.name)
+		if tt.err == "" && err != nil || tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+			t.Errorf("checkLogFile(%q) = %v, want %q", tt.name, err, tt.err)
+		}
+	}
+	if _, err := os.Stat("logs/nested/bell.log"); err != nil {
+		t.Errorf("log file not created: %v", err)
+	}
+}
+
+func TestLoggingStatusAndBytes(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		status  float64
+		bytes   float64
+	}{
+		{"not found", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte("missing"))
+		}, 404, 7},
+		{"implicit ok", func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("hello, "))
+			w.Write([]byte("world"))
+		}, 200, 12},
+		{"no body", func(w http.ResponseWriter, r *http.Request) {}, 200, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs := captureLog(t)
+			rec := httptest.NewRecorder()
+			loggingMiddleware(tt.handler).ServeHTTP(rec, httptest.NewRequest("GET", "/api/v1/thing", nil))
+			if rec.Code != int(tt.status) {
+				t.Errorf("response status = %d, want %v", rec.Code, tt.status)
+			}
+			entries := logEntries(t, logs, "Handler called")
+			if len(entries) != 1 || entries[0]["Status"] != tt.status || entries[0]["Bytes"] != tt.bytes {
+				t.Errorf("logged %v, want Status %v and Bytes %v", entries, tt.status, tt.bytes)
+			}
+		})
+	}
+}
+
+func TestRecoveryMiddleware(t *testing.T) {
+	logs := captureLog(t)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/panic", func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})
+	mux.HandleFunc("/api/v1/ok", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("still here"))
+	})
+	srv := httptest.NewServer(requestIDMiddleware(loggingMiddleware(recoveryMiddleware(mux))))
+	defer srv.Close()
+
+	req, _ := http.NewRequest("GET", srv.URL+"/api/v1/panic", nil)
+	req.Header.Set("X-Request-ID", "panic-1")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := map[string]string{}
+	json.NewDecoder(resp.Body).Decode(&body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusInternalServerError || body["error"] != "internal server error" {
+		t.Errorf("panic answered %d %v, want a 500 JSON error", resp.StatusCode, body)
+	}
+
+	panics := logEntries(t, logs, "Handler panic: boom")
+	if len(panics) != 1 || panics[0]["RequestID"] != "panic-1" || !strings.Contains(panics[0]["Stack"].(string), "TestRecoveryMiddleware") {
+		t.Errorf("panic logged as %v, want the request id and stack", panics)
+	}
+	calls := logEntries(t, logs, "Handler called")
+	if len(calls) != 1 || calls[0]["Status"] != 500.0 || calls[0]["Cost"] == nil {
+		t.Errorf("request logged as %v, want status 500 with its timing", calls)
+	}
+
+	resp, err = http.Get(srv.URL + "/api/v1/ok")
+	if err != nil {
+		t.Fatalf("server didn't survive the panic: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("next request = %d, want 200", resp.StatusCode)
+	}
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	logs := captureLog(t)
+	setConfig(t, "app.shutdown-timeout", "200ms")
+	setConfig(t, "audio.drain-on-shutdown", true)
+	player := &recordingPlayer{gate: make(chan struct{})}
+	useQueue(t, player, 8)
+	defer close(player.gate)
+
+	// a request that outlasts the timeout
+	release := make(chan struct{})
+	defer close(release)
+	entered := make(chan struct{})
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(entered)
+		<-release
+	})}
+	go srv.Serve(ln)
+	go http.Get("http://" + ln.Addr().String())
+	<-entered
+
+	// a sound playing and one waiting behind it
+	if err := enqueuePlay(pcmJob("playing", time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the first sound to start", func() bool { return len(playQueue) == 0 })
+	if err := enqueuePlay(pcmJob("waiting", time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	shutdown(srv)
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond || elapsed > 2*time.Second {
+		t.Errorf("shutdown took %s, want the 200ms timeout", elapsed)
+	}
+	if len(logEntries(t, logs, "Shutdown timeout of 200ms reached, closing open connections")) != 1 {
+		t.Errorf("closing connections not logged:\n%s", logs)
+	}
+	if len(logEntries(t, logs, "Shutdown timeout reached, discarding 1 queued sounds")) != 1 {
+		t.Errorf("discarded sounds not logged:\n%s", logs)
+	}
+}
+
+func TestShutdownInTime(t *testing.T) {
+	logs := captureLog(t)
+	setConfig(t, "app.shutdown-timeout", "2s")
+	useQueue(t, &recordingPlayer{}, 8)
+	srv := &http.Server{}
+	start := time.Now()
+	shutdown(srv)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("idle shutdown took %s, want it done without waiting out the timeout", elapsed)
+	}
+	if strings.Contains(logs.String(), "timeout") {
+		t.Errorf("idle shutdown hit the timeout:\n%s", logs)
+	}
+}
+
+func TestRemoteAddrIP(t *testing.T) {
+	tests := []struct {
+		remoteAddr, want string
+	}{
+		{"192.0.2.10:5678", "192.0.2.10"},
+		{"192.0.2.10", "192.0.2.10"},
+		{"[2001:db8::1]:5678", "2001:db8::1"},
+		{"[2001:db8:0:0::1]", "2001:db8::1"},
+		{"2001:db8::1", "2001:db8::1"},
+		{"[fe80::1%eth0]:5678", "fe80::1%eth0"},
+		{"not an address", "not an address"},
+		{"example.com:80", "example.com:80"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := remoteAddrIP(tt.remoteAddr); got != tt.want {
+			t.Errorf("remoteAddrIP(%q) = %q, want %q", tt.remoteAddr, got, tt.want)
+		}
+	}
+}
+
+func TestLoggedRemoteAddr(t *testing.T) {
+	logs := captureLog(t)
+	req := httptest.NewRequest("GET", "/api/v1/thing", nil)
+	req.RemoteAddr = "[2001:db8::7]:40000"
+	loggingMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(httptest.NewRecorder(), req)
+	entries := logEntries(t, logs, "Handler called")
+	if len(entries) != 1 || entries[0]["IP"] != "2001:db8::7" || entries[0]["Peer"] != "2001:db8::7" {
+		t.Errorf("logged %v, want the IPv6 client without its port", entries)
+	}
+}
+
+func TestStaticRequestLogging(t *testing.T) {
+	tests := []struct {
+		mode, static string
+	}{
+		{"", "debug"},
+		{"debug", "debug"},
+		{"info", "info"},
+		{"off", ""},
+	}
+	handler := loggingMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	for _, tt := range tests {
+		setConfig(t, "log.static-requests", tt.mode)
+		logs := captureLog(t)
+		log.SetLevel(log.DebugLevel)
+		for _, path := range []string{"/assets/app.js", "/api/v1/version"} {
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+		}
+		levels := map[string]interface{}{}
+		for _, entry := range logEntries(t, logs, "Handler called") {
+			levels[entry["URI"].(string)] = entry["level"]
+		}
+		if levels["/api/v1/version"] != "info" {
+			t.Errorf("log.static-requests %q: API call logged at %v, want info", tt.mode, levels["/api/v1/version"])
+		}
+		if got, logged := levels["/assets/app.js"]; tt.static == "" && logged || tt.static != "" && got != tt.static {
+			t.Errorf("log.static-requests %q: asset logged at %v, want %q", tt.mode, got, tt.static)
+		}
+	}
+}
+
+func TestStaticRequestsQuiet(t *testing.T) {
+	testDir(t)
+	setConfig(t, "log.static-requests", "debug")
+	writeFile(t, "web/dist/index.html", "<html></html>")
+	writeFile(t, "web/dist/assets/app.js", "app()")
+	logs := captureLog(t)
+	// the app's files and its routes, which get index.html
+	for _, path := range []string{"/assets/app.js", "/", "/timetable"} {
+		if rec := apiRequest(t, "GET", path, ""); rec.Code != http.StatusOK {
+			t.Errorf("GET %s = %d, want 200", path, rec.Code)
+		}
+	}
+	if got := logs.String(); got != "" {
+		t.Errorf("static requests logged %s, want nothing at info", got)
+	}
+}
+
+func TestTimeoutMiddleware(t *testing.T) {
+	setConfig(t, "app.request-timeout", 50*time.Millisecond)
+	tests := []struct {
+		name, path string
+		handler    http.HandlerFunc
+		status     int
+		body       string
+	}{
+		{"slow", "/api/v1/slow", func(w http.ResponseWriter, r *http.Request) {
+			<-r.Context().Done()
+		}, http.StatusGatewayTimeout, `{"error":"request timed out"}`},
+		{"in time", "/api/v1/quick", func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("ok"))
+		}, http.StatusOK, "ok"},
+		{"answered before giving up", "/api/v1/slow", func(w http.ResponseWriter, r *http.Request) {
+			<-r.Context().Done()
+			writeError(w, http.StatusServiceUnavailable, "gave up")
+		}, http.StatusServiceUnavailable, `{"error":"gave up"}`},
+		{"event stream", "/api/v1/events", func(w http.ResponseWriter, r *http.Request) {
+			if _, ok := r.Context().Deadline(); ok {
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+		}, http.StatusOK, ""},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		start := time.Now()
+		timeoutMiddleware(tt.handler).ServeHTTP(rec, httptest.NewRequest("GET", tt.path, nil))
+		if waited := time.Since(start); waited > time.Second {
+			t.Errorf("%s: answered after %s", tt.name, waited)
+		}
+		if rec.Code != tt.status || strings.TrimSpace(rec.Body.String()) != tt.body {
+			t.Errorf("%s: %d %q, want %d %q", tt.name, rec.Code, rec.Body, tt.status, tt.body)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"sync/atomic"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// maintenanceMode pauses bells and rejects changes made through the API.
+var maintenanceMode atomic.Bool
+
+const maintenancePath = "/api/v1/maintenance"
+
+// maintenanceAllowed are the mutating requests still served in maintenance
+// mode: turning it off and the ones that don't change anything.
+var maintenanceAllowed = map[string]bool{
+	maintenancePath:            true,
+	"/api/v1/preview-schedule": true,
+}
+
+// maintenanceMiddleware answers 503 to mutating requests while in
+// maintenance mode. Reads keep working.
+func maintenanceMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		if maintenanceMode.Load() && isMutating(request.Method) && !maintenanceAllowed[request.URL.Path] {
+			writeError(response, http.StatusServiceUnavailable, "bell is in maintenance mode, changes are disabled")
+			return
+		}
+		next.ServeHTTP(response, request)
+	})
+}
+
+func isMutating(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+func getMaintenanceHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]bool{"enabled": maintenanceMode.Load()})
+}
+
+func putMaintenanceHandler(w http.ResponseWriter, r *http.Request) {
+	body := struct {
+		Enabled *bool `json:"enabled"`
+	}{}
+	err := json.NewDecoder(io.LimitReader(r.Body, 1000000)).Decode(&body)
+	if err != nil || body.Enabled == nil {
+		writeError(w, http.StatusBadRequest, `expected {"enabled": true|false}`)
+		return
+	}
+	maintenanceMode.Store(*body.Enabled)
+	log.Warnf("Maintenance mode: %v", *body.Enabled)
+	writeJSON(w, http.StatusOK, map[string]bool{"enabled": *body.Enabled})
+}
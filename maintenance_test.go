@@ -0,0 +1,69 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestMaintenanceMode(t *testing.T) {
+	testDir(t)
+	t.Cleanup(func() { maintenanceMode.Store(false) })
+	player := &recordingPlayer{}
+	useQueue(t, player, 8)
+	loadSchedule(t, time.Date(2024, 3, 4, 7, 0, 0, 0, time.UTC), mondayBells)
+	play := func() error {
+		t.Helper()
+		job := &playJob{Sound: "bell.mp3", Done: make(chan error, 1), skipDedup: true}
+		if err := enqueuePlay(job); err != nil {
+			t.Fatal(err)
+		}
+		return <-job.Done
+	}
+
+	rec := apiRequest(t, "PUT", "/api/v1/maintenance", `{"enabled": true}`)
+	if rec.Code != http.StatusOK || !maintenanceMode.Load() {
+		t.Fatalf("enable = %d %s, want maintenance mode on", rec.Code, rec.Body)
+	}
+
+	if err := play(); err == nil || player.count() != 0 {
+		t.Errorf("play in maintenance = %v, want it skipped", err)
+	}
+	mutations := []struct{ method, target, body string }{
+		{"POST", "/api/v1/reload", ""},
+		{"POST", "/api/v1/silence-until", `{"until": "2099-01-01T00:00:00Z"}`},
+		{"PUT", "/api/v1/schedules/term/days/MON/enabled", `{"enabled": false}`},
+	}
+	for _, m := range mutations {
+		if rec := apiRequest(t, m.method, m.target, m.body); rec.Code != http.StatusServiceUnavailable {
+			t.Errorf("%s %s in maintenance = %d, want 503", m.method, m.target, rec.Code)
+		}
+	}
+	if days := entriesOf("bell"); len(days) != 1 {
+		t.Error("a blocked change reached the schedule")
+	}
+	for _, target := range []string{"/api/v1/stats", "/api/v1/cron", "/api/v1/maintenance"} {
+		if rec := apiRequest(t, "GET", target, ""); rec.Code != http.StatusOK {
+			t.Errorf("GET %s in maintenance = %d, want 200", target, rec.Code)
+		}
+	}
+	if rec := apiRequest(t, "POST", "/api/v1/preview-schedule", mondayBells); rec.Code == http.StatusServiceUnavailable {
+		t.Error("preview refused in maintenance, it changes nothing")
+	}
+	state := &health{}
+	decodeBody(t, apiRequest(t, "GET", "/api/v1/healthz", ""), state)
+	if state.Status != "maintenance" || !state.Maintenance {
+		t.Errorf("healthz = %+v, want maintenance", state)
+	}
+
+	rec = apiRequest(t, "PUT", "/api/v1/maintenance", `{"enabled": false}`)
+	if rec.Code != http.StatusOK || maintenanceMode.Load() {
+		t.Fatalf("disable = %d %s, want maintenance mode off", rec.Code, rec.Body)
+	}
+	if err := play(); err != nil || player.count() != 1 {
+		t.Errorf("play after maintenance = %v, want played", err)
+	}
+	if rec := apiRequest(t, "POST", "/api/v1/reload", ""); rec.Code != http.StatusOK {
+		t.Errorf("reload after maintenance = %d, want 200", rec.Code)
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+)
+
+const frameSize = numOfChannels * audioBitDepth
+
+// durationFrames is how many frames ms milliseconds last at rate.
+func durationFrames(rate, ms int) int {
+	return rate * ms / 1000
+}
+
+// crossfadeClips joins the clips, 16 bit stereo PCM, overlapping each pair by
+// up to overlapFrames: the outgoing clip ramps down while the next one ramps
+// up.
+func crossfadeClips(clips []io.Reader, overlapFrames int) ([]byte, error) {
+	var out []byte
+	for i, clip := range clips {
+		pcm, err := io.ReadAll(clip)
+		if err != nil {
+			return nil, err
+		}
+		pcm = pcm[:len(pcm)/frameSize*frameSize]
+		if i == 0 {
+			out = pcm
+			continue
+		}
+
+		n := overlapFrames * frameSize
+		if n > len(out) {
+			n = len(out) / frameSize * frameSize
+		}
+		if n > len(pcm) {
+			n = len(pcm)
+		}
+		tail := out[len(out)-n:]
+		frames := n / frameSize
+		for f := 0; f < frames; f++ {
+			t := float64(f+1) / float64(frames+1)
+			for c := 0; c < numOfChannels; c++ {
+				j := f*frameSize + c*audioBitDepth
+				a := float64(int16(binary.LittleEndian.Uint16(tail[j:])))
+				b := float64(int16(binary.LittleEndian.Uint16(pcm[j:])))
+				binary.LittleEndian.PutUint16(tail[j:], uint16(clampSample(a*(1-t)+b*t)))
+			}
+		}
+		out = append(out, pcm[n:]...)
+	}
+	return out, nil
+}
+
+func clampSample(v float64) int16 {
+	return int16(math.Max(math.Min(v, math.MaxInt16), math.MinInt16))
+}
+
+// mixReader sums its clips, 16 bit stereo PCM, sample by sample into one
+// stream as long as the longest, clamping what would overflow. While a
+// foreground clip plays, the background ones are ducked: their gain fades to
+// duck over fadeFrames, and back up once the foreground is done.
+type mixReader struct {
+	foreground []io.Reader
+	background []io.Reader
+	duck       float64
+	fadeFrames int
+	// gain is the background gain reached so far.
+	gain  float64
+	buf   []byte
+	sums  []float64
+	gains []float64
+}
+
+func newMixReader(clips []io.Reader) io.Reader {
+	return &mixReader{background: clips, duck: 1, gain: 1}
+}
+
+// newDuckingMixReader mixes foreground over background, which plays at duck
+// gain while foreground does.
+func newDuckingMixReader(foreground, background []io.Reader, duck float64, fadeFrames int) io.Reader {
+	return &mixReader{foreground: foreground, background: background, duck: duck, fadeFrames: fadeFrames, gain: 1}
+}
+
+func (m *mixReader) Read(p []byte) (int, error) {
+	n := len(p) / frameSize * frameSize
+	if n == 0 {
+		return 0, io.ErrShortBuffer
+	}
+	if len(m.buf) < n {
+		m.buf = make([]byte, n)
+		m.sums = make([]float64, n/audioBitDepth)
+		m.gains = make([]float64, n/frameSize)
+	}
+	sums := m.sums[:n/audioBitDepth]
+	for i := range sums {
+		sums[i] = 0
+	}
+	var fgLongest, bgLongest int
+	var err error
+	m.foreground, fgLongest, err = m.add(m.foreground, n, nil)
+	if err != nil {
+		return 0, err
+	}
+	m.background, bgLongest, err = m.add(m.background, n, m.backgroundGains(n/frameSize, fgLongest/frameSize))
+	if err != nil {
+		return 0, err
+	}
+	longest := max(fgLongest, bgLongest)
+	if longest == 0 {
+		return 0, io.EOF
+	}
+	for i, v := range sums[:longest/audioBitDepth] {
+		binary.LittleEndian.PutUint16(p[i*audioBitDepth:], uint16(clampSample(v)))
+	}
+	return longest, nil
+}
+
+// add reads up to n bytes of each clip into the sums, by gains per frame
+// when set, and returns the clips that aren't finished and the most read.
+func (m *mixReader) add(clips []io.Reader, n int, gains []float64) ([]io.Reader, int, error) {
+	longest := 0
+	playing := clips[:0]
+	for _, clip := range clips {
+		got, err := io.ReadFull(clip, m.buf[:n])
+		got = got / audioBitDepth * audioBitDepth
+		for i := 0; i < got/audioBitDepth; i++ {
+			v := float64(int16(binary.LittleEndian.Uint16(m.buf[i*audioBitDepth:])))
+			if gains != nil {
+				v *= gains[i/numOfChannels]
+			}
+			m.sums[i] += v
+		}
+		if got > longest {
+			longest = got
+		}
+		switch err {
+		case nil:
+			playing = append(playing, clip)
+		case io.EOF, io.ErrUnexpectedEOF:
+		default:
+			return nil, 0, err
+		}
+	}
+	return playing, longest, nil
+}
+
+// backgroundGains is the background gain of each of the next frames, the
+// first ducked of them under the foreground, or nil without ducking.
+func (m *mixReader) backgroundGains(frames, ducked int) []float64 {
+	if m.duck == 1 {
+		return nil
+	}
+	step := (1 - m.duck) / float64(max(m.fadeFrames, 1))
+	gains := m.gains[:frames]
+	for f := range gains {
+		if f < ducked {
+			m.gain = math.Max(m.gain-step, m.duck)
+		} else {
+			m.gain = math.Min(m.gain+step, 1)
+		}
+		gains[f] = m.gain
+	}
+	return gains
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"reflect"
+	"testing"
+)
+
+// constantPCM is frames of 16 bit stereo PCM holding value on both channels.
+func constantPCM(frames int, value int16) []byte {
+	pcm := make([]byte, frames*frameSize)
+	for j := 0; j < len(pcm); j += audioBitDepth {
+		binary.LittleEndian.PutUint16(pcm[j:], uint16(value))
+	}
+	return pcm
+}
+
+// frameSamples are the left channel samples of pcm.
+func frameSamples(pcm []byte) []int16 {
+	samples := []int16{}
+	for j := 0; j+frameSize <= len(pcm); j += frameSize {
+		samples = append(samples, int16(binary.LittleEndian.Uint16(pcm[j:])))
+	}
+	return samples
+}
+
+func TestCrossfadeClips(t *testing.T) {
+	out, err := crossfadeClips([]io.Reader{
+		bytes.NewReader(constantPCM(10, 1000)),
+		bytes.NewReader(constantPCM(10, 5000)),
+	}, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	samples := frameSamples(out)
+	if len(samples) != 16 {
+		t.Fatalf("%d frames, want 16 with 4 overlapping", len(samples))
+	}
+	for f, s := range samples {
+		switch {
+		case f < 6 && s != 1000:
+			t.Errorf("frame %d = %d, want the first clip", f, s)
+		case f >= 10 && s != 5000:
+			t.Errorf("frame %d = %d, want the second clip", f, s)
+		case f >= 6 && f < 10:
+			// both clips are in the overlap, the second one rising
+			if s <= 1000 || s >= 5000 || s <= samples[f-1] {
+				t.Errorf("overlap frame %d = %d after %d, want a rising mix of both", f, s, samples[f-1])
+			}
+		}
+	}
+	if samples[6] != 1800 || samples[9] != 4200 {
+		t.Errorf("overlap = %v, want 1800 to 4200", samples[6:10])
+	}
+
+	// an overlap longer than a clip is cut to it
+	out, err = crossfadeClips([]io.Reader{
+		bytes.NewReader(constantPCM(3, 1000)),
+		bytes.NewReader(constantPCM(10, 1000)),
+	}, 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != 10*frameSize {
+		t.Errorf("%d frames, want 10", len(out)/frameSize)
+	}
+}
+
+func TestPlaylistCrossfade(t *testing.T) {
+	testDir(t)
+	read := func(job *playJob) []byte {
+		t.Helper()
+		pcm, _, err := jobPCM(job)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(pcm)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+	once := read(&playJob{Sound: "bell.mp3"})
+	sequential := read(&playJob{Sound: "bell.mp3", Playlist: []string{"bell.mp3"}})
+	faded := read(&playJob{Sound: "bell.mp3", Playlist: []string{"bell.mp3"}, CrossfadeMs: 500})
+	if len(sequential) != 2*len(once) {
+		t.Errorf("playlist is %d bytes, want %d", len(sequential), 2*len(once))
+	}
+	if want := 2*len(once) - durationFrames(48000, 500)*frameSize; len(faded) != want {
+		t.Errorf("crossfaded playlist is %d bytes, want %d", len(faded), want)
+	}
+}
+
+// stereoPCM is 16 bit stereo PCM holding samples on both channels.
+func stereoPCM(samples ...int16) []byte {
+	pcm := []byte{}
+	for _, s := range samples {
+		pcm = append(pcm, constantPCM(1, s)...)
+	}
+	return pcm
+}
+
+func TestMixReader(t *testing.T) {
+	mix := newMixReader([]io.Reader{
+		bytes.NewReader(stereoPCM(1000, -2000, 30000, -30000, 5)),
+		bytes.NewReader(stereoPCM(500, 500, 10000, -10000)),
+	})
+	// read a couple of frames at a time, as a backend might
+	out := []byte{}
+	buf := make([]byte, 2*frameSize)
+	for {
+		n, err := mix.Read(buf)
+		out = append(out, buf[:n]...)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := []int16{1500, -1500, 32767, -32768, 5}
+	if got := frameSamples(out); !reflect.DeepEqual(got, want) {
+		t.Errorf("mix = %v, want %v, summed and clipped as long as the longest", got, want)
+	}
+	if !bytes.Equal(out, stereoPCM(want...)) {
+		t.Errorf("right channel differs from the left in %v", out)
+	}
+	if _, err := mix.Read(make([]byte, 1)); err != io.ErrShortBuffer {
+		t.Errorf("read under a frame = %v, want io.ErrShortBuffer", err)
+	}
+}
+
+func TestMixedPlayback(t *testing.T) {
+	tests := []struct {
+		overlap string
+		want    [][]int16
+	}{
+		{"mix", [][]int16{{3000, 3000, 1000, 1000}}},
+		{"serialize", [][]int16{{1000, 1000, 1000, 1000}, {2000, 2000}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.overlap, func(t *testing.T) {
+			setConfig(t, "audio.overlap", tt.overlap)
+			setConfig(t, "audio.mix-window-ms", 50)
+			player := &recordingPlayer{}
+			useQueue(t, player, 4)
+			jobs := []*playJob{
+				{Sound: "chime", PCM: constantPCM(4, 1000), Done: make(chan error, 1)},
+				{Sound: "cue", PCM: constantPCM(2, 2000), Done: make(chan error, 1)},
+			}
+			for _, job := range jobs {
+				if err := enqueuePlay(job); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for _, job := range jobs {
+				if err := <-job.Done; err != nil {
+					t.Errorf("%s: %v", job.Sound, err)
+				}
+			}
+			player.mu.Lock()
+			defer player.mu.Unlock()
+			got := [][]int16{}
+			for _, pcm := range player.played {
+				got = append(got, frameSamples(pcm))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("played %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDuckingMix(t *testing.T) {
+	// the background ducks to half over 4 frames while the 10 frame
+	// announcement speaks, then comes back up over 4 more
+	want := []int16{8850, 7600, 6350, 5100, 5100, 5100, 5100, 5100, 5100, 5100, 6250, 7500, 8750, 10000, 10000, 10000}
+	for _, chunk := range []int{64, 3} {
+		mix := newDuckingMixReader(
+			[]io.Reader{bytes.NewReader(constantPCM(10, 100))},
+			[]io.Reader{bytes.NewReader(constantPCM(16, 10000))},
+			0.5, 4)
+		out := []byte{}
+		buf := make([]byte, chunk*frameSize)
+		for {
+			n, err := mix.Read(buf)
+			out = append(out, buf[:n]...)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		if got := frameSamples(out); !reflect.DeepEqual(got, want) {
+			t.Errorf("read %d frames at a time: mix = %v, want %v", chunk, got, want)
+		}
+	}
+
+	// without an announcement nothing ducks
+	mix := newDuckingMixReader(nil, []io.Reader{bytes.NewReader(constantPCM(4, 10000))}, 0.5, 4)
+	out, err := io.ReadAll(mix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := frameSamples(out); !reflect.DeepEqual(got, []int16{10000, 10000, 10000, 10000}) {
+		t.Errorf("mix without an announcement = %v, want the background as is", got)
+	}
+}
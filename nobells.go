@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// noBellsNotified is the last day reported as having no bells, so a reload
+// later that day doesn't report it again. Guarded by scheduleMu.
+var noBellsNotified string
+
+// bellsOn counts the bell entries that fire on the day starting at midnight.
+// Callers must hold scheduleMu.
+func bellsOn(midnight time.Time) int {
+	next := midnight.AddDate(0, 0, 1)
+	count := 0
+	for id, info := range entryMeta {
+		if info.Kind != "bell" {
+			continue
+		}
+		fires := cronService.Entry(id).Schedule.Next(midnight.Add(-time.Nanosecond))
+		if !fires.IsZero() && fires.Before(next) {
+			count++
+		}
+	}
+	return count
+}
+
+// checkBellsToday confirms a day without bells, a holiday or a weekend, is
+// intended: it's logged and, with notifications.no-bells, sent to the
+// notification channels. Callers must hold scheduleMu.
+func checkBellsToday(now time.Time) {
+	now = now.In(globalLocation())
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	date := midnight.Format("2006-01-02")
+	if bellsOn(midnight) > 0 || noBellsNotified == date {
+		return
+	}
+	noBellsNotified = date
+	message := fmt.Sprintf("No bells scheduled for %s", date)
+	log.Info(message)
+	if viper.GetBool("notifications.no-bells") {
+		go dispatchNotification(&notification{
+			Event:   "no-bells",
+			Message: message,
+			At:      now,
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestNoBellsToday(t *testing.T) {
+	testDir(t)
+	setConfig(t, "notifications.no-bells", true)
+	channel := &stubNotifier{name: "ok"}
+	useNotifiers(t, channel)
+	t.Cleanup(func() { noBellsNotified = "" })
+	buf := captureLog(t)
+
+	// a Monday with bells isn't reported
+	clock := loadSchedule(t, time.Date(2024, 3, 4, 0, 0, 5, 0, time.UTC), mondayBells)
+	if got := logEntries(t, buf, "No bells scheduled for 2024-03-04"); len(got) != 0 {
+		t.Error("a day with bells reported as having none")
+	}
+
+	// the Saturday after is, once however many times it's reloaded
+	clock.Set(time.Date(2024, 3, 9, 0, 0, 5, 0, time.UTC))
+	for i := 0; i < 2; i++ {
+		if err := reloadSchedule(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := logEntries(t, buf, "No bells scheduled for 2024-03-09"); len(got) != 1 || got[0]["level"] != "info" {
+		t.Errorf("notices = %v, want one at info", got)
+	}
+	waitFor(t, "the notification", func() bool { return len(channel.sent()) == 1 })
+	if n := channel.sent()[0]; n.Event != "no-bells" || n.Message != "No bells scheduled for 2024-03-09" {
+		t.Errorf("notification = %+v, want the no bells notice", n)
+	}
+}
+
+func TestNoBellsNotificationOff(t *testing.T) {
+	testDir(t)
+	channel := &stubNotifier{name: "ok"}
+	useNotifiers(t, channel)
+	t.Cleanup(func() { noBellsNotified = "" })
+	buf := captureLog(t)
+	loadSchedule(t, time.Date(2024, 3, 9, 0, 0, 5, 0, time.UTC), mondayBells)
+	if got := logEntries(t, buf, "No bells scheduled for 2024-03-09"); len(got) != 1 {
+		t.Errorf("notices = %v, want one logged", got)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if sent := channel.sent(); len(sent) != 0 {
+		t.Errorf("sent %+v without notifications.no-bells", sent)
+	}
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// notification is sent to every configured channel when a bell rings, and
+// for the events that operators want to hear about, like a day without bells.
+type notification struct {
+	Event    string    `json:"event"`
+	Schedule string    `json:"schedule,omitempty"`
+	Day      string    `json:"day,omitempty"`
+	Time     string    `json:"time,omitempty"`
+	Sound    string    `json:"sound,omitempty"`
+	Label    string    `json:"label,omitempty"`
+	Message  string    `json:"message,omitempty"`
+	At       time.Time `json:"at"`
+	Test     bool      `json:"test,omitempty"`
+}
+
+// notifier is a notification channel.
+type notifier interface {
+	Name() string
+	Notify(ctx context.Context, n *notification) error
+}
+
+type deliveryResult struct {
+	Channel   string `json:"channel"`
+	Success   bool   `json:"success"`
+	Error     string `json:"error,omitempty"`
+	LatencyMs int64  `json:"latencyMs"`
+}
+
+var (
+	notifiers   []notifier
+	notifiersMu sync.RWMutex
+)
+
+type webhookConfig struct {
+	Name      string `mapstructure:"name"`
+	URL       string `mapstructure:"url"`
+	TimeoutMs int    `mapstructure:"timeout-ms"`
+}
+
+// timeoutNotifier is a channel with its own delivery timeout, overriding
+// notifications.timeout-ms when non zero.
+type timeoutNotifier interface {
+	Timeout() time.Duration
+}
+
+// notifySlots bounds how many deliveries run at once across dispatches, see
+// notifications.concurrency.
+var notifySlots chan struct{}
+
+// channelConfigs reads the list of channels under key, dropping those
+// without a url and naming the unnamed ones after kind.
+func channelConfigs(key, kind string) []*webhookConfig {
+	channels := []*webhookConfig{}
+	err := viper.UnmarshalKey(key, &channels)
+	if err != nil {
+		log.Errorf("Could not parse %s: %v", key, err)
+	}
+	valid := []*webhookConfig{}
+	for i, ch := range channels {
+		if ch.URL == "" {
+			log.Errorf("%s %d has no url", key, i)
+			continue
+		}
+		if ch.Name == "" {
+			ch.Name = fmt.Sprintf("%s-%d", kind, i)
+		}
+		valid = append(valid, ch)
+	}
+	return valid
+}
+
+// setupNotifiers builds the channels in notifications.*.
+func setupNotifiers() {
+	configured := []notifier{}
+	for _, wh := range channelConfigs("notifications.webhooks", "webhook") {
+		timeout := time.Duration(wh.TimeoutMs) * time.Millisecond
+		configured = append(configured, &webhookNotifier{name: wh.Name, url: wh.URL, client: http.DefaultClient, timeout: timeout})
+	}
+	for _, platform := range []string{"slack", "discord"} {
+		for _, ch := range channelConfigs("notifications."+platform, platform) {
+			timeout := time.Duration(ch.TimeoutMs) * time.Millisecond
+			configured = append(configured, &chatNotifier{platform: platform, name: ch.Name, url: ch.URL, client: http.DefaultClient, timeout: timeout})
+		}
+	}
+
+	concurrency := viper.GetInt("notifications.concurrency")
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	notifiersMu.Lock()
+	notifiers = configured
+	notifySlots = make(chan struct{}, concurrency)
+	notifiersMu.Unlock()
+}
+
+func notificationTimeout() time.Duration {
+	return time.Duration(viper.GetInt("notifications.timeout-ms")) * time.Millisecond
+}
+
+// dispatchNotification sends n to the event stream and to every channel at
+// once, at most notifications.concurrency deliveries running overall, and
+// reports how each went in channel order. A slow channel only holds up its own result.
+func dispatchNotification(n *notification) []*deliveryResult {
+	liveEvents.publish(n)
+	notifiersMu.RLock()
+	channels := notifiers
+	slots := notifySlots
+	notifiersMu.RUnlock()
+	if slots == nil {
+		slots = make(chan struct{}, 1)
+	}
+
+	results := make([]*deliveryResult, len(channels))
+	var wg sync.WaitGroup
+	for i, ch := range channels {
+		wg.Add(1)
+		go func(i int, ch notifier) {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+			results[i] = deliver(ch, n)
+		}(i, ch)
+	}
+	wg.Wait()
+	return results
+}
+
+// deliver sends n to ch within its timeout.
+func deliver(ch notifier, n *notification) *deliveryResult {
+	timeout := notificationTimeout()
+	if t, ok := ch.(timeoutNotifier); ok && t.Timeout() > 0 {
+		timeout = t.Timeout()
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	start := time.Now()
+	err := ch.Notify(ctx, n)
+	result := &deliveryResult{
+		Channel:   ch.Name(),
+		Success:   err == nil,
+		LatencyMs: time.Since(start).Milliseconds(),
+	}
+	if err != nil {
+		log.Errorf("Could not notify %s: %v", ch.Name(), err)
+		result.Error = err.Error()
+	}
+	recordDelivery(result)
+	return result
+}
+
+// webhookNotifier posts the notification as JSON.
+type webhookNotifier struct {
+	name    string
+	url     string
+	client  *http.Client
+	timeout time.Duration
+}
+
+func (wh *webhookNotifier) Name() string {
+	return wh.name
+}
+
+func (wh *webhookNotifier) Timeout() time.Duration {
+	return wh.timeout
+}
+
+func (wh *webhookNotifier) Notify(ctx context.Context, n *notification) error {
+	body, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	return postJSON(ctx, wh.client, wh.url, body)
+}
+
+func postJSON(ctx context.Context, client *http.Client, url string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=UTF-8")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+	return nil
+}
+
+func postTestWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	results := dispatchNotification(&notification{
+		Event: "test",
+		At:    time.Now(),
+		Test:  true,
+	})
+	writeJSON(w, http.StatusOK, results)
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// stubNotifier records what it's sent and answers err.
+type stubNotifier struct {
+	name string
+	err  error
+	mu   sync.Mutex
+	got  []*notification
+}
+
+func (s *stubNotifier) Name() string {
+	return s.name
+}
+
+func (s *stubNotifier) Notify(ctx context.Context, n *notification) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.got = append(s.got, n)
+	return s.err
+}
+
+func (s *stubNotifier) sent() []*notification {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*notification{}, s.got...)
+}
+
+func useNotifiers(t *testing.T, channels ...notifier) {
+	t.Helper()
+	setConfig(t, "notifications.timeout-ms", 1000)
+	notifiersMu.Lock()
+	notifiers = channels
+	notifySlots = make(chan struct{}, len(channels))
+	notifiersMu.Unlock()
+	t.Cleanup(func() {
+		notifiersMu.Lock()
+		notifiers, notifySlots = nil, nil
+		notifiersMu.Unlock()
+	})
+}
+
+func TestTestWebhook(t *testing.T) {
+	ok := &stubNotifier{name: "ok"}
+	down := &stubNotifier{name: "down", err: errors.New("connection refused")}
+	useNotifiers(t, ok, down)
+
+	rec := apiRequest(t, "POST", "/api/v1/test-webhook", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	results := []*deliveryResult{}
+	decodeBody(t, rec, &results)
+	if len(results) != 2 {
+		t.Fatalf("results = %s, want one per channel", rec.Body)
+	}
+	if results[0].Channel != "ok" || !results[0].Success || results[0].Error != "" {
+		t.Errorf("ok result = %+v, want a success", results[0])
+	}
+	if results[1].Channel != "down" || results[1].Success || results[1].Error != "connection refused" {
+		t.Errorf("down result = %+v, want the failure", results[1])
+	}
+	for _, ch := range []*stubNotifier{ok, down} {
+		sent := ch.sent()
+		if len(sent) != 1 || !sent[0].Test || sent[0].Event != "test" {
+			t.Errorf("%s was sent %+v, want one test notification", ch.name, sent)
+		}
+	}
+}
+
+func TestNotifyOnlyAfterPlay(t *testing.T) {
+	testDir(t)
+	stub := &stubNotifier{name: "stub"}
+	useNotifiers(t, stub)
+	player := &recordingPlayer{gate: make(chan struct{})}
+	useQueue(t, player, 8)
+	clock := loadSchedule(t, time.Date(2024, 3, 4, 7, 0, 0, 0, time.UTC), mondayBells)
+
+	clock.Set(time.Date(2024, 3, 4, 8, 0, 0, 0, time.UTC))
+	runBell(t, "term", "08:00")
+	time.Sleep(50 * time.Millisecond)
+	if sent := stub.sent(); len(sent) != 0 {
+		t.Fatalf("notified %+v before the bell played", sent)
+	}
+	close(player.gate)
+	waitFor(t, "the notification", func() bool { return len(stub.sent()) == 1 })
+	n := stub.sent()[0]
+	if n.Schedule != "term" || n.Time != "08:00" || n.Sound != "bell.mp3" || n.Test {
+		t.Errorf("notification = %+v, want the term 08:00 bell", n)
+	}
+}
+
+func TestNotifySkippedBell(t *testing.T) {
+	stub := &stubNotifier{name: "stub"}
+	useNotifiers(t, stub)
+	job := &playJob{Sound: "bell.mp3", Done: make(chan error, 1)}
+	job.Done <- errQueueClosed
+	notifyPlayed(job, &notification{Event: "bell", Sound: "bell.mp3"})
+	if sent := stub.sent(); len(sent) != 0 {
+		t.Errorf("notified %+v for a bell that didn't play", sent)
+	}
+}
+
+// heldNotifier waits for release, or its timeout, and counts how many of
+// its kind are delivering at once.
+type heldNotifier struct {
+	name    string
+	timeout time.Duration
+	release chan struct{}
+	running *atomic.Int32
+	most    *atomic.Int32
+}
+
+func (h *heldNotifier) Name() string {
+	return h.name
+}
+
+func (h *heldNotifier) Timeout() time.Duration {
+	return h.timeout
+}
+
+func (h *heldNotifier) Notify(ctx context.Context, n *notification) error {
+	now := h.running.Add(1)
+	defer h.running.Add(-1)
+	for {
+		most := h.most.Load()
+		if now <= most || h.most.CompareAndSwap(most, now) {
+			break
+		}
+	}
+	select {
+	case <-h.release:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func heldNotifiers(n int) ([]notifier, chan struct{}, *atomic.Int32, *atomic.Int32) {
+	release := make(chan struct{})
+	running, most := &atomic.Int32{}, &atomic.Int32{}
+	channels := []notifier{}
+	for i := 0; i < n; i++ {
+		channels = append(channels, &heldNotifier{name: fmt.Sprintf("held-%d", i), release: release, running: running, most: most})
+	}
+	return channels, release, running, most
+}
+
+func TestDispatchConcurrent(t *testing.T) {
+	channels, release, running, most := heldNotifiers(3)
+	useNotifiers(t, channels...)
+	done := make(chan []*deliveryResult)
+	go func() { done <- dispatchNotification(&notification{Event: "bell"}) }()
+	waitFor(t, "every channel to be notified at once", func() bool { return running.Load() == 3 })
+	close(release)
+	results := <-done
+	for i, r := range results {
+		if r.Channel != fmt.Sprintf("held-%d", i) || !r.Success {
+			t.Errorf("result %d = %+v, want held-%d delivered", i, r, i)
+		}
+	}
+	if most.Load() != 3 {
+		t.Errorf("at most %d deliveries ran at once, want 3", most.Load())
+	}
+}
+
+func TestDispatchBounded(t *testing.T) {
+	channels, release, running, most := heldNotifiers(3)
+	close(release)
+	useNotifiers(t, channels...)
+	notifiersMu.Lock()
+	notifySlots = make(chan struct{}, 1)
+	notifiersMu.Unlock()
+	for _, r := range dispatchNotification(&notification{Event: "bell"}) {
+		if !r.Success {
+			t.Errorf("result = %+v, want delivered", r)
+		}
+	}
+	if most.Load() != 1 || running.Load() != 0 {
+		t.Errorf("at most %d deliveries ran at once, want 1 for notifications.concurrency 1", most.Load())
+	}
+}
+
+func TestSlowChannel(t *testing.T) {
+	slow, _, _, _ := heldNotifiers(1)
+	slow[0].(*heldNotifier).timeout = 100 * time.Millisecond
+	fast := &stubNotifier{name: "fast"}
+	useNotifiers(t, slow[0], fast)
+
+	start := time.Now()
+	results := dispatchNotification(&notification{Event: "bell"})
+	if took := time.Since(start); took > time.Second {
+		t.Errorf("dispatch took %s, want the slow channel's 100ms timeout", took)
+	}
+	if results[0].Success || results[0].Error != context.DeadlineExceeded.Error() {
+		t.Errorf("slow result = %+v, want it timed out", results[0])
+	}
+	if !results[1].Success || results[1].LatencyMs >= 100 {
+		t.Errorf("fast result = %+v, want it delivered without waiting for the slow one", results[1])
+	}
+}
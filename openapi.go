@@ -0,0 +1,51 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+)
+
+// openAPISpec describes the API. checkOpenAPI flags routes it's missing.
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
+func getOpenAPIHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.Write(openAPISpec)
+}
+
+// checkOpenAPI warns about every route of r not documented in openAPISpec,
+// so the spec doesn't drift from the handlers.
+func checkOpenAPI(r *mux.Router) {
+	spec := struct {
+		Paths map[string]map[string]interface{} `json:"paths"`
+	}{}
+	err := json.Unmarshal(openAPISpec, &spec)
+	if err != nil {
+		log.Errorf("Could not parse openapi.json: %v", err)
+		return
+	}
+	r.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		path, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		// the web UI catch-all has no methods
+		methods, err := route.GetMethods()
+		if err != nil {
+			return nil
+		}
+		for _, method := range methods {
+			if _, ok := spec.Paths[path][strings.ToLower(method)]; !ok {
+				log.Warnf("Route missing from openapi.json: %s %s", method, path)
+			}
+		}
+		return nil
+	})
+}
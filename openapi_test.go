@@ -0,0 +1,40 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestOpenAPI(t *testing.T) {
+	rec := apiRequest(t, "GET", "/api/v1/openapi.json", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+	spec := struct {
+		OpenAPI string                            `json:"openapi"`
+		Paths   map[string]map[string]interface{} `json:"paths"`
+	}{}
+	decodeBody(t, rec, &spec)
+	if !strings.HasPrefix(spec.OpenAPI, "3.") {
+		t.Errorf("openapi = %q, want 3.x", spec.OpenAPI)
+	}
+	for path, method := range map[string]string{
+		"/api/v1/schedules":     "get",
+		"/api/v1/play":          "post",
+		"/api/v1/weekday/{day}": "get",
+		"/api/v1/rehearse":      "delete",
+	} {
+		if _, ok := spec.Paths[path][method]; !ok {
+			t.Errorf("spec is missing %s %s", method, path)
+		}
+	}
+}
+
+func TestOpenAPICoversRoutes(t *testing.T) {
+	buf := captureLog(t)
+	newRouter()
+	if strings.Contains(buf.String(), "Route missing from openapi.json") {
+		t.Errorf("routes missing from the spec:\n%s", buf)
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// postPlayHandler queues a sound now. During quiet hours it answers 403
+// unless override=true is passed.
+func postPlayHandler(w http.ResponseWriter, r *http.Request) {
+	if inQuietHours(appClock.Now()) {
+		if r.URL.Query().Get("override") != "true" {
+			writeError(w, http.StatusForbidden, "quiet hours, pass override=true to play anyway")
+			return
+		}
+		log.Warnf("Manual play during quiet hours overridden by %s", getIPAddress(r))
+	}
+	job := &playJob{}
+	err := json.NewDecoder(io.LimitReader(r.Body, 1000000)).Decode(job)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "could not parse body: "+err.Error())
+		return
+	}
+	for _, sound := range append([]string{job.Sound}, job.Playlist...) {
+		soundPath, err := resolveSoundPath(soundsDir(), sound)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		_, err = os.Stat(soundPath)
+		if err != nil {
+			writeError(w, http.StatusNotFound, "sound not found: "+sound)
+			return
+		}
+	}
+	_, err = resolveZone(job.Zone)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if job.Repeat < 0 || job.Repeat > maxRepeat || job.RepeatGapMs < 0 || job.CrossfadeMs < 0 {
+		writeError(w, http.StatusBadRequest, "invalid repeat or crossfade")
+		return
+	}
+	if hasSegment(job.StartMs, job.EndMs) {
+		err = checkSegment(soundsDir(), job.Sound, nil, job.StartMs, job.EndMs)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	err = enqueuePlay(job)
+	if errors.Is(err, errDuplicate) {
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		log.Errorf("Could not queue sound: %s : %v", job.Sound, err)
+		writeError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusAccepted, job)
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxPreviewFires caps how many fire times a preview returns.
+const maxPreviewFires = 1000
+
+type previewFire struct {
+	At       time.Time `json:"at"`
+	Schedule string    `json:"schedule"`
+	Day      string    `json:"day"`
+	Time     string    `json:"time,omitempty"`
+	Cron     string    `json:"cron,omitempty"`
+	Sound    string    `json:"sound"`
+	Label    string    `json:"label,omitempty"`
+}
+
+type preview struct {
+	Active   []string       `json:"active"`
+	Fires    []*previewFire `json:"fires"`
+	Warnings []string       `json:"warnings"`
+	Errors   []string       `json:"errors"`
+}
+
+// postPreviewScheduleHandler validates a candidate schedule document, read
+// like an import so schedule.jsonc holds, and answers what it would ring over
+// the next days (7 by default, at most 31), without touching cron or the
+// schedule file. Pinning is ignored.
+func postPreviewScheduleHandler(w http.ResponseWriter, r *http.Request) {
+	days := 7
+	if value := r.URL.Query().Get("days"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > 31 {
+			writeError(w, http.StatusBadRequest, "days must be between 1 and 31")
+			return
+		}
+		days = n
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxRemoteSchedule))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "could not read body")
+		return
+	}
+	body = scheduleJSON(body)
+	err = validateScheduleJSON(body)
+	if err != nil {
+		var invalid *validationError
+		if errors.As(err, &invalid) {
+			writeJSON(w, http.StatusUnprocessableEntity, map[string]interface{}{
+				"error":      "schedule is invalid",
+				"violations": invalid.Violations,
+			})
+			return
+		}
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	data := []*schedule{}
+	err = json.Unmarshal(body, &data)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	now := appClock.Now()
+	writeJSON(w, http.StatusOK, previewSchedules(data, now, now.AddDate(0, 0, days)))
+}
+
+// previewSchedules picks the schedules active at now, as parseSchedule
+// would, and lists their bells up to until.
+func previewSchedules(data []*schedule, now, until time.Time) *preview {
+	result := &preview{Active: []string{}, Fires: []*previewFire{}, Warnings: []string{}, Errors: []string{}}
+	data, problems := expandPrograms(data)
+	for _, p := range problems {
+		result.Errors = append(result.Errors, fmt.Sprintf("Schedule %s: %s", p.Schedule, p.Message))
+	}
+	var fallback *schedule
+	for _, sch := range data {
+		if sch.Default {
+			if fallback != nil {
+				result.Warnings = append(result.Warnings, fmt.Sprintf("Multiple default schedules, ignoring: %s (using %s)", sch.Name, fallback.Name))
+				continue
+			}
+			fallback = sch
+			continue
+		}
+		starts, ends, _, err := scheduleWindow(sch, now)
+		if err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("Schedule %s: %v", sch.Name, err))
+			continue
+		}
+		if now.Before(starts) || now.After(ends) {
+			continue
+		}
+		previewBells(result, sch, now, minTime(until, ends))
+	}
+	if len(result.Active) == 0 && fallback != nil {
+		previewBells(result, fallback, now, until)
+	}
+
+	sort.SliceStable(result.Fires, func(i, j int) bool {
+		return result.Fires[i].At.Before(result.Fires[j].At)
+	})
+	for i := 1; i < len(result.Fires); i++ {
+		previous, fire := result.Fires[i-1], result.Fires[i]
+		if fire.At.Equal(previous.At) {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("Bells at the same time on %s: %s %s and %s %s",
+				fire.At.Format(time.RFC3339), previous.Schedule, previous.Sound, fire.Schedule, fire.Sound))
+		}
+	}
+	if len(result.Fires) > maxPreviewFires {
+		result.Warnings = append(result.Warnings, fmt.Sprintf("Only the first %d bells are listed", maxPreviewFires))
+		result.Fires = result.Fires[:maxPreviewFires]
+	}
+	return result
+}
+
+// previewBells checks sch's enabled events and adds their fire times from
+// now to until to result.
+func previewBells(result *preview, sch *schedule, now, until time.Time) {
+	result.Active = append(result.Active, sch.Name)
+	dir, err := sch.soundsDir()
+	if err != nil {
+		result.Errors = append(result.Errors, fmt.Sprintf("Schedule %s: %v", sch.Name, err))
+		return
+	}
+	sounds, _ := themeSounds(currentTheme().Active)
+	fires := 0
+	for _, d := range sch.Days {
+		if !d.isEnabled() {
+			continue
+		}
+		dayName := strings.ToUpper(d.Name[0:3])
+		for _, evt := range d.Events {
+			evt, defaulted, err := withDefaultSound(evt, d.DefaultSound)
+			if defaulted {
+				result.Warnings = append(result.Warnings, fmt.Sprintf("Schedule %s: %s %s has no sound, using audio.default-sound %s", sch.Name, d.Name, evt.Time, evt.Sound))
+			}
+			evt = withTheme(evt, sounds)
+			evtDir := dir
+			if err == nil {
+				evtDir, err = eventSoundsDir(dir, evt)
+			}
+			if err == nil {
+				_, err = checkEvent(evtDir, evt)
+			}
+			if err == nil {
+				err = checkSoundFiles(evtDir, evt)
+			}
+			if err != nil {
+				result.Errors = append(result.Errors, fmt.Sprintf("Schedule %s: %s %s: %v", sch.Name, d.Name, evt.Time, err))
+				continue
+			}
+			spec, err := eventSpec(sch, dayName, evt, now)
+			if err != nil {
+				result.Errors = append(result.Errors, fmt.Sprintf("Schedule %s: %s %s: %v", sch.Name, d.Name, evt.Time, err))
+				continue
+			}
+			parsed, err := cronParser.Parse(spec)
+			if err != nil {
+				result.Errors = append(result.Errors, fmt.Sprintf("Schedule %s: %s %s: %v", sch.Name, d.Name, evt.Time, err))
+				continue
+			}
+			// Next is strictly after its argument, a bell right at now counts
+			for at := parsed.Next(now.Add(-time.Nanosecond)); !at.IsZero() && !at.After(until); at = parsed.Next(at) {
+				result.Fires = append(result.Fires, &previewFire{
+					At:       at,
+					Schedule: sch.Name,
+					Day:      d.Name,
+					Time:     evt.Time,
+					Cron:     evt.Cron,
+					Sound:    evt.Sound,
+					Label:    evt.Label,
+				})
+				fires++
+				if fires > maxPreviewFires {
+					break
+				}
+			}
+		}
+	}
+	if fires == 0 && until.After(now) {
+		result.Warnings = append(result.Warnings, fmt.Sprintf("Schedule %s rings no bells before %s", sch.Name, until.Format(time.RFC3339)))
+	}
+}
+
+// checkSoundFiles reports sounds of evt missing from dir.
+func checkSoundFiles(dir string, evt *event) error {
+	if evt.Relay == relayOnly {
+		return nil
+	}
+	sounds := evt.Playlist
+	if evt.SoundData == "" {
+		sounds = append([]string{evt.Sound}, sounds...)
+	}
+	for _, sound := range sounds {
+		err := checkSoundFile(dir, sound)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkSoundFile reports whether sound is missing from dir.
+func checkSoundFile(dir, sound string) error {
+	soundPath, err := resolveSoundPath(dir, sound)
+	if err != nil {
+		return err
+	}
+	_, err = os.Stat(soundPath)
+	if err != nil {
+		return fmt.Errorf("sound not found: %s", sound)
+	}
+	return nil
+}
+
+func minTime(a, b time.Time) time.Time {
+	if b.Before(a) {
+		return b
+	}
+	return a
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPreviewSchedule(t *testing.T) {
+	testDir(t)
+	setConfig(t, "schedule.jsonc", true)
+	loadSchedule(t, time.Date(2024, 3, 4, 7, 0, 0, 0, time.UTC), mondayBells)
+	candidate := `[
+		// the trial timetable
+		{"name": "trial", "starts": "2024-01-01", "ends": "2024-12-31", "days": [
+			{"name": "Monday", "events": [
+				{"time": "09:00", "sound": "bell.mp3"}, /* twice on purpose */
+				{"time": "09:00", "sound": "bell.mp3", "label": "again"},
+				{"time": "10:00", "sound": "missing.mp3"}
+			]},
+			{"name": "Wednesday", "events": [{"time": "10:00", "sound": "bell.mp3"}]},
+		]},
+		{"name": "summer", "starts": "2024-06-01", "ends": "2024-08-31", "days": []}
+	]`
+
+	rec := apiRequest(t, "POST", "/api/v1/preview-schedule?days=7", candidate)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("preview = %d %s, want 200", rec.Code, rec.Body)
+	}
+	result := &preview{}
+	decodeBody(t, rec, result)
+	if len(result.Active) != 1 || result.Active[0] != "trial" {
+		t.Errorf("active = %v, want trial", result.Active)
+	}
+	// the next Monday is past the 7 days, they end at 07:00
+	want := []time.Time{
+		time.Date(2024, 3, 4, 9, 0, 0, 0, time.UTC),
+		time.Date(2024, 3, 4, 9, 0, 0, 0, time.UTC),
+		time.Date(2024, 3, 6, 10, 0, 0, 0, time.UTC),
+	}
+	if len(result.Fires) != len(want) {
+		t.Fatalf("fires = %s, want %d", rec.Body, len(want))
+	}
+	for i, fire := range result.Fires {
+		if !fire.At.Equal(want[i]) || fire.Schedule != "trial" {
+			t.Errorf("fire %d = %+v, want trial at %s", i, fire, want[i])
+		}
+	}
+	if len(result.Errors) != 1 || !strings.Contains(result.Errors[0], "sound not found: missing.mp3") {
+		t.Errorf("errors = %q, want the missing sound", result.Errors)
+	}
+	if len(result.Warnings) != 1 || !strings.HasPrefix(result.Warnings[0], "Bells at the same time on 2024-03-04T09:00:00Z") {
+		t.Errorf("warnings = %q, want the clash", result.Warnings)
+	}
+
+	if bells := entriesOf("bell"); len(bells) != 1 || bells[0].Schedule != "term" {
+		t.Errorf("bells = %v, the preview changed the running schedule", bells)
+	}
+	if saved, _ := os.ReadFile(scheduleFile); string(saved) != mondayBells {
+		t.Error("the preview changed the schedule file")
+	}
+
+	setConfig(t, "schedule.jsonc", false)
+	if rec := apiRequest(t, "POST", "/api/v1/preview-schedule", candidate); rec.Code != http.StatusBadRequest {
+		t.Errorf("preview with comments and schedule.jsonc off = %d, want 400", rec.Code)
+	}
+}
+
+func TestPreviewInvalidSchedule(t *testing.T) {
+	testDir(t)
+	useClock(t, time.Date(2024, 3, 4, 7, 0, 0, 0, time.UTC))
+	tests := []struct {
+		name, target, body string
+		code               int
+		contains           string
+	}{
+		{"schema violation", "/api/v1/preview-schedule", `[{"name": "trial", "days": [{"name": "Monday", "events": [{"time": "9am"}]}]}]`, http.StatusUnprocessableEntity, `schedules[0].days[0].events[0].time: \"9am\" does not match`},
+		{"not json", "/api/v1/preview-schedule", `[{"name": `, http.StatusBadRequest, "unexpected end of JSON input"},
+		{"too many days", "/api/v1/preview-schedule?days=40", mondayBells, http.StatusBadRequest, "days must be between 1 and 31"},
+		{"bad window", "/api/v1/preview-schedule", `[{"name": "trial", "starts": "2024-13-01", "days": []}]`, http.StatusOK, "could not parse start date: 2024-13-01"},
+	}
+	for _, tt := range tests {
+		rec := apiRequest(t, "POST", tt.target, tt.body)
+		if rec.Code != tt.code || !strings.Contains(rec.Body.String(), tt.contains) {
+			t.Errorf("%s: preview = %d %s, want %d with %q", tt.name, rec.Code, rec.Body, tt.code, tt.contains)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// programPart brings the events of another schedule between From and Until,
+// HH:MM with Until excluded, into a program. Empty bounds are the start and
+// end of the day.
+type programPart struct {
+	Schedule string `json:"schedule"`
+	From     string `json:"from,omitempty"`
+	Until    string `json:"until,omitempty"`
+}
+
+func (p *programPart) includes(at string) bool {
+	return (p.From == "" || at >= p.From) && (p.Until == "" || at < p.Until)
+}
+
+// expandPrograms returns the schedules to pick the active ones from: data
+// without the schedules programs are made of, which never activate on their
+// own, and with each program's days holding its own events plus those of
+// its parts. data itself isn't changed, so the document saves and exports
+// as written.
+func expandPrograms(data []*schedule) ([]*schedule, []*scheduleError) {
+	problems := []*scheduleError{}
+	parts := map[string]bool{}
+	for _, sch := range data {
+		for _, part := range sch.Program {
+			parts[part.Schedule] = true
+		}
+	}
+	expanded := []*schedule{}
+	for _, sch := range data {
+		if parts[sch.Name] {
+			if len(sch.Program) > 0 {
+				problems = append(problems, &scheduleError{Schedule: sch.Name, Message: "a program can't be part of another program"})
+			}
+			continue
+		}
+		if len(sch.Program) == 0 {
+			expanded = append(expanded, sch)
+			continue
+		}
+		composed, partProblems := composeProgram(sch, data)
+		problems = append(problems, partProblems...)
+		expanded = append(expanded, composed)
+	}
+	return expanded, problems
+}
+
+// findExpanded finds name among the expanded schedules, composed for a
+// program, and otherwise in data: a program's part can still be pinned, and
+// then plays all of its events.
+func findExpanded(expanded, data []*schedule, name string) *schedule {
+	if sch := findSchedule(expanded, name); sch != nil {
+		return sch
+	}
+	return findSchedule(data, name)
+}
+
+// composeProgram copies sch with the events of its parts added to its
+// enabled days. A part's events keep its sounds folder, timezone and volume
+// tiers.
+func composeProgram(sch *schedule, data []*schedule) (*schedule, []*scheduleError) {
+	problems := []*scheduleError{}
+	composed := *sch
+	composed.Days = []*day{}
+	byName := map[string]*day{}
+	disabled := map[string]bool{}
+	addDay := func(d *day) *day {
+		key := strings.ToUpper(d.Name[0:3])
+		if merged, ok := byName[key]; ok {
+			return merged
+		}
+		merged := &day{Name: d.Name, Label: d.Label, Note: d.Note, Events: []*event{}}
+		byName[key] = merged
+		composed.Days = append(composed.Days, merged)
+		return merged
+	}
+	for _, d := range sch.Days {
+		if !d.isEnabled() {
+			disabled[strings.ToUpper(d.Name[0:3])] = true
+			continue
+		}
+		merged := addDay(d)
+		for _, evt := range d.Events {
+			merged.Events = append(merged.Events, withDaySound(evt, d))
+		}
+	}
+	for _, part := range sch.Program {
+		ref := findSchedule(data, part.Schedule)
+		if ref == nil {
+			problems = append(problems, &scheduleError{Schedule: sch.Name, Message: fmt.Sprintf("program schedule not found: %s", part.Schedule)})
+			continue
+		}
+		if len(ref.Program) > 0 {
+			continue
+		}
+		for _, d := range ref.Days {
+			if !d.isEnabled() || disabled[strings.ToUpper(d.Name[0:3])] {
+				continue
+			}
+			merged := addDay(d)
+			for _, evt := range d.Events {
+				if evt.Cron != "" {
+					problems = append(problems, &scheduleError{Schedule: sch.Name, Day: d.Name, Message: fmt.Sprintf("cron event of %s can't be placed in a program window", ref.Name)})
+					continue
+				}
+				if evt.RelativeTo != "" {
+					problems = append(problems, &scheduleError{Schedule: sch.Name, Day: d.Name, Message: fmt.Sprintf("%s event of %s can't be placed in a program window", evt.RelativeTo, ref.Name)})
+					continue
+				}
+				if part.includes(evt.Time) {
+					placed := *withDaySound(evt, d)
+					placed.from = ref
+					merged.Events = append(merged.Events, &placed)
+				}
+			}
+		}
+	}
+	return &composed, problems
+}
+
+// withDaySound returns evt, or a copy playing d's default_sound when it has
+// no sound, since the merged day doesn't keep the defaults of the days it's
+// made of.
+func withDaySound(evt *event, d *day) *event {
+	if evt.hasSound() || d.DefaultSound == "" {
+		return evt
+	}
+	return withSound(evt, d.DefaultSound)
+}
+
+// eventSchedule is the schedule evt takes its sounds folder, timezone and
+// volume tiers from: the part it came from in a program, otherwise sch.
+func eventSchedule(sch *schedule, evt *event) *schedule {
+	if evt.from != nil {
+		return evt.from
+	}
+	return sch
+}
+
+// eventSoundsDir is the folder evt's sounds are in, dir being its
+// schedule's.
+func eventSoundsDir(dir string, evt *event) (string, error) {
+	if evt.from == nil {
+		return dir, nil
+	}
+	return evt.from.soundsDir()
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+const programSchedules = `[
+	{"name": "day", "starts": "2024-01-01", "ends": "2024-12-31",
+		"program": [{"schedule": "morning", "until": "12:00"}, {"schedule": "afternoon", "from": "12:30"}],
+		"days": [
+			{"name": "Monday", "events": [{"time": "12:00", "sound": "bell.mp3", "label": "Lunch"}]},
+			{"name": "Tuesday", "enabled": false, "events": []}
+		]},
+	{"name": "morning", "days": [
+		{"name": "Monday", "events": [{"time": "08:00", "sound": "bell.mp3"}, {"time": "09:00", "sound": "bell.mp3"}, {"time": "13:00", "sound": "bell.mp3"}]},
+		{"name": "Tuesday", "events": [{"time": "08:00", "sound": "bell.mp3"}]}
+	]},
+	{"name": "afternoon", "sounds_dir": "pm", "timezone": "America/New_York", "volume_tiers": [{"after": "14:00", "volume": 0.4}], "days": [
+		{"name": "Monday", "events": [{"time": "08:00", "sound": "chime.mp3"}, {"time": "13:00", "sound": "chime.mp3"}, {"time": "14:00", "sound": "chime.mp3"}]}
+	]}
+]`
+
+func TestProgram(t *testing.T) {
+	testDir(t)
+	sound, err := os.ReadFile("sounds/bell.mp3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, "sounds/pm/chime.mp3", string(sound))
+	player := &recordingPlayer{}
+	useQueue(t, player, 4)
+	loadSchedule(t, time.Date(2024, 3, 4, 7, 0, 0, 0, time.UTC), programSchedules)
+
+	if len(parseErrors) != 0 || len(parseWarnings) != 0 {
+		t.Errorf("errors = %+v, warnings = %q, want none", parseErrors, parseWarnings)
+	}
+	if got := active(); !reflect.DeepEqual(got, []string{"day"}) {
+		t.Errorf("active = %q, want only the program, its parts don't activate on their own", got)
+	}
+	// the program's own bell and those of its parts within their windows,
+	// the afternoon's at New York time; Tuesday is off for the whole program
+	fires := nextFires(time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC))
+	got := []string{}
+	for bell, at := range fires {
+		got = append(got, bell+" "+at.UTC().Format("Mon 15:04"))
+	}
+	sort.Strings(got)
+	want := []string{
+		"day 08:00 Mon 08:00",
+		"day 09:00 Mon 09:00",
+		"day 12:00 Mon 12:00",
+		"day 13:00 Mon 18:00",
+		"day 14:00 Mon 19:00",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("bells = %q, want %q", got, want)
+	}
+
+	// a part's bell plays from its folder at its volume tiers
+	data, _ := expandPrograms(loadedSchedules)
+	composed := findSchedule(data, "day")
+	var late *event
+	for _, evt := range composed.Days[0].Events {
+		if evt.Time == "14:00" {
+			late = evt
+		}
+	}
+	if late == nil {
+		t.Fatalf("no 14:00 bell in %+v", composed.Days[0].Events)
+	}
+	if v := effectiveVolume(composed, late, time.Date(2024, 3, 4, 19, 0, 0, 0, time.UTC)); v != 0.4 {
+		t.Errorf("afternoon 14:00 volume = %v, want its tier's 0.4", v)
+	}
+	if v := effectiveVolume(composed, late, time.Date(2024, 3, 4, 14, 0, 0, 0, time.UTC)); v != 1 {
+		t.Errorf("afternoon volume at 09:00 New York = %v, want 1 before its tier", v)
+	}
+	runBell(t, "day", "14:00")
+	waitFor(t, "the afternoon bell", func() bool { return getLastPlayed() != nil })
+	if played := getLastPlayed(); played.Sound != "chime.mp3" || played.Error != "" {
+		t.Errorf("played %+v, want chime.mp3 from the afternoon's folder", played)
+	}
+
+	// the document is kept as written
+	schedules := []*schedule{}
+	decodeBody(t, apiRequest(t, "GET", "/api/v1/schedules", ""), &schedules)
+	if len(schedules) != 3 || len(schedules[0].Days[0].Events) != 1 {
+		t.Errorf("schedules = %d, day has %d Monday events, want the 3 as written", len(schedules), len(schedules[0].Days[0].Events))
+	}
+}
+
+func TestProgramProblems(t *testing.T) {
+	testDir(t)
+	loadSchedule(t, time.Date(2024, 3, 4, 7, 0, 0, 0, time.UTC), `[
+		{"name": "day", "starts": "2024-01-01", "ends": "2024-12-31", "program": [{"schedule": "clubs"}, {"schedule": "gone"}, {"schedule": "week"}], "days": []},
+		{"name": "clubs", "days": [{"name": "Monday", "events": [
+			{"time": "15:00", "sound": "bell.mp3"},
+			{"cron": "0 */2 * * *", "sound": "bell.mp3"}
+		]}]},
+		{"name": "week", "program": [{"schedule": "clubs"}], "days": []}
+	]`)
+	want := []string{
+		"day: cron event of clubs can't be placed in a program window",
+		"day: program schedule not found: gone",
+		"week: a program can't be part of another program",
+	}
+	got := []string{}
+	for _, e := range parseErrors {
+		got = append(got, e.Schedule+": "+e.Message)
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("errors = %q, want %q", got, want)
+	}
+	if bells := entriesOf("bell"); len(bells) != 1 || bells[0].Schedule != "day" || bells[0].Time != "15:00" {
+		t.Errorf("bells = %+v, want the clubs 15:00 bell in day", bells)
+	}
+}
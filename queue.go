@@ -0,0 +1,271 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+var (
+	errQueueClosed = errors.New("play queue is closed")
+	errQueueFull   = errors.New("play queue is full")
+	errDuplicate   = errors.New("same sound was just queued")
+)
+
+// The play queue serializes playback so overlapping bells don't fight over
+// the audio device.
+var (
+	playQueue       chan *playJob
+	playQueueMu     sync.Mutex
+	playQueueClosed bool
+	playQueueDone   chan struct{}
+	discardQueue    atomic.Bool
+	// recentPlays is when each sound, segment and zone was last queued, for
+	// dedupe.
+	recentPlays = map[string]time.Time{}
+)
+
+// playJob is one sound to play and where.
+type playJob struct {
+	Sound  string   `json:"sound"`
+	Zone   string   `json:"zone,omitempty"`
+	Volume *float64 `json:"volume,omitempty"`
+	Role   string   `json:"role,omitempty"`
+	// StartMs and EndMs play only that part of Sound, EndMs 0 to its end.
+	StartMs int `json:"start_ms,omitempty"`
+	EndMs   int `json:"end_ms,omitempty"`
+	// SoundsDir is where Sound and Playlist are, audio.sounds-dir when empty.
+	SoundsDir string `json:"-"`
+	// SoundData, when set, is played instead of the Sound file.
+	SoundData []byte `json:"-"`
+	// Announce, when set, is spoken instead of playing Sound.
+	Announce string `json:"-"`
+	// PCM, when set, is 16 bit stereo at samplingRate played instead of
+	// Sound.
+	PCM []byte `json:"-"`
+	// Started, when set, gets when the backend took the first sample, and
+	// Done why the job didn't play, nil once it did. Both need room for one
+	// value.
+	Started chan time.Time `json:"-"`
+	Done    chan error     `json:"-"`
+	// queuedAt is when enqueuePlay took it, to tell which sounds are
+	// simultaneous for audio.overlap mix.
+	queuedAt time.Time
+	// skipDedup queues it even when the same sound was just queued, see
+	// audio.dedup-window-ms.
+	skipDedup bool
+	// Playlist sounds play after Sound, overlapping by CrossfadeMs.
+	Playlist    []string `json:"playlist,omitempty"`
+	CrossfadeMs int      `json:"crossfade_ms,omitempty"`
+	// Repeat plays the whole sequence that many times, RepeatGapMs apart.
+	Repeat      int `json:"repeat,omitempty"`
+	RepeatGapMs int `json:"repeat_gap_ms,omitempty"`
+}
+
+func startPlayQueue(size int) {
+	playQueue = make(chan *playJob, size)
+	playQueueDone = make(chan struct{})
+	go func() {
+		defer close(playQueueDone)
+		// next is a job taken while looking for simultaneous ones that wasn't
+		var next *playJob
+		for {
+			job, ok := next, true
+			next = nil
+			if job == nil {
+				select {
+				case job, ok = <-playQueue:
+				default:
+					if keepWarm() {
+						continue
+					}
+					job, ok = <-playQueue
+				}
+			}
+			if !ok {
+				return
+			}
+			if discardQueue.Load() {
+				finishJob(job, errQueueClosed)
+				continue
+			}
+			var batch []*playJob
+			if viper.GetString("audio.overlap") == "mix" {
+				batch, next = simultaneousJobs(job)
+			}
+			if offset := audioOffset(); offset > 0 {
+				time.Sleep(offset)
+			}
+			if len(batch) > 1 {
+				for i, err := range playMixed(batch) {
+					finishJob(batch[i], err)
+				}
+				continue
+			}
+			finishJob(job, playSound(job))
+		}
+	}()
+}
+
+// simultaneousJobs collects the jobs queued within audio.mix-window-ms of
+// first, waiting out the window if it's still open, for audio.overlap mix.
+// It returns them with first and the job after them, if it took one.
+func simultaneousJobs(first *playJob) ([]*playJob, *playJob) {
+	window := time.Duration(viper.GetInt("audio.mix-window-ms")) * time.Millisecond
+	batch := []*playJob{first}
+	deadline := time.NewTimer(time.Until(first.queuedAt.Add(window)))
+	defer deadline.Stop()
+	for {
+		select {
+		case job, ok := <-playQueue:
+			if !ok {
+				return batch, nil
+			}
+			if job.queuedAt.Sub(first.queuedAt) > window {
+				return batch, job
+			}
+			batch = append(batch, job)
+		case <-deadline.C:
+			return batch, nil
+		}
+	}
+}
+
+func finishJob(job *playJob, err error) {
+	if job.Done != nil {
+		job.Done <- err
+	}
+}
+
+// startReader reports on started when the first sample is read from it.
+type startReader struct {
+	io.Reader
+	started chan time.Time
+	once    sync.Once
+}
+
+func (s *startReader) Read(p []byte) (int, error) {
+	n, err := s.Reader.Read(p)
+	if n > 0 {
+		s.once.Do(func() {
+			select {
+			case s.started <- time.Now():
+			default:
+			}
+		})
+	}
+	return n, err
+}
+
+// lastPlayEnd is when the worker last finished playing a sound. Only the
+// worker uses it.
+var lastPlayEnd time.Time
+
+// waitMinGap holds the next sound until audio.min-gap-ms has passed since
+// the last one finished, so a burst of bells, say a warning, the bell and
+// an announcement, doesn't run together. Sounds skipped without playing
+// don't count.
+func waitMinGap() {
+	gap := time.Duration(viper.GetInt("audio.min-gap-ms")) * time.Millisecond
+	if gap <= 0 || lastPlayEnd.IsZero() {
+		return
+	}
+	if wait := gap - time.Since(lastPlayEnd); wait > 0 {
+		log.Debugf("Waiting %s before the next sound", wait)
+		time.Sleep(wait)
+	}
+}
+
+// keepWarmSlice is how much silence keepWarm plays at a time, short enough
+// that a queued bell isn't noticeably held up.
+const keepWarmSlice = 100 * time.Millisecond
+
+// keepWarm plays a slice of silence when the last sound finished less than
+// audio.keep-warm-ms ago, so a sound card that sleeps when idle is still
+// awake for the next of a run of closely spaced bells. It reports whether it
+// played. Only the sound card is kept warm.
+func keepWarm() bool {
+	warm := time.Duration(viper.GetInt("audio.keep-warm-ms")) * time.Millisecond
+	if warm <= 0 || lastPlayEnd.IsZero() || time.Since(lastPlayEnd) >= warm {
+		return false
+	}
+	if _, ok := audioBackend.(*otoPlayer); !ok {
+		return false
+	}
+	pcm := bytes.NewReader(silence(samplingRate, keepWarmSlice))
+	return audioBackend.Play(context.Background(), pcm, samplingRate, numOfChannels) == nil
+}
+
+// enqueuePlay queues job, refusing with errDuplicate the same sound on the
+// same zone within audio.dedup-window-ms, such as two schedules ringing the
+// same bell.
+func enqueuePlay(job *playJob) error {
+	playQueueMu.Lock()
+	defer playQueueMu.Unlock()
+	if playQueueClosed {
+		return errQueueClosed
+	}
+	now := appClock.Now()
+	window := time.Duration(viper.GetInt("audio.dedup-window-ms")) * time.Millisecond
+	zone := job.Zone
+	if zone == "" {
+		zone = defaultZone
+	}
+	key := fmt.Sprintf("%s|%s|%s|%d-%d", zone, job.SoundsDir, job.Sound, job.StartMs, job.EndMs)
+	for k, at := range recentPlays {
+		if now.Sub(at) >= window {
+			delete(recentPlays, k)
+		}
+	}
+	if _, ok := recentPlays[key]; ok && !job.skipDedup {
+		log.Warnf("Suppressed duplicate: %s (zone %s)", job.Sound, zone)
+		return errDuplicate
+	}
+	job.queuedAt = time.Now()
+	select {
+	case playQueue <- job:
+		if window > 0 {
+			recentPlays[key] = now
+		}
+		return nil
+	default:
+		return errQueueFull
+	}
+}
+
+// stopPlayQueue stops accepting sounds and, when drain is set, lets the
+// worker finish the queued ones until ctx expires. Whatever is left is
+// discarded and logged.
+func stopPlayQueue(ctx context.Context, drain bool) {
+	playQueueMu.Lock()
+	if playQueueClosed {
+		playQueueMu.Unlock()
+		return
+	}
+	playQueueClosed = true
+	close(playQueue)
+	playQueueMu.Unlock()
+
+	if !drain {
+		discardQueue.Store(true)
+		if pending := len(playQueue); pending > 0 {
+			log.Warnf("Discarding %d queued sounds", pending)
+		}
+	}
+
+	select {
+	case <-playQueueDone:
+		log.Printf("Play queue drained")
+	case <-ctx.Done():
+		discardQueue.Store(true)
+		log.Warnf("Shutdown timeout reached, discarding %d queued sounds", len(playQueue))
+	}
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestStopPlayQueueDrains(t *testing.T) {
+	backend := &recordingPlayer{}
+	useQueue(t, backend, 8)
+	jobs := []*playJob{}
+	for _, name := range []string{"first", "second", "third"} {
+		job := pcmJob(name, 10*time.Millisecond)
+		if err := enqueuePlay(job); err != nil {
+			t.Fatal(err)
+		}
+		jobs = append(jobs, job)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	stopPlayQueue(ctx, true)
+
+	if backend.count() != 3 {
+		t.Errorf("played %d sounds, want all 3", backend.count())
+	}
+	for _, job := range jobs {
+		if err := <-job.Done; err != nil {
+			t.Errorf("%s: %v, want played", job.Sound, err)
+		}
+	}
+	if err := enqueuePlay(pcmJob("late", time.Millisecond)); !errors.Is(err, errQueueClosed) {
+		t.Errorf("enqueue after shutdown = %v, want errQueueClosed", err)
+	}
+}
+
+func TestStopPlayQueueDiscards(t *testing.T) {
+	logs := captureLog(t)
+	backend := &recordingPlayer{gate: make(chan struct{})}
+	useQueue(t, backend, 8)
+	playing := pcmJob("playing", time.Millisecond)
+	if err := enqueuePlay(playing); err != nil {
+		t.Fatal(err)
+	}
+	// the worker holds the first job in the backend while the rest wait
+	waitFor(t, "the first sound to start", func() bool { return len(playQueue) == 0 })
+	queued := []*playJob{pcmJob("second", time.Millisecond), pcmJob("third", time.Millisecond)}
+	for _, job := range queued {
+		if err := enqueuePlay(job); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		stopPlayQueue(ctx, false)
+		close(done)
+	}()
+	waitFor(t, "the discard to be logged", func() bool {
+		return len(logEntries(t, logs, "Discarding 2 queued sounds")) == 1
+	})
+	backend.gate <- struct{}{}
+	<-done
+
+	if backend.count() != 1 {
+		t.Errorf("played %d sounds, want only the one already playing", backend.count())
+	}
+	for _, job := range queued {
+		if err := <-job.Done; !errors.Is(err, errQueueClosed) {
+			t.Errorf("%s: %v, want errQueueClosed", job.Sound, err)
+		}
+	}
+}
+
+func TestStopPlayQueueTimeout(t *testing.T) {
+	logs := captureLog(t)
+	backend := &recordingPlayer{gate: make(chan struct{}, 1)}
+	useQueue(t, backend, 8)
+	for _, name := range []string{"first", "second", "third"} {
+		if err := enqueuePlay(pcmJob(name, time.Millisecond)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	stopPlayQueue(ctx, true)
+	if entries := logEntries(t, logs, "Shutdown timeout reached, discarding 2 queued sounds"); len(entries) != 1 {
+		t.Errorf("discard on timeout not logged:\n%s", logs)
+	}
+	// let the stuck sound end, the rest are dropped
+	backend.gate <- struct{}{}
+	waitFor(t, "the queue to stop", func() bool {
+		select {
+		case <-playQueueDone:
+			return true
+		default:
+			return false
+		}
+	})
+	if backend.count() != 1 {
+		t.Errorf("played %d sounds, want 1", backend.count())
+	}
+}
+
+func TestDedupWindow(t *testing.T) {
+	testDir(t)
+	setConfig(t, "audio.dedup-window-ms", 2000)
+	setConfig(t, "zones", map[string]interface{}{"gym": map[string]interface{}{"device": "hw:1"}})
+	clock := useClock(t, time.Date(2024, 3, 4, 8, 0, 0, 0, time.UTC))
+	useQueue(t, &recordingPlayer{gate: make(chan struct{})}, 8)
+	logs := captureLog(t)
+
+	if err := enqueuePlay(&playJob{Sound: "bell.mp3"}); err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(1500 * time.Millisecond)
+	if err := enqueuePlay(&playJob{Sound: "bell.mp3"}); !errors.Is(err, errDuplicate) {
+		t.Errorf("same bell 1.5s later = %v, want errDuplicate", err)
+	}
+	if n := len(logEntries(t, logs, "Suppressed duplicate: bell.mp3 (zone all)")); n != 1 {
+		t.Errorf("logged %d suppressions, want 1", n)
+	}
+	if err := enqueuePlay(&playJob{Sound: "bell.mp3", Zone: "gym"}); err != nil {
+		t.Errorf("same bell on another zone = %v, want queued", err)
+	}
+	if err := enqueuePlay(&playJob{Sound: "chime.mp3"}); err != nil {
+		t.Errorf("another sound = %v, want queued", err)
+	}
+	clock.Advance(500 * time.Millisecond)
+	if err := enqueuePlay(&playJob{Sound: "bell.mp3"}); err != nil {
+		t.Errorf("same bell 2s later = %v, want queued", err)
+	}
+	if err := enqueuePlay(&playJob{Sound: "bell.mp3", skipDedup: true}); err != nil {
+		t.Errorf("a bell that skips the check = %v, want queued", err)
+	}
+
+	setConfig(t, "audio.dedup-window-ms", 0)
+	for i := 0; i < 2; i++ {
+		if err := enqueuePlay(&playJob{Sound: "tone.mp3"}); err != nil {
+			t.Errorf("with no window, bell %d = %v, want queued", i+1, err)
+		}
+	}
+}
+
+func TestDedupSchedules(t *testing.T) {
+	testDir(t)
+	setConfig(t, "audio.dedup-window-ms", 2000)
+	player := &recordingPlayer{}
+	useQueue(t, player, 8)
+	clock := loadSchedule(t, time.Date(2024, 3, 4, 7, 0, 0, 0, time.UTC), `[
+		{"name": "term", "starts": "2024-01-01", "ends": "2024-12-31", "days": [{"name": "Monday", "events": [{"time": "08:00", "sound": "bell.mp3"}]}]},
+		{"name": "clubs", "starts": "2024-01-01", "ends": "2024-12-31", "days": [{"name": "Monday", "events": [{"time": "08:00", "sound": "bell.mp3"}]}]}
+	]`)
+	clock.Set(time.Date(2024, 3, 4, 8, 0, 0, 0, time.UTC))
+	runBell(t, "term", "08:00")
+	runBell(t, "clubs", "08:00")
+	waitFor(t, "the bell", func() bool { return player.count() == 1 })
+	time.Sleep(50 * time.Millisecond)
+	if player.count() != 1 {
+		t.Errorf("played %d times, want the second schedule's bell suppressed", player.count())
+	}
+}
+
+// timedPlayer keeps when each playback started and finished.
+type timedPlayer struct {
+	mu       sync.Mutex
+	started  []time.Time
+	finished []time.Time
+}
+
+func (p *timedPlayer) Play(ctx context.Context, pcm io.Reader, rate, channels int) error {
+	p.mu.Lock()
+	p.started = append(p.started, time.Now())
+	p.mu.Unlock()
+	_, err := io.Copy(io.Discard, pcm)
+	p.mu.Lock()
+	p.finished = append(p.finished, time.Now())
+	p.mu.Unlock()
+	return err
+}
+
+func TestMinGap(t *testing.T) {
+	tests := []struct {
+		gapMs int
+		min   time.Duration
+	}{
+		{150, 150 * time.Millisecond},
+		{0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(strconv.Itoa(tt.gapMs), func(t *testing.T) {
+			setConfig(t, "audio.min-gap-ms", tt.gapMs)
+			backend := &timedPlayer{}
+			useQueue(t, backend, 8)
+			jobs := []*playJob{}
+			for _, name := range []string{"warning", "bell", "announcement"} {
+				job := pcmJob(name, 10*time.Millisecond)
+				if err := enqueuePlay(job); err != nil {
+					t.Fatal(err)
+				}
+				jobs = append(jobs, job)
+			}
+			for _, job := range jobs {
+				if err := <-job.Done; err != nil {
+					t.Fatal(err)
+				}
+			}
+			backend.mu.Lock()
+			defer backend.mu.Unlock()
+			for i := 1; i < len(backend.started); i++ {
+				gap := backend.started[i].Sub(backend.finished[i-1])
+				if gap < tt.min || tt.min == 0 && gap > 100*time.Millisecond {
+					t.Errorf("sound %d started %s after the last finished, want at least %s", i, gap, tt.min)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// inQuietHours reports whether now falls within quiet-hours, when manual
+// plays are refused. A window whose end is before its start runs past
+// midnight and belongs to the day it starts on. No days means every day.
+func inQuietHours(now time.Time) bool {
+	start, end := viper.GetString("quiet-hours.start"), viper.GetString("quiet-hours.end")
+	if start == "" || end == "" {
+		return false
+	}
+	from, err := parseClock(start)
+	if err != nil {
+		log.Errorf("Could not parse quiet-hours.start: %s : %v", start, err)
+		return false
+	}
+	to, err := parseClock(end)
+	if err != nil {
+		log.Errorf("Could not parse quiet-hours.end: %s : %v", end, err)
+		return false
+	}
+	now = now.In(globalLocation())
+	minutes := now.Hour()*60 + now.Minute()
+	day := now
+	switch {
+	case from < to:
+		if minutes < from || minutes >= to {
+			return false
+		}
+	case from > to:
+		if minutes < from && minutes >= to {
+			return false
+		}
+		if minutes < to {
+			day = now.AddDate(0, 0, -1)
+		}
+	default:
+		return false
+	}
+	days := viper.GetStringSlice("quiet-hours.days")
+	if len(days) == 0 {
+		return true
+	}
+	for _, d := range days {
+		if len(d) >= 3 && strings.EqualFold(d[0:3], weekdays[day.Weekday()]) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseClock returns the minutes since midnight of "15:04".
+func parseClock(value string) (int, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("expected HH:MM: %v", err)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestInQuietHours(t *testing.T) {
+	setConfig(t, "app.timezone", "America/Mexico_City")
+	setConfig(t, "quiet-hours.start", "22:00")
+	setConfig(t, "quiet-hours.end", "06:00")
+	local, err := time.LoadLocation("America/Mexico_City")
+	if err != nil {
+		t.Skip(err)
+	}
+	// 2024-03-04 is a Monday
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2024, 3, day, hour, minute, 0, 0, local)
+	}
+	tests := []struct {
+		name string
+		days []string
+		now  time.Time
+		want bool
+	}{
+		{"before", nil, at(4, 21, 59), false},
+		{"start", nil, at(4, 22, 0), true},
+		{"after midnight", nil, at(5, 5, 59), true},
+		{"end", nil, at(5, 6, 0), false},
+		{"in UTC", nil, at(4, 23, 0).UTC(), true},
+		{"on its day", []string{"MON"}, at(4, 23, 0), true},
+		{"past midnight of its day", []string{"Monday"}, at(5, 1, 0), true},
+		{"on another day", []string{"MON"}, at(5, 23, 0), false},
+	}
+	for _, tt := range tests {
+		setConfig(t, "quiet-hours.days", tt.days)
+		if got := inQuietHours(tt.now); got != tt.want {
+			t.Errorf("%s: inQuietHours(%s) = %v, want %v", tt.name, tt.now, got, tt.want)
+		}
+	}
+
+	setConfig(t, "quiet-hours.start", "")
+	if inQuietHours(at(4, 23, 0)) {
+		t.Error("in quiet hours without any configured")
+	}
+}
+
+func TestQuietHoursPlay(t *testing.T) {
+	testDir(t)
+	setConfig(t, "quiet-hours.start", "22:00")
+	setConfig(t, "quiet-hours.end", "06:00")
+	player := &recordingPlayer{}
+	useQueue(t, player, 8)
+	loadSchedule(t, time.Date(2024, 3, 4, 23, 0, 0, 0, time.UTC), `[{"name": "term", "starts": "2024-01-01", "ends": "2024-12-31", "days": [{"name": "Monday", "events": [
+		{"time": "23:00", "sound": "bell.mp3"}
+	]}]}]`)
+
+	if rec := apiRequest(t, "POST", "/api/v1/play", `{"sound": "bell.mp3"}`); rec.Code != http.StatusForbidden {
+		t.Errorf("play during quiet hours = %d %s, want 403", rec.Code, rec.Body)
+	}
+	if rec := apiRequest(t, "POST", "/api/v1/play?override=true", `{"sound": "bell.mp3"}`); rec.Code != http.StatusAccepted {
+		t.Errorf("play with override = %d %s, want 202", rec.Code, rec.Body)
+	}
+	waitFor(t, "the overridden play", func() bool { return player.count() == 1 })
+
+	// scheduled bells still ring
+	runBell(t, "term", "23:00")
+	waitFor(t, "the scheduled bell", func() bool { return player.count() == 2 })
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// maxRehearsalInterval caps the spacing between rehearsed bells.
+const maxRehearsalInterval = 300
+
+type rehearsalBell struct {
+	// OffsetSeconds is how far into the rehearsal the bell is queued.
+	OffsetSeconds int    `json:"offsetSeconds"`
+	Time          string `json:"time"`
+	// Sound is the event's, a weather sound may play instead as on a real day.
+	Sound   string `json:"sound"`
+	Label   string `json:"label,omitempty"`
+	Zone    string `json:"zone,omitempty"`
+	job     *playJob
+	weather []*weatherSound
+}
+
+type rehearsal struct {
+	Schedule        string           `json:"schedule"`
+	Day             string           `json:"day"`
+	IntervalSeconds int              `json:"intervalSeconds"`
+	Bells           []*rehearsalBell `json:"bells"`
+	// Skipped are the events left out, like cron ones that have no place in
+	// the day.
+	Skipped []string `json:"skipped"`
+	cancel  context.CancelFunc
+}
+
+// the rehearsal running, if any
+var (
+	runningRehearsal *rehearsal
+	rehearsalMu      sync.Mutex
+)
+
+// planRehearsal lists the bells of sch's day called dayName (e.g. "MON") in
+// the order they ring, interval apart. Sunrise and sunset ones are placed
+// at their time on the next such day.
+func planRehearsal(sch *schedule, dayName string, interval int, now time.Time) (*rehearsal, error) {
+	var d *day
+	for _, candidate := range sch.Days {
+		if strings.ToUpper(candidate.Name[0:3]) == dayName {
+			d = candidate
+			break
+		}
+	}
+	if d == nil {
+		return nil, fmt.Errorf("%s has no %s", sch.Name, dayName)
+	}
+	dir, err := sch.soundsDir()
+	if err != nil {
+		return nil, err
+	}
+	loc := scheduleLocationOrGlobal(sch)
+	sounds, _ := themeSounds(currentTheme().Active)
+	result := &rehearsal{Schedule: sch.Name, Day: dayName, IntervalSeconds: interval, Bells: []*rehearsalBell{}, Skipped: []string{}}
+	type timed struct {
+		at  string
+		evt *event
+	}
+	bells := []*timed{}
+	for _, evt := range d.Events {
+		at := fmt.Sprintf("%s:%02d", evt.Time, evt.Second)
+		switch {
+		case evt.RelativeTo != "":
+			sunAt, err := sunEventTime(evt, dayName, now, loc)
+			if err != nil {
+				result.Skipped = append(result.Skipped, fmt.Sprintf("%s: %v", evt.RelativeTo, err))
+				continue
+			}
+			at = sunAt.In(loc).Format("15:04:05")
+		case evt.Cron != "":
+			result.Skipped = append(result.Skipped, "cron "+evt.Cron)
+			continue
+		case evt.Time == "":
+			result.Skipped = append(result.Skipped, "event without a time")
+			continue
+		}
+		if evt.Relay == relayOnly {
+			result.Skipped = append(result.Skipped, at+": relay only")
+			continue
+		}
+		evt, _, err := withDefaultSound(evt, d.DefaultSound)
+		if err != nil {
+			result.Skipped = append(result.Skipped, fmt.Sprintf("%s: %v", at, err))
+			continue
+		}
+		bells = append(bells, &timed{at: at, evt: withTheme(evt, sounds)})
+	}
+	sort.SliceStable(bells, func(i, j int) bool {
+		return bells[i].at < bells[j].at
+	})
+	for _, b := range bells {
+		dir, err := eventSoundsDir(dir, b.evt)
+		var soundData []byte
+		if err == nil {
+			soundData, err = checkEvent(dir, b.evt)
+		}
+		if err == nil {
+			err = checkSoundFiles(dir, b.evt)
+		}
+		if err != nil {
+			result.Skipped = append(result.Skipped, fmt.Sprintf("%s: %v", b.at, err))
+			continue
+		}
+		sound := b.evt.Sound
+		if len(b.evt.Choices) > 0 {
+			sound = randomSound(b.evt.Choices)
+		}
+		volume := effectiveVolume(sch, b.evt, now)
+		result.Bells = append(result.Bells, &rehearsalBell{
+			OffsetSeconds: len(result.Bells) * interval,
+			Time:          b.at,
+			Sound:         sound,
+			Label:         b.evt.Label,
+			Zone:          b.evt.Zone,
+			weather:       b.evt.Weather,
+			job: &playJob{
+				Sound:       sound,
+				SoundsDir:   dir,
+				Role:        b.evt.Role,
+				SoundData:   soundData,
+				StartMs:     b.evt.StartMs,
+				EndMs:       b.evt.EndMs,
+				Zone:        b.evt.Zone,
+				Volume:      &volume,
+				Playlist:    b.evt.Playlist,
+				CrossfadeMs: b.evt.CrossfadeMs,
+				Repeat:      b.evt.Repeat,
+				RepeatGapMs: b.evt.RepeatGapMs,
+				// the same sound comes round again sooner than on a real day
+				skipDedup: true,
+			},
+		})
+	}
+	return result, nil
+}
+
+// runRehearsal queues each bell at its offset from now until ctx ends,
+// picking weather sounds as it goes. Playback goes through the queue, so
+// silencing and maintenance mode still hold, though not the duplicate check;
+// a bell still playing delays the next.
+func runRehearsal(ctx context.Context, plan *rehearsal) {
+	defer func() {
+		rehearsalMu.Lock()
+		defer rehearsalMu.Unlock()
+		plan.cancel()
+		if runningRehearsal == plan {
+			runningRehearsal = nil
+		}
+	}()
+	start := time.Now()
+	for _, b := range plan.Bells {
+		wait := time.NewTimer(time.Until(start.Add(time.Duration(b.OffsetSeconds) * time.Second)))
+		select {
+		case <-ctx.Done():
+			wait.Stop()
+			log.Warnf("Rehearsal of %s %s stopped", plan.Schedule, plan.Day)
+			return
+		case <-wait.C:
+		}
+		if len(b.weather) > 0 {
+			sound := weatherChoice(b.weather, b.job.Sound, appClock.Now())
+			if sound != b.job.Sound {
+				b.job.Sound, b.job.SoundData = sound, nil
+			}
+		}
+		log.WithFields(log.Fields{"Schedule": plan.Schedule, "Day": plan.Day, "Time": b.Time, "Sound": b.job.Sound}).Info("Rehearsing bell")
+		err := enqueuePlay(b.job)
+		if err != nil {
+			log.Errorf("Could not queue rehearsed bell: %s : %v", b.Sound, err)
+		}
+	}
+	log.Printf("Rehearsal of %s %s done", plan.Schedule, plan.Day)
+}
+
+// postRehearseHandler plays a day's bells in order, interval_seconds apart
+// (3 by default) instead of at their times, for a demonstration. It answers
+// the plan straight away; one rehearsal runs at a time. During quiet hours
+// it answers 403 unless override=true is passed.
+func postRehearseHandler(w http.ResponseWriter, r *http.Request) {
+	if inQuietHours(appClock.Now()) {
+		if r.URL.Query().Get("override") != "true" {
+			writeError(w, http.StatusForbidden, "quiet hours, pass override=true to play anyway")
+			return
+		}
+		log.Warnf("Rehearsal during quiet hours overridden by %s", getIPAddress(r))
+	}
+	body := struct {
+		Schedule        string `json:"schedule"`
+		Day             string `json:"day"`
+		IntervalSeconds *int   `json:"interval_seconds"`
+	}{}
+	err := json.NewDecoder(io.LimitReader(r.Body, 1000000)).Decode(&body)
+	if err != nil || body.Schedule == "" || body.Day == "" {
+		writeError(w, http.StatusBadRequest, `expected {"schedule": "<schedule>", "day": "MON", "interval_seconds": 3}`)
+		return
+	}
+	interval := 3
+	if body.IntervalSeconds != nil {
+		interval = *body.IntervalSeconds
+	}
+	if interval < 1 || interval > maxRehearsalInterval {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("interval_seconds must be between 1 and %d", maxRehearsalInterval))
+		return
+	}
+	weekday, err := parseWeekday(body.Day)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	dayName := strings.ToUpper(weekday.String()[0:3])
+
+	scheduleMu.RLock()
+	data := runningSchedules()
+	scheduleMu.RUnlock()
+	expanded, _ := expandPrograms(data)
+	sch := findExpanded(expanded, data, body.Schedule)
+	if sch == nil {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("schedule not found: %s", body.Schedule))
+		return
+	}
+	plan, err := planRehearsal(sch, dayName, interval, appClock.Now())
+	if err != nil {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	rehearsalMu.Lock()
+	defer rehearsalMu.Unlock()
+	if runningRehearsal != nil {
+		writeError(w, http.StatusConflict, "a rehearsal is already running")
+		return
+	}
+	var ctx context.Context
+	ctx, plan.cancel = context.WithCancel(context.Background())
+	runningRehearsal = plan
+	log.Warnf("Rehearsing %s %s, %d bells %ds apart, started by %s", plan.Schedule, dayName, len(plan.Bells), interval, getIPAddress(r))
+	go runRehearsal(ctx, plan)
+	writeJSON(w, http.StatusAccepted, plan)
+}
+
+// deleteRehearseHandler stops the running rehearsal. Bells already queued
+// still play.
+func deleteRehearseHandler(w http.ResponseWriter, r *http.Request) {
+	rehearsalMu.Lock()
+	defer rehearsalMu.Unlock()
+	if runningRehearsal == nil {
+		writeError(w, http.StatusNotFound, "no rehearsal is running")
+		return
+	}
+	runningRehearsal.cancel()
+	runningRehearsal = nil
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"os"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// stampedPlayer is an audio backend keeping when each playback started.
+type stampedPlayer struct {
+	mu sync.Mutex
+	at []time.Time
+}
+
+func (p *stampedPlayer) Play(ctx context.Context, pcm io.Reader, rate, channels int) error {
+	p.mu.Lock()
+	p.at = append(p.at, time.Now())
+	p.mu.Unlock()
+	_, err := io.Copy(io.Discard, pcm)
+	return err
+}
+
+func (p *stampedPlayer) started() []time.Time {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]time.Time{}, p.at...)
+}
+
+// rehearsalDay is a Monday given out of order, the same sound twice and a
+// weather sound on the last bell.
+const rehearsalDay = `[{"name": "term", "starts": "2024-01-01", "ends": "2024-12-31", "days": [{"name": "Monday", "events": [
+	{"time": "10:00", "sound": "bell.mp3", "weather": [{"condition": "rain", "sound": "recess.mp3"}]},
+	{"time": "08:00", "sound": "bell.mp3"},
+	{"time": "09:00", "second": 30, "sound": "bell.mp3"}
+]}]}]`
+
+// rehearsalTest sets up for rehearsalDay with rain forecast.
+func rehearsalTest(t *testing.T) {
+	t.Helper()
+	testDir(t)
+	sound, err := os.ReadFile("sounds/bell.mp3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, "sounds/recess.mp3", string(sound))
+	setConfig(t, "location.latitude", 19.43)
+	setConfig(t, "location.longitude", -99.13)
+	setConfig(t, "weather.timeout-ms", 1000)
+	setConfig(t, "audio.dedup-window-ms", 60000)
+	setConfig(t, "weather.max-age-minutes", 120)
+	useWeather(t, &mockWeather{condition: "rain"})
+}
+
+// rehearsalDone waits for the running rehearsal to queue its last bell.
+func rehearsalDone(t *testing.T) {
+	t.Helper()
+	waitFor(t, "the rehearsal", func() bool {
+		rehearsalMu.Lock()
+		defer rehearsalMu.Unlock()
+		return runningRehearsal == nil
+	})
+}
+
+func TestRehearse(t *testing.T) {
+	rehearsalTest(t)
+	logs := captureLog(t)
+	player := &stampedPlayer{}
+	useQueue(t, player, 8)
+	loadSchedule(t, time.Date(2024, 3, 4, 7, 0, 0, 0, time.UTC), rehearsalDay)
+	refreshWeather(appClock.Now())
+
+	for _, body := range []string{`{"schedule": "term"}`, `{"schedule": "term", "day": "MON", "interval_seconds": 0}`, `{"schedule": "term", "day": "someday"}`} {
+		if rec := apiRequest(t, "POST", "/api/v1/rehearse", body); rec.Code != http.StatusBadRequest {
+			t.Errorf("rehearse %s = %d, want 400", body, rec.Code)
+		}
+	}
+	if rec := apiRequest(t, "POST", "/api/v1/rehearse", `{"schedule": "term", "day": "TUE"}`); rec.Code != http.StatusNotFound {
+		t.Errorf("rehearse a day without bells = %d, want 404", rec.Code)
+	}
+
+	rec := apiRequest(t, "POST", "/api/v1/rehearse", `{"schedule": "term", "day": "mon", "interval_seconds": 1}`)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("rehearse = %d %s, want 202", rec.Code, rec.Body)
+	}
+	t.Cleanup(func() { rehearsalDone(t) })
+	plan := &rehearsal{}
+	decodeBody(t, rec, plan)
+	planned := []string{}
+	for _, b := range plan.Bells {
+		planned = append(planned, b.Time+" "+b.Sound+" +"+time.Duration(b.OffsetSeconds*int(time.Second)).String())
+	}
+	if want := []string{"08:00:00 bell.mp3 +0s", "09:00:30 bell.mp3 +1s", "10:00:00 bell.mp3 +2s"}; plan.Day != "MON" || plan.IntervalSeconds != 1 || !reflect.DeepEqual(planned, want) {
+		t.Errorf("plan %s %d %q, want MON 1s apart %q", plan.Day, plan.IntervalSeconds, planned, want)
+	}
+	if rec := apiRequest(t, "POST", "/api/v1/rehearse", `{"schedule": "term", "day": "MON"}`); rec.Code != http.StatusConflict {
+		t.Errorf("second rehearsal = %d, want 409", rec.Code)
+	}
+
+	// queued in order, the same sound despite the duplicate check and the
+	// rain's sound on the last
+	rehearsalDone(t)
+	waitFor(t, "the bells", func() bool { return len(player.started()) == 3 })
+	rung := []string{}
+	for _, entry := range logEntries(t, logs, "Rehearsing bell") {
+		rung = append(rung, entry["Time"].(string)+" "+entry["Sound"].(string))
+	}
+	if want := []string{"08:00:00 bell.mp3", "09:00:30 bell.mp3", "10:00:00 recess.mp3"}; !reflect.DeepEqual(rung, want) {
+		t.Errorf("rang %q, want %q", rung, want)
+	}
+	waitFor(t, "the rainy day's recess.mp3", func() bool {
+		played := getLastPlayed()
+		return played != nil && played.Sound == "recess.mp3"
+	})
+	started := player.started()
+	for i := 1; i < len(started); i++ {
+		if gap := started[i].Sub(started[i-1]); gap < 900*time.Millisecond || gap > 1500*time.Millisecond {
+			t.Errorf("bell %d played %v after the one before, want 1s", i, gap)
+		}
+	}
+}
+
+func TestRehearseSilenced(t *testing.T) {
+	rehearsalTest(t)
+	logs := captureLog(t)
+	t.Cleanup(func() {
+		silenceMu.Lock()
+		silencedUntil = map[string]time.Time{}
+		silenceMu.Unlock()
+	})
+	player := &recordingPlayer{}
+	useQueue(t, player, 8)
+	loadSchedule(t, time.Date(2024, 3, 4, 7, 0, 0, 0, time.UTC), rehearsalDay)
+	refreshWeather(appClock.Now())
+
+	if rec := apiRequest(t, "POST", "/api/v1/silence-until", `{"until": "2024-03-04T12:00:00Z"}`); rec.Code != http.StatusOK {
+		t.Fatalf("silence = %d %s", rec.Code, rec.Body)
+	}
+	if rec := apiRequest(t, "POST", "/api/v1/rehearse", `{"schedule": "term", "day": "MON", "interval_seconds": 1}`); rec.Code != http.StatusAccepted {
+		t.Fatalf("rehearse = %d %s, want 202", rec.Code, rec.Body)
+	}
+	t.Cleanup(func() { rehearsalDone(t) })
+	rehearsalDone(t)
+	waitFor(t, "the bells to be skipped", func() bool {
+		return len(logEntries(t, logs, "Silenced, skipping: bell.mp3 (zone )")) == 2 && len(logEntries(t, logs, "Silenced, skipping: recess.mp3 (zone )")) == 1
+	})
+	if player.count() != 0 {
+		t.Errorf("played %d bells while silenced, want none", player.count())
+	}
+
+	// stopped before the second bell
+	silenceMu.Lock()
+	silencedUntil = map[string]time.Time{}
+	silenceMu.Unlock()
+	if rec := apiRequest(t, "POST", "/api/v1/rehearse", `{"schedule": "term", "day": "MON", "interval_seconds": 60}`); rec.Code != http.StatusAccepted {
+		t.Fatalf("rehearse = %d %s, want 202", rec.Code, rec.Body)
+	}
+	waitFor(t, "the first bell", func() bool { return player.count() == 1 })
+	if rec := apiRequest(t, "DELETE", "/api/v1/rehearse", ""); rec.Code != http.StatusNoContent {
+		t.Errorf("stop = %d, want 204", rec.Code)
+	}
+	waitFor(t, "the rehearsal to stop", func() bool { return len(logEntries(t, logs, "Rehearsal of term MON stopped")) == 1 })
+	if rec := apiRequest(t, "DELETE", "/api/v1/rehearse", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("stop again = %d, want 404", rec.Code)
+	}
+	if player.count() != 1 {
+		t.Errorf("played %d bells, want only the first before it stopped", player.count())
+	}
+}
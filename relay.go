@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// Event relay values: pulse the relay as well as playing the sound, or
+// instead of it.
+const (
+	relayAlso = "also"
+	relayOnly = "only"
+)
+
+// gpioPin is an output pin driving the relay, see openGPIO.
+type gpioPin interface {
+	Set(high bool) error
+	Close() error
+}
+
+// relay is a physical bell wired to a GPIO pin.
+type relay struct {
+	// mu keeps pulses from overlapping, the second would be cut short
+	mu         sync.Mutex
+	pin        gpioPin
+	activeHigh bool
+	pulse      time.Duration
+}
+
+// bellRelay is the relay set up from relay.*, nil when disabled. It's set
+// once at startup.
+var bellRelay *relay
+
+// Pulse energizes the relay for its pulse length.
+func (r *relay) Pulse() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	err := r.pin.Set(r.activeHigh)
+	if err != nil {
+		return err
+	}
+	time.Sleep(r.pulse)
+	return r.pin.Set(!r.activeHigh)
+}
+
+// Close leaves the relay released.
+func (r *relay) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	err := r.pin.Set(!r.activeHigh)
+	if err != nil {
+		r.pin.Close()
+		return err
+	}
+	return r.pin.Close()
+}
+
+// setupRelay opens relay.pin when relay.enabled. Without GPIO support in the
+// build, or on a pin that can't be opened, bells asking for the relay only
+// log an error.
+func setupRelay() {
+	if !viper.GetBool("relay.enabled") {
+		return
+	}
+	number := viper.GetInt("relay.pin")
+	pulse := time.Duration(viper.GetInt("relay.pulse-ms")) * time.Millisecond
+	if pulse <= 0 {
+		log.Errorf("Invalid relay.pulse-ms: %d", viper.GetInt("relay.pulse-ms"))
+		return
+	}
+	activeHigh := viper.GetBool("relay.active-high")
+	pin, err := openGPIO(number, !activeHigh)
+	if err != nil {
+		log.Errorf("Could not open relay pin %d: %v", number, err)
+		return
+	}
+	bellRelay = &relay{pin: pin, activeHigh: activeHigh, pulse: pulse}
+	log.WithFields(log.Fields{
+		"Pin":        number,
+		"ActiveHigh": activeHigh,
+		"Pulse":      pulse,
+	}).Info("Relay ready")
+}
+
+func closeRelay() {
+	if bellRelay == nil {
+		return
+	}
+	err := bellRelay.Close()
+	if err != nil {
+		log.Errorf("Could not release relay: %v", err)
+	}
+}
+
+// ringRelay pulses the relay for a bell on zone, held back like its sound
+// would be in maintenance mode and while zone is silenced, and reports
+// whether it did.
+func ringRelay(label, zone string) bool {
+	if bellRelay == nil {
+		log.Errorf("Bell asks for the relay but it isn't set up: %s", label)
+		return false
+	}
+	if maintenanceMode.Load() {
+		log.Printf("Maintenance mode, skipping relay: %s", label)
+		return false
+	}
+	if isSilenced(zone, appClock.Now()) {
+		log.Printf("Silenced, skipping relay: %s", label)
+		return false
+	}
+	log.Printf("Pulsing relay: %s (%s)", label, bellRelay.pulse)
+	err := bellRelay.Pulse()
+	if err != nil {
+		log.Errorf("Could not pulse relay: %v", err)
+		return false
+	}
+	return true
+}
+
+func checkRelay(value string) error {
+	switch value {
+	case "", relayAlso, relayOnly:
+		return nil
+	}
+	return fmt.Errorf("invalid relay: %s", value)
+}
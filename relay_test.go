@@ -0,0 +1,152 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// pinChange is a level a mockPin was set to and when.
+type pinChange struct {
+	high bool
+	at   time.Time
+}
+
+// mockPin records how it's driven.
+type mockPin struct {
+	mu      sync.Mutex
+	changes []pinChange
+	closed  bool
+}
+
+func (p *mockPin) Set(high bool) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.changes = append(p.changes, pinChange{high, time.Now()})
+	return nil
+}
+
+func (p *mockPin) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	return nil
+}
+
+func (p *mockPin) levels() []pinChange {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]pinChange{}, p.changes...)
+}
+
+// useRelay wires bellRelay to a mock pin until the test ends.
+func useRelay(t *testing.T, activeHigh bool, pulse time.Duration) *mockPin {
+	t.Helper()
+	pin := &mockPin{}
+	bellRelay = &relay{pin: pin, activeHigh: activeHigh, pulse: pulse}
+	t.Cleanup(func() { bellRelay = nil })
+	return pin
+}
+
+func TestRelayPulse(t *testing.T) {
+	for _, activeHigh := range []bool{true, false} {
+		pin := useRelay(t, activeHigh, 40*time.Millisecond)
+		if err := bellRelay.Pulse(); err != nil {
+			t.Fatal(err)
+		}
+		got := pin.levels()
+		if len(got) != 2 || got[0].high != activeHigh || got[1].high != !activeHigh {
+			t.Fatalf("active high %v: levels = %+v, want on then off", activeHigh, got)
+		}
+		if held := got[1].at.Sub(got[0].at); held < 40*time.Millisecond || held > 500*time.Millisecond {
+			t.Errorf("active high %v: held %s, want the 40ms pulse", activeHigh, held)
+		}
+		if err := bellRelay.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if got := pin.levels(); got[len(got)-1].high != !activeHigh || !pin.closed {
+			t.Errorf("active high %v: closed at %+v, want released", activeHigh, got[len(got)-1])
+		}
+	}
+}
+
+func TestRelayPulsesDontOverlap(t *testing.T) {
+	pin := useRelay(t, true, 30*time.Millisecond)
+	var wg sync.WaitGroup
+	for range 2 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			bellRelay.Pulse()
+		}()
+	}
+	wg.Wait()
+	got := pin.levels()
+	if len(got) != 4 || !got[0].high || got[1].high || !got[2].high || got[3].high {
+		t.Fatalf("levels = %+v, want two whole pulses", got)
+	}
+	if held := got[3].at.Sub(got[2].at); held < 30*time.Millisecond {
+		t.Errorf("second pulse held %s, want all 30ms", held)
+	}
+}
+
+func TestRingRelay(t *testing.T) {
+	useClock(t, time.Date(2024, 3, 4, 8, 0, 0, 0, time.UTC))
+	t.Cleanup(func() {
+		maintenanceMode.Store(false)
+		silenceMu.Lock()
+		silencedUntil = map[string]time.Time{}
+		silenceMu.Unlock()
+	})
+	if ringRelay("term", "") {
+		t.Error("rang without a relay set up")
+	}
+	pin := useRelay(t, true, time.Millisecond)
+
+	maintenanceMode.Store(true)
+	if ringRelay("term", "") {
+		t.Error("rang in maintenance mode")
+	}
+	maintenanceMode.Store(false)
+
+	silenceMu.Lock()
+	silencedUntil["gym"] = time.Date(2024, 3, 4, 9, 0, 0, 0, time.UTC)
+	silenceMu.Unlock()
+	if ringRelay("term", "gym") {
+		t.Error("rang with its zone silenced")
+	}
+	if len(pin.levels()) != 0 {
+		t.Errorf("levels = %+v, want the pin untouched", pin.levels())
+	}
+	// another zone's silence doesn't hold it back
+	if !ringRelay("term", "") || len(pin.levels()) != 2 {
+		t.Errorf("levels = %+v, want a pulse", pin.levels())
+	}
+}
+
+func TestRelayEvents(t *testing.T) {
+	testDir(t)
+	pin := useRelay(t, true, time.Millisecond)
+	ch := &stubNotifier{name: "chat"}
+	useNotifiers(t, ch)
+	player := &recordingPlayer{}
+	useQueue(t, player, 4)
+	loadSchedule(t, time.Date(2024, 3, 4, 7, 0, 0, 0, time.UTC), `[{"name": "term", "starts": "2024-01-01", "ends": "2024-12-31", "days": [{"name": "Monday", "events": [
+		{"time": "08:00", "sound": "bell.mp3", "relay": "only"},
+		{"time": "09:00", "sound": "bell.mp3", "relay": "also"}
+	]}]}]`)
+
+	runBell(t, "term", "08:00")
+	waitFor(t, "the relay", func() bool { return len(ch.sent()) == 1 })
+	if got := pin.levels(); len(got) != 2 || player.count() != 0 {
+		t.Errorf("levels = %+v, played %d, want only a pulse", got, player.count())
+	}
+
+	runBell(t, "term", "09:00")
+	waitFor(t, "the bell", func() bool { return player.count() == 1 && len(pin.levels()) == 4 && len(ch.sent()) == 2 })
+
+	if err := checkRelay("sometimes"); err == nil || !strings.Contains(err.Error(), "invalid relay") {
+		t.Errorf("checkRelay(sometimes) = %v, want it rejected", err)
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// remoteSchedule is the last schedule fetched from schedule.url, kept to
+// answer 304s and to fall back on when the server can't be reached.
+var (
+	remoteSchedule   []byte
+	remoteScheduleMu sync.Mutex
+	remoteETag       string
+)
+
+// maxRemoteSchedule caps the size of a fetched schedule.
+const maxRemoteSchedule = 10 << 20
+
+// loadScheduleSource returns the raw schedule document, from schedule.url
+// when set and from the schedule file otherwise. When ctx ends first, its
+// error is returned instead of falling back to the cached copy.
+func loadScheduleSource(ctx context.Context) ([]byte, error) {
+	url := viper.GetString("schedule.url")
+	if url == "" {
+		jsonFile, err := os.ReadFile(scheduleFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not open schedule.json: %v", err)
+		}
+		return jsonFile, nil
+	}
+
+	remoteScheduleMu.Lock()
+	defer remoteScheduleMu.Unlock()
+
+	body, err := fetchRemoteSchedule(ctx, url)
+	if err == nil {
+		return body, nil
+	}
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	if remoteSchedule == nil {
+		cached, cacheErr := os.ReadFile(viper.GetString("schedule.cache-file"))
+		if cacheErr != nil {
+			return nil, fmt.Errorf("could not fetch schedule and there's no cached copy: %v", err)
+		}
+		remoteSchedule = cached
+	}
+	log.Warnf("Could not fetch schedule, using the cached copy: %v", err)
+	return remoteSchedule, nil
+}
+
+// fetchRemoteSchedule gets url, sending the ETag of the cached copy so an
+// unchanged schedule isn't downloaded again. Only a schedule that validates
+// is kept and cached. Callers must hold remoteScheduleMu.
+func fetchRemoteSchedule(ctx context.Context, url string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, viper.GetDuration("schedule.fetch-timeout"))
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if token := viper.GetString("schedule.token"); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	if remoteSchedule != nil && remoteETag != "" {
+		req.Header.Set("If-None-Match", remoteETag)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		if remoteSchedule == nil {
+			return nil, fmt.Errorf("got 304 without a cached schedule")
+		}
+		log.Debugf("Remote schedule not modified")
+		return remoteSchedule, nil
+	case http.StatusOK:
+	default:
+		return nil, fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxRemoteSchedule))
+	if err != nil {
+		return nil, err
+	}
+	// a bad document mustn't replace the last good copy
+	_, err = decodeSchedule(body)
+	if err != nil {
+		return nil, fmt.Errorf("invalid remote schedule: %v", err)
+	}
+	remoteSchedule = body
+	remoteETag = resp.Header.Get("ETag")
+
+	err = os.WriteFile(viper.GetString("schedule.cache-file"), body, 0644)
+	if err != nil {
+		log.Errorf("Could not cache remote schedule: %v", err)
+	}
+	return body, nil
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func useRemote(t *testing.T, handler http.HandlerFunc) string {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	cacheFile := filepath.Join(t.TempDir(), "schedule.remote.json")
+	setConfig(t, "schedule.url", server.URL+"/schedule.json")
+	setConfig(t, "schedule.token", "secret")
+	setConfig(t, "schedule.fetch-timeout", time.Second)
+	setConfig(t, "schedule.cache-file", cacheFile)
+	t.Cleanup(func() {
+		remoteScheduleMu.Lock()
+		remoteSchedule, remoteETag = nil, ""
+		remoteScheduleMu.Unlock()
+	})
+	return cacheFile
+}
+
+func TestRemoteSchedule(t *testing.T) {
+	testDir(t)
+	var status atomic.Int32
+	status.Store(http.StatusOK)
+	var fetches, notModified atomic.Int32
+	cacheFile := useRemote(t, func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if s := int(status.Load()); s != http.StatusOK {
+			w.WriteHeader(s)
+			return
+		}
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			notModified.Add(1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte(mondayBells))
+	})
+	load := func() string {
+		t.Helper()
+		body, err := loadScheduleSource(context.Background())
+		if err != nil {
+			t.Fatalf("loadScheduleSource: %v", err)
+		}
+		return string(body)
+	}
+
+	if body := load(); body != mondayBells {
+		t.Fatalf("fetched %q, want the served schedule", body)
+	}
+	if cached, _ := os.ReadFile(cacheFile); string(cached) != mondayBells {
+		t.Errorf("cache file = %q, want the fetched schedule", cached)
+	}
+
+	if body := load(); body != mondayBells || notModified.Load() != 1 {
+		t.Errorf("refetch = %q with %d 304s, want the cached copy on a 304", body, notModified.Load())
+	}
+
+	status.Store(http.StatusInternalServerError)
+	if body := load(); body != mondayBells {
+		t.Errorf("fetch failure = %q, want the last good copy", body)
+	}
+
+	// after a restart only the cache file is left
+	remoteSchedule, remoteETag = nil, ""
+	if body := load(); body != mondayBells {
+		t.Errorf("fetch failure after a restart = %q, want the cache file", body)
+	}
+
+	remoteSchedule, remoteETag = nil, ""
+	os.Remove(cacheFile)
+	if _, err := loadScheduleSource(context.Background()); err == nil {
+		t.Error("fetch failure without a cache succeeded")
+	}
+	if fetches.Load() != 5 {
+		t.Errorf("%d fetches, want one per load", fetches.Load())
+	}
+
+	status.Store(http.StatusOK)
+	loadSchedule(t, time.Date(2024, 3, 4, 7, 0, 0, 0, time.UTC), `[]`)
+	if bells := entriesOf("bell"); len(bells) != 1 || bells[0].Schedule != "term" {
+		t.Errorf("bells = %v, want the remote schedule's, not the file's", bells)
+	}
+}
+
+func TestRemoteScheduleRejected(t *testing.T) {
+	testDir(t)
+	var served atomic.Value
+	served.Store(mondayBells)
+	cacheFile := useRemote(t, func(w http.ResponseWriter, r *http.Request) {
+		body := served.Load().(string)
+		if body == "" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(body))
+	})
+	loadSchedule(t, time.Date(2024, 3, 4, 7, 0, 0, 0, time.UTC), `[]`)
+	stillTerm := func(when string) {
+		t.Helper()
+		if bells := entriesOf("bell"); len(bells) != 1 || bells[0].Schedule != "term" {
+			t.Errorf("bells %s = %+v, want term's", when, bells)
+		}
+		if cached, _ := os.ReadFile(cacheFile); string(cached) != mondayBells {
+			t.Errorf("cache file %s = %q, want the good schedule", when, cached)
+		}
+	}
+	stillTerm("after the first fetch")
+
+	served.Store(`[{"name": "term", "days": "Monday"}]`)
+	if err := parseSchedule(context.Background()); err != nil {
+		t.Errorf("reload with an invalid remote schedule = %v, want the last good copy", err)
+	}
+	stillTerm("after an invalid schedule")
+
+	served.Store("")
+	if err := parseSchedule(context.Background()); err != nil {
+		t.Errorf("reload while the remote is down = %v, want the last good copy", err)
+	}
+	stillTerm("while the remote is down")
+
+	// after a restart only the cache file is left
+	remoteSchedule, remoteETag = nil, ""
+	if body, err := loadScheduleSource(context.Background()); err != nil || string(body) != mondayBells {
+		t.Errorf("fetch failure after a restart = %q, %v, want the good schedule", body, err)
+	}
+}
+
+func TestReloadTimesOut(t *testing.T) {
+	testDir(t)
+	loadSchedule(t, time.Date(2024, 3, 4, 7, 0, 0, 0, time.UTC), mondayBells)
+	// schedule.url hangs until the reload gives up on it
+	useRemote(t, func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	})
+	setConfig(t, "app.request-timeout", 100*time.Millisecond)
+
+	start := time.Now()
+	rec := apiRequest(t, "POST", "/api/v1/reload", "")
+	if rec.Code != http.StatusGatewayTimeout {
+		t.Errorf("reload = %d %s, want 504", rec.Code, rec.Body)
+	}
+	if waited := time.Since(start); waited > 500*time.Millisecond {
+		t.Errorf("reload answered after %s, want app.request-timeout", waited)
+	}
+	if bells := entriesOf("bell"); len(bells) != 1 || bells[0].Schedule != "term" {
+		t.Errorf("bells = %+v, want term's still ringing", bells)
+	}
+}
+
+func TestEditsReloadWithRequest(t *testing.T) {
+	testDir(t)
+	loadSchedule(t, time.Date(2024, 3, 4, 7, 0, 0, 0, time.UTC), mondayBells)
+	// calendar.url hangs until the reload gives up on it
+	feed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	t.Cleanup(feed.Close)
+	setConfig(t, "calendar.url", feed.URL)
+	setConfig(t, "schedule.fetch-timeout", 5*time.Second)
+	setConfig(t, "app.request-timeout", 100*time.Millisecond)
+	t.Cleanup(func() {
+		scheduleMu.Lock()
+		pinnedSchedule, activeTheme = "", ""
+		scheduleMu.Unlock()
+	})
+
+	tests := []struct {
+		method, target, body string
+	}{
+		{"POST", "/api/v1/active", `{"name": "term"}`},
+		{"DELETE", "/api/v1/active", ""},
+		{"POST", "/api/v1/theme", `{"name": ""}`},
+		{"PUT", "/api/v1/schedules/term/days/MON/enabled", `{"enabled": true}`},
+	}
+	for _, tt := range tests {
+		start := time.Now()
+		if rec := apiRequest(t, tt.method, tt.target, tt.body); rec.Code != http.StatusGatewayTimeout {
+			t.Errorf("%s %s = %d %s, want 504", tt.method, tt.target, rec.Code, rec.Body)
+		}
+		if waited := time.Since(start); waited > time.Second {
+			t.Errorf("%s %s answered after %s, want app.request-timeout", tt.method, tt.target, waited)
+		}
+	}
+}
+
+func TestReloadCoalesced(t *testing.T) {
+	testDir(t)
+	loadSchedule(t, time.Date(2024, 3, 4, 7, 0, 0, 0, time.UTC), mondayBells)
+	forgetReloads := func() {
+		apiReloads.mu.Lock()
+		apiReloads.last = time.Time{}
+		apiReloads.mu.Unlock()
+	}
+	forgetReloads()
+	t.Cleanup(forgetReloads)
+	fetching, release := make(chan struct{}, 8), make(chan struct{})
+	var fetches atomic.Int32
+	useRemote(t, func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		fetching <- struct{}{}
+		<-release
+		w.Write([]byte(mondayBells))
+	})
+	setConfig(t, "schedule.reload-min-interval", time.Hour)
+
+	codes := make(chan int, 5)
+	reload := func() { codes <- apiRequest(t, "POST", "/api/v1/reload", "").Code }
+	go reload()
+	<-fetching
+	// these arrive while the first reload is still fetching
+	for range 4 {
+		go reload()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	for range 5 {
+		if code := <-codes; code != http.StatusOK {
+			t.Errorf("reload = %d, want 200", code)
+		}
+	}
+	if got := fetches.Load(); got != 1 {
+		t.Errorf("5 reloads fetched %d times, want them coalesced into 1", got)
+	}
+
+	rec := apiRequest(t, "POST", "/api/v1/reload", "")
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "3600" {
+		t.Errorf("reload right after = %d, Retry-After %q, want 429 in an hour", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	if fetches.Load() != 1 {
+		t.Errorf("a refused reload fetched the schedule")
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"net/http"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+const (
+	ringTestTone     = 880
+	ringTestDuration = 300 * time.Millisecond
+	// ringTestTimeout bounds the wait for the beep, queued bells included,
+	// when app.request-timeout doesn't.
+	ringTestTimeout = 30 * time.Second
+	// ringTestMargin is kept from app.request-timeout to answer in.
+	ringTestMargin = 2 * time.Second
+)
+
+// ringTestWait is how long the ring test waits for the beep: short of
+// app.request-timeout by ringTestMargin, so the result is still written, and
+// at most ringTestTimeout.
+func ringTestWait() time.Duration {
+	timeout := viper.GetDuration("app.request-timeout")
+	if timeout <= 0 {
+		return ringTestTimeout
+	}
+	wait := timeout - ringTestMargin
+	if wait <= 0 {
+		wait = timeout / 2
+	}
+	return min(wait, ringTestTimeout)
+}
+
+// ringTestBeep is the beep played by the ring test, a sine at half volume
+// faded in and out so it doesn't click.
+var ringTestBeep = beep(samplingRate, ringTestTone, ringTestDuration)
+
+// beep returns a tone of freq Hz lasting d as 16 bit stereo PCM at rate.
+func beep(rate int, freq float64, d time.Duration) []byte {
+	frames := int(int64(rate) * int64(d) / int64(time.Second))
+	fade := rate / 100
+	pcm := make([]byte, frames*numOfChannels*audioBitDepth)
+	for i := 0; i < frames; i++ {
+		gain := 0.5
+		if i < fade {
+			gain *= float64(i) / float64(fade)
+		} else if frames-i < fade {
+			gain *= float64(frames-i) / float64(fade)
+		}
+		sample := int16(gain * math.MaxInt16 * math.Sin(2*math.Pi*freq*float64(i)/float64(rate)))
+		for c := 0; c < numOfChannels; c++ {
+			binary.LittleEndian.PutUint16(pcm[(i*numOfChannels+c)*audioBitDepth:], uint16(sample))
+		}
+	}
+	return pcm
+}
+
+type ringTestResult struct {
+	Success bool   `json:"success"`
+	Backend string `json:"backend"`
+	// LatencyMs is from the request to the backend taking the beep's first
+	// sample, including any sounds queued ahead of it.
+	LatencyMs *int64 `json:"latencyMs"`
+	Error     string `json:"error,omitempty"`
+}
+
+// postRingTestHandler plays a short built in beep through the play queue and
+// the audio backend, and answers whether it played and how long it took to
+// start. Like a manual play it's refused in quiet hours without
+// ?override=true.
+func postRingTestHandler(w http.ResponseWriter, r *http.Request) {
+	if inQuietHours(appClock.Now()) {
+		if r.URL.Query().Get("override") != "true" {
+			writeError(w, http.StatusForbidden, "quiet hours, pass override=true to play anyway")
+			return
+		}
+		log.Warnf("Ring test during quiet hours overridden by %s", getIPAddress(r))
+	}
+	start := time.Now()
+	job := &playJob{
+		Sound:   "ring-test",
+		PCM:     ringTestBeep,
+		Started: make(chan time.Time, 1),
+		Done:    make(chan error, 1),
+	}
+	err := enqueuePlay(job)
+	if errors.Is(err, errDuplicate) {
+		writeError(w, http.StatusConflict, "a ring test is already running")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+
+	result := &ringTestResult{Backend: audioBackendName(audioBackend)}
+	timeout := time.NewTimer(ringTestWait())
+	defer timeout.Stop()
+	var started time.Time
+	for done := false; !done; {
+		select {
+		case started = <-job.Started:
+		case err = <-job.Done:
+			done = true
+		case <-timeout.C:
+			err = errors.New("timed out waiting for the beep")
+			done = true
+		case <-r.Context().Done():
+			err = errors.New("request ended waiting for the beep")
+			done = true
+		}
+	}
+	if !started.IsZero() {
+		latency := started.Sub(start).Milliseconds()
+		result.LatencyMs = &latency
+	}
+	result.Success = err == nil && !started.IsZero()
+	if err != nil {
+		result.Error = err.Error()
+	}
+	log.WithFields(log.Fields{
+		"Success":   result.Success,
+		"LatencyMs": result.LatencyMs,
+		"Error":     result.Error,
+	}).Info("Ring test")
+	writeJSON(w, http.StatusOK, result)
+}
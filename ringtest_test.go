@@ -0,0 +1,76 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRingTest(t *testing.T) {
+	t.Run("plays", func(t *testing.T) {
+		useQueue(t, &nullPlayer{}, 4)
+		rec := apiRequest(t, "POST", "/api/v1/ring-test", "")
+		result := &ringTestResult{}
+		decodeBody(t, rec, result)
+		if rec.Code != http.StatusOK || !result.Success || result.Backend != "none" || result.Error != "" {
+			t.Fatalf("ring test = %d %s, want a success on none", rec.Code, rec.Body)
+		}
+		if result.LatencyMs == nil || *result.LatencyMs < 0 {
+			t.Errorf("latencyMs = %v, want it measured", result.LatencyMs)
+		}
+	})
+
+	t.Run("the beep", func(t *testing.T) {
+		player := &recordingPlayer{}
+		useQueue(t, player, 4)
+		apiRequest(t, "POST", "/api/v1/ring-test", "")
+		if player.count() != 1 || len(player.played[0]) != len(ringTestBeep) || player.rates[0] != samplingRate {
+			t.Fatalf("played %d sounds, want the %d byte beep at %d", player.count(), len(ringTestBeep), samplingRate)
+		}
+		// 300ms of 16 bit stereo, silent at both ends
+		if want := samplingRate * 3 / 10 * numOfChannels * audioBitDepth; len(ringTestBeep) != want {
+			t.Errorf("beep is %d bytes, want %d", len(ringTestBeep), want)
+		}
+		if ringTestBeep[0] != 0 || ringTestBeep[1] != 0 {
+			t.Errorf("beep starts at %v, want silence", ringTestBeep[:2])
+		}
+	})
+
+	t.Run("times out", func(t *testing.T) {
+		setConfig(t, "app.request-timeout", 100*time.Millisecond)
+		player := &recordingPlayer{gate: make(chan struct{})}
+		useQueue(t, player, 4)
+		t.Cleanup(func() { close(player.gate) })
+		start := time.Now()
+		rec := apiRequest(t, "POST", "/api/v1/ring-test", "")
+		if waited := time.Since(start); waited > time.Second {
+			t.Errorf("answered after %s, want within app.request-timeout", waited)
+		}
+		if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"latencyMs":null`) {
+			t.Errorf("ring test = %d %s, want 200 with no latency", rec.Code, rec.Body)
+		}
+		result := &ringTestResult{}
+		decodeBody(t, rec, result)
+		if result.Success || result.Error != "timed out waiting for the beep" {
+			t.Errorf("result = %+v, want a timeout", result)
+		}
+	})
+}
+
+func TestRingTestWait(t *testing.T) {
+	tests := []struct {
+		timeout, want time.Duration
+	}{
+		{0, ringTestTimeout},
+		{10 * time.Second, 8 * time.Second},
+		{time.Second, 500 * time.Millisecond},
+		{time.Minute, ringTestTimeout},
+	}
+	for _, tt := range tests {
+		setConfig(t, "app.request-timeout", tt.timeout)
+		if got := ringTestWait(); got != tt.want {
+			t.Errorf("ringTestWait with app.request-timeout %s = %s, want %s", tt.timeout, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// maxRTPPayload keeps packets under a typical 1500 byte MTU.
+const maxRTPPayload = 1400
+
+// rtpPlayer streams 16 bit PCM to an IP speaker as RTP over UDP, using the
+// L16 payload of RFC 3551: big endian samples, a timestamp counting frames.
+// Packets are paced in real time so the receiver's buffer doesn't overflow.
+type rtpPlayer struct {
+	address     string
+	payloadType int
+	packetMs    int
+}
+
+func (p *rtpPlayer) Play(ctx context.Context, pcm io.Reader, rate, channels int) error {
+	if p.address == "" {
+		return errors.New("audio.rtp.address is not set")
+	}
+	conn, err := net.Dial("udp", p.address)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	frameSize := channels * audioBitDepth
+	frames := rate * p.packetMs / 1000
+	if frames*frameSize > maxRTPPayload {
+		frames = maxRTPPayload / frameSize
+	}
+	if frames < 1 {
+		frames = 1
+	}
+	packetTime := time.Duration(frames) * time.Second / time.Duration(rate)
+
+	// RFC 3550 wants random initial values
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+	ssrc := r.Uint32()
+	seq := uint16(r.Uint32())
+	timestamp := r.Uint32()
+	buf := make([]byte, frames*frameSize)
+	packet := make([]byte, 12+len(buf))
+	start := time.Now()
+	sent := 0
+	for {
+		n, err := io.ReadFull(pcm, buf)
+		if err == io.EOF {
+			break
+		}
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return err
+		}
+		// drop a trailing partial frame
+		n -= n % frameSize
+		if n == 0 {
+			break
+		}
+
+		packet[0] = 0x80
+		packet[1] = byte(p.payloadType & 0x7f)
+		if sent == 0 {
+			// marker on the first packet of a talkspurt
+			packet[1] |= 0x80
+		}
+		binary.BigEndian.PutUint16(packet[2:], seq)
+		binary.BigEndian.PutUint32(packet[4:], timestamp)
+		binary.BigEndian.PutUint32(packet[8:], ssrc)
+		for i := 0; i < n; i += 2 {
+			packet[12+i], packet[13+i] = buf[i+1], buf[i]
+		}
+		_, err = conn.Write(packet[:12+n])
+		if err != nil {
+			return err
+		}
+		seq++
+		timestamp += uint32(n / frameSize)
+		sent++
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Until(start.Add(time.Duration(sent) * packetTime))):
+		}
+	}
+	log.Debugf("Sent %d RTP packets to %s", sent, p.address)
+	return nil
+}
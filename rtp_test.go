@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestRTPPackets(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	setConfig(t, "audio.rtp.address", conn.LocalAddr().String())
+	setConfig(t, "audio.rtp.payload-type", 96)
+	setConfig(t, "audio.rtp.packet-ms", 20)
+	player, err := newAudioPlayer("rtp")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 50 ms of 48 kHz stereo, with a trailing partial frame that's dropped
+	pcm := make([]byte, 2400*4+3)
+	for i := range pcm {
+		pcm[i] = byte(i)
+	}
+	err = player.Play(context.Background(), bytes.NewReader(pcm), 48000, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 20 ms would be 3840 bytes, over the MTU, so packets carry 350 frames
+	payloads := []int{1400, 1400, 1400, 1400, 1400, 1400, 1200}
+	var first []byte
+	payload := []byte{}
+	buf := make([]byte, 2000)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for i, size := range payloads {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("packet %d: %v", i, err)
+		}
+		packet := append([]byte{}, buf[:n]...)
+		if n != 12+size {
+			t.Fatalf("packet %d is %d bytes, want %d", i, n, 12+size)
+		}
+		if first == nil {
+			first = packet
+		}
+		if packet[0] != 0x80 {
+			t.Errorf("packet %d version byte = %#x, want RTP version 2", i, packet[0])
+		}
+		if marker := packet[1]&0x80 != 0; marker != (i == 0) || packet[1]&0x7f != 96 {
+			t.Errorf("packet %d = marker %v, payload type %d, want the marker on the first only and type 96", i, marker, packet[1]&0x7f)
+		}
+		seq := binary.BigEndian.Uint16(packet[2:]) - binary.BigEndian.Uint16(first[2:])
+		timestamp := binary.BigEndian.Uint32(packet[4:]) - binary.BigEndian.Uint32(first[4:])
+		if int(seq) != i || int(timestamp) != i*350 || !bytes.Equal(packet[8:12], first[8:12]) {
+			t.Errorf("packet %d = seq +%d, timestamp +%d, want +%d, +%d with one SSRC", i, seq, timestamp, i, i*350)
+		}
+		payload = append(payload, packet[12:]...)
+	}
+	for i := 0; i < len(payload); i += 2 {
+		if payload[i] != pcm[i+1] || payload[i+1] != pcm[i] {
+			t.Fatalf("sample at %d = % x, want % x byte swapped to big endian", i, payload[i:i+2], pcm[i:i+2])
+		}
+	}
+}
+
+func TestRTPWithoutAddress(t *testing.T) {
+	player := &rtpPlayer{packetMs: 20}
+	if err := player.Play(context.Background(), bytes.NewReader(make([]byte, 4)), 48000, 2); err == nil {
+		t.Error("played without audio.rtp.address")
+	}
+}
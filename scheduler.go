@@ -2,66 +2,286 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"math"
 	"os"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/hajimehoshi/go-mp3"
-	"github.com/hajimehoshi/oto/v2"
 	"github.com/robfig/cron/v3"
 	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
 )
 
+// scheduleFile is where the schedule is loaded from and saved to.
+const scheduleFile = "./schedule.json"
+
 var cronService *cron.Cron
 
+// cronParser accepts the standard 5 field specs plus an optional leading
+// seconds field, used to shift bells by audio.offset-ms.
+var cronParser = cron.NewParser(cron.SecondOptional | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
+// scheduleMu guards cronService, entryMeta, entryKeys and the parse results
+// below, which are updated on every parse.
+var scheduleMu sync.RWMutex
+
+// loadedSchedules is the last parsed schedule.json document.
+var loadedSchedules []*schedule
+
+// generatedSchedules are the ones the last parse made from calendar.url. They
+// ring like the others but aren't part of the document, so they're kept out
+// of loadedSchedules: not exported, imported or pinned.
+var generatedSchedules []*schedule
+
+// activeSchedules are the names of the schedules configured in cron.
+var activeSchedules []string
+
+// pinnedSchedule, when set, is configured instead of the schedules selected
+// by their date windows.
+var pinnedSchedule string
+
+// parseWarnings are the problems found by the last parse that didn't stop
+// it, reported back by the reload endpoint.
+var parseWarnings []string
+
+// parseErrors are the schedules, days and events the last parse had to
+// leave out, reported back by the reload endpoint.
+var parseErrors []*scheduleError
+
+// scheduleError is a part of the schedule that couldn't be configured.
+type scheduleError struct {
+	Schedule string `json:"schedule"`
+	Day      string `json:"day,omitempty"`
+	Time     string `json:"time,omitempty"`
+	Message  string `json:"message"`
+}
+
+// entryMeta describes what each cron entry was registered for.
+var entryMeta = map[cron.EntryID]*entryInfo{}
+
+// entryKeys maps what an entry does, see addEntry, to its cron entry so a
+// reparse keeps the entries that didn't change. parsedKeys collects the keys
+// seen by the parse in progress.
+var (
+	entryKeys  = map[string]cron.EntryID{}
+	parsedKeys map[string]cron.EntryID
+)
+
+type entryInfo struct {
+	Kind     string `json:"kind"`
+	Schedule string `json:"schedule,omitempty"`
+	Day      string `json:"day,omitempty"`
+	Time     string `json:"time,omitempty"`
+	Cron     string `json:"cron,omitempty"`
+	Sound    string `json:"sound,omitempty"`
+	Zone     string `json:"zone,omitempty"`
+	Label    string `json:"label,omitempty"`
+	Role     string `json:"role,omitempty"`
+	// Broken is why the bell won't sound, like a missing sound file it was
+	// registered with anyway, see schedule.strict-sounds.
+	Broken string `json:"broken,omitempty"`
+	// fired is the bell's bellFiredKey.
+	fired string
+}
+
+// boundaryTimer reparses the schedule when the nearest date window opens or
+// closes, so activation doesn't wait for the daily reparse.
+var boundaryTimer *time.Timer
+
 type event struct {
-	Time  string `json:"time"`
-	Sound string `json:"sound"`
+	Time string `json:"time,omitempty"`
+	// Second rings the bell that many seconds into Time's minute.
+	Second int      `json:"second,omitempty"`
+	Sound  string   `json:"sound"`
+	Zone   string   `json:"zone,omitempty"`
+	Volume *float64 `json:"volume,omitempty"`
+	Label  string   `json:"label,omitempty"`
+	Note   string   `json:"note,omitempty"`
+	// Role marks a ceremonial bell, "first" or "last" of the day.
+	Role string `json:"role,omitempty"`
+	// Choices, when "sound" is a list, are picked from at random each time
+	// the bell rings, and Sound is the first one. See UnmarshalJSON.
+	Choices []*soundChoice `json:"-"`
+	// SoundData is the sound inline, base64 encoded in SoundFormat, and
+	// Sound only names it.
+	SoundData   string `json:"sound_data,omitempty"`
+	SoundFormat string `json:"sound_format,omitempty"`
+	// StartMs and EndMs play only that part of Sound, EndMs 0 to its end.
+	StartMs int `json:"start_ms,omitempty"`
+	EndMs   int `json:"end_ms,omitempty"`
+	// Cron, when set, is registered as is and Time and the day are ignored.
+	Cron string `json:"cron,omitempty"`
+	// Playlist sounds play after Sound, overlapping by CrossfadeMs.
+	Playlist    []string `json:"playlist,omitempty"`
+	CrossfadeMs int      `json:"crossfade_ms,omitempty"`
+	// Repeat plays the sound that many times (default 1), RepeatGapMs apart.
+	Repeat      int `json:"repeat,omitempty"`
+	RepeatGapMs int `json:"repeat_gap_ms,omitempty"`
+	// RelativeTo "sunrise" or "sunset" rings OffsetMinutes after it, in
+	// place of Time. See sunEventTime.
+	RelativeTo    string `json:"relative_to,omitempty"`
+	OffsetMinutes int    `json:"offset_minutes,omitempty"`
+	// Relay "also" pulses the relay as the sound plays, "only" instead of
+	// playing a sound.
+	Relay string `json:"relay,omitempty"`
+	// Weather sounds play in place of Sound when the bell rings in their
+	// weather. See weatherChoice.
+	Weather []*weatherSound `json:"weather,omitempty"`
+	// from is the schedule a program's part event comes from, see
+	// eventSchedule.
+	from *schedule
 }
 
 type day struct {
-	Name   string   `json:"name"`
-	Events []*event `json:"events"`
+	Name  string `json:"name"`
+	Label string `json:"label,omitempty"`
+	Note  string `json:"note,omitempty"`
+	// Enabled false keeps the day in the file without registering its bells.
+	Enabled *bool `json:"enabled,omitempty"`
+	// DefaultSound is played by the day's events that don't set a sound,
+	// ahead of audio.default-sound.
+	DefaultSound string   `json:"default_sound,omitempty"`
+	Events       []*event `json:"events"`
+}
+
+func (d *day) isEnabled() bool {
+	return d.Enabled == nil || *d.Enabled
 }
 
 type schedule struct {
-	Name   string `json:"name"`
-	Starts string `json:"starts"`
-	Ends   string `json:"ends"`
-	Days   []*day `json:"days"`
+	Name    string `json:"name"`
+	Label   string `json:"label,omitempty"`
+	Note    string `json:"note,omitempty"`
+	Starts  string `json:"starts,omitempty"`
+	Ends    string `json:"ends,omitempty"`
+	Default bool   `json:"default,omitempty"`
+	// Recur "yearly" reads Starts and Ends as month-days repeating every year.
+	Recur string `json:"recur,omitempty"`
+	// Timezone overrides app.timezone for this schedule's date window and
+	// bell times.
+	Timezone string `json:"timezone,omitempty"`
+	// SoundsDir, a folder of audio.sounds-dir, holds this schedule's sounds
+	// instead of audio.sounds-dir itself.
+	SoundsDir   string        `json:"sounds_dir,omitempty"`
+	VolumeTiers []*volumeTier `json:"volume_tiers,omitempty"`
+	// Program adds the events of other schedules, each within its window of
+	// the day, to this one's. See expandPrograms.
+	Program []*programPart `json:"program,omitempty"`
+	Days    []*day         `json:"days"`
 }
 
-func parseSchedule() error {
-	jsonFile, err := os.ReadFile("./schedule.json")
+// parseSchedule loads schedule.json, or schedule.url, and rebuilds the cron service from it.
+// If the file can't be read or parsed, or ctx ends while loading it, the
+// running schedule is left alone.
+func parseSchedule(ctx context.Context) error {
+	return buildSchedule(ctx, false)
+}
+
+// decodeSchedule validates the schedule document raw against the schema and
+// decodes it.
+func decodeSchedule(raw []byte) ([]*schedule, error) {
+	raw = scheduleJSON(raw)
+	err := validateScheduleJSON(raw)
 	if err != nil {
-		log.Fatalf("Could not open schedule.json: %v", err)
+		return nil, err
 	}
-
 	data := []*schedule{}
-	err = json.Unmarshal(jsonFile, &data)
+	err = json.Unmarshal(raw, &data)
 	if err != nil {
-		log.Fatalf("Could not parse schedule.json: %v", err)
+		return nil, fmt.Errorf("could not parse schedule.json: %v", err)
 	}
+	return data, nil
+}
 
-	if cronService != nil {
+// buildSchedule is parseSchedule. With fresh, the entries that didn't change
+// are registered again as well, in a new cron service, so every next fire
+// time is worked out from the clock as it is now.
+func buildSchedule(ctx context.Context, fresh bool) (err error) {
+	defer func() { recordParse(appClock.Now(), err) }()
+	jsonFile, err := loadScheduleSource(ctx)
+	if err != nil {
+		return err
+	}
+	data, err := decodeSchedule(jsonFile)
+	if err != nil {
+		return err
+	}
+	generated := calendarSchedules(ctx, appClock.Now())
+	// past this point the cron service is rebuilt in one go
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	scheduleMu.Lock()
+	defer scheduleMu.Unlock()
+
+	if fresh && cronService != nil {
+		// jobs already running finish on their own
 		cronService.Stop()
+		cronService = nil
+		entryKeys = map[string]cron.EntryID{}
+		entryMeta = map[cron.EntryID]*entryInfo{}
 	}
-	cronService = cron.New()
-	now := time.Now()
-	for _, sch := range data {
-		starts, err := time.Parse("2006-01-02", sch.Starts)
-		if err != nil {
-			log.Errorf("Could not parse start date: %s : %v", sch.Starts, err)
+	if cronService == nil {
+		cronService = cron.New(cron.WithLocation(globalLocation()), cron.WithParser(cronParser))
+	}
+	parsedKeys = map[string]cron.EntryID{}
+	loadedSchedules = data
+	generatedSchedules = generated
+	activeSchedules = []string{}
+	parseWarnings = []string{}
+	parseErrors = []*scheduleError{}
+	var found bool
+	parseTheme, found = themeSounds(activeTheme)
+	if !found {
+		addWarning("Theme not found, playing the schedule's sounds: %s", activeTheme)
+	}
+	expanded, problems := expandPrograms(runningSchedules())
+	for _, p := range problems {
+		addScheduleError(p.Schedule, p.Day, p.Time, "%s", p.Message)
+	}
+	now := appClock.Now()
+	var nextBoundary time.Time
+	var fallback *schedule
+	active := 0
+	pinned := findExpanded(expanded, data, pinnedSchedule)
+	if pinnedSchedule != "" && pinned == nil {
+		addWarning("Pinned schedule not found, using date windows: %s", pinnedSchedule)
+	}
+	if pinned != nil {
+		log.Printf("Configuring pinned schedule: %s", pinned.Name)
+		activateSchedule(pinned, now, now.AddDate(1, 0, 0), scheduleLocationOrGlobal(pinned))
+		// the date windows don't matter while pinned
+		expanded = nil
+	}
+	for _, sch := range expanded {
+		if sch.Default {
+			if fallback != nil {
+				log.Warnf("Multiple default schedules, ignoring: %s (using %s)", sch.Name, fallback.Name)
+				continue
+			}
+			fallback = sch
 			continue
 		}
-		ends, err := time.Parse("2006-01-02", sch.Ends)
+		starts, ends, loc, err := scheduleWindow(sch, now)
 		if err != nil {
-			log.Errorf("Could not parse start date: %s : %v", sch.Starts, err)
+			addScheduleError(sch.Name, "", "", "Could not read date window: %v", err)
 			continue
 		}
+		for _, boundary := range []time.Time{starts, ends} {
+			if boundary.After(now) && (nextBoundary.IsZero() || boundary.Before(nextBoundary)) {
+				nextBoundary = boundary
+			}
+		}
 		if now.Before(starts) {
 			continue
 		}
@@ -70,23 +290,352 @@ func parseSchedule() error {
 		}
 
 		log.Printf("Configuring schedule: %s", sch.Name)
-		err = configureDays(sch.Days)
+		activateSchedule(sch, now, ends, loc)
+		active++
+	}
+
+	// the default schedule only applies when no dated schedule matches today
+	if active == 0 && fallback != nil {
+		log.Printf("Configuring default schedule: %s", fallback.Name)
+		activateSchedule(fallback, now, now.AddDate(1, 0, 0), scheduleLocationOrGlobal(fallback))
+	}
+
+	// Without the daily reparse, date windows are only re-evaluated on an
+	// explicit reload.
+	if viper.GetBool("schedule.daily-reparse") {
+		spec := viper.GetString("schedule.reparse-cron")
+		_, err := addEntry("reparse|"+spec, spec, &entryInfo{Kind: "reparse"}, func() {
+			reloadSchedule(context.Background())
+		})
 		if err != nil {
-			log.Errorf("Could not configure days: %v", err)
+			log.Errorf("Could not schedule daily reparse: %s : %v", spec, err)
 		}
-		cronService.AddFunc("1 0 * * *", func() {
-			parseSchedule()
+	}
+	if viper.GetBool("schedule.drift-check") {
+		_, err := addEntry("drift|"+driftProbeSpec, driftProbeSpec, &entryInfo{Kind: "drift"}, func() {
+			checkDrift(time.Now())
+		})
+		if err != nil {
+			log.Errorf("Could not schedule drift check: %v", err)
+		}
+	}
+	removeStaleEntries()
+	cronService.Start()
+	cronRunning.Store(true)
+	checkBellsToday(now)
+	catchUpBells(now)
+
+	if boundaryTimer != nil {
+		boundaryTimer.Stop()
+		boundaryTimer = nil
+	}
+	if !nextBoundary.IsZero() {
+		log.Printf("Next schedule window boundary: %s", nextBoundary.Format(time.RFC3339))
+		// fire just after the boundary so now.After(ends) holds
+		boundaryTimer = time.AfterFunc(nextBoundary.Sub(now)+time.Second, func() {
+			reloadSchedule(context.Background())
 		})
-		cronService.Start()
 	}
 
 	return nil
 }
 
-func configureDays(days []*day) error {
-	for _, d := range days {
+// scheduleWindow returns when sch starts and ends and the location its dates
+// and bells are in. For a yearly schedule that's the window around now, or
+// the next one once this year's has closed.
+func scheduleWindow(sch *schedule, now time.Time) (time.Time, time.Time, *time.Location, error) {
+	loc, err := scheduleLocation(sch)
+	if err != nil {
+		return time.Time{}, time.Time{}, nil, fmt.Errorf("could not load timezone: %v", err)
+	}
+	if sch.Recur == "yearly" {
+		starts, ends, err := yearlyWindow(sch, now.In(loc), loc)
+		return starts, ends, loc, err
+	}
+	if sch.Recur != "" {
+		return time.Time{}, time.Time{}, nil, fmt.Errorf("unknown recur: %s", sch.Recur)
+	}
+	starts, err := parseScheduleDate(sch.Starts, loc)
+	if err != nil {
+		return time.Time{}, time.Time{}, nil, fmt.Errorf("could not parse start date: %s : %v", sch.Starts, err)
+	}
+	ends, err := parseScheduleDate(sch.Ends, loc)
+	if err != nil {
+		return time.Time{}, time.Time{}, nil, fmt.Errorf("could not parse end date: %s : %v", sch.Ends, err)
+	}
+	return starts, ends, loc, nil
+}
+
+// yearlyWindow places sch's month-day window in now's year. A window that
+// ends before it starts spans the new year.
+func yearlyWindow(sch *schedule, now time.Time, loc *time.Location) (time.Time, time.Time, error) {
+	starts, err := parseYearlyDate(sch.Starts, now.Year(), loc)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("could not parse start date: %s : %v", sch.Starts, err)
+	}
+	ends, err := parseYearlyDate(sch.Ends, now.Year(), loc)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("could not parse end date: %s : %v", sch.Ends, err)
+	}
+	if !ends.After(starts) {
+		if now.Before(ends) {
+			starts = starts.AddDate(-1, 0, 0)
+		} else {
+			ends = ends.AddDate(1, 0, 0)
+		}
+	}
+	if now.After(ends) {
+		starts = starts.AddDate(1, 0, 0)
+		ends = ends.AddDate(1, 0, 0)
+	}
+	return starts, ends, nil
+}
+
+// parseYearlyDate accepts a month and day ("01-02"), optionally with a time
+// ("01-02 15:04"), in year. The year of a full date is ignored. Feb 29 falls
+// on Mar 1 outside leap years.
+func parseYearlyDate(value string, year int, loc *time.Location) (time.Time, error) {
+	if len(value) >= 10 && value[4] == '-' {
+		value = value[5:]
+	}
+	// 2000 is a leap year so Feb 29 parses
+	t, err := parseScheduleDate("2000-"+value, loc)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Date(year, t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, loc), nil
+}
+
+// activateSchedule registers sch's bells and records it as active. until
+// bounds the DST check. Callers must hold scheduleMu.
+func activateSchedule(sch *schedule, now, until time.Time, loc *time.Location) {
+	registered := len(parsedKeys)
+	err := configureDays(sch)
+	if err != nil {
+		addScheduleError(sch.Name, "", "", "Could not configure: %v", err)
+	}
+	// an empty schedule or one whose every event was rejected rings nothing
+	if len(parsedKeys) == registered {
+		if len(sch.Days) == 0 {
+			addWarning("Active schedule has no days: %s", sch.Name)
+		} else {
+			addWarning("Active schedule registered no bells: %s", sch.Name)
+		}
+	}
+	if viper.GetBool("announce.enabled") {
+		addAnnouncements(sch)
+	}
+	logScheduleSummary(sch)
+	checkDST(sch, now, until, loc)
+	activeSchedules = append(activeSchedules, sch.Name)
+}
+
+// scheduleLocationOrGlobal is scheduleLocation, logging and falling back to
+// app.timezone when sch's timezone is invalid.
+func scheduleLocationOrGlobal(sch *schedule) *time.Location {
+	loc, err := scheduleLocation(sch)
+	if err != nil {
+		log.Errorf("Could not load timezone for %s: %v", sch.Name, err)
+		return globalLocation()
+	}
+	return loc
+}
+
+// runningSchedules is loadedSchedules with generatedSchedules, all that can
+// ring. Callers must hold scheduleMu.
+func runningSchedules() []*schedule {
+	return append(loadedSchedules[:len(loadedSchedules):len(loadedSchedules)], generatedSchedules...)
+}
+
+// findSchedule returns the schedule called name, or nil.
+func findSchedule(data []*schedule, name string) *schedule {
+	if name == "" {
+		return nil
+	}
+	for _, sch := range data {
+		if sch.Name == name {
+			return sch
+		}
+	}
+	return nil
+}
+
+// addEntry registers job under key, which must capture everything that
+// changes what the entry does. An entry already registered under key by the
+// previous parse is kept as is. Callers must hold scheduleMu.
+func addEntry(key, spec string, info *entryInfo, job func()) (cron.EntryID, error) {
+	if id, ok := parsedKeys[key]; ok {
+		return id, nil
+	}
+	if id, ok := entryKeys[key]; ok {
+		parsedKeys[key] = id
+		entryMeta[id] = info
+		return id, nil
+	}
+	id, err := cronService.AddFunc(spec, job)
+	if err != nil {
+		return 0, err
+	}
+	parsedKeys[key] = id
+	entryMeta[id] = info
+	return id, nil
+}
+
+// removeStaleEntries drops the entries the parse in progress didn't register
+// again. Callers must hold scheduleMu.
+func removeStaleEntries() {
+	kept, removed := 0, 0
+	for key, id := range entryKeys {
+		if _, ok := parsedKeys[key]; ok {
+			kept++
+			continue
+		}
+		cronService.Remove(id)
+		delete(entryMeta, id)
+		removed++
+	}
+	added := len(parsedKeys) - kept
+	entryKeys = parsedKeys
+	parsedKeys = nil
+	log.WithFields(log.Fields{
+		"Added":   added,
+		"Removed": removed,
+		"Kept":    kept,
+	}).Info("Cron entries updated")
+}
+
+// bellKey identifies what a bell entry does: its spec plus everything about
+// the event and its schedule that's used when it fires, including dir, the
+// folder its sounds are played from.
+func bellKey(sch *schedule, dir, dayName, spec string, evt *event) string {
+	evtJSON, _ := json.Marshal(evt)
+	tiersJSON, _ := json.Marshal(eventSchedule(sch, evt).VolumeTiers)
+	return strings.Join([]string{"bell", spec, sch.Name, sch.Timezone, dir, dayName, string(evtJSON), string(tiersJSON)}, "|")
+}
+
+// addWarning logs a parse problem and keeps it for the reload response.
+// Callers must hold scheduleMu.
+func addWarning(format string, args ...interface{}) {
+	message := fmt.Sprintf(format, args...)
+	log.Warn(message)
+	parseWarnings = append(parseWarnings, message)
+}
+
+// addScheduleError logs a part of the schedule that was left out and keeps
+// it for the reload response. Callers must hold scheduleMu.
+func addScheduleError(schedule, day, at, format string, args ...interface{}) {
+	e := &scheduleError{Schedule: schedule, Day: day, Time: at, Message: fmt.Sprintf(format, args...)}
+	log.WithFields(log.Fields{"Schedule": schedule, "Day": day, "Time": at}).Error(e.Message)
+	parseErrors = append(parseErrors, e)
+}
+
+// reloadSchedule reparses the schedule at runtime, keeping the last good one
+// on failure.
+func reloadSchedule(ctx context.Context) error {
+	err := parseSchedule(ctx)
+	if err != nil {
+		log.Errorf("Could not reload schedule, keeping the current one: %v", err)
+	}
+	return err
+}
+
+// rebuildSchedule is reloadSchedule registering every entry anew, for when
+// the clock was stepped and the kept entries would fire at the wrong times.
+func rebuildSchedule(ctx context.Context) error {
+	err := buildSchedule(ctx, true)
+	if err != nil {
+		log.Errorf("Could not rebuild schedule, keeping the current one: %v", err)
+	}
+	return err
+}
+
+// parseScheduleDate accepts a date ("2006-01-02") or a date and time
+// ("2006-01-02 15:04") in loc.
+func parseScheduleDate(value string, loc *time.Location) (time.Time, error) {
+	t, err := time.ParseInLocation("2006-01-02 15:04", value, loc)
+	if err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation("2006-01-02", value, loc)
+}
+
+// globalLocation is app.timezone, or the system timezone when unset.
+func globalLocation() *time.Location {
+	name := viper.GetString("app.timezone")
+	if name == "" {
+		return time.Local
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		log.Errorf("Could not load timezone: %s : %v", name, err)
+		return time.Local
+	}
+	return loc
+}
+
+func scheduleLocation(sch *schedule) (*time.Location, error) {
+	if sch.Timezone == "" {
+		return globalLocation(), nil
+	}
+	return time.LoadLocation(sch.Timezone)
+}
+
+// logScheduleSummary logs what a configured schedule resolved to, one field
+// per day with its event times.
+func logScheduleSummary(sch *schedule) {
+	days := map[string][]string{}
+	count := 0
+	for _, d := range sch.Days {
+		if len(d.Events) == 0 || !d.isEnabled() {
+			continue
+		}
+		times := []string{}
+		for _, evt := range d.Events {
+			if evt.Cron != "" {
+				times = append(times, evt.Cron)
+				continue
+			}
+			if evt.RelativeTo != "" {
+				times = append(times, fmt.Sprintf("%s%+dm", evt.RelativeTo, evt.OffsetMinutes))
+				continue
+			}
+			times = append(times, evt.Time)
+		}
+		days[d.Name] = times
+		count += len(times)
+	}
+	log.WithFields(log.Fields{
+		"Schedule": sch.Name,
+		"Starts":   sch.Starts,
+		"Ends":     sch.Ends,
+		"Default":  sch.Default,
+		"Events":   count,
+		"Days":     days,
+	}).Info("Schedule configured")
+}
+
+func configureDays(sch *schedule) error {
+	dir, err := sch.soundsDir()
+	if err != nil {
+		return err
+	}
+	for _, d := range sch.Days {
+		if !d.isEnabled() {
+			log.Printf("Skipping disabled day: %s %s", sch.Name, d.Name)
+			continue
+		}
 		name := strings.ToUpper(d.Name[0:3])
-		err := configureEvents(name, d.Events)
+		if d.DefaultSound != "" {
+			sound := d.DefaultSound
+			if file, ok := parseTheme[sound]; ok {
+				sound = file
+			}
+			err := checkSoundFile(dir, sound)
+			if err != nil {
+				addScheduleError(sch.Name, name, "", "Invalid default_sound: %v", err)
+			}
+		}
+		err := configureEvents(sch, dir, name, d.DefaultSound, d.Events)
 		if err != nil {
 			log.Errorf("Could not configure events: %v", err)
 		}
@@ -94,75 +643,559 @@ func configureDays(days []*day) error {
 	return nil
 }
 
-func configureEvents(dayName string, events []*event) error {
+func configureEvents(sch *schedule, dir, dayName, daySound string, events []*event) error {
 	log.Printf("Configuring: %s", dayName)
 	for _, evt := range events {
-		hour, err := strconv.Atoi(evt.Time[0:2])
+		evt, defaulted, err := withDefaultSound(evt, daySound)
 		if err != nil {
-			log.Errorf("Could not parse hour: %s : %v", evt.Time[0:2], err)
+			addScheduleError(sch.Name, dayName, evt.Time, "Invalid event: %v", err)
 			continue
 		}
-		minute, err := strconv.Atoi(evt.Time[3:])
+		if defaulted {
+			addWarning("Schedule %s: %s %s has no sound, using audio.default-sound %s", sch.Name, dayName, evt.Time, evt.Sound)
+		}
+		evt = withTheme(evt, parseTheme)
+		// a program's part event plays from the part's folder
+		dir, err := eventSoundsDir(dir, evt)
+		if err != nil {
+			addScheduleError(sch.Name, dayName, evt.Time, "Invalid event: %v", err)
+			continue
+		}
+		soundData, err := checkEvent(dir, evt)
+		if err != nil {
+			addScheduleError(sch.Name, dayName, evt.Time, "Invalid event: %v", err)
+			continue
+		}
+		// a missing file only shows when the bell rings, unless it's caught here
+		var broken string
+		err = checkSoundFiles(dir, evt)
 		if err != nil {
-			log.Errorf("Could not parse minute: %s : %v", evt.Time[3:], err)
+			if viper.GetBool("schedule.strict-sounds") {
+				addScheduleError(sch.Name, dayName, evt.Time, "Invalid event: %v", err)
+				continue
+			}
+			broken = err.Error()
+			addWarning("Schedule %s: %s %s: %v, registered anyway", sch.Name, dayName, evt.Time, err)
+		}
+		spec, err := eventSpec(sch, dayName, evt, appClock.Now())
+		if errors.Is(err, errNoSunEvent) {
+			addWarning("Schedule %s: %s %s skipped: %v", sch.Name, dayName, evt.RelativeTo, err)
 			continue
 		}
-		time := fmt.Sprintf("%d %d * * %s", minute, hour, dayName)
-		log.Printf("%d : %d | %s", hour, minute, time)
+		if err != nil {
+			addScheduleError(sch.Name, dayName, evt.Time, "Could not schedule event: %v", err)
+			continue
+		}
+		log.Printf("%s %s | %s", dayName, evt.Time, spec)
 
-		cronService.AddFunc(time, func() {
-			playSound(evt.Sound)
+		info := &entryInfo{
+			Kind:     "bell",
+			Schedule: sch.Name,
+			Day:      dayName,
+			Time:     evt.Time,
+			Cron:     evt.Cron,
+			Sound:    evt.Sound,
+			Zone:     evt.Zone,
+			Label:    evt.Label,
+			Role:     evt.Role,
+			Broken:   broken,
+			fired:    bellFiredKey(sch.Name, dayName, spec, evt.Zone),
+		}
+		_, err = addEntry(bellKey(sch, dir, dayName, spec, evt), spec, info, func() {
+			markFired(info.fired, appClock.Now())
+			sound := evt.Sound
+			if len(evt.Choices) > 0 {
+				sound = randomSound(evt.Choices)
+			}
+			data := soundData
+			if len(evt.Weather) > 0 {
+				sound = weatherChoice(evt.Weather, sound, appClock.Now())
+				if sound != evt.Sound {
+					data = nil
+				}
+			}
+			fields := log.Fields{
+				"Schedule": sch.Name,
+				"Day":      dayName,
+				"Time":     evt.Time,
+				"Sound":    sound,
+				"Zone":     evt.Zone,
+				"Label":    evt.Label,
+				"Role":     evt.Role,
+			}
+			now := appClock.Now()
+			if consumeSnooze(info, now) {
+				log.WithFields(fields).Info("Bell snoozed")
+				return
+			}
+			if maintenanceMode.Load() {
+				log.WithFields(fields).Info("Maintenance mode, skipping bell")
+				return
+			}
+			log.WithFields(fields).Info("Bell fired")
+			rang := &notification{
+				Event:    "bell",
+				Schedule: sch.Name,
+				Day:      dayName,
+				Time:     evt.Time,
+				Sound:    sound,
+				Label:    evt.Label,
+				At:       now,
+			}
+			if evt.Relay == relayOnly {
+				go func() {
+					if ringRelay(fmt.Sprintf("%s %s %s", sch.Name, dayName, evt.Time), evt.Zone) {
+						dispatchNotification(rang)
+					}
+				}()
+				return
+			}
+			if evt.Relay != "" {
+				go ringRelay(fmt.Sprintf("%s %s %s", sch.Name, dayName, evt.Time), evt.Zone)
+			}
+			volume := effectiveVolume(sch, evt, now)
+			job := &playJob{
+				Sound:       sound,
+				SoundsDir:   dir,
+				Role:        evt.Role,
+				SoundData:   data,
+				StartMs:     evt.StartMs,
+				EndMs:       evt.EndMs,
+				Zone:        evt.Zone,
+				Volume:      &volume,
+				Playlist:    evt.Playlist,
+				CrossfadeMs: evt.CrossfadeMs,
+				Repeat:      evt.Repeat,
+				RepeatGapMs: evt.RepeatGapMs,
+				Done:        make(chan error, 1),
+			}
+			err := enqueuePlay(job)
+			if err != nil && !errors.Is(err, errDuplicate) {
+				log.Errorf("Could not queue sound: %s : %v", sound, err)
+			}
+			if err == nil {
+				go notifyPlayed(job, rang)
+			}
 		})
+		if err != nil {
+			addScheduleError(sch.Name, dayName, evt.Time, "Could not schedule event: %s : %v", spec, err)
+			continue
+		}
 	}
 	return nil
 }
 
-func playSound(sound string) {
-	log.Printf("Playing: %s", sound)
-	fileBytes, err := os.ReadFile("./sounds/" + sound)
+// notifyPlayed sends n once job has played. A bell that was skipped, e.g.
+// silenced or in maintenance mode, or that failed to play isn't reported as
+// rung.
+func notifyPlayed(job *playJob, n *notification) {
+	err := <-job.Done
 	if err != nil {
-		log.Errorf("Could not load audio file: %v", err)
+		log.Printf("Not notifying, bell didn't play: %s : %v", job.Sound, err)
 		return
 	}
-	fileBytesReader := bytes.NewReader(fileBytes)
-	decodedMp3, err := mp3.NewDecoder(fileBytesReader)
+	dispatchNotification(n)
+}
+
+// withDefaultSound returns evt, or when it has no sound a copy playing
+// daySound, its day's default_sound, or else audio.default-sound, reporting
+// whether audio.default-sound was used. An event without any is an error
+// instead of a bell that rings nothing.
+func withDefaultSound(evt *event, daySound string) (*event, bool, error) {
+	if evt.hasSound() {
+		return evt, false, nil
+	}
+	if daySound != "" {
+		return withSound(evt, daySound), false, nil
+	}
+	sound := viper.GetString("audio.default-sound")
+	if sound == "" {
+		return evt, false, fmt.Errorf("no sound and no audio.default-sound")
+	}
+	return withSound(evt, sound), true, nil
+}
+
+// hasSound reports whether evt sets what it plays itself.
+func (evt *event) hasSound() bool {
+	return evt.Sound != "" || len(evt.Choices) > 0 || evt.SoundData != "" || evt.Relay == relayOnly
+}
+
+func withSound(evt *event, sound string) *event {
+	defaulted := *evt
+	defaulted.Sound = sound
+	return &defaulted
+}
+
+// checkEvent validates evt's sounds, found in dir, zone and playback options
+// and returns its decoded inline sound, if any.
+func checkEvent(dir string, evt *event) ([]byte, error) {
+	err := checkRelay(evt.Relay)
 	if err != nil {
-		log.Errorf("Could not decode mp3: %v", err)
-		return
+		return nil, err
+	}
+	if evt.Relay == relayOnly {
+		return nil, nil
+	}
+	sounds := append([]string{evt.Sound}, evt.Playlist...)
+	var soundData []byte
+	if evt.SoundData != "" {
+		data, err := decodeSoundData(evt)
+		if err != nil {
+			return nil, fmt.Errorf("invalid sound data: %v", err)
+		}
+		soundData = data
+		// Sound only names the inline clip
+		sounds = evt.Playlist
+	}
+	if len(evt.Choices) > 0 {
+		if evt.SoundData != "" {
+			return nil, fmt.Errorf("sound data can't be used with a list of sounds")
+		}
+		// every choice must be there, a missing one would only show up when
+		// it's picked
+		for _, c := range evt.Choices {
+			err := checkSoundFile(dir, c.File)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	err = validateSounds(dir, sounds)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sound: %v", err)
+	}
+	err = checkWeatherSounds(dir, evt.Weather)
+	if err != nil {
+		return nil, fmt.Errorf("invalid weather sound: %v", err)
+	}
+	if evt.CrossfadeMs < 0 {
+		return nil, fmt.Errorf("invalid crossfade: %dms", evt.CrossfadeMs)
+	}
+	_, err = resolveZone(evt.Zone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid zone: %v", err)
 	}
+	if evt.Repeat < 0 || evt.Repeat > maxRepeat || evt.RepeatGapMs < 0 {
+		return nil, fmt.Errorf("invalid repeat: %d every %dms", evt.Repeat, evt.RepeatGapMs)
+	}
+	if hasSegment(evt.StartMs, evt.EndMs) {
+		err = checkSegment(dir, evt.Sound, soundData, evt.StartMs, evt.EndMs)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return soundData, nil
+}
 
-	samplingRate := 44100
+// eventSpec returns the cron spec for evt on dayName: its raw cron
+// expression when set, its sunrise or sunset time on the next dayName from
+// now when relative to the sun, otherwise one built from its HH:MM time, in
+// the timezone of evt's schedule.
+func eventSpec(sch *schedule, dayName string, evt *event, now time.Time) (string, error) {
+	sch = eventSchedule(sch, evt)
+	var spec string
+	if evt.RelativeTo != "" {
+		if evt.Second != 0 {
+			return "", fmt.Errorf("second can't be used with relative_to")
+		}
+		loc, err := scheduleLocation(sch)
+		if err != nil {
+			return "", fmt.Errorf("could not load timezone: %v", err)
+		}
+		at, err := sunEventTime(evt, dayName, now, loc)
+		if err != nil {
+			return "", err
+		}
+		spec = eventCronSpec(at.Hour(), at.Minute(), at.Second(), weekdays[at.Weekday()], audioOffset())
+	} else if evt.Cron != "" {
+		_, err := cronParser.Parse(evt.Cron)
+		if err != nil {
+			return "", fmt.Errorf("invalid cron expression %q: %v", evt.Cron, err)
+		}
+		if evt.Second != 0 {
+			return "", fmt.Errorf("second can't be used with a cron expression")
+		}
+		spec = evt.Cron
+	} else {
+		if len(evt.Time) != 5 || evt.Time[2] != ':' {
+			return "", fmt.Errorf("invalid time %q, expected HH:MM", evt.Time)
+		}
+		hour, err := strconv.Atoi(evt.Time[0:2])
+		if err != nil {
+			return "", fmt.Errorf("could not parse hour: %s : %v", evt.Time[0:2], err)
+		}
+		minute, err := strconv.Atoi(evt.Time[3:])
+		if err != nil {
+			return "", fmt.Errorf("could not parse minute: %s : %v", evt.Time[3:], err)
+		}
+		if evt.Second < 0 || evt.Second > 59 {
+			return "", fmt.Errorf("invalid second %d, expected 0 to 59", evt.Second)
+		}
+		spec = eventCronSpec(hour, minute, evt.Second, dayName, audioOffset())
+	}
+	if sch.Timezone != "" && !strings.HasPrefix(spec, "CRON_TZ=") && !strings.HasPrefix(spec, "TZ=") {
+		spec = fmt.Sprintf("CRON_TZ=%s %s", sch.Timezone, spec)
+	}
+	return spec, nil
+}
 
-	// Number of channels (aka locations) to play sounds from. Either 1 or 2.
-	// 1 is mono sound, and 2 is stereo (most speakers are stereo).
-	numOfChannels := 2
+// maxRepeat caps how many times one event can repeat its sound.
+const maxRepeat = 50
 
-	// Bytes used by a channel to represent one sample. Either 1 or 2 (usually 2).
-	audioBitDepth := 2
+var weekdays = []string{"SUN", "MON", "TUE", "WED", "THU", "FRI", "SAT"}
 
-	// Remember that you should **not** create more than one context
-	otoCtx, readyChan, err := oto.NewContext(samplingRate, numOfChannels, audioBitDepth)
-	if err != nil {
-		log.Errorf("Could not initialize oto: %v", err)
-		return
+// eventCronSpec builds the cron spec for a bell at hour:minute:second on
+// dayName. A negative offset moves the bell earlier, rounded to whole seconds, which
+// may move it to the previous day; positive offsets are applied as a delay
+// at play time instead.
+func eventCronSpec(hour, minute, second int, dayName string, offset time.Duration) string {
+	if offset < 0 {
+		shift := int((-offset + time.Second - 1) / time.Second)
+		total := hour*3600 + minute*60 + second - shift
+		if total < 0 {
+			total += 24 * 3600
+			for i, d := range weekdays {
+				if d == dayName {
+					dayName = weekdays[(i+len(weekdays)-1)%len(weekdays)]
+					break
+				}
+			}
+		}
+		hour, minute, second = total/3600, total%3600/60, total%60
 	}
+	return fmt.Sprintf("%d %d %d * * %s", second, minute, hour, dayName)
+}
 
-	// It might take a bit for the hardware audio devices to be ready, so we wait on the channel.
-	<-readyChan
+// audioOffset is audio.offset-ms, used to line up the audible bell with a
+// reference clock on PA systems with a fixed latency.
+func audioOffset() time.Duration {
+	return time.Duration(viper.GetInt("audio.offset-ms")) * time.Millisecond
+}
 
-	// Create a new 'player' that will handle our sound. Paused by default.
-	player := otoCtx.NewPlayer(decodedMp3)
+// prepareSound checks job may play now and returns its PCM, at its volume,
+// with its sample rate and zone.
+func prepareSound(job *playJob) (io.Reader, int, *zone, error) {
+	if maintenanceMode.Load() {
+		log.Printf("Maintenance mode, skipping: %s", job.Sound)
+		return nil, 0, nil, errors.New("maintenance mode")
+	}
+	if isSilenced(job.Zone, appClock.Now()) {
+		log.Printf("Silenced, skipping: %s (zone %s)", job.Sound, job.Zone)
+		return nil, 0, nil, errors.New("bells are silenced")
+	}
+	if !audioRetryDue() {
+		log.Warnf("Audio unavailable, skipping: %s", job.Sound)
+		return nil, 0, nil, errors.New("audio unavailable")
+	}
+	z, err := resolveZone(job.Zone)
+	if err != nil {
+		log.Errorf("Could not resolve zone: %v", err)
+		return nil, 0, nil, err
+	}
+	pcm, rate, err := jobPCM(job)
+	if err != nil {
+		log.Errorf("Could not load sound: %s : %v", job.Sound, err)
+		return nil, 0, nil, err
+	}
+	if job.Volume != nil {
+		pcm = newGainReader(pcm, *job.Volume)
+	}
+	if job.Started != nil {
+		pcm = &startReader{Reader: pcm, started: job.Started}
+	}
+	return pcm, rate, z, nil
+}
+
+// playSound plays job, returning why it didn't when it was skipped or
+// failed.
+func playSound(job *playJob) error {
+	pcm, rate, z, err := prepareSound(job)
+	if err != nil {
+		return err
+	}
+	log.Printf("Playing: %s (zone %s)", job.Sound, z.Name)
+	pcm = withPrebuffer(pcm, rate)
+	waitMinGap()
+	started := appClock.Now()
+	setNowPlaying(&playRecord{Sound: job.Sound, Zone: z.Name, Role: job.Role, At: started})
+	err = playPCM(pcm, rate)
+	setNowPlaying(nil)
+	lastPlayEnd = time.Now()
+	recordPlay(job, started, err)
+	if err != nil {
+		log.Errorf("Could not play sound: %s : %v", job.Sound, err)
+	}
+	return err
+}
 
-	// Play starts playing the sound and returns without waiting for it (Play() is async).
-	player.Play()
+// playMixed plays jobs at once, summed into one stream, and returns why each
+// didn't play. A job at another sample rate than the first plays after the
+// mix on its own. With audio.duck-db set, the others are turned down while
+// an announcement speaks.
+func playMixed(jobs []*playJob) []error {
+	errs := make([]error, len(jobs))
+	clips := []io.Reader{}
+	announcements := []io.Reader{}
+	duckDB := viper.GetFloat64("audio.duck-db")
+	mixed := []int{}
+	later := []int{}
+	names := []string{}
+	rate := 0
+	for i, job := range jobs {
+		pcm, r, z, err := prepareSound(job)
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		if rate != 0 && r != rate {
+			later = append(later, i)
+			continue
+		}
+		rate = r
+		if job.Announce != "" && duckDB > 0 {
+			announcements = append(announcements, pcm)
+		} else {
+			clips = append(clips, pcm)
+		}
+		mixed = append(mixed, i)
+		names = append(names, fmt.Sprintf("%s (zone %s)", job.Sound, z.Name))
+	}
+	if len(mixed) > 0 {
+		log.Printf("Playing mixed: %s", strings.Join(names, ", "))
+		var pcm io.Reader
+		if len(announcements) > 0 {
+			duck := math.Pow(10, -duckDB/20)
+			fade := durationFrames(rate, viper.GetInt("audio.duck-fade-ms"))
+			pcm = newDuckingMixReader(announcements, clips, duck, fade)
+		} else {
+			pcm = newMixReader(clips)
+		}
+		pcm = withPrebuffer(pcm, rate)
+		waitMinGap()
+		started := appClock.Now()
+		first := jobs[mixed[0]]
+		setNowPlaying(&playRecord{Sound: strings.Join(names, " + "), Zone: first.Zone, Role: first.Role, At: started})
+		err := playPCM(pcm, rate)
+		setNowPlaying(nil)
+		lastPlayEnd = time.Now()
+		if err != nil {
+			log.Errorf("Could not play mix: %v", err)
+		}
+		for _, i := range mixed {
+			recordPlay(jobs[i], started, err)
+			errs[i] = err
+		}
+	}
+	for _, i := range later {
+		log.Warnf("Sound %s isn't at %d Hz, playing it after the mix", jobs[i].Sound, rate)
+		errs[i] = playSound(jobs[i])
+	}
+	return errs
+}
 
-	// We can wait for the sound to finish playing using something like this
-	for player.IsPlaying() {
-		time.Sleep(time.Millisecond * 50)
+func validateSounds(dir string, sounds []string) error {
+	for _, sound := range sounds {
+		_, err := resolveSoundPath(dir, sound)
+		if err != nil {
+			return err
+		}
 	}
+	return nil
+}
+
+// maxSoundData caps the decoded size of an inline sound.
+const maxSoundData = 1 << 20
 
-	err = player.Close()
+// decodeSoundData returns evt's inline sound.
+func decodeSoundData(evt *event) ([]byte, error) {
+	if evt.SoundFormat != "mp3" {
+		return nil, fmt.Errorf("unsupported sound format: %q", evt.SoundFormat)
+	}
+	if base64.StdEncoding.DecodedLen(len(evt.SoundData)) > maxSoundData {
+		return nil, fmt.Errorf("sound data is over %d bytes", maxSoundData)
+	}
+	data, err := base64.StdEncoding.DecodeString(evt.SoundData)
 	if err != nil {
-		log.Errorf("Could not close player: %v", err)
+		return nil, err
+	}
+	_, err = mp3.NewDecoder(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("could not decode mp3: %v", err)
+	}
+	return data, nil
+}
+
+// jobPCM decodes the job's sound and playlist, repeated as asked, into one
+// stream of 16 bit stereo PCM and returns it with its sample rate. Repeats
+// decode the files again and gaps are silence, so there's no pause between
+// them on the device.
+func jobPCM(job *playJob) (io.Reader, int, error) {
+	if job.Announce != "" {
+		return speak(job.Announce)
+	}
+	if job.PCM != nil {
+		return bytes.NewReader(job.PCM), samplingRate, nil
+	}
+	sounds := append([]string{job.Sound}, job.Playlist...)
+	dir := job.SoundsDir
+	if dir == "" {
+		dir = soundsDir()
+	}
+	files := map[string][]byte{}
+	repeat := job.Repeat
+	if repeat < 1 {
+		repeat = 1
+	}
+
+	rate := 0
+	clips := []io.Reader{}
+	for r := 0; r < repeat; r++ {
+		if r > 0 && job.RepeatGapMs > 0 {
+			gap := time.Duration(job.RepeatGapMs) * time.Millisecond
+			clips = append(clips, bytes.NewReader(silence(rate, gap)))
+		}
+		for i, sound := range sounds {
+			fileBytes, ok := files[sound]
+			if i == 0 && job.SoundData != nil {
+				fileBytes, ok = job.SoundData, true
+			}
+			if !ok {
+				soundPath, err := resolveSoundPath(dir, sound)
+				if err != nil {
+					return nil, 0, err
+				}
+				fileBytes, err = os.ReadFile(soundPath)
+				if err != nil {
+					return nil, 0, err
+				}
+				files[sound] = fileBytes
+			}
+			decoded, err := mp3.NewDecoder(bytes.NewReader(fileBytes))
+			if err != nil {
+				return nil, 0, fmt.Errorf("could not decode mp3 %s: %v", sound, err)
+			}
+			if rate == 0 {
+				rate = decoded.SampleRate()
+			} else if decoded.SampleRate() != rate {
+				log.Warnf("Sound %s is %d Hz, playing at %d Hz", sound, decoded.SampleRate(), rate)
+			}
+			var clip io.Reader = decoded
+			if i == 0 && hasSegment(job.StartMs, job.EndMs) {
+				clip, err = segmentReader(decoded, job.StartMs, job.EndMs)
+				if err != nil {
+					return nil, 0, fmt.Errorf("could not seek %s: %v", sound, err)
+				}
+			}
+			clips = append(clips, clip)
+		}
+	}
+
+	if job.CrossfadeMs > 0 && len(clips) > 1 {
+		pcm, err := crossfadeClips(clips, durationFrames(rate, job.CrossfadeMs))
+		if err != nil {
+			return nil, 0, err
+		}
+		return bytes.NewReader(pcm), rate, nil
 	}
+	return io.MultiReader(clips...), rate, nil
 }
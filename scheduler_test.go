@@ -0,0 +1,679 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// mondayBells is a schedule ringing bell.mp3 at 08:00 on Mondays of 2024.
+const mondayBells = `[{"name": "term", "starts": "2024-01-01", "ends": "2024-12-31", "days": [{"name": "Monday", "events": [{"time": "08:00", "sound": "bell.mp3"}]}]}]`
+
+func TestDailyReparse(t *testing.T) {
+	tests := []struct {
+		name    string
+		enabled bool
+		spec    string
+		want    string
+	}{
+		{"enabled", true, "1 0 * * *", "reparse|1 0 * * *"},
+		{"custom expression", true, "30 2 * * *", "reparse|30 2 * * *"},
+		{"disabled", false, "1 0 * * *", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testDir(t)
+			setConfig(t, "schedule.daily-reparse", tt.enabled)
+			setConfig(t, "schedule.reparse-cron", tt.spec)
+			loadSchedule(t, time.Date(2024, 3, 4, 7, 0, 0, 0, time.UTC), mondayBells)
+
+			reparses := entriesOf("reparse")
+			if tt.want == "" {
+				if len(reparses) != 0 {
+					t.Fatalf("reparse entries = %d, want none", len(reparses))
+				}
+				return
+			}
+			if len(reparses) != 1 || !hasEntryKey(tt.want) {
+				t.Fatalf("reparse entries = %d, want one registered as %q", len(reparses), tt.want)
+			}
+			if bells := entriesOf("bell"); len(bells) != 1 {
+				t.Errorf("bell entries = %d, want 1", len(bells))
+			}
+		})
+	}
+}
+
+// active lists the schedules the last parse configured.
+func active() []string {
+	scheduleMu.RLock()
+	defer scheduleMu.RUnlock()
+	return append([]string{}, activeSchedules...)
+}
+
+func TestWindowBoundaryReparse(t *testing.T) {
+	tests := []struct {
+		name         string
+		starts, ends string
+		// before and after the boundary at noon
+		activeBefore, activeAfter bool
+	}{
+		{"starting later today", "2024-03-04 12:00", "2024-12-31", false, true},
+		{"ending later today", "2024-01-01", "2024-03-04 12:00", true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testDir(t)
+			logs := captureLog(t)
+			doc := `[{"name": "term", "starts": "` + tt.starts + `", "ends": "` + tt.ends + `", "days": [{"name": "Monday", "events": [{"time": "14:00", "sound": "bell.mp3"}]}]}]`
+			clock := loadSchedule(t, time.Date(2024, 3, 4, 9, 0, 0, 0, time.UTC), doc)
+
+			if got := len(active()) == 1; got != tt.activeBefore {
+				t.Fatalf("active before the boundary = %v, want %v", got, tt.activeBefore)
+			}
+			if boundaryTimer == nil {
+				t.Fatal("no reparse scheduled for the boundary")
+			}
+			if entries := logEntries(t, logs, "Next schedule window boundary: 2024-03-04T12:00:00Z"); len(entries) != 1 {
+				t.Errorf("boundary not logged at noon:\n%s", logs)
+			}
+
+			// what the boundary timer does once it fires
+			clock.Set(time.Date(2024, 3, 4, 12, 0, 1, 0, time.UTC))
+			err := reloadSchedule(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := len(active()) == 1; got != tt.activeAfter {
+				t.Errorf("active after the boundary = %v, want %v", got, tt.activeAfter)
+			}
+			if got := len(entriesOf("bell")) == 1; got != tt.activeAfter {
+				t.Errorf("bell registered after the boundary = %v, want %v", got, tt.activeAfter)
+			}
+		})
+	}
+}
+
+func TestDefaultSchedule(t *testing.T) {
+	const doc = `[
+		{"name": "fall", "starts": "2024-09-01", "ends": "2024-12-20", "days": [{"name": "Monday", "events": [{"time": "08:00", "sound": "bell.mp3"}]}]},
+		{"name": "summer", "default": true, "days": [{"name": "Monday", "events": [{"time": "09:00", "sound": "bell.mp3"}]}]},
+		{"name": "spare", "default": true, "days": [{"name": "Monday", "events": [{"time": "10:00", "sound": "bell.mp3"}]}]}
+	]`
+	tests := []struct {
+		name string
+		now  time.Time
+		want string
+	}{
+		{"no dated schedule matches", time.Date(2024, 7, 1, 7, 0, 0, 0, time.UTC), "summer"},
+		{"dated schedule takes precedence", time.Date(2024, 9, 2, 7, 0, 0, 0, time.UTC), "fall"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testDir(t)
+			logs := captureLog(t)
+			loadSchedule(t, tt.now, doc)
+
+			if got := active(); len(got) != 1 || got[0] != tt.want {
+				t.Errorf("active = %v, want [%s]", got, tt.want)
+			}
+			bells := entriesOf("bell")
+			if len(bells) != 1 || bells[0].Schedule != tt.want {
+				t.Errorf("bells = %v, want one of %s", bells, tt.want)
+			}
+			if entries := logEntries(t, logs, "Multiple default schedules, ignoring: spare (using summer)"); len(entries) != 1 {
+				t.Errorf("second default not warned about:\n%s", logs)
+			}
+		})
+	}
+}
+
+func TestScheduleSummaryLogged(t *testing.T) {
+	testDir(t)
+	logs := captureLog(t)
+	loadSchedule(t, time.Date(2024, 3, 4, 7, 0, 0, 0, time.UTC), `[{"name": "term", "starts": "2024-01-01", "ends": "2024-12-31", "days": [
+		{"name": "Monday", "events": [{"time": "08:00", "sound": "bell.mp3"}, {"time": "12:30", "sound": "bell.mp3"}]},
+		{"name": "Tuesday", "events": [{"cron": "0 9 * * 2", "sound": "bell.mp3"}]},
+		{"name": "Wednesday", "events": []}
+	]}]`)
+
+	entries := logEntries(t, logs, "Schedule configured")
+	if len(entries) != 1 {
+		t.Fatalf("summaries = %d, want 1:\n%s", len(entries), logs)
+	}
+	summary := entries[0]
+	for field, want := range map[string]interface{}{
+		"Schedule": "term",
+		"Starts":   "2024-01-01",
+		"Ends":     "2024-12-31",
+		"Default":  false,
+		"Events":   3.0,
+	} {
+		if summary[field] != want {
+			t.Errorf("%s = %v, want %v", field, summary[field], want)
+		}
+	}
+	days, _ := summary["Days"].(map[string]interface{})
+	if fmt.Sprint(days) != "map[Monday:[08:00 12:30] Tuesday:[0 9 * * 2]]" {
+		t.Errorf("Days = %v, want Monday's times and Tuesday's cron", summary["Days"])
+	}
+}
+
+func TestLabelsRoundTrip(t *testing.T) {
+	const doc = `[{"name":"term","label":"Fall term","note":"set by the office","starts":"2024-01-01","ends":"2024-12-31","days":[{"name":"Monday","label":"Long day","note":"assembly at 9","events":[{"time":"08:00","label":"First period","note":"doors open","sound":"bell.mp3"}]}]}]`
+	data := []*schedule{}
+	err := json.Unmarshal([]byte(doc), &data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sch := data[0]
+	d := sch.Days[0]
+	evt := d.Events[0]
+	if sch.Label != "Fall term" || sch.Note != "set by the office" || d.Label != "Long day" || d.Note != "assembly at 9" || evt.Label != "First period" || evt.Note != "doors open" {
+		t.Errorf("parsed labels and notes = %q %q %q %q %q %q", sch.Label, sch.Note, d.Label, d.Note, evt.Label, evt.Note)
+	}
+	out, err := json.Marshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != doc {
+		t.Errorf("serialized =\n%s\nwant\n%s", out, doc)
+	}
+}
+
+func TestNextBellLabel(t *testing.T) {
+	testDir(t)
+	loadSchedule(t, time.Date(2024, 3, 4, 7, 0, 0, 0, time.UTC), `[{"name": "term", "starts": "2024-01-01", "ends": "2024-12-31", "days": [{"name": "Monday", "events": [{"time": "08:00", "sound": "bell.mp3", "label": "First period"}]}]}]`)
+
+	rec := apiRequest(t, "GET", "/api/v1/next", "")
+	next := map[string]interface{}{}
+	decodeBody(t, rec, &next)
+	if rec.Code != http.StatusOK || next["label"] != "First period" || next["sound"] != "bell.mp3" {
+		t.Errorf("next = %d %s, want the labelled bell", rec.Code, rec.Body)
+	}
+}
+
+func TestEventRole(t *testing.T) {
+	testDir(t)
+	loadSchedule(t, time.Date(2024, 3, 4, 7, 0, 0, 0, time.UTC), `[{"name": "term", "starts": "2024-01-01", "ends": "2024-12-31", "days": [{"name": "Monday", "events": [
+		{"time": "08:00", "sound": "bell.mp3", "role": "first"},
+		{"time": "15:00", "sound": "bell.mp3", "role": "last"}
+	]}]}]`)
+
+	schedules := []*schedule{}
+	decodeBody(t, apiRequest(t, "GET", "/api/v1/schedules", ""), &schedules)
+	if events := schedules[0].Days[0].Events; events[0].Role != "first" || events[1].Role != "last" {
+		t.Errorf("roles = %q, %q, want first and last", events[0].Role, events[1].Role)
+	}
+	next := map[string]interface{}{}
+	decodeBody(t, apiRequest(t, "GET", "/api/v1/next", ""), &next)
+	if next["role"] != "first" {
+		t.Errorf("next = %v, want the first bell", next)
+	}
+
+	useQueue(t, &recordingPlayer{}, 4)
+	runBell(t, "term", "15:00")
+	waitFor(t, "the last bell", func() bool { return getLastPlayed() != nil })
+	if played := getLastPlayed(); played.Role != "last" {
+		t.Errorf("last played = %+v, want the last bell", played)
+	}
+}
+
+func TestScheduleTimezones(t *testing.T) {
+	testDir(t)
+	loadSchedule(t, time.Date(2024, 3, 4, 5, 0, 0, 0, time.UTC), `[
+		{"name": "east", "timezone": "America/New_York", "starts": "2024-01-01", "ends": "2024-12-31", "days": [{"name": "Monday", "events": [{"time": "08:00", "sound": "bell.mp3"}]}]},
+		{"name": "berlin", "timezone": "Europe/Berlin", "starts": "2024-01-01", "ends": "2024-12-31", "days": [{"name": "Monday", "events": [{"time": "08:00", "sound": "bell.mp3"}]}]}
+	]`)
+
+	fires := nextFires(time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC))
+	want := map[string]time.Time{
+		// 08:00 EST and CET
+		"east 08:00":   time.Date(2024, 3, 4, 13, 0, 0, 0, time.UTC),
+		"berlin 08:00": time.Date(2024, 3, 4, 7, 0, 0, 0, time.UTC),
+	}
+	if len(fires) != len(want) {
+		t.Fatalf("fires = %v, want %v", fires, want)
+	}
+	for bell, at := range want {
+		if !fires[bell].Equal(at) {
+			t.Errorf("%s fires at %s, want %s", bell, fires[bell].UTC(), at)
+		}
+	}
+}
+
+func TestEventCronSpecOffset(t *testing.T) {
+	tests := []struct {
+		hour, minute, second int
+		day                  string
+		offset               time.Duration
+		want                 string
+	}{
+		{8, 0, 0, "MON", 0, "0 0 8 * * MON"},
+		{8, 0, 0, "MON", 500 * time.Millisecond, "0 0 8 * * MON"},
+		{8, 0, 0, "MON", -2 * time.Second, "58 59 7 * * MON"},
+		// part seconds round up so the bell is never late
+		{8, 0, 30, "MON", -1500 * time.Millisecond, "28 0 8 * * MON"},
+		{0, 0, 0, "MON", -time.Second, "59 59 23 * * SUN"},
+		{0, 0, 0, "SUN", -time.Second, "59 59 23 * * SAT"},
+	}
+	for _, tt := range tests {
+		got := eventCronSpec(tt.hour, tt.minute, tt.second, tt.day, tt.offset)
+		if got != tt.want {
+			t.Errorf("eventCronSpec(%02d:%02d:%02d %s, %s) = %q, want %q", tt.hour, tt.minute, tt.second, tt.day, tt.offset, got, tt.want)
+		}
+	}
+}
+
+func TestEventSecond(t *testing.T) {
+	testDir(t)
+	loadSchedule(t, time.Date(2024, 3, 4, 7, 0, 0, 0, time.UTC), `[{"name": "term", "starts": "2024-01-01", "ends": "2024-12-31", "days": [{"name": "Monday", "events": [
+		{"time": "08:00", "second": 30, "sound": "bell.mp3"},
+		{"time": "09:00", "sound": "bell.mp3"}
+	]}]}]`)
+	fires := nextFires(time.Date(2024, 3, 4, 7, 0, 0, 0, time.UTC))
+	want := map[string]time.Time{
+		"term 08:00": time.Date(2024, 3, 4, 8, 0, 30, 0, time.UTC),
+		"term 09:00": time.Date(2024, 3, 4, 9, 0, 0, 0, time.UTC),
+	}
+	if len(fires) != len(want) {
+		t.Fatalf("fires = %v, want %v", fires, want)
+	}
+	for bell, at := range want {
+		if !fires[bell].Equal(at) {
+			t.Errorf("%s fires at %s, want %s", bell, fires[bell], at)
+		}
+	}
+
+	rec := apiRequest(t, "POST", "/api/v1/preview-schedule", `[{"name": "term", "starts": "2024-01-01", "ends": "2024-12-31", "days": [{"name": "Monday", "events": [{"time": "08:00", "second": -1, "sound": "bell.mp3"}]}]}]`)
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("preview with second -1 = %d, want 422", rec.Code)
+	}
+}
+
+func TestNegativeAudioOffset(t *testing.T) {
+	testDir(t)
+	setConfig(t, "audio.offset-ms", -2000)
+	loadSchedule(t, time.Date(2024, 3, 4, 7, 0, 0, 0, time.UTC), mondayBells)
+	fires := nextFires(time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC))
+	if want := time.Date(2024, 3, 4, 7, 59, 58, 0, time.UTC); !fires["term 08:00"].Equal(want) {
+		t.Errorf("08:00 bell fires at %s, want %s", fires["term 08:00"], want)
+	}
+}
+
+func TestPositiveAudioOffset(t *testing.T) {
+	setConfig(t, "audio.offset-ms", 100)
+	backend := &recordingPlayer{}
+	useQueue(t, backend, 8)
+	start := time.Now()
+	job := pcmJob("late", time.Millisecond)
+	if err := enqueuePlay(job); err != nil {
+		t.Fatal(err)
+	}
+	<-job.Done
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("played after %s, want held back 100ms", elapsed)
+	}
+	if spec := eventCronSpec(8, 0, 0, "MON", audioOffset()); spec != "0 0 8 * * MON" {
+		t.Errorf("spec = %q, want the bell's own time", spec)
+	}
+}
+
+func TestCronEvents(t *testing.T) {
+	testDir(t)
+	loadSchedule(t, time.Date(2024, 3, 4, 7, 0, 0, 0, time.UTC), `[{"name": "term", "starts": "2024-01-01", "ends": "2024-12-31", "days": [{"name": "Monday", "events": [
+		{"cron": "0 9 * * 1-5", "sound": "bell.mp3"},
+		{"cron": "0 9 * * MON-FUNDAY", "sound": "bell.mp3"},
+		{"cron": "0 10 * * *", "second": 30, "sound": "bell.mp3"}
+	]}]}]`)
+
+	bells := entriesOf("bell")
+	if len(bells) != 1 || bells[0].Cron != "0 9 * * 1-5" {
+		t.Fatalf("bells = %v, want the valid expression only", bells)
+	}
+	// registered as is, every weekday rather than only on its Monday
+	fires := nextFires(time.Date(2024, 3, 5, 0, 0, 0, 0, time.UTC))
+	if want := time.Date(2024, 3, 5, 9, 0, 0, 0, time.UTC); !fires["term "].Equal(want) {
+		t.Errorf("cron bell fires at %v, want %s", fires, want)
+	}
+	if len(parseErrors) != 2 {
+		t.Fatalf("parse errors = %d, want 2", len(parseErrors))
+	}
+	if msg := parseErrors[0].Message; !strings.Contains(msg, `invalid cron expression "0 9 * * MON-FUNDAY"`) {
+		t.Errorf("error = %q, want the invalid expression named", msg)
+	}
+	if msg := parseErrors[1].Message; !strings.Contains(msg, "second can't be used with a cron expression") {
+		t.Errorf("error = %q, want second rejected", msg)
+	}
+}
+
+func TestRepeat(t *testing.T) {
+	testDir(t)
+	readAll := func(job *playJob) []byte {
+		t.Helper()
+		pcm, rate, err := jobPCM(job)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rate != 48000 {
+			t.Fatalf("rate = %d, want 48000", rate)
+		}
+		data, err := io.ReadAll(pcm)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+	once := readAll(&playJob{Sound: "bell.mp3"})
+	gap := silence(48000, 250*time.Millisecond)
+
+	repeated := readAll(&playJob{Sound: "bell.mp3", Repeat: 3, RepeatGapMs: 250})
+	if want := 3*len(once) + 2*len(gap); len(repeated) != want {
+		t.Fatalf("repeated %d bytes, want %d", len(repeated), want)
+	}
+	for i := 0; i < 3; i++ {
+		start := i * (len(once) + len(gap))
+		if !bytes.Equal(repeated[start:start+len(once)], once) {
+			t.Errorf("repeat %d isn't the sound", i+1)
+		}
+		if i < 2 && !bytes.Equal(repeated[start+len(once):start+len(once)+len(gap)], gap) {
+			t.Errorf("gap after repeat %d isn't silence", i+1)
+		}
+	}
+
+	if gapless := readAll(&playJob{Sound: "bell.mp3", Repeat: 2}); len(gapless) != 2*len(once) {
+		t.Errorf("gapless repeat is %d bytes, want %d", len(gapless), 2*len(once))
+	}
+
+	// one job on the device, not one per repeat
+	player := &recordingPlayer{}
+	useQueue(t, player, 8)
+	job := &playJob{Sound: "bell.mp3", Repeat: 2, RepeatGapMs: 250, Done: make(chan error, 1)}
+	if err := enqueuePlay(job); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-job.Done; err != nil {
+		t.Fatal(err)
+	}
+	if player.count() != 1 || len(player.played[0]) != 2*len(once)+len(gap) {
+		t.Errorf("played %d times, want the repeats in one playback", player.count())
+	}
+}
+
+func TestRepeatRejected(t *testing.T) {
+	dir := testDir(t)
+	for _, evt := range []*event{
+		{Time: "08:00", Sound: "bell.mp3", Repeat: -1},
+		{Time: "08:00", Sound: "bell.mp3", Repeat: maxRepeat + 1},
+		{Time: "08:00", Sound: "bell.mp3", Repeat: 2, RepeatGapMs: -1},
+	} {
+		if _, err := checkEvent(filepath.Join(dir, "sounds"), evt); err == nil || !strings.Contains(err.Error(), "invalid repeat") {
+			t.Errorf("checkEvent(repeat %d gap %d) = %v, want invalid repeat", evt.Repeat, evt.RepeatGapMs, err)
+		}
+	}
+}
+
+func TestSchedulesWithoutBells(t *testing.T) {
+	testDir(t)
+	loadSchedule(t, time.Date(2024, 3, 4, 7, 0, 0, 0, time.UTC), `[
+		{"name": "term", "starts": "2024-01-01", "ends": "2024-12-31", "days": [{"name": "Monday", "events": [{"time": "08:00", "sound": "bell.mp3"}]}]},
+		{"name": "empty", "starts": "2024-01-01", "ends": "2024-12-31", "days": []},
+		{"name": "broken", "starts": "2024-01-01", "ends": "2024-12-31", "days": [
+			{"name": "Monday", "events": [{"time": "09:00", "sound": "bell.mp3", "zone": "roof"}]},
+			{"name": "Tuesday", "events": [{"time": "09:00", "sound": "../bell.mp3"}]}
+		]},
+		{"name": "later", "starts": "2024-06-01", "ends": "2024-12-31", "days": []}
+	]`)
+
+	rec := apiRequest(t, "POST", "/api/v1/reload", "")
+	result := &reloadResult{}
+	decodeBody(t, rec, result)
+	want := []string{"Active schedule has no days: empty", "Active schedule registered no bells: broken"}
+	if rec.Code != http.StatusOK || len(result.Warnings) != len(want) {
+		t.Fatalf("reload = %d %s, want warnings %q", rec.Code, rec.Body, want)
+	}
+	for i := range want {
+		if result.Warnings[i] != want[i] {
+			t.Errorf("warning = %q, want %q", result.Warnings[i], want[i])
+		}
+	}
+	if len(result.Errors) != 2 || result.Errors[0].Schedule != "broken" || result.Errors[1].Schedule != "broken" {
+		t.Errorf("errors = %s, want broken's two rejected events", rec.Body)
+	}
+	if got := active(); len(got) != 3 || len(entriesOf("bell")) != 1 {
+		t.Errorf("active = %v with %d bells, want term ringing alongside empty and broken", got, len(entriesOf("bell")))
+	}
+}
+
+func TestParseErrorList(t *testing.T) {
+	testDir(t)
+	buf := captureLog(t)
+	loadSchedule(t, time.Date(2024, 3, 4, 7, 0, 0, 0, time.UTC), `[
+		{"name": "term", "starts": "2024-01-01", "ends": "2024-12-31", "days": [
+			{"name": "Monday", "default_sound": "../gong.mp3", "events": [
+				{"time": "08:00", "sound": "bell.mp3"},
+				{"time": "09:00", "sound": "bell.mp3", "zone": "roof"},
+				{"cron": "0 10 * * *", "second": 30, "sound": "bell.mp3"}
+			]},
+			{"name": "Friday", "events": [{"time": "12:00", "sound": "bell.mp3", "start_ms": 9000}]}
+		]},
+		{"name": "away", "sounds_dir": "../away", "starts": "2024-01-01", "ends": "2024-12-31", "days": [{"name": "Monday", "events": [{"time": "08:00", "sound": "bell.mp3"}]}]}
+	]`)
+
+	want := []scheduleError{
+		{"term", "MON", "", "Invalid default_sound: "},
+		{"term", "MON", "09:00", "Invalid event: "},
+		{"term", "MON", "", "Could not schedule event: second can't be used with a cron expression"},
+		{"term", "FRI", "12:00", "Invalid event: "},
+		{"away", "", "", "Could not configure: invalid sounds_dir"},
+	}
+	rec := apiRequest(t, "POST", "/api/v1/reload", "")
+	result := &reloadResult{}
+	decodeBody(t, rec, result)
+	if len(result.Errors) != len(want) {
+		t.Fatalf("errors = %s, want %d", rec.Body, len(want))
+	}
+	for i, got := range result.Errors {
+		w := want[i]
+		if got.Schedule != w.Schedule || got.Day != w.Day || got.Time != w.Time || !strings.HasPrefix(got.Message, w.Message) {
+			t.Errorf("error %d = %+v, want %+v", i, got, w)
+		}
+	}
+	// each is logged too, with where it was
+	logged := logEntries(t, buf, result.Errors[1].Message)
+	if len(logged) == 0 || logged[0]["level"] != "error" || logged[0]["Schedule"] != "term" || logged[0]["Time"] != "09:00" {
+		t.Errorf("logged %v, want the rejected event at error", logged)
+	}
+}
+
+func TestDefaultSound(t *testing.T) {
+	doc := `[{"name": "term", "starts": "2024-01-01", "ends": "2024-12-31", "days": [
+		{"name": "Monday", "events": [{"time": "08:00"}, {"time": "09:00", "sound": "bell.mp3"}]},
+		{"name": "Tuesday", "default_sound": "bell.mp3", "events": [{"time": "08:00"}]}
+	]}]`
+	now := time.Date(2024, 3, 4, 7, 0, 0, 0, time.UTC)
+
+	t.Run("applied", func(t *testing.T) {
+		testDir(t)
+		setConfig(t, "audio.default-sound", "bell.mp3")
+		loadSchedule(t, now, doc)
+		if len(parseErrors) != 0 || len(entriesOf("bell")) != 3 {
+			t.Fatalf("errors = %+v with %d bells, want all 3 registered", parseErrors, len(entriesOf("bell")))
+		}
+		want := "Schedule term: MON 08:00 has no sound, using audio.default-sound bell.mp3"
+		if len(parseWarnings) != 1 || parseWarnings[0] != want {
+			t.Errorf("warnings = %q, want only %q", parseWarnings, want)
+		}
+		for _, b := range entriesOf("bell") {
+			if b.Sound != "bell.mp3" {
+				t.Errorf("bell %s %s plays %q, want bell.mp3", b.Day, b.Time, b.Sound)
+			}
+		}
+		// the schedule itself still has no sound there
+		schedules := []*schedule{}
+		decodeBody(t, apiRequest(t, "GET", "/api/v1/schedules", ""), &schedules)
+		if sound := schedules[0].Days[0].Events[0].Sound; sound != "" {
+			t.Errorf("stored sound = %q, want none", sound)
+		}
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		testDir(t)
+		loadSchedule(t, now, doc)
+		if len(parseErrors) != 1 || parseErrors[0].Time != "08:00" || parseErrors[0].Day != "MON" || !strings.Contains(parseErrors[0].Message, "no sound and no audio.default-sound") {
+			t.Errorf("errors = %+v, want the soundless Monday bell rejected", parseErrors)
+		}
+		if len(entriesOf("bell")) != 2 {
+			t.Errorf("bells = %d, want the other 2", len(entriesOf("bell")))
+		}
+	})
+}
+
+func TestDayDefaultSound(t *testing.T) {
+	testDir(t)
+	sound, err := os.ReadFile("sounds/bell.mp3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, "sounds/chime.mp3", string(sound))
+	writeFile(t, "sounds/gong.mp3", string(sound))
+	setConfig(t, "audio.default-sound", "gong.mp3")
+	loadSchedule(t, time.Date(2024, 3, 4, 7, 0, 0, 0, time.UTC), `[{"name": "term", "starts": "2024-01-01", "ends": "2024-12-31", "days": [
+		{"name": "Monday", "default_sound": "chime.mp3", "events": [{"time": "08:00"}, {"time": "09:00", "sound": "bell.mp3"}, {"time": "10:00"}]},
+		{"name": "Tuesday", "events": [{"time": "08:00"}]},
+		{"name": "Wednesday", "default_sound": "missing.mp3", "events": [{"time": "08:00"}, {"time": "09:00", "sound": "bell.mp3"}]}
+	]}]`)
+
+	// the event's own sound, then its day's, then audio.default-sound
+	got := map[string]string{}
+	for _, b := range entriesOf("bell") {
+		got[b.Day+" "+b.Time] = b.Sound
+	}
+	want := map[string]string{
+		"MON 08:00": "chime.mp3",
+		"MON 09:00": "bell.mp3",
+		"MON 10:00": "chime.mp3",
+		"TUE 08:00": "gong.mp3",
+		"WED 08:00": "missing.mp3",
+		"WED 09:00": "bell.mp3",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("bells = %v, want %v", got, want)
+	}
+	if len(parseErrors) != 1 || parseErrors[0].Day != "WED" || !strings.HasPrefix(parseErrors[0].Message, "Invalid default_sound: ") || !strings.Contains(parseErrors[0].Message, "missing.mp3") {
+		t.Errorf("errors = %+v, want Wednesday's missing default_sound", parseErrors)
+	}
+	// without schedule.strict-sounds the bells using it are flagged, not dropped
+	for _, b := range entriesOf("bell") {
+		if broken := b.Broken != ""; broken != (b.Sound == "missing.mp3") {
+			t.Errorf("bell %s %s playing %s broken = %q", b.Day, b.Time, b.Sound, b.Broken)
+		}
+	}
+}
+
+func TestInlineSound(t *testing.T) {
+	testDir(t)
+	sound, err := os.ReadFile("sounds/bell.mp3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	player := &recordingPlayer{}
+	useQueue(t, player, 8)
+	inline := func(data, format string) string {
+		return fmt.Sprintf(`[{"name": "term", "starts": "2024-01-01", "ends": "2024-12-31", "days": [{"name": "Monday", "events": [{"time": "08:00", "sound_data": %q, "sound_format": %q}]}]}]`, data, format)
+	}
+	clock := loadSchedule(t, time.Date(2024, 3, 4, 7, 0, 0, 0, time.UTC), inline(base64.StdEncoding.EncodeToString(sound), "mp3"))
+	os.Remove("sounds/bell.mp3")
+
+	clock.Set(time.Date(2024, 3, 4, 8, 0, 0, 0, time.UTC))
+	runBell(t, "term", "08:00")
+	waitFor(t, "the inline sound to play", func() bool { return player.count() == 1 })
+	pcm, _, err := jobPCM(&playJob{SoundData: sound})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, _ := io.ReadAll(pcm)
+	player.mu.Lock()
+	played := player.played[0]
+	player.mu.Unlock()
+	if !bytes.Equal(played, want) {
+		t.Errorf("played %d bytes, want the inline mp3's %d", len(played), len(want))
+	}
+
+	tests := []struct {
+		name, data, format, err string
+	}{
+		{"oversized", base64.StdEncoding.EncodeToString(make([]byte, maxSoundData+3)), "mp3", "sound data is over"},
+		{"wrong format", base64.StdEncoding.EncodeToString(sound), "ogg", "unsupported sound format"},
+		{"not base64", "not base64!", "mp3", "illegal base64"},
+		{"not an mp3", base64.StdEncoding.EncodeToString([]byte("hello")), "mp3", "could not decode mp3"},
+	}
+	for _, tt := range tests {
+		// the schema already refuses formats other than mp3
+		if _, err := decodeSoundData(&event{SoundData: tt.data, SoundFormat: tt.format}); err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: decodeSoundData = %v, want %q", tt.name, err, tt.err)
+		}
+	}
+	writeFile(t, scheduleFile, inline(tests[0].data, "mp3"))
+	if err := reloadSchedule(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(parseErrors) != 1 || !strings.Contains(parseErrors[0].Message, "sound data is over") || len(entriesOf("bell")) != 0 {
+		t.Errorf("errors = %+v, want the oversized sound rejected", parseErrors)
+	}
+}
+
+func TestYearlyWindow(t *testing.T) {
+	day := func(y int, m time.Month, d int) time.Time {
+		return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+	}
+	tests := []struct {
+		name, starts, ends string
+		now                time.Time
+		active             bool
+		windowStart        time.Time
+		windowEnd          time.Time
+	}{
+		{"same year, inside", "09-01", "12-20", day(2024, 10, 1), true, day(2024, 9, 1), day(2024, 12, 20)},
+		{"same year, after", "09-01", "12-20", day(2025, 1, 10), false, day(2025, 9, 1), day(2025, 12, 20)},
+		{"same year, next year", "09-01", "12-20", day(2025, 9, 2), true, day(2025, 9, 1), day(2025, 12, 20)},
+		{"dates with a year", "2019-09-01", "2019-12-20", day(2024, 10, 1), true, day(2024, 9, 1), day(2024, 12, 20)},
+		{"spanning, December", "12-01", "02-28", day(2024, 12, 15), true, day(2024, 12, 1), day(2025, 2, 28)},
+		{"spanning, January", "12-01", "02-28", day(2025, 1, 15), true, day(2024, 12, 1), day(2025, 2, 28)},
+		{"spanning, March", "12-01", "02-28", day(2025, 3, 5), false, day(2025, 12, 1), day(2026, 2, 28)},
+		{"spanning, November", "12-01", "02-28", day(2025, 11, 30), false, day(2025, 12, 1), day(2026, 2, 28)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testDir(t)
+			doc := fmt.Sprintf(`[{"name": "term", "recur": "yearly", "starts": %q, "ends": %q, "days": [
+				{"name": "Sunday", "events": [{"time": "08:00", "sound": "bell.mp3"}]},
+				{"name": "Monday", "events": [{"time": "08:00", "sound": "bell.mp3"}]},
+				{"name": "Tuesday", "events": [{"time": "08:00", "sound": "bell.mp3"}]},
+				{"name": "Wednesday", "events": [{"time": "08:00", "sound": "bell.mp3"}]},
+				{"name": "Thursday", "events": [{"time": "08:00", "sound": "bell.mp3"}]},
+				{"name": "Friday", "events": [{"time": "08:00", "sound": "bell.mp3"}]},
+				{"name": "Saturday", "events": [{"time": "08:00", "sound": "bell.mp3"}]}
+			]}]`, tt.starts, tt.ends)
+			now := tt.now.Add(7 * time.Hour)
+			loadSchedule(t, now, doc)
+			if got := len(active()) == 1; got != tt.active {
+				t.Errorf("active on %s = %v, want %v", tt.now.Format("2006-01-02"), got, tt.active)
+			}
+			starts, ends, _, err := scheduleWindow(&schedule{Recur: "yearly", Starts: tt.starts, Ends: tt.ends}, now)
+			if err != nil || !starts.Equal(tt.windowStart) || !ends.Equal(tt.windowEnd) {
+				t.Errorf("window = %s to %s %v, want %s to %s", starts, ends, err, tt.windowStart, tt.windowEnd)
+			}
+		})
+	}
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+func getSchedulesHandler(w http.ResponseWriter, r *http.Request) {
+	scheduleMu.RLock()
+	defer scheduleMu.RUnlock()
+	writeJSON(w, http.StatusOK, loadedSchedules)
+}
+
+// getExportSchedulesHandler downloads the loaded schedule document,
+// indented as saveSchedules writes it, to back it up or import it elsewhere.
+func getExportSchedulesHandler(w http.ResponseWriter, r *http.Request) {
+	scheduleMu.RLock()
+	content, err := json.MarshalIndent(loadedSchedules, "", "  ")
+	scheduleMu.RUnlock()
+	if err != nil {
+		log.Errorf("Could not export schedule: %v", err)
+		writeError(w, http.StatusInternalServerError, "could not export schedule")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.Header().Set("Content-Disposition", "attachment; filename=schedule.json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(append(content, '\n'))
+}
+
+type reloadResult struct {
+	Status   string           `json:"status"`
+	Warnings []string         `json:"warnings"`
+	Errors   []*scheduleError `json:"errors"`
+}
+
+// apiReloads coalesces the reload endpoint's requests: one arriving while a
+// reload runs waits for it instead of starting another, and once it's done
+// the next has to wait schedule.reload-min-interval.
+var apiReloads struct {
+	mu      sync.Mutex
+	running *reloadCall
+	last    time.Time
+}
+
+type reloadCall struct {
+	done chan struct{}
+	err  error
+}
+
+// coalescedReload reloads the schedule, or joins the reload already
+// running. It returns how long to wait instead when the last one finished
+// too recently.
+func coalescedReload(ctx context.Context) (time.Duration, error) {
+	apiReloads.mu.Lock()
+	if call := apiReloads.running; call != nil {
+		apiReloads.mu.Unlock()
+		select {
+		case <-call.done:
+			return 0, call.err
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		}
+	}
+	interval := viper.GetDuration("schedule.reload-min-interval")
+	if wait := interval - time.Since(apiReloads.last); interval > 0 && !apiReloads.last.IsZero() && wait > 0 {
+		apiReloads.mu.Unlock()
+		return wait, nil
+	}
+	call := &reloadCall{done: make(chan struct{})}
+	apiReloads.running = call
+	apiReloads.mu.Unlock()
+
+	call.err = reloadSchedule(ctx)
+
+	apiReloads.mu.Lock()
+	apiReloads.running = nil
+	apiReloads.last = time.Now()
+	apiReloads.mu.Unlock()
+	close(call.done)
+	return 0, call.err
+}
+
+func postReloadHandler(w http.ResponseWriter, r *http.Request) {
+	wait, err := coalescedReload(r.Context())
+	if wait > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		writeError(w, http.StatusTooManyRequests, fmt.Sprintf("reloaded less than %s ago", viper.GetDuration("schedule.reload-min-interval")))
+		return
+	}
+	if writeTimeout(w, err) {
+		return
+	}
+	if err != nil {
+		var invalid *validationError
+		if errors.As(err, &invalid) {
+			writeJSON(w, http.StatusUnprocessableEntity, map[string]interface{}{
+				"error":      "schedule.json is invalid",
+				"violations": invalid.Violations,
+			})
+			return
+		}
+		writeError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	scheduleMu.RLock()
+	defer scheduleMu.RUnlock()
+	writeJSON(w, http.StatusOK, &reloadResult{Status: "reloaded", Warnings: parseWarnings, Errors: parseErrors})
+}
+
+// readScheduleFile loads the schedule document from disk.
+func readScheduleFile() ([]*schedule, error) {
+	jsonFile, err := os.ReadFile(scheduleFile)
+	if err != nil {
+		return nil, err
+	}
+	data := []*schedule{}
+	err = json.Unmarshal(scheduleJSON(jsonFile), &data)
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// saveSchedules writes data to the schedule file, replacing it atomically.
+func saveSchedules(data []*schedule) error {
+	content, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeScheduleFile(append(content, '\n'))
+}
+
+// writeScheduleFile replaces the schedule file with content atomically.
+func writeScheduleFile(content []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(scheduleFile), ".schedule-*.json")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(content)
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+	err = tmp.Close()
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), scheduleFile)
+}
+
+// findDay matches a day by its full name or three letter abbreviation.
+func findDay(sch *schedule, name string) *day {
+	for _, d := range sch.Days {
+		if strings.EqualFold(d.Name, name) || (len(d.Name) >= 3 && strings.EqualFold(d.Name[0:3], name)) {
+			return d
+		}
+	}
+	return nil
+}
+
+// putDayEnabledHandler turns a day of a schedule on or off in the schedule
+// file and reloads. A schedule fetched from schedule.url is changed there,
+// and one with comments by hand.
+func putDayEnabledHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	body := struct {
+		Enabled *bool `json:"enabled"`
+	}{}
+	err := json.NewDecoder(io.LimitReader(r.Body, 1000000)).Decode(&body)
+	if err != nil || body.Enabled == nil {
+		writeError(w, http.StatusBadRequest, `expected {"enabled": true|false}`)
+		return
+	}
+	if viper.GetString("schedule.url") != "" {
+		writeError(w, http.StatusConflict, "the schedule is fetched from schedule.url, change it there")
+		return
+	}
+
+	importMu.Lock()
+	defer importMu.Unlock()
+	// rewriting the file would lose the admin's comments
+	if raw, err := os.ReadFile(scheduleFile); err == nil && viper.GetBool("schedule.jsonc") && hasComments(raw) {
+		writeError(w, http.StatusConflict, "schedule.json has comments, edit it by hand to keep them")
+		return
+	}
+	data, err := readScheduleFile()
+	if err != nil {
+		log.Errorf("Could not read schedule: %v", err)
+		writeError(w, http.StatusInternalServerError, "could not read schedule")
+		return
+	}
+	var d *day
+	for _, sch := range data {
+		if sch.Name == vars["name"] {
+			d = findDay(sch, vars["day"])
+			break
+		}
+	}
+	if d == nil {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("day not found: %s %s", vars["name"], vars["day"]))
+		return
+	}
+	d.Enabled = body.Enabled
+
+	err = saveSchedules(data)
+	if err != nil {
+		log.Errorf("Could not save schedule: %v", err)
+		writeError(w, http.StatusInternalServerError, "could not save schedule")
+		return
+	}
+	err = reloadSchedule(r.Context())
+	if writeTimeout(w, err) {
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, d)
+}
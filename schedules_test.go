@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+func TestReloadBadScheduleKeepsRunning(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  string
+	}{
+		{"truncated", `[{"name": "term", "days": [`},
+		{"schema violation", `[{"name": "term", "days": "Monday"}]`},
+		{"missing file", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testDir(t)
+			loadSchedule(t, time.Date(2024, 3, 4, 7, 0, 0, 0, time.UTC), mondayBells)
+			service, loaded := cronService, loadedSchedules
+			before := entriesOf("bell")
+
+			if tt.doc == "" {
+				os.Remove(scheduleFile)
+			} else {
+				writeFile(t, scheduleFile, tt.doc)
+			}
+			if err := reloadSchedule(context.Background()); err == nil {
+				t.Fatal("reload succeeded, want an error")
+			}
+			rec := apiRequest(t, "POST", "/api/v1/reload", "")
+			if rec.Code != http.StatusUnprocessableEntity {
+				t.Errorf("reload endpoint = %d %s, want 422", rec.Code, rec.Body)
+			}
+
+			if cronService != service || len(loadedSchedules) != 1 || loadedSchedules[0] != loaded[0] {
+				t.Error("the running schedule was replaced")
+			}
+			after := entriesOf("bell")
+			if len(after) != 1 || after[0] != before[0] {
+				t.Errorf("bells = %v, want the one registered before", after)
+			}
+			if !cronRunning.Load() {
+				t.Error("cron stopped")
+			}
+		})
+	}
+}
+
+func TestDayEnabled(t *testing.T) {
+	testDir(t)
+	loadSchedule(t, time.Date(2024, 3, 4, 7, 0, 0, 0, time.UTC), `[{"name": "term", "starts": "2024-01-01", "ends": "2024-12-31", "days": [
+		{"name": "Monday", "events": [{"time": "08:00", "sound": "bell.mp3"}]},
+		{"name": "Tuesday", "enabled": false, "events": [{"time": "09:00", "sound": "bell.mp3"}]}
+	]}]`)
+	days := func() []string {
+		names := []string{}
+		for _, info := range entriesOf("bell") {
+			names = append(names, info.Day)
+		}
+		sort.Strings(names)
+		return names
+	}
+	if got := days(); !reflect.DeepEqual(got, []string{"MON"}) {
+		t.Fatalf("bell days = %v, want only MON", got)
+	}
+
+	tests := []struct {
+		day, body string
+		code      int
+		want      []string
+	}{
+		{"tue", `{"enabled": true}`, http.StatusOK, []string{"MON", "TUE"}},
+		{"Monday", `{"enabled": false}`, http.StatusOK, []string{"TUE"}},
+		{"MON", `{"enabled": true}`, http.StatusOK, []string{"MON", "TUE"}},
+		{"Friday", `{"enabled": false}`, http.StatusNotFound, []string{"MON", "TUE"}},
+		{"MON", `{}`, http.StatusBadRequest, []string{"MON", "TUE"}},
+	}
+	for _, tt := range tests {
+		rec := apiRequest(t, "PUT", "/api/v1/schedules/term/days/"+tt.day+"/enabled", tt.body)
+		if rec.Code != tt.code {
+			t.Errorf("PUT %s %s = %d %s, want %d", tt.day, tt.body, rec.Code, rec.Body, tt.code)
+		}
+		if got := days(); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("after PUT %s %s bell days = %v, want %v", tt.day, tt.body, got, tt.want)
+		}
+	}
+
+	saved, err := readScheduleFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(saved[0].Days) != 2 || !saved[0].Days[0].isEnabled() || !saved[0].Days[1].isEnabled() {
+		t.Error("the toggles weren't saved to the schedule file")
+	}
+
+	setConfig(t, "schedule.url", "http://example.com/schedule.json")
+	rec := apiRequest(t, "PUT", "/api/v1/schedules/term/days/MON/enabled", `{"enabled": false}`)
+	if rec.Code != http.StatusConflict {
+		t.Errorf("PUT with schedule.url = %d, want 409", rec.Code)
+	}
+	if saved, _ := readScheduleFile(); !saved[0].Days[0].isEnabled() {
+		t.Error("the schedule file changed with schedule.url set")
+	}
+}
+
+func TestIncrementalReload(t *testing.T) {
+	testDir(t)
+	sound, err := os.ReadFile("sounds/bell.mp3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, "sounds/chime.mp3", string(sound))
+	writeFile(t, "sounds/lower/bell.mp3", string(sound))
+	loadSchedule(t, time.Date(2024, 3, 4, 7, 0, 0, 0, time.UTC), `[{"name": "term", "starts": "2024-01-01", "ends": "2024-12-31", "days": [{"name": "Monday", "events": [
+		{"time": "08:00", "sound": "bell.mp3"},
+		{"time": "09:00", "sound": "bell.mp3"},
+		{"time": "10:00", "sound": "bell.mp3"}
+	]}]}, {"name": "lower", "starts": "2024-01-01", "ends": "2024-12-31", "days": [{"name": "Monday", "events": [
+		{"time": "11:00", "sound": "bell.mp3"}
+	]}]}]`)
+	ids := func() map[string]cron.EntryID {
+		scheduleMu.RLock()
+		defer scheduleMu.RUnlock()
+		byTime := map[string]cron.EntryID{}
+		for _, entry := range cronService.Entries() {
+			if info := entryMeta[entry.ID]; info != nil && info.Kind == "bell" {
+				byTime[info.Time] = entry.ID
+			}
+		}
+		return byTime
+	}
+	before := ids()
+	service := cronService
+	logs := captureLog(t)
+
+	// 08:00 stays, 09:00 plays another sound, 10:00 goes, 12:00 is new and
+	// lower's sounds move to their own folder
+	writeFile(t, scheduleFile, `[{"name": "term", "starts": "2024-01-01", "ends": "2024-12-31", "days": [{"name": "Monday", "events": [
+		{"time": "08:00", "sound": "bell.mp3"},
+		{"time": "09:00", "sound": "chime.mp3"},
+		{"time": "12:00", "sound": "bell.mp3"}
+	]}]}, {"name": "lower", "sounds_dir": "lower", "starts": "2024-01-01", "ends": "2024-12-31", "days": [{"name": "Monday", "events": [
+		{"time": "11:00", "sound": "bell.mp3"}
+	]}]}]`)
+	err = reloadSchedule(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	after := ids()
+
+	if cronService != service {
+		t.Error("reload replaced the cron service")
+	}
+	if after["08:00"] != before["08:00"] {
+		t.Error("the unchanged 08:00 bell got a new entry")
+	}
+	if after["09:00"] == before["09:00"] || after["11:00"] == before["11:00"] {
+		t.Error("changed bells kept their old entries")
+	}
+	if _, ok := after["10:00"]; ok {
+		t.Error("the removed 10:00 bell is still scheduled")
+	}
+	if _, ok := after["12:00"]; !ok || len(after) != 4 {
+		t.Errorf("bells = %v, want 08:00, 09:00, 11:00 and 12:00", after)
+	}
+	entries := logEntries(t, logs, "Cron entries updated")
+	if len(entries) != 1 || entries[0]["Added"] != 3.0 || entries[0]["Removed"] != 3.0 || entries[0]["Kept"] != 1.0 {
+		t.Errorf("logged %v, want 3 added, 3 removed and 1 kept", entries)
+	}
+
+	// a fresh rebuild registers everything again in a new service
+	err = rebuildSchedule(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cronService == service || len(ids()) != 4 {
+		t.Errorf("rebuild kept the old service or lost bells: %v", ids())
+	}
+}
+
+func TestExportSchedules(t *testing.T) {
+	testDir(t)
+	doc := `[{"name": "term", "starts": "2024-01-01", "ends": "2024-12-31", "days": [{"name": "Monday", "events": [
+		{"time": "08:00", "sound": "bell.mp3", "label": "First period", "role": "first"},
+		{"time": "09:00", "second": 30, "sound": [{"file": "bell.mp3", "weight": 2}, {"file": "bell.mp3"}]},
+		{"cron": "0 */2 * * *", "sound": "bell.mp3", "zone": "all"}
+	]}]}]`
+	loadSchedule(t, time.Date(2024, 3, 4, 7, 0, 0, 0, time.UTC), doc)
+	before := entriesOf("bell")
+
+	rec := apiRequest(t, "GET", "/api/v1/schedules/export", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("export = %d, want 200", rec.Code)
+	}
+	if got := rec.Header().Get("Content-Disposition"); got != "attachment; filename=schedule.json" {
+		t.Errorf("Content-Disposition = %q, want a schedule.json attachment", got)
+	}
+	if !strings.HasPrefix(rec.Body.String(), "[\n  {\n    \"name\": \"term\"") {
+		t.Errorf("export = %s, want it indented", rec.Body)
+	}
+
+	// what's exported loads back as the same bells
+	writeFile(t, scheduleFile, rec.Body.String())
+	if err := parseSchedule(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(parseErrors) != 0 {
+		t.Errorf("errors = %+v, want none", parseErrors)
+	}
+	after := entriesOf("bell")
+	key := func(infos []*entryInfo) []string {
+		keys := []string{}
+		for _, info := range infos {
+			keys = append(keys, info.Time+info.Cron+" "+info.Sound+" "+info.Label+" "+info.Role+" "+info.Zone)
+		}
+		sort.Strings(keys)
+		return keys
+	}
+	if !reflect.DeepEqual(key(after), key(before)) {
+		t.Errorf("bells after the round trip = %q, want %q", key(after), key(before))
+	}
+	again := apiRequest(t, "GET", "/api/v1/schedules/export", "")
+	if again.Body.String() != rec.Body.String() {
+		t.Errorf("second export =\n%s\nwant\n%s", again.Body, rec.Body)
+	}
+}
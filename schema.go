@@ -0,0 +1,159 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// scheduleSchema is the JSON Schema for schedule.json. Only the keywords it
+// uses are implemented: type (a name or a list of names), properties,
+// required, items, pattern, minLength, minimum and maximum.
+//
+//go:embed schedule.schema.json
+var scheduleSchema []byte
+
+// validationError lists every schema violation in a document.
+type validationError struct {
+	Violations []string
+}
+
+func (v *validationError) Error() string {
+	return fmt.Sprintf("schedule.json is invalid: %s", strings.Join(v.Violations, "; "))
+}
+
+// validateScheduleJSON checks raw against scheduleSchema, returning a
+// *validationError when it doesn't conform.
+func validateScheduleJSON(raw []byte) error {
+	schema := map[string]interface{}{}
+	err := json.Unmarshal(scheduleSchema, &schema)
+	if err != nil {
+		return fmt.Errorf("could not parse embedded schema: %v", err)
+	}
+	var doc interface{}
+	err = json.Unmarshal(raw, &doc)
+	if err != nil {
+		return err
+	}
+	violations := []string{}
+	validateValue(schema, doc, "schedules", &violations)
+	if len(violations) > 0 {
+		return &validationError{Violations: violations}
+	}
+	return nil
+}
+
+func validateValue(schema map[string]interface{}, value interface{}, path string, violations *[]string) {
+	if types := schemaTypes(schema); len(types) > 0 && !hasAnyType(value, types) {
+		*violations = append(*violations, fmt.Sprintf("%s: expected %s, got %s", path, strings.Join(types, " or "), jsonType(value)))
+		return
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if required, ok := schema["required"].([]interface{}); ok {
+			for _, name := range required {
+				if _, ok := v[name.(string)]; !ok {
+					*violations = append(*violations, fmt.Sprintf("%s.%s: is required", path, name))
+				}
+			}
+		}
+		if properties, ok := schema["properties"].(map[string]interface{}); ok {
+			names := []string{}
+			for name := range v {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				if property, ok := properties[name].(map[string]interface{}); ok {
+					validateValue(property, v[name], path+"."+name, violations)
+				}
+			}
+		}
+	case []interface{}:
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			for i, item := range v {
+				validateValue(items, item, fmt.Sprintf("%s[%d]", path, i), violations)
+			}
+		}
+	case string:
+		if minLength, ok := schema["minLength"].(float64); ok && float64(utf8.RuneCountInString(v)) < minLength {
+			*violations = append(*violations, fmt.Sprintf("%s: %q is shorter than %v characters", path, v, minLength))
+		}
+		if pattern, ok := schema["pattern"].(string); ok {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				*violations = append(*violations, fmt.Sprintf("%s: invalid schema pattern %q", path, pattern))
+			} else if !re.MatchString(v) {
+				*violations = append(*violations, fmt.Sprintf("%s: %q does not match %s", path, v, pattern))
+			}
+		}
+	case float64:
+		if minimum, ok := schema["minimum"].(float64); ok && v < minimum {
+			*violations = append(*violations, fmt.Sprintf("%s: %v is less than %v", path, v, minimum))
+		}
+		if maximum, ok := schema["maximum"].(float64); ok && v > maximum {
+			*violations = append(*violations, fmt.Sprintf("%s: %v is greater than %v", path, v, maximum))
+		}
+	}
+}
+
+// schemaTypes returns the "type" of schema, a name or a list of names.
+func schemaTypes(schema map[string]interface{}) []string {
+	switch t := schema["type"].(type) {
+	case string:
+		return []string{t}
+	case []interface{}:
+		types := []string{}
+		for _, name := range t {
+			if name, ok := name.(string); ok {
+				types = append(types, name)
+			}
+		}
+		return types
+	}
+	return nil
+}
+
+func hasAnyType(value interface{}, types []string) bool {
+	for _, t := range types {
+		if hasType(value, t) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasType(value interface{}, t string) bool {
+	switch t {
+	case "integer":
+		n, ok := value.(float64)
+		return ok && n == math.Trunc(n)
+	default:
+		return jsonType(value) == t
+	}
+}
+
+func jsonType(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
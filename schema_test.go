@@ -0,0 +1,89 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestValidateScheduleJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  string
+		want []string
+	}{
+		{"valid", `[{"name": "term", "starts": "2024-01-01", "ends": "2024-12-31", "sounds_dir": "term", "days": [
+			{"name": "Monday", "default_sound": "bell.mp3", "events": [
+				{"time": "08:00", "sound": [{"file": "a.mp3", "weight": 2}, {"file": "b.mp3"}], "volume": 0.5},
+				{"cron": "0 */15 * * * *", "sound": "bell.mp3", "repeat": 3, "weather": [{"condition": "rain", "sound": "rain.mp3"}]}
+			]}]}]`, nil},
+		{"not a list", `{"name": "term"}`, []string{"schedules: expected array, got object"}},
+		{"missing fields", `[{"starts": "2024-01-01"}]`, []string{"schedules[0].name: is required", "schedules[0].days: is required"}},
+		{"wrong types", `[{"name": 1, "days": [{"name": "Monday", "enabled": "yes", "events": [{"time": 800}]}]}]`, []string{
+			"schedules[0].days[0].enabled: expected boolean, got string",
+			"schedules[0].days[0].events[0].time: expected string, got number",
+			"schedules[0].name: expected string, got number",
+		}},
+		{"bad time", `[{"name": "term", "days": [{"name": "Monday"}, {"name": "Tuesday", "events": [{"time": "8:00"}, {"time": "24:00"}]}]}]`, []string{
+			`schedules[0].days[1].events[0].time: "8:00" does not match ^([01]\d|2[0-3]):[0-5]\d$`,
+			`schedules[0].days[1].events[1].time: "24:00" does not match ^([01]\d|2[0-3]):[0-5]\d$`,
+		}},
+		{"out of range", `[{"name": "term", "days": [{"name": "Monday", "events": [{"time": "08:00", "volume": 1.5, "second": 60, "repeat": 1.5}]}]}]`, []string{
+			"schedules[0].days[0].events[0].repeat: expected integer, got number",
+			"schedules[0].days[0].events[0].second: 60 is greater than 59",
+			"schedules[0].days[0].events[0].volume: 1.5 is greater than 1",
+		}},
+		{"empty strings", `[{"name": "term", "sounds_dir": "", "days": [{"name": "Monday", "default_sound": "", "events": [{"time": "08:00", "weather": [{"condition": "rain", "sound": ""}]}]}]}]`, []string{
+			`schedules[0].days[0].default_sound: "" is shorter than 1 characters`,
+			`schedules[0].days[0].events[0].weather[0].sound: "" is shorter than 1 characters`,
+			`schedules[0].sounds_dir: "" is shorter than 1 characters`,
+		}},
+		{"bad day", `[{"name": "term", "days": [{"name": "Someday"}]}]`, []string{
+			`schedules[0].days[0].name: "Someday" does not match ^(?i)(sun|mon|tue|wed|thu|fri|sat)`,
+		}},
+		{"weighted sound without file", `[{"name": "term", "days": [{"name": "Monday", "events": [{"time": "08:00", "sound": [{"weight": 0}]}]}]}]`, []string{
+			"schedules[0].days[0].events[0].sound[0].file: is required",
+			"schedules[0].days[0].events[0].sound[0].weight: 0 is less than 1",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateScheduleJSON([]byte(tt.doc))
+			if tt.want == nil {
+				if err != nil {
+					t.Fatalf("validateScheduleJSON = %v, want valid", err)
+				}
+				return
+			}
+			var invalid *validationError
+			if !errors.As(err, &invalid) {
+				t.Fatalf("validateScheduleJSON = %v, want a validation error", err)
+			}
+			if !reflect.DeepEqual(invalid.Violations, tt.want) {
+				t.Errorf("violations = %q, want %q", invalid.Violations, tt.want)
+			}
+		})
+	}
+}
+
+func TestReloadReportsViolations(t *testing.T) {
+	testDir(t)
+	loadSchedule(t, time.Date(2024, 3, 4, 7, 0, 0, 0, time.UTC), mondayBells)
+	writeFile(t, scheduleFile, `[{"name": "term", "days": [{"name": "Monday", "events": [{"time": "8:00", "sound": "bell.mp3"}]}]}]`)
+
+	rec := apiRequest(t, "POST", "/api/v1/reload", "")
+	result := struct {
+		Error      string   `json:"error"`
+		Violations []string `json:"violations"`
+	}{}
+	decodeBody(t, rec, &result)
+	want := []string{`schedules[0].days[0].events[0].time: "8:00" does not match ^([01]\d|2[0-3]):[0-5]\d$`}
+	if rec.Code != http.StatusUnprocessableEntity || !reflect.DeepEqual(result.Violations, want) {
+		t.Errorf("reload = %d %s, want 422 with %q", rec.Code, rec.Body, want)
+	}
+	if len(entriesOf("bell")) != 1 {
+		t.Error("the running schedule was dropped")
+	}
+}
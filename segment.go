@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/hajimehoshi/go-mp3"
+)
+
+// hasSegment reports whether only part of a sound should play.
+func hasSegment(startMs, endMs int) bool {
+	return startMs != 0 || endMs != 0
+}
+
+// checkSegment validates a startMs..endMs segment of sound in dir, or of its
+// inline data when set, against the sound's duration. endMs 0 plays to the end.
+func checkSegment(dir, sound string, data []byte, startMs, endMs int) error {
+	if startMs < 0 || endMs < 0 || (endMs != 0 && endMs <= startMs) {
+		return fmt.Errorf("invalid segment: %dms to %dms", startMs, endMs)
+	}
+	if data == nil {
+		soundPath, err := resolveSoundPath(dir, sound)
+		if err != nil {
+			return err
+		}
+		data, err = os.ReadFile(soundPath)
+		if err != nil {
+			return err
+		}
+	}
+	decoded, err := mp3.NewDecoder(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("could not decode mp3 %s: %v", sound, err)
+	}
+	durationMs := decoded.Length() / frameSize * 1000 / int64(decoded.SampleRate())
+	if int64(startMs) >= durationMs || int64(endMs) > durationMs {
+		return fmt.Errorf("segment %dms to %dms is outside %s (%dms)", startMs, endMs, sound, durationMs)
+	}
+	return nil
+}
+
+// segmentReader seeks decoded to startMs and stops it at endMs, or at the
+// end when endMs is 0.
+func segmentReader(decoded *mp3.Decoder, startMs, endMs int) (io.Reader, error) {
+	start := int64(durationFrames(decoded.SampleRate(), startMs)) * frameSize
+	_, err := decoded.Seek(start, io.SeekStart)
+	if err != nil {
+		return nil, err
+	}
+	if endMs == 0 {
+		return decoded, nil
+	}
+	end := int64(durationFrames(decoded.SampleRate(), endMs)) * frameSize
+	return io.LimitReader(decoded, end-start), nil
+}
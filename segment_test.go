@@ -0,0 +1,69 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckSegment(t *testing.T) {
+	testDir(t)
+	tests := []struct {
+		startMs, endMs int
+		err            string
+	}{
+		{0, 1000, ""},
+		{1000, 2000, ""},
+		{2000, 0, ""},
+		{0, 3744, ""},
+		{-1, 1000, "invalid segment"},
+		{1000, 1000, "invalid segment"},
+		{2000, 1000, "invalid segment"},
+		{0, 5000, "outside bell.mp3"},
+		{4000, 0, "outside bell.mp3"},
+	}
+	for _, tt := range tests {
+		err := checkSegment(soundsDir(), "bell.mp3", nil, tt.startMs, tt.endMs)
+		if tt.err == "" && err != nil || tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+			t.Errorf("checkSegment(%d, %d) = %v, want %q", tt.startMs, tt.endMs, err, tt.err)
+		}
+	}
+}
+
+func TestPlaySegment(t *testing.T) {
+	testDir(t)
+	player := &recordingPlayer{}
+	useQueue(t, player, 4)
+	for _, job := range []*playJob{
+		{Sound: "bell.mp3", Done: make(chan error, 1)},
+		{Sound: "bell.mp3", StartMs: 1000, EndMs: 2000, Done: make(chan error, 1)},
+	} {
+		if err := enqueuePlay(job); err != nil {
+			t.Fatal(err)
+		}
+		if err := <-job.Done; err != nil {
+			t.Fatal(err)
+		}
+	}
+	player.mu.Lock()
+	defer player.mu.Unlock()
+	full, segment := len(player.played[0]), len(player.played[1])
+	if want := durationFrames(player.rates[1], 1000) * frameSize; segment != want {
+		t.Errorf("segment played %d bytes, want %d of the %d", segment, want, full)
+	}
+}
+
+func TestSegmentOutsideSound(t *testing.T) {
+	testDir(t)
+	loadSchedule(t, time.Date(2024, 3, 4, 7, 0, 0, 0, time.UTC), `[{"name": "term", "starts": "2024-01-01", "ends": "2024-12-31", "days": [{"name": "Monday", "events": [
+		{"time": "08:00", "sound": "bell.mp3", "start_ms": 1000, "end_ms": 2000},
+		{"time": "09:00", "sound": "bell.mp3", "start_ms": 3000, "end_ms": 9000}
+	]}]}]`)
+	bells := entriesOf("bell")
+	if len(bells) != 1 || bells[0].Time != "08:00" {
+		t.Errorf("bells = %+v, want only the one at 08:00", bells)
+	}
+	if len(parseErrors) != 1 || !strings.Contains(parseErrors[0].Message, "segment 3000ms to 9000ms is outside bell.mp3") {
+		t.Errorf("errors = %+v, want the 09:00 segment rejected", parseErrors)
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// newServer builds the HTTP server for handler. With a certificate, TLS
+// negotiates HTTP/2 on its own; app.h2c also accepts HTTP/2 over plain TCP,
+// for when TLS is terminated by a proxy in front. HTTP/1.1 keeps working
+// either way.
+func newServer(addr string, handler http.Handler) *http.Server {
+	srv := &http.Server{
+		Handler:     handler,
+		Addr:        addr,
+		IdleTimeout: viper.GetDuration("app.idle-timeout"),
+	}
+	srv.SetKeepAlivesEnabled(viper.GetBool("app.keep-alive"))
+
+	protocols := new(http.Protocols)
+	protocols.SetHTTP1(true)
+	protocols.SetHTTP2(true)
+	protocols.SetUnencryptedHTTP2(viper.GetBool("app.h2c"))
+	srv.Protocols = protocols
+	srv.HTTP2 = &http.HTTP2Config{
+		MaxConcurrentStreams: viper.GetInt("app.http2.max-concurrent-streams"),
+	}
+	return srv
+}
+
+// serve runs srv over TLS when app.tls.cert-file and key-file are set and
+// over plain TCP otherwise.
+func serve(srv *http.Server) error {
+	ln, err := listen(srv.Addr)
+	if err != nil {
+		return err
+	}
+	cert, key := viper.GetString("app.tls.cert-file"), viper.GetString("app.tls.key-file")
+	if cert != "" && key != "" {
+		return srv.ServeTLS(ln, cert, key)
+	}
+	return srv.Serve(ln)
+}
+
+// listen opens addr, a TCP address or "unix:<path>" for a unix socket. A
+// socket left behind by a previous run is replaced; the listener removes
+// the file once the server shuts down and closes it.
+func listen(addr string) (net.Listener, error) {
+	path, ok := strings.CutPrefix(addr, "unix:")
+	if !ok {
+		if addr == "" {
+			addr = ":http"
+		}
+		return net.Listen("tcp", addr)
+	}
+	info, err := os.Stat(path)
+	if err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and isn't a socket", path)
+		}
+		err = os.Remove(path)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return net.Listen("unix", path)
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// startServer serves newRouter with newServer on a free port until the test
+// ends, returning its address.
+func startServer(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := newServer(ln.Addr().String(), newRouter())
+	go srv.Serve(ln)
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		srv.Shutdown(ctx)
+	})
+	return ln.Addr().String()
+}
+
+// h2cClient only speaks HTTP/2 without TLS, with prior knowledge.
+func h2cClient(t *testing.T) *http.Client {
+	t.Helper()
+	protocols := new(http.Protocols)
+	protocols.SetUnencryptedHTTP2(true)
+	transport := &http.Transport{Protocols: protocols}
+	t.Cleanup(transport.CloseIdleConnections)
+	return &http.Client{Transport: transport, Timeout: 5 * time.Second}
+}
+
+func TestH2C(t *testing.T) {
+	testDir(t)
+	writeFile(t, "web/dist/index.html", "<html>bell</html>")
+	writeFile(t, "web/dist/assets/app.js", "console.log('bell')")
+	setConfig(t, "app.h2c", true)
+	setConfig(t, "app.keep-alive", true)
+	setConfig(t, "app.http2.max-concurrent-streams", 250)
+	addr := startServer(t)
+	client := h2cClient(t)
+
+	tests := []struct {
+		path, want string
+	}{
+		{"/assets/app.js", "console.log('bell')"},
+		// the web UI's own routes get its index
+		{"/schedules/term", "<html>bell</html>"},
+		{"/api/v1/version", `"version"`},
+	}
+	for _, tt := range tests {
+		resp, err := client.Get("http://" + addr + tt.path)
+		if err != nil {
+			t.Fatalf("GET %s: %v", tt.path, err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.ProtoMajor != 2 || resp.StatusCode != http.StatusOK || !strings.Contains(string(body), tt.want) {
+			t.Errorf("GET %s = %s %d %q, want HTTP/2 200 with %q", tt.path, resp.Proto, resp.StatusCode, body, tt.want)
+		}
+	}
+}
+
+func TestH2COff(t *testing.T) {
+	testDir(t)
+	addr := startServer(t)
+	if resp, err := h2cClient(t).Get("http://" + addr + "/api/v1/version"); err == nil {
+		resp.Body.Close()
+		t.Errorf("HTTP/2 without TLS answered %s with app.h2c off", resp.Proto)
+	}
+	// HTTP/1.1 still works
+	resp, err := http.Get("http://" + addr + "/api/v1/version")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.ProtoMajor != 1 || resp.StatusCode != http.StatusOK {
+		t.Errorf("GET over HTTP/1.1 = %s %d, want 200", resp.Proto, resp.StatusCode)
+	}
+}
+
+func TestUnixSocket(t *testing.T) {
+	testDir(t)
+	path := filepath.Join(t.TempDir(), "bell.sock")
+	// a socket a previous run left behind is replaced
+	stale, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	srv := newServer("unix:"+path, newRouter())
+	served := make(chan error, 1)
+	go func() { served <- serve(srv) }()
+	client := &http.Client{Timeout: 5 * time.Second, Transport: &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", path)
+		},
+	}}
+	var resp *http.Response
+	waitFor(t, "the socket", func() bool {
+		resp, err = client.Get("http://bell/api/v1/version")
+		return err == nil
+	})
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), `"version"`) {
+		t.Errorf("GET over the socket = %d %q, want the version", resp.StatusCode, body)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-served; err != http.ErrServerClosed {
+		t.Errorf("serve = %v, want http.ErrServerClosed", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("socket after shutdown: %v, want it removed", err)
+	}
+
+	// anything else at the path is left alone
+	writeFile(t, path, "notes")
+	if _, err := listen("unix:" + path); err == nil || !strings.Contains(err.Error(), "isn't a socket") {
+		t.Errorf("listen on a file = %v, want it refused", err)
+	}
+}
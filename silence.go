@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// silencedUntil keeps the bells of a zone quiet until that time, then they
+// resume on their own. Silencing defaultZone quiets every zone.
+var (
+	silencedUntil = map[string]time.Time{}
+	silenceMu     sync.RWMutex
+)
+
+// silenceState is whether every zone is silenced, plus the zones silenced
+// on their own.
+type silenceState struct {
+	Silenced bool                  `json:"silenced"`
+	Until    *time.Time            `json:"until,omitempty"`
+	Zones    map[string]*time.Time `json:"zones,omitempty"`
+}
+
+// isSilenced reports whether bells on zone, defaultZone when empty, are
+// silenced at now. Bells on defaultZone itself only stop for a silence of
+// every zone.
+func isSilenced(zone string, now time.Time) bool {
+	if zone == "" {
+		zone = defaultZone
+	}
+	silenceMu.RLock()
+	defer silenceMu.RUnlock()
+	return now.Before(silencedUntil[defaultZone]) || now.Before(silencedUntil[zone])
+}
+
+func currentSilence(now time.Time) *silenceState {
+	silenceMu.RLock()
+	defer silenceMu.RUnlock()
+	state := &silenceState{}
+	for zone, until := range silencedUntil {
+		if !now.Before(until) {
+			continue
+		}
+		until := until
+		if zone == defaultZone {
+			state.Silenced, state.Until = true, &until
+			continue
+		}
+		if state.Zones == nil {
+			state.Zones = map[string]*time.Time{}
+		}
+		state.Zones[zone] = &until
+	}
+	return state
+}
+
+// parseSilenceUntil accepts RFC 3339 or a local "2006-01-02T15:04:05" in
+// the configured timezone.
+func parseSilenceUntil(value string) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339, value)
+	if err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation("2006-01-02T15:04:05", value, globalLocation())
+}
+
+func getSilenceHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, currentSilence(appClock.Now()))
+}
+
+func postSilenceHandler(w http.ResponseWriter, r *http.Request) {
+	body := struct {
+		Until string `json:"until"`
+		Zone  string `json:"zone"`
+	}{}
+	err := json.NewDecoder(io.LimitReader(r.Body, 1000000)).Decode(&body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "could not parse body: "+err.Error())
+		return
+	}
+	until, err := parseSilenceUntil(body.Until)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid until: "+body.Until)
+		return
+	}
+	now := appClock.Now()
+	if !until.After(now) {
+		writeError(w, http.StatusBadRequest, "until must be in the future")
+		return
+	}
+	z, err := resolveZone(body.Zone)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	silenceMu.Lock()
+	for zone, at := range silencedUntil {
+		if !now.Before(at) {
+			delete(silencedUntil, zone)
+		}
+	}
+	silencedUntil[z.Name] = until
+	silenceMu.Unlock()
+
+	log.Printf("Bells silenced until %s (zone %s)", until.Format(time.RFC3339), z.Name)
+	writeJSON(w, http.StatusOK, currentSilence(now))
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestSilenceUntil(t *testing.T) {
+	testDir(t)
+	setConfig(t, "zones", map[string]interface{}{"gym": map[string]interface{}{"device": "hw:1"}})
+	t.Cleanup(func() {
+		silenceMu.Lock()
+		silencedUntil = map[string]time.Time{}
+		silenceMu.Unlock()
+	})
+	clock := useClock(t, time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC))
+	player := &recordingPlayer{}
+	useQueue(t, player, 8)
+	play := func(zone string) error {
+		t.Helper()
+		job := &playJob{Sound: "bell.mp3", Zone: zone, Done: make(chan error, 1), skipDedup: true}
+		if err := enqueuePlay(job); err != nil {
+			t.Fatal(err)
+		}
+		return <-job.Done
+	}
+
+	for _, body := range []string{`{"until": "2024-05-01T09:00:00"}`, `{"until": "11 o'clock"}`, `{"until": "2024-05-01T11:00:00", "zone": "roof"}`} {
+		if rec := apiRequest(t, "POST", "/api/v1/silence-until", body); rec.Code != http.StatusBadRequest {
+			t.Errorf("silence %s = %d, want 400", body, rec.Code)
+		}
+	}
+
+	rec := apiRequest(t, "POST", "/api/v1/silence-until", `{"until": "2024-05-01T11:00:00"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("silence = %d %s, want 200", rec.Code, rec.Body)
+	}
+	state := &silenceState{}
+	decodeBody(t, apiRequest(t, "GET", "/api/v1/silence-until", ""), state)
+	if !state.Silenced || state.Until == nil || !state.Until.Equal(time.Date(2024, 5, 1, 11, 0, 0, 0, time.UTC)) {
+		t.Errorf("state = %+v, want silenced until 11:00", state)
+	}
+	if err := play(""); err == nil || player.count() != 0 {
+		t.Errorf("played %v during the silence, want it skipped", err)
+	}
+
+	clock.Set(time.Date(2024, 5, 1, 11, 0, 0, 0, time.UTC))
+	state = &silenceState{}
+	decodeBody(t, apiRequest(t, "GET", "/api/v1/silence-until", ""), state)
+	if state.Silenced {
+		t.Errorf("state = %+v after 11:00, want resumed", state)
+	}
+	if err := play(""); err != nil || player.count() != 1 {
+		t.Errorf("play after the silence = %v, want played", err)
+	}
+
+	rec = apiRequest(t, "POST", "/api/v1/silence-until", `{"until": "2024-05-01T12:00:00Z", "zone": "gym"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("silence gym = %d %s, want 200", rec.Code, rec.Body)
+	}
+	if err := play("gym"); err == nil {
+		t.Error("gym bell played while the gym is silenced")
+	}
+	if err := play(""); err != nil || player.count() != 2 {
+		t.Errorf("other zones = %v, want still playing", err)
+	}
+}
+
+func TestZoneSilence(t *testing.T) {
+	testDir(t)
+	setConfig(t, "zones", map[string]interface{}{"gym": nil, "library": nil})
+	t.Cleanup(func() {
+		silenceMu.Lock()
+		silencedUntil = map[string]time.Time{}
+		silenceMu.Unlock()
+	})
+	player := &recordingPlayer{}
+	useQueue(t, player, 8)
+	clock := loadSchedule(t, time.Date(2024, 3, 4, 7, 0, 0, 0, time.UTC), `[{"name": "term", "starts": "2024-01-01", "ends": "2024-12-31", "days": [{"name": "Monday", "events": [
+		{"time": "08:00", "sound": "bell.mp3", "zone": "gym"},
+		{"time": "09:00", "sound": "bell.mp3", "zone": "library"}
+	]}]}]`)
+
+	apiRequest(t, "POST", "/api/v1/silence-until", `{"until": "2024-03-04T10:00:00Z", "zone": "gym"}`)
+	state := &silenceState{}
+	decodeBody(t, apiRequest(t, "GET", "/api/v1/silence-until", ""), state)
+	if state.Silenced || len(state.Zones) != 1 || state.Zones["gym"] == nil || !state.Zones["gym"].Equal(time.Date(2024, 3, 4, 10, 0, 0, 0, time.UTC)) {
+		t.Errorf("state = %+v, want only the gym silenced until 10:00", state)
+	}
+	runBell(t, "term", "08:00")
+	runBell(t, "term", "09:00")
+	waitFor(t, "the library bell", func() bool { return player.count() == 1 })
+	time.Sleep(20 * time.Millisecond)
+	if player.count() != 1 || getLastPlayed().Zone != "library" {
+		t.Errorf("played %d, last %+v, want only the library's", player.count(), getLastPlayed())
+	}
+
+	// silencing every zone holds the library back too
+	apiRequest(t, "POST", "/api/v1/silence-until", `{"until": "2024-03-04T09:30:00Z"}`)
+	clock.Set(time.Date(2024, 3, 4, 9, 0, 0, 0, time.UTC))
+	for zone, want := range map[string]bool{"": true, "gym": true, "library": true} {
+		if got := isSilenced(zone, clock.Now()); got != want {
+			t.Errorf("%q silenced = %v, want %v", zone, got, want)
+		}
+	}
+	clock.Set(time.Date(2024, 3, 4, 9, 45, 0, 0, time.UTC))
+	for zone, want := range map[string]bool{"": false, "gym": true, "library": false} {
+		if got := isSilenced(zone, clock.Now()); got != want {
+			t.Errorf("after the all zones silence %q silenced = %v, want %v", zone, got, want)
+		}
+	}
+}
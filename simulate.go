@@ -0,0 +1,58 @@
+package main
+
+import (
+	"net/http"
+	"time"
+)
+
+// simulateLayouts are the forms accepted for ?at=, RFC 3339 or a local time
+// in app.timezone.
+var simulateLayouts = []string{"2006-01-02T15:04:05", "2006-01-02T15:04"}
+
+func parseSimulateTime(value string) (time.Time, error) {
+	at, err := time.Parse(time.RFC3339, value)
+	if err == nil {
+		return at, nil
+	}
+	for _, layout := range simulateLayouts {
+		local, localErr := time.ParseInLocation(layout, value, globalLocation())
+		if localErr == nil {
+			return local, nil
+		}
+	}
+	return time.Time{}, err
+}
+
+// simulateSchedules answers what data would ring at exactly at: the
+// schedules active then and their bells due that second. A pinned schedule
+// stays active regardless of dates, as it does in parseSchedule.
+func simulateSchedules(data []*schedule, pinnedName string, at time.Time) *preview {
+	at = at.Truncate(time.Second)
+	expanded, _ := expandPrograms(data)
+	if pinned := findExpanded(expanded, data, pinnedName); pinned != nil {
+		result := &preview{Active: []string{}, Fires: []*previewFire{}, Warnings: []string{}, Errors: []string{}}
+		previewBells(result, pinned, at, at)
+		return result
+	}
+	return previewSchedules(data, at, at)
+}
+
+// getSimulateHandler evaluates the schedule at ?at= without touching cron
+// or playing anything, for checking DST days, date window boundaries and
+// holidays ahead of time.
+func getSimulateHandler(w http.ResponseWriter, r *http.Request) {
+	value := r.URL.Query().Get("at")
+	if value == "" {
+		writeError(w, http.StatusBadRequest, "at is required")
+		return
+	}
+	at, err := parseSimulateTime(value)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid at: "+value)
+		return
+	}
+	scheduleMu.RLock()
+	data, pinned := runningSchedules(), pinnedSchedule
+	scheduleMu.RUnlock()
+	writeJSON(w, http.StatusOK, simulateSchedules(data, pinned, at))
+}
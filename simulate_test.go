@@ -0,0 +1,115 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+)
+
+const simulatedSchedules = `[
+	{"name": "term", "starts": "2024-01-01", "ends": "2024-03-22", "days": [{"name": "Monday", "events": [
+		{"time": "08:00", "sound": "bell.mp3"},
+		{"time": "09:00", "sound": "bell.mp3"},
+		{"relative_to": "sunset", "offset_minutes": 10, "sound": "bell.mp3", "label": "Lights"}
+	]}]},
+	{"name": "exams", "starts": "2024-03-11", "ends": "2024-03-15", "days": [{"name": "Monday", "events": [
+		{"time": "09:00", "sound": "bell.mp3", "label": "Exam"}
+	]}]},
+	{"name": "holidays", "default": true, "days": []}
+]`
+
+// simulate asks what would ring at at.
+func simulate(t *testing.T, at string) *preview {
+	t.Helper()
+	rec := apiRequest(t, "GET", "/api/v1/simulate?at="+url.QueryEscape(at), "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("simulate %s = %d %s, want 200", at, rec.Code, rec.Body)
+	}
+	result := &preview{}
+	decodeBody(t, rec, result)
+	return result
+}
+
+// fired lists the schedule and label of each bell in p.
+func fired(p *preview) []string {
+	got := []string{}
+	for _, f := range p.Fires {
+		got = append(got, f.Schedule+" "+f.Label)
+	}
+	return got
+}
+
+func TestSimulate(t *testing.T) {
+	testDir(t)
+	setConfig(t, "location.latitude", 51.5)
+	setConfig(t, "location.longitude", -0.12)
+	player := &recordingPlayer{}
+	useQueue(t, player, 4)
+	loadSchedule(t, time.Date(2024, 3, 1, 7, 0, 0, 0, time.UTC), simulatedSchedules)
+
+	tests := []struct {
+		name, at string
+		active   []string
+		fires    []string
+	}{
+		{"normal weekday", "2024-03-04T08:00", []string{"term"}, []string{"term "}},
+		{"between bells", "2024-03-04T08:00:01", []string{"term"}, []string{}},
+		{"inside the exams", "2024-03-11T09:00:00Z", []string{"term", "exams"}, []string{"term ", "exams Exam"}},
+		{"exams over", "2024-03-18T09:00", []string{"term"}, []string{"term "}},
+		{"holiday", "2024-03-25T08:00", []string{"holidays"}, []string{}},
+	}
+	for _, tt := range tests {
+		got := simulate(t, tt.at)
+		if !reflect.DeepEqual(got.Active, tt.active) || !reflect.DeepEqual(fired(got), tt.fires) {
+			t.Errorf("%s: simulate %s = active %q, fires %q, want %q, %q", tt.name, tt.at, got.Active, fired(got), tt.active, tt.fires)
+		}
+	}
+
+	// sunset is worked out for the simulated day, not today
+	lights := &event{RelativeTo: sunset, OffsetMinutes: 10}
+	at, err := sunEventTime(lights, "MON", time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC), time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fired(simulate(t, at.Format(time.RFC3339))); !reflect.DeepEqual(got, []string{"term Lights"}) {
+		t.Errorf("simulate at %s = %q, want the lights bell", at, got)
+	}
+	// two weeks on the sun sets minutes later
+	if got := fired(simulate(t, at.AddDate(0, 0, 14).Format(time.RFC3339))); len(got) != 0 {
+		t.Errorf("simulate two weeks after %s = %q, want nothing", at, got)
+	}
+
+	// a pinned schedule is active whatever the date
+	apiRequest(t, "POST", "/api/v1/active", `{"name": "exams"}`)
+	if got := simulate(t, "2024-06-03T09:00"); !reflect.DeepEqual(got.Active, []string{"exams"}) || !reflect.DeepEqual(fired(got), []string{"exams Exam"}) {
+		t.Errorf("simulate with exams pinned = %q, %q, want exams ringing", got.Active, fired(got))
+	}
+
+	if rec := apiRequest(t, "GET", "/api/v1/simulate?at=tomorrow", ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("simulate at tomorrow = %d, want 400", rec.Code)
+	}
+	if rec := apiRequest(t, "GET", "/api/v1/simulate", ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("simulate without at = %d, want 400", rec.Code)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if player.count() != 0 {
+		t.Errorf("simulating played %d sounds", player.count())
+	}
+}
+
+func TestSimulateCalendar(t *testing.T) {
+	testDir(t)
+	useCalendar(t)
+	ny, _ := time.LoadLocation("America/New_York")
+	loadSchedule(t, time.Date(2024, 3, 4, 7, 0, 0, 0, ny), `[{"name": "holidays", "default": true, "days": []}]`)
+
+	result := simulate(t, "2024-03-05T12:00:00")
+	if got := fired(result); !reflect.DeepEqual(got, []string{"calendar-2024-03-05 lunch"}) {
+		t.Errorf("fired = %q, want the calendar's lunch", got)
+	}
+	if !reflect.DeepEqual(result.Active, []string{"calendar-2024-03-05"}) {
+		t.Errorf("active = %q, want the calendar's Tuesday", result.Active)
+	}
+}
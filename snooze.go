@@ -0,0 +1,69 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// snoozed is the bell to skip once. It's matched by what the bell is and
+// when it's due rather than by cron EntryID, since a reparse renumbers the
+// entries.
+var (
+	snoozed  *snoozeInfo
+	snoozeMu sync.Mutex
+)
+
+// snoozeWindow is how long after its due time a snoozed bell is still
+// waited for.
+const snoozeWindow = time.Minute
+
+type snoozeInfo struct {
+	At time.Time `json:"at"`
+	*entryInfo
+}
+
+func postSnoozeHandler(w http.ResponseWriter, r *http.Request) {
+	scheduleMu.RLock()
+	next := nextBellEntry()
+	scheduleMu.RUnlock()
+
+	if next == nil {
+		writeError(w, http.StatusNotFound, "no bells scheduled")
+		return
+	}
+
+	snoozeMu.Lock()
+	snoozed = &snoozeInfo{At: *next.Next, entryInfo: next.entryInfo}
+	snoozeMu.Unlock()
+
+	log.Printf("Snoozed bell at %s: %s", next.Next.Format(time.RFC3339), next.Sound)
+	writeJSON(w, http.StatusOK, snoozed)
+}
+
+// consumeSnooze reports whether the bell described by info, firing at now,
+// is the snoozed one, clearing the snooze if so.
+func consumeSnooze(info *entryInfo, now time.Time) bool {
+	snoozeMu.Lock()
+	defer snoozeMu.Unlock()
+
+	if snoozed == nil {
+		return false
+	}
+	if now.Sub(snoozed.At) >= snoozeWindow {
+		// the snoozed bell never fired, e.g. it was removed by a reload
+		snoozed = nil
+		return false
+	}
+	if now.Before(snoozed.At) || !sameBell(snoozed.entryInfo, info) {
+		return false
+	}
+	snoozed = nil
+	return true
+}
+
+func sameBell(a, b *entryInfo) bool {
+	return a.Schedule == b.Schedule && a.Day == b.Day && a.Time == b.Time && a.Sound == b.Sound
+}
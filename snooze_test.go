@@ -0,0 +1,51 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestSnoozeSkipsOneBell(t *testing.T) {
+	testDir(t)
+	backend := &recordingPlayer{}
+	useQueue(t, backend, 8)
+	logs := captureLog(t)
+	clock := loadSchedule(t, time.Date(2024, 3, 4, 7, 0, 0, 0, time.UTC), mondayBells)
+	t.Cleanup(func() { snoozed = nil })
+
+	rec := apiRequest(t, "POST", "/api/v1/snooze", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d %s, want 200", rec.Code, rec.Body)
+	}
+	body := struct {
+		At    time.Time `json:"at"`
+		Time  string    `json:"time"`
+		Sound string    `json:"sound"`
+	}{}
+	decodeBody(t, rec, &body)
+	if body.At.IsZero() || body.At.Weekday() != time.Monday || body.Time != "08:00" || body.Sound != "bell.mp3" {
+		t.Fatalf("snoozed = %s, want the next Monday 08:00 bell", rec.Body)
+	}
+
+	clock.Set(body.At)
+	runBell(t, "term", "08:00")
+	clock.Set(body.At.AddDate(0, 0, 7))
+	runBell(t, "term", "08:00")
+	waitFor(t, "the next week's bell to play", func() bool { return backend.count() == 1 })
+	clock.Set(body.At.AddDate(0, 0, 14))
+	runBell(t, "term", "08:00")
+	waitFor(t, "the bell after it to play", func() bool { return backend.count() == 2 })
+	if skipped, fired := logEntries(t, logs, "Bell snoozed"), logEntries(t, logs, "Bell fired"); len(skipped) != 1 || len(fired) != 2 {
+		t.Errorf("%d bells snoozed and %d fired, want 1 and 2", len(skipped), len(fired))
+	}
+}
+
+func TestSnoozeWithoutBells(t *testing.T) {
+	testDir(t)
+	loadSchedule(t, time.Date(2025, 3, 3, 7, 0, 0, 0, time.UTC), mondayBells)
+	rec := apiRequest(t, "POST", "/api/v1/snooze", "")
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want 404 outside the schedule's window", rec.Code)
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hajimehoshi/go-mp3"
+	log "github.com/sirupsen/logrus"
+)
+
+type soundInfo struct {
+	Name       string  `json:"name"`
+	Duration   float64 `json:"duration"`
+	SampleRate int     `json:"sampleRate"`
+	Size       int64   `json:"size"`
+
+	modTime time.Time
+}
+
+// soundInfoCache avoids decoding a file again until its modtime or size
+// changes.
+var (
+	soundInfoCache   = map[string]*soundInfo{}
+	soundInfoCacheMu sync.Mutex
+)
+
+func getSoundInfo(dir, name string) (*soundInfo, error) {
+	p, err := resolveSoundPath(dir, name)
+	if err != nil {
+		return nil, err
+	}
+	stat, err := os.Stat(p)
+	if err != nil {
+		return nil, err
+	}
+
+	soundInfoCacheMu.Lock()
+	cached := soundInfoCache[p]
+	soundInfoCacheMu.Unlock()
+	if cached != nil && cached.modTime.Equal(stat.ModTime()) && cached.Size == stat.Size() {
+		return cached, nil
+	}
+
+	info := &soundInfo{Name: name, Size: stat.Size(), modTime: stat.ModTime()}
+	switch strings.ToLower(filepath.Ext(p)) {
+	case ".mp3":
+		err = readMP3Info(p, info)
+	default:
+		err = fmt.Errorf("unsupported sound format: %s", name)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	soundInfoCacheMu.Lock()
+	soundInfoCache[p] = info
+	soundInfoCacheMu.Unlock()
+	return info, nil
+}
+
+// rescanSounds drops the cached sound info and reads every sound under dir
+// again, returning how many were found.
+func rescanSounds(dir string) (int, error) {
+	names, err := listSounds(dir)
+	if err != nil {
+		return 0, err
+	}
+
+	soundInfoCacheMu.Lock()
+	soundInfoCache = map[string]*soundInfo{}
+	soundInfoCacheMu.Unlock()
+
+	for _, name := range names {
+		_, err := getSoundInfo(dir, name)
+		if err != nil {
+			log.Errorf("Could not read sound info: %s : %v", name, err)
+		}
+	}
+	return len(names), nil
+}
+
+func readMP3Info(p string, info *soundInfo) error {
+	f, err := os.Open(p)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// with a seekable source the decoder only scans frame headers to get the
+	// length, it doesn't decode the audio
+	decoder, err := mp3.NewDecoder(f)
+	if err != nil {
+		return err
+	}
+	info.SampleRate = decoder.SampleRate()
+	// decoded output is always 16 bit stereo
+	info.Duration = float64(decoder.Length()) / float64(4*decoder.SampleRate())
+	return nil
+}
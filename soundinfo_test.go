@@ -0,0 +1,117 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestGetSoundInfo(t *testing.T) {
+	testDir(t)
+	info, err := getSoundInfo(soundsDir(), "bell.mp3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stat, _ := os.Stat("sounds/bell.mp3")
+	if info.Name != "bell.mp3" || info.Duration != 3.744 || info.SampleRate != 48000 || info.Size != stat.Size() {
+		t.Errorf("info = %+v, want bell.mp3, 3.744 s at 48000 Hz, %d bytes", info, stat.Size())
+	}
+
+	again, _ := getSoundInfo(soundsDir(), "bell.mp3")
+	if again != info {
+		t.Error("unchanged file decoded again, want the cached info")
+	}
+	later := stat.ModTime().Add(time.Minute)
+	err = os.Chtimes("sounds/bell.mp3", later, later)
+	if err != nil {
+		t.Fatal(err)
+	}
+	changed, _ := getSoundInfo(soundsDir(), "bell.mp3")
+	if changed == info || !changed.modTime.Equal(later) {
+		t.Error("changed file served from the cache")
+	}
+
+	writeFile(t, "sounds/tone.wav", "RIFF")
+	_, err = getSoundInfo(soundsDir(), "tone.wav")
+	if err == nil {
+		t.Error("tone.wav read, want an unsupported format")
+	}
+}
+
+func TestGetSoundsInfo(t *testing.T) {
+	testDir(t)
+	writeFile(t, "sounds/broken.mp3", "not an mp3")
+	rec := apiRequest(t, "GET", "/api/v1/sounds", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+	sounds := []map[string]interface{}{}
+	decodeBody(t, rec, &sounds)
+	if len(sounds) != 2 {
+		t.Fatalf("sounds = %s, want bell.mp3 and broken.mp3", rec.Body)
+	}
+	if sounds[0]["name"] != "bell.mp3" || sounds[0]["duration"] != 3.744 || sounds[0]["sampleRate"] != 48000.0 {
+		t.Errorf("bell.mp3 = %v, want its duration and sample rate", sounds[0])
+	}
+	if sounds[1]["name"] != "broken.mp3" || sounds[1]["duration"] != 0.0 {
+		t.Errorf("broken.mp3 = %v, want listed without a duration", sounds[1])
+	}
+}
+
+func TestRescanSounds(t *testing.T) {
+	dir := testDir(t)
+	cached := func(name string) bool {
+		soundInfoCacheMu.Lock()
+		defer soundInfoCacheMu.Unlock()
+		return soundInfoCache[filepath.Join(dir, "sounds", name)] != nil
+	}
+	rescan := func() int {
+		t.Helper()
+		rec := apiRequest(t, "POST", "/api/v1/sounds/rescan", "")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("rescan = %d %s, want 200", rec.Code, rec.Body)
+		}
+		result := map[string]int{}
+		decodeBody(t, rec, &result)
+		return result["count"]
+	}
+
+	if count := rescan(); count != 1 || !cached("bell.mp3") {
+		t.Fatalf("rescan = %d, want bell.mp3 read", count)
+	}
+
+	sound, err := os.ReadFile("sounds/bell.mp3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, "sounds/extra/chime.mp3", string(sound))
+	if cached("extra/chime.mp3") {
+		t.Fatal("a file added out of band is cached before a rescan")
+	}
+
+	// a rescan while a sound plays doesn't wait on it
+	player := &recordingPlayer{gate: make(chan struct{})}
+	useQueue(t, player, 8)
+	defer close(player.gate)
+	err = enqueuePlay(&playJob{Sound: "bell.mp3"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the sound to play", func() bool { return currentPlayback().Playing })
+
+	for i := 0; i < 2; i++ {
+		if count := rescan(); count != 2 || !cached("extra/chime.mp3") {
+			t.Errorf("rescan %d = %d, want bell.mp3 and extra/chime.mp3", i+1, count)
+		}
+	}
+
+	err = os.Remove("sounds/extra/chime.mp3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count := rescan(); count != 1 || cached("extra/chime.mp3") {
+		t.Errorf("rescan = %d, want the removed file dropped", count)
+	}
+}
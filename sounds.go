@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+func soundsDir() string {
+	return viper.GetString("audio.sounds-dir")
+}
+
+// soundsDir is where sch's sounds are: its sounds_dir under
+// audio.sounds-dir, or audio.sounds-dir itself when unset.
+func (sch *schedule) soundsDir() (string, error) {
+	if sch.SoundsDir == "" {
+		return soundsDir(), nil
+	}
+	dir, err := resolveSoundPath(soundsDir(), sch.SoundsDir)
+	if err != nil {
+		return "", fmt.Errorf("invalid sounds_dir: %v", err)
+	}
+	info, err := os.Stat(dir)
+	if err != nil {
+		return "", fmt.Errorf("invalid sounds_dir: %v", err)
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("invalid sounds_dir: %s is not a directory", sch.SoundsDir)
+	}
+	return dir, nil
+}
+
+// resolveSoundPath maps a sound name, optionally with subfolders such as
+// "chimes/soft.mp3", to a file under dir, rejecting anything that would
+// escape it.
+func resolveSoundPath(dir, sound string) (string, error) {
+	if sound == "" {
+		return "", fmt.Errorf("empty sound name")
+	}
+	name := filepath.FromSlash(sound)
+	if filepath.IsAbs(name) {
+		return "", fmt.Errorf("sound path must be relative: %s", sound)
+	}
+	name = filepath.Clean(name)
+	if name == ".." || strings.HasPrefix(name, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("sound path escapes sounds dir: %s", sound)
+	}
+	return filepath.Join(dir, name), nil
+}
+
+// listSounds returns the mp3 files under dir, including subfolders, as
+// slash separated paths relative to dir.
+func listSounds(dir string) ([]string, error) {
+	sounds := []string{}
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !strings.EqualFold(filepath.Ext(p), ".mp3") {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		sounds = append(sounds, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(sounds)
+	return sounds, nil
+}
+
+func getSoundsHandler(w http.ResponseWriter, r *http.Request) {
+	dir := soundsDir()
+	names, err := listSounds(dir)
+	if err != nil {
+		log.Errorf("Could not list sounds: %v", err)
+		writeError(w, http.StatusInternalServerError, "could not list sounds")
+		return
+	}
+	sounds := []*soundInfo{}
+	for _, name := range names {
+		info, err := getSoundInfo(dir, name)
+		if err != nil {
+			log.Errorf("Could not read sound info: %s : %v", name, err)
+			info = &soundInfo{Name: name}
+		}
+		sounds = append(sounds, info)
+	}
+	writeJSON(w, http.StatusOK, sounds)
+}
+
+func postSoundsRescanHandler(w http.ResponseWriter, r *http.Request) {
+	count, err := rescanSounds(soundsDir())
+	if err != nil {
+		log.Errorf("Could not rescan sounds: %v", err)
+		writeError(w, http.StatusInternalServerError, "could not rescan sounds")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]int{"count": count})
+}
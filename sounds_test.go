@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestResolveSoundPath(t *testing.T) {
+	dir := filepath.FromSlash("/srv/sounds")
+	tests := []struct {
+		sound string
+		want  string
+		err   string
+	}{
+		{"bell.mp3", "/srv/sounds/bell.mp3", ""},
+		{"chimes/soft.mp3", "/srv/sounds/chimes/soft.mp3", ""},
+		{"chimes/../bell.mp3", "/srv/sounds/bell.mp3", ""},
+		{"../secret.mp3", "", "escapes sounds dir"},
+		{"chimes/../../secret.mp3", "", "escapes sounds dir"},
+		{"/etc/passwd", "", "must be relative"},
+		{"", "", "empty sound name"},
+	}
+	for _, tt := range tests {
+		got, err := resolveSoundPath(dir, tt.sound)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("resolveSoundPath(%q) error = %v, want %q", tt.sound, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || got != filepath.FromSlash(tt.want) {
+			t.Errorf("resolveSoundPath(%q) = %q, %v, want %q", tt.sound, got, err, tt.want)
+		}
+	}
+}
+
+func TestNestedSounds(t *testing.T) {
+	testDir(t)
+	sound, err := os.ReadFile("sounds/bell.mp3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, "sounds/chimes/soft.mp3", string(sound))
+	writeFile(t, "sounds/chimes/readme.txt", "not a sound")
+	writeFile(t, "secret.mp3", string(sound))
+
+	names, err := listSounds(soundsDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(names, ",") != "bell.mp3,chimes/soft.mp3" {
+		t.Errorf("listSounds = %v, want bell.mp3 and chimes/soft.mp3", names)
+	}
+
+	loadSchedule(t, time.Date(2024, 3, 4, 7, 0, 0, 0, time.UTC), `[{"name": "term", "starts": "2024-01-01", "ends": "2024-12-31", "days": [{"name": "Monday", "events": [
+		{"time": "08:00", "sound": "chimes/soft.mp3"},
+		{"time": "09:00", "sound": "../secret.mp3"}
+	]}]}]`)
+	bells := entriesOf("bell")
+	if len(bells) != 1 || bells[0].Sound != "chimes/soft.mp3" {
+		t.Errorf("bells = %v, want only chimes/soft.mp3", bells)
+	}
+	if len(parseErrors) != 1 || parseErrors[0].Time != "09:00" || !strings.Contains(parseErrors[0].Message, "escapes sounds dir") {
+		t.Errorf("parse errors = %v, want the traversal rejected", parseErrors)
+	}
+}
+
+func TestScheduleSoundsDir(t *testing.T) {
+	testDir(t)
+	sound, err := os.ReadFile("sounds/bell.mp3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, "sounds/after/chime.mp3", string(sound))
+	writeFile(t, "sounds/plain.txt", "not a folder")
+	player := &recordingPlayer{}
+	useQueue(t, player, 4)
+	loadSchedule(t, time.Date(2024, 3, 4, 7, 0, 0, 0, time.UTC), `[
+		{"name": "after", "sounds_dir": "after", "starts": "2024-01-01", "ends": "2024-12-31", "days": [{"name": "Monday", "events": [
+			{"time": "16:00", "sound": "chime.mp3"},
+			{"time": "17:00", "sound": "bell.mp3"}
+		]}]},
+		{"name": "term", "starts": "2024-01-01", "ends": "2024-12-31", "days": [{"name": "Monday", "events": [
+			{"time": "08:00", "sound": "bell.mp3"},
+			{"time": "09:00", "sound": "chime.mp3"}
+		]}]},
+		{"name": "escape", "sounds_dir": "../elsewhere", "starts": "2024-01-01", "ends": "2024-12-31", "days": [{"name": "Monday", "events": [{"time": "10:00", "sound": "bell.mp3"}]}]},
+		{"name": "file", "sounds_dir": "plain.txt", "starts": "2024-01-01", "ends": "2024-12-31", "days": [{"name": "Monday", "events": [{"time": "11:00", "sound": "bell.mp3"}]}]}
+	]`)
+
+	// each schedule's sounds are looked for in its own folder only
+	warnings := strings.Join(parseWarnings, "\n")
+	for _, want := range []string{"after: MON 17:00", "term: MON 09:00"} {
+		if !strings.Contains(warnings, want) {
+			t.Errorf("warnings = %q, want %s's sound missing", parseWarnings, want)
+		}
+	}
+	if len(parseErrors) != 2 || !strings.Contains(parseErrors[0].Message, "escapes sounds dir") || !strings.Contains(parseErrors[1].Message, "plain.txt is not a directory") {
+		t.Errorf("errors = %+v, want escape and file rejected", parseErrors)
+	}
+
+	runBell(t, "after", "16:00")
+	runBell(t, "term", "08:00")
+	waitFor(t, "both bells", func() bool { return player.count() == 2 })
+}
+
+func TestMissingSound(t *testing.T) {
+	doc := `[{"name": "term", "starts": "2024-01-01", "ends": "2024-12-31", "days": [{"name": "Monday", "events": [
+		{"time": "08:00", "sound": "bell.mp3"},
+		{"time": "09:00", "sound": "bel.mp3"}
+	]}]}]`
+	for _, strict := range []bool{false, true} {
+		t.Run(fmt.Sprintf("strict %v", strict), func(t *testing.T) {
+			testDir(t)
+			setConfig(t, "schedule.strict-sounds", strict)
+			loadSchedule(t, time.Date(2024, 3, 4, 7, 0, 0, 0, time.UTC), doc)
+			bells := entriesOf("bell")
+			if strict {
+				if len(parseErrors) != 1 || parseErrors[0].Time != "09:00" || !strings.Contains(parseErrors[0].Message, "bel.mp3") {
+					t.Errorf("strict: errors = %+v, want the 09:00 bell refused", parseErrors)
+				}
+				if len(bells) != 1 || bells[0].Time != "08:00" {
+					t.Errorf("strict: bells = %+v, want only 08:00", bells)
+				}
+				return
+			}
+			if len(parseErrors) != 0 || len(parseWarnings) != 1 || !strings.Contains(parseWarnings[0], "bel.mp3") || !strings.HasSuffix(parseWarnings[0], "registered anyway") {
+				t.Errorf("lenient: errors = %+v, warnings = %q, want the 09:00 bell flagged", parseErrors, parseWarnings)
+			}
+			entries := []*entryInfo{}
+			decodeBody(t, apiRequest(t, "GET", "/api/v1/cron", ""), &entries)
+			broken := map[string]string{}
+			for _, e := range entries {
+				if e.Kind == "bell" {
+					broken[e.Time] = e.Broken
+				}
+			}
+			if len(broken) != 2 || broken["08:00"] != "" || !strings.Contains(broken["09:00"], "bel.mp3") {
+				t.Errorf("lenient: broken = %q, want only 09:00 flagged in /api/v1/cron", broken)
+			}
+		})
+	}
+}
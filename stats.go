@@ -0,0 +1,68 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+var startTime = time.Now()
+
+// lastPlayed is the most recent playback and how it went.
+var (
+	lastPlayed   *playRecord
+	lastPlayedMu sync.RWMutex
+)
+
+type playRecord struct {
+	Sound string    `json:"sound"`
+	Zone  string    `json:"zone,omitempty"`
+	Role  string    `json:"role,omitempty"`
+	At    time.Time `json:"at"`
+	Error string    `json:"error,omitempty"`
+}
+
+func recordPlay(job *playJob, at time.Time, err error) {
+	record := &playRecord{Sound: job.Sound, Zone: job.Zone, Role: job.Role, At: at}
+	if err != nil {
+		record.Error = err.Error()
+	}
+	lastPlayedMu.Lock()
+	lastPlayed = record
+	lastPlayedMu.Unlock()
+}
+
+func getLastPlayed() *playRecord {
+	lastPlayedMu.RLock()
+	defer lastPlayedMu.RUnlock()
+	return lastPlayed
+}
+
+type stats struct {
+	BellsPerDay   map[string]int `json:"bellsPerDay"`
+	NextBell      *cronEntry     `json:"nextBell"`
+	LastPlayed    *playRecord    `json:"lastPlayed"`
+	Silence       *silenceState  `json:"silence"`
+	UptimeSeconds int64          `json:"uptimeSeconds"`
+}
+
+func getStatsHandler(w http.ResponseWriter, r *http.Request) {
+	now := appClock.Now()
+	result := &stats{
+		BellsPerDay:   map[string]int{},
+		LastPlayed:    getLastPlayed(),
+		Silence:       currentSilence(now),
+		UptimeSeconds: int64(time.Since(startTime).Seconds()),
+	}
+
+	scheduleMu.RLock()
+	for _, info := range entryMeta {
+		if info.Kind == "bell" {
+			result.BellsPerDay[info.Day]++
+		}
+	}
+	result.NextBell = nextBellEntry()
+	scheduleMu.RUnlock()
+
+	writeJSON(w, http.StatusOK, result)
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestGetStats(t *testing.T) {
+	testDir(t)
+	useQueue(t, &recordingPlayer{}, 8)
+	clock := loadSchedule(t, time.Date(2024, 3, 4, 7, 0, 0, 0, time.UTC), `[{"name": "term", "starts": "2024-01-01", "ends": "2024-12-31", "days": [
+		{"name": "Monday", "events": [{"time": "08:00", "sound": "bell.mp3"}, {"time": "12:00", "sound": "bell.mp3"}]},
+		{"name": "Tuesday", "events": [{"time": "08:00", "sound": "bell.mp3"}]}
+	]}]`)
+	clock.Set(time.Date(2024, 3, 4, 8, 0, 0, 0, time.UTC))
+	runBell(t, "term", "12:00")
+	waitFor(t, "the bell to play", func() bool { return getLastPlayed() != nil })
+
+	rec := apiRequest(t, "GET", "/api/v1/stats", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+	result := struct {
+		stats
+		NextBell *struct {
+			Next     *time.Time `json:"next"`
+			Kind     string     `json:"kind"`
+			Schedule string     `json:"schedule"`
+		} `json:"nextBell"`
+	}{}
+	decodeBody(t, rec, &result)
+	if len(result.BellsPerDay) != 2 || result.BellsPerDay["MON"] != 2 || result.BellsPerDay["TUE"] != 1 {
+		t.Errorf("bells per day = %v, want MON 2 and TUE 1", result.BellsPerDay)
+	}
+	next := result.NextBell
+	if next == nil || next.Next == nil || next.Kind != "bell" || next.Schedule != "term" {
+		t.Fatalf("next bell = %s, want one", rec.Body)
+	}
+	if !next.Next.After(time.Now()) || next.Next.Sub(time.Now()) > 7*24*time.Hour {
+		t.Errorf("next bell at %s, want within the coming week", next.Next)
+	}
+	for _, fire := range nextFires(time.Now()) {
+		if fire.Before(*next.Next) {
+			t.Errorf("next bell at %s, but one fires at %s", next.Next, fire)
+		}
+	}
+	if result.LastPlayed == nil || result.LastPlayed.Sound != "bell.mp3" || !result.LastPlayed.At.Equal(clock.Now()) {
+		t.Errorf("last played = %+v, want the bell just rung", result.LastPlayed)
+	}
+	if result.Silence == nil || result.Silence.Silenced {
+		t.Errorf("silence = %+v, want not silenced", result.Silence)
+	}
+	if result.UptimeSeconds < 0 || result.UptimeSeconds > int64(time.Since(startTime).Seconds())+1 {
+		t.Errorf("uptime = %ds, want the time since start", result.UptimeSeconds)
+	}
+}
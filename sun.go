@@ -0,0 +1,77 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// Events with relative_to ring offset_minutes after sunrise or sunset at
+// location.latitude and location.longitude.
+const (
+	sunrise = "sunrise"
+	sunset  = "sunset"
+)
+
+// errNoSunEvent is a sunrise or sunset that doesn't happen that day, in
+// polar day or night.
+var errNoSunEvent = errors.New("the sun doesn't rise or set that day")
+
+// sunTime returns when the sun rises, or sets, on date's day at lat, lon
+// (degrees, north and east positive), following the sunrise equation with
+// the usual -0.833° for refraction and the sun's radius.
+func sunTime(date time.Time, lat, lon float64, rising bool) (time.Time, error) {
+	const j2000 = 2451545.0
+	rad := math.Pi / 180
+	noon := time.Date(date.Year(), date.Month(), date.Day(), 12, 0, 0, 0, date.Location())
+	julian := float64(noon.Unix())/86400 + 2440587.5
+	n := math.Round(julian - j2000 + lon/360)
+	meanNoon := n - lon/360
+	anomaly := math.Mod(357.5291+0.98560028*meanNoon, 360)
+	center := 1.9148*math.Sin(anomaly*rad) + 0.0200*math.Sin(2*anomaly*rad) + 0.0003*math.Sin(3*anomaly*rad)
+	longitude := math.Mod(anomaly+center+180+102.9372, 360)
+	transit := j2000 + meanNoon + 0.0053*math.Sin(anomaly*rad) - 0.0069*math.Sin(2*longitude*rad)
+	declination := math.Asin(math.Sin(longitude*rad) * math.Sin(23.4397*rad))
+	cosHour := (math.Sin(-0.833*rad) - math.Sin(lat*rad)*math.Sin(declination)) / (math.Cos(lat*rad) * math.Cos(declination))
+	if cosHour < -1 || cosHour > 1 {
+		return time.Time{}, errNoSunEvent
+	}
+	hourAngle := math.Acos(cosHour) / rad
+	at := transit + hourAngle/360
+	if rising {
+		at = transit - hourAngle/360
+	}
+	unix := (at - 2440587.5) * 86400
+	return time.Unix(0, int64(unix*float64(time.Second))).In(date.Location()), nil
+}
+
+// sunEventTime is when evt rings on the next dayName from now in loc, its
+// sunrise or sunset that day moved by offset_minutes. Callers recompute it
+// on the daily reparse as the days get longer or shorter.
+func sunEventTime(evt *event, dayName string, now time.Time, loc *time.Location) (time.Time, error) {
+	if evt.RelativeTo != sunrise && evt.RelativeTo != sunset {
+		return time.Time{}, fmt.Errorf("invalid relative_to: %s", evt.RelativeTo)
+	}
+	if evt.Cron != "" || evt.Time != "" {
+		return time.Time{}, fmt.Errorf("relative_to can't be used with time or cron")
+	}
+	if viper.GetString("location.latitude") == "" || viper.GetString("location.longitude") == "" {
+		return time.Time{}, fmt.Errorf("relative_to needs location.latitude and location.longitude")
+	}
+	lat, lon := viper.GetFloat64("location.latitude"), viper.GetFloat64("location.longitude")
+	if lat < -90 || lat > 90 || lon < -180 || lon > 180 {
+		return time.Time{}, fmt.Errorf("invalid location: %g, %g", lat, lon)
+	}
+	date := now.In(loc)
+	for i := 0; i < 7 && weekdays[date.Weekday()] != dayName; i++ {
+		date = date.AddDate(0, 0, 1)
+	}
+	at, err := sunTime(date, lat, lon, evt.RelativeTo == sunrise)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("no %s on %s: %w", evt.RelativeTo, date.Format("2006-01-02"), err)
+	}
+	return at.Add(time.Duration(evt.OffsetMinutes) * time.Minute).Truncate(time.Second), nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSunTime(t *testing.T) {
+	tests := []struct {
+		name     string
+		lat, lon float64
+		date     time.Time
+		rising   bool
+		want     time.Time
+	}{
+		// NOAA times, to the minute
+		{"London sunrise at midsummer", 51.5074, -0.1278, time.Date(2024, 6, 21, 0, 0, 0, 0, time.UTC), true, time.Date(2024, 6, 21, 3, 43, 0, 0, time.UTC)},
+		{"London sunset at midsummer", 51.5074, -0.1278, time.Date(2024, 6, 21, 0, 0, 0, 0, time.UTC), false, time.Date(2024, 6, 21, 20, 21, 0, 0, time.UTC)},
+		{"Mexico City sunrise in March", 19.4326, -99.1332, time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC), true, time.Date(2024, 3, 4, 12, 54, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		got, err := sunTime(tt.date, tt.lat, tt.lon, tt.rising)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if diff := got.Sub(tt.want); diff < -2*time.Minute || diff > 2*time.Minute {
+			t.Errorf("%s = %s, want %s", tt.name, got.Format("15:04:05"), tt.want.Format("15:04"))
+		}
+	}
+
+	// Tromsø has polar night in December and midnight sun in June
+	for _, date := range []time.Time{time.Date(2024, 12, 21, 0, 0, 0, 0, time.UTC), time.Date(2024, 6, 21, 0, 0, 0, 0, time.UTC)} {
+		if _, err := sunTime(date, 69.65, 18.96, true); !errors.Is(err, errNoSunEvent) {
+			t.Errorf("Tromsø sunrise on %s: %v, want errNoSunEvent", date.Format("2006-01-02"), err)
+		}
+	}
+}
+
+func TestSunEventTime(t *testing.T) {
+	setConfig(t, "location.latitude", 51.5074)
+	setConfig(t, "location.longitude", -0.1278)
+	// a Thursday, so Monday's sunrise is the 24th's
+	now := time.Date(2024, 6, 20, 12, 0, 0, 0, time.UTC)
+	at, err := sunEventTime(&event{RelativeTo: sunrise, OffsetMinutes: 30}, "MON", now, time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := time.Date(2024, 6, 24, 4, 14, 0, 0, time.UTC)
+	if diff := at.Sub(want); diff < -2*time.Minute || diff > 2*time.Minute || at.Weekday() != time.Monday {
+		t.Errorf("30 minutes after Monday's sunrise = %s, want about %s", at, want)
+	}
+
+	tests := []struct {
+		evt  *event
+		want string
+	}{
+		{&event{RelativeTo: "noon"}, "invalid relative_to: noon"},
+		{&event{RelativeTo: sunset, Time: "18:00"}, "relative_to can't be used with time or cron"},
+	}
+	for _, tt := range tests {
+		if _, err := sunEventTime(tt.evt, "MON", now, time.UTC); err == nil || err.Error() != tt.want {
+			t.Errorf("sunEventTime(%+v) = %v, want %q", tt.evt, err, tt.want)
+		}
+	}
+	setConfig(t, "location.latitude", "")
+	if _, err := sunEventTime(&event{RelativeTo: sunset}, "MON", now, time.UTC); err == nil || !strings.Contains(err.Error(), "location.latitude") {
+		t.Errorf("without a location = %v, want it asked for", err)
+	}
+}
+
+func TestSunEvents(t *testing.T) {
+	testDir(t)
+	setConfig(t, "app.timezone", "UTC")
+	setConfig(t, "location.latitude", 69.65)
+	setConfig(t, "location.longitude", 18.96)
+	loadSchedule(t, time.Date(2024, 12, 16, 7, 0, 0, 0, time.UTC), `[{"name": "term", "starts": "2024-01-01", "ends": "2024-12-31", "days": [{"name": "Monday", "events": [
+		{"time": "08:00", "sound": "bell.mp3"},
+		{"relative_to": "sunrise", "offset_minutes": 30, "sound": "bell.mp3"}
+	]}]}]`)
+	// no sunrise in the polar night, the rest of the day still rings
+	if len(parseErrors) != 0 || len(parseWarnings) != 1 || !strings.Contains(parseWarnings[0], "MON sunrise skipped") {
+		t.Errorf("errors = %+v, warnings = %q, want the sunrise skipped", parseErrors, parseWarnings)
+	}
+	if bells := entriesOf("bell"); len(bells) != 1 || bells[0].Time != "08:00" {
+		t.Errorf("bells = %+v, want only 08:00", bells)
+	}
+}
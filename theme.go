@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// themeConfig is a named tone set from the themes config: each sound an
+// event names is played from its file instead.
+type themeConfig struct {
+	Name   string        `mapstructure:"name" json:"name"`
+	Sounds []*themeSound `mapstructure:"sounds" json:"sounds"`
+}
+
+type themeSound struct {
+	Sound string `mapstructure:"sound" json:"sound"`
+	File  string `mapstructure:"file" json:"file"`
+}
+
+// activeTheme is the theme applied by the next parse, empty for none, and
+// parseTheme the sounds it remapped for the parse in progress. Guarded by
+// scheduleMu.
+var (
+	activeTheme string
+	parseTheme  map[string]string
+)
+
+func themes() []*themeConfig {
+	configured := []*themeConfig{}
+	err := viper.UnmarshalKey("themes", &configured)
+	if err != nil {
+		log.Errorf("Could not parse themes: %v", err)
+	}
+	return configured
+}
+
+func findTheme(name string) *themeConfig {
+	for _, t := range themes() {
+		if t.Name == name {
+			return t
+		}
+	}
+	return nil
+}
+
+// themeSounds maps the sounds remapped by the theme called name, reporting
+// whether it's configured. No theme, or a missing one, remaps nothing.
+func themeSounds(name string) (map[string]string, bool) {
+	sounds := map[string]string{}
+	if name == "" {
+		return sounds, true
+	}
+	t := findTheme(name)
+	if t == nil {
+		return sounds, false
+	}
+	for _, s := range t.Sounds {
+		sounds[s.Sound] = s.File
+	}
+	return sounds, true
+}
+
+// withTheme returns evt, or a copy with its sound, choices, weather sounds
+// and playlist remapped by sounds.
+func withTheme(evt *event, sounds map[string]string) *event {
+	if len(sounds) == 0 {
+		return evt
+	}
+	themed := *evt
+	if file, ok := sounds[evt.Sound]; ok && evt.SoundData == "" {
+		themed.Sound = file
+	}
+	if len(evt.Choices) > 0 {
+		themed.Choices = make([]*soundChoice, len(evt.Choices))
+		for i, c := range evt.Choices {
+			choice := *c
+			if file, ok := sounds[c.File]; ok {
+				choice.File = file
+			}
+			themed.Choices[i] = &choice
+		}
+	}
+	if len(evt.Weather) > 0 {
+		themed.Weather = make([]*weatherSound, len(evt.Weather))
+		for i, w := range evt.Weather {
+			ws := *w
+			if file, ok := sounds[w.Sound]; ok {
+				ws.Sound = file
+			}
+			themed.Weather[i] = &ws
+		}
+	}
+	if len(evt.Playlist) > 0 {
+		themed.Playlist = make([]string, len(evt.Playlist))
+		for i, sound := range evt.Playlist {
+			if file, ok := sounds[sound]; ok {
+				sound = file
+			}
+			themed.Playlist[i] = sound
+		}
+	}
+	return &themed
+}
+
+type themeState struct {
+	Active string         `json:"active"`
+	Themes []*themeConfig `json:"themes"`
+}
+
+func currentTheme() *themeState {
+	scheduleMu.RLock()
+	defer scheduleMu.RUnlock()
+	return &themeState{Active: activeTheme, Themes: themes()}
+}
+
+func getThemeHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, currentTheme())
+}
+
+// postThemeHandler switches the active theme, "" for none, and reloads so
+// it takes effect.
+func postThemeHandler(w http.ResponseWriter, r *http.Request) {
+	body := struct {
+		Name *string `json:"name"`
+	}{}
+	err := json.NewDecoder(io.LimitReader(r.Body, 1000000)).Decode(&body)
+	if err != nil || body.Name == nil {
+		writeError(w, http.StatusBadRequest, `expected {"name": "<theme>"}`)
+		return
+	}
+	if *body.Name != "" && findTheme(*body.Name) == nil {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("theme not found: %s", *body.Name))
+		return
+	}
+	scheduleMu.Lock()
+	activeTheme = *body.Name
+	scheduleMu.Unlock()
+	log.Warnf("Theme switched to %q", *body.Name)
+
+	err = reloadSchedule(r.Context())
+	if writeTimeout(w, err) {
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, currentTheme())
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestThemeSwitch(t *testing.T) {
+	testDir(t)
+	sound, err := os.ReadFile("sounds/bell.mp3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, "sounds/winter/jingle.mp3", string(sound))
+	setConfig(t, "themes", []map[string]interface{}{
+		{"name": "winter", "sounds": []map[string]interface{}{{"sound": "bell.mp3", "file": "winter/jingle.mp3"}}},
+	})
+	t.Cleanup(func() { activeTheme = "" })
+	player := &recordingPlayer{}
+	useQueue(t, player, 4)
+	loadSchedule(t, time.Date(2024, 3, 4, 7, 0, 0, 0, time.UTC), mondayBells)
+	sounds := func() string {
+		t.Helper()
+		bells := entriesOf("bell")
+		if len(bells) != 1 {
+			t.Fatalf("bells = %d, want 1", len(bells))
+		}
+		return bells[0].Sound
+	}
+	if got := sounds(); got != "bell.mp3" {
+		t.Errorf("without a theme the bell plays %s, want bell.mp3", got)
+	}
+
+	rec := apiRequest(t, "POST", "/api/v1/theme", `{"name": "winter"}`)
+	state := &themeState{}
+	decodeBody(t, rec, state)
+	if rec.Code != http.StatusOK || state.Active != "winter" || len(state.Themes) != 1 {
+		t.Fatalf("switch = %d %s, want winter active", rec.Code, rec.Body)
+	}
+	if got := sounds(); got != "winter/jingle.mp3" {
+		t.Errorf("with winter the bell plays %s, want winter/jingle.mp3", got)
+	}
+	runBell(t, "term", "08:00")
+	waitFor(t, "the themed bell", func() bool { return getLastPlayed() != nil })
+	if played := getLastPlayed(); played.Sound != "winter/jingle.mp3" || played.Error != "" {
+		t.Errorf("played %+v, want winter/jingle.mp3", played)
+	}
+	// the schedule itself is untouched
+	schedules := []*schedule{}
+	decodeBody(t, apiRequest(t, "GET", "/api/v1/schedules", ""), &schedules)
+	if got := schedules[0].Days[0].Events[0].Sound; got != "bell.mp3" {
+		t.Errorf("stored sound = %s, want bell.mp3", got)
+	}
+
+	if rec := apiRequest(t, "POST", "/api/v1/theme", `{"name": "summer"}`); rec.Code != http.StatusNotFound {
+		t.Errorf("switch to an unknown theme = %d, want 404", rec.Code)
+	}
+	if rec := apiRequest(t, "POST", "/api/v1/theme", `{}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("switch without a name = %d, want 400", rec.Code)
+	}
+	apiRequest(t, "POST", "/api/v1/theme", `{"name": ""}`)
+	if got := sounds(); got != "bell.mp3" {
+		t.Errorf("back without a theme the bell plays %s, want bell.mp3", got)
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// timeSource returns the current time according to a trusted clock.
+type timeSource func(ctx context.Context) (time.Time, error)
+
+// httpTimeSource reads the Date header of a HEAD request to url. It's only
+// good to the second, plenty to catch a clock that hasn't synced.
+func httpTimeSource(url string) timeSource {
+	return func(ctx context.Context) (time.Time, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodHead, url, nil)
+		if err != nil {
+			return time.Time{}, err
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return time.Time{}, err
+		}
+		resp.Body.Close()
+		date := resp.Header.Get("Date")
+		if date == "" {
+			return time.Time{}, fmt.Errorf("no Date header from %s", url)
+		}
+		return http.ParseTime(date)
+	}
+}
+
+// clockSkew is how far the local clock, read by now, is behind source:
+// positive when it's slow. The source is taken at the midpoint of the
+// request so its latency doesn't count.
+func clockSkew(ctx context.Context, now func() time.Time, source timeSource) (time.Duration, error) {
+	before := now()
+	remote, err := source(ctx)
+	if err != nil {
+		return 0, err
+	}
+	after := now()
+	local := before.Add(after.Sub(before) / 2)
+	return remote.Sub(local), nil
+}
+
+// clockWaiting is set while waitForClock holds off scheduling.
+var clockWaiting atomic.Bool
+
+// waitForClock holds off scheduling while the clock disagrees with
+// schedule.time-check.url by more than max-skew, checking every retry, so
+// bells don't ring at the wrong time on a machine that booted before NTP
+// synced. After wait, a source that can't be reached or a clock that's still
+// off is given up on, and the schedule goes ahead on the local clock.
+func waitForClock() {
+	url := viper.GetString("schedule.time-check.url")
+	if url == "" {
+		return
+	}
+	clockWaiting.Store(true)
+	defer clockWaiting.Store(false)
+	maxSkew := viper.GetDuration("schedule.time-check.max-skew")
+	retry := viper.GetDuration("schedule.time-check.retry")
+	giveUp := time.Now().Add(viper.GetDuration("schedule.time-check.wait"))
+	source := httpTimeSource(url)
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), viper.GetDuration("schedule.fetch-timeout"))
+		skew, err := clockSkew(ctx, time.Now, source)
+		cancel()
+		switch {
+		case err != nil && time.Now().After(giveUp):
+			log.Warnf("Could not check the clock, scheduling anyway: %v", err)
+			return
+		case err != nil:
+			log.Warnf("Could not check the clock, retrying in %s: %v", retry, err)
+		case skew.Abs() > maxSkew && time.Now().After(giveUp):
+			log.WithFields(log.Fields{"Skew": skew.String(), "MaxSkew": maxSkew.String()}).
+				Warn("Clock is still off, scheduling anyway")
+			return
+		case skew.Abs() > maxSkew:
+			log.WithFields(log.Fields{"Skew": skew.String(), "MaxSkew": maxSkew.String()}).
+				Warnf("Clock is off, holding bells, retrying in %s", retry)
+		default:
+			log.WithFields(log.Fields{"Skew": skew.String()}).Info("Clock checked")
+			return
+		}
+		time.Sleep(retry)
+	}
+}
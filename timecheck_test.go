@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestClockSkew(t *testing.T) {
+	local := time.Date(2024, 3, 4, 8, 0, 0, 0, time.UTC)
+	// the request takes 2 s, the source answers for its midpoint
+	reads := []time.Time{local, local.Add(2 * time.Second)}
+	now := func() time.Time {
+		at := reads[0]
+		reads = reads[1:]
+		return at
+	}
+	source := func(ctx context.Context) (time.Time, error) {
+		return local.Add(time.Minute + time.Second), nil
+	}
+	skew, err := clockSkew(context.Background(), now, source)
+	if err != nil || skew != time.Minute {
+		t.Errorf("clockSkew = %s, %v, want the local clock a minute slow", skew, err)
+	}
+
+	ahead := func(ctx context.Context) (time.Time, error) {
+		return local.Add(-time.Hour), nil
+	}
+	skew, _ = clockSkew(context.Background(), func() time.Time { return local }, ahead)
+	if skew != -time.Hour {
+		t.Errorf("clockSkew = %s, want an hour fast", skew)
+	}
+
+	down := func(ctx context.Context) (time.Time, error) {
+		return time.Time{}, errors.New("connection refused")
+	}
+	if _, err := clockSkew(context.Background(), time.Now, down); err == nil {
+		t.Error("clockSkew without a source didn't fail")
+	}
+}
+
+func TestHTTPTimeSource(t *testing.T) {
+	at := time.Date(2024, 3, 4, 8, 0, 0, 0, time.UTC)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/nodate" {
+			w.Header()["Date"] = nil
+			return
+		}
+		w.Header().Set("Date", at.Format(http.TimeFormat))
+	}))
+	defer srv.Close()
+
+	got, err := httpTimeSource(srv.URL)(context.Background())
+	if err != nil || !got.Equal(at) {
+		t.Errorf("httpTimeSource = %s, %v, want %s", got, err, at)
+	}
+	if _, err := httpTimeSource(srv.URL + "/nodate")(context.Background()); err == nil {
+		t.Error("httpTimeSource without a Date header didn't fail")
+	}
+}
+
+func TestWaitForClock(t *testing.T) {
+	// the clock is an hour off for the first two checks
+	var checks atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		at := time.Now()
+		if checks.Add(1) <= 2 {
+			at = at.Add(time.Hour)
+		}
+		w.Header().Set("Date", at.UTC().Format(http.TimeFormat))
+	}))
+	defer srv.Close()
+	setConfig(t, "schedule.time-check.url", srv.URL)
+	setConfig(t, "schedule.time-check.max-skew", 30*time.Second)
+	setConfig(t, "schedule.time-check.retry", time.Millisecond)
+	setConfig(t, "schedule.time-check.wait", time.Minute)
+	setConfig(t, "schedule.fetch-timeout", 5*time.Second)
+	buf := captureLog(t)
+
+	waitForClock()
+	if held := logEntries(t, buf, "Clock is off, holding bells, retrying in 1ms"); len(held) != 2 {
+		t.Errorf("held %d times, want 2", len(held))
+	}
+	if checked := logEntries(t, buf, "Clock checked"); len(checked) != 1 || checks.Load() != 3 {
+		t.Errorf("checked %d times, %d requests, want scheduling after the third", len(checked), checks.Load())
+	}
+
+	// a source that can't be reached is given up on
+	srv.Close()
+	setConfig(t, "schedule.time-check.wait", time.Duration(0))
+	waitForClock()
+	if !strings.Contains(buf.String(), "Could not check the clock, scheduling anyway") {
+		t.Errorf("log = %s, want the check given up on", buf)
+	}
+
+	// so is a clock that stays off
+	off := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Date", time.Now().Add(time.Hour).UTC().Format(http.TimeFormat))
+	}))
+	defer off.Close()
+	setConfig(t, "schedule.time-check.url", off.URL)
+	waitForClock()
+	if len(logEntries(t, buf, "Clock is still off, scheduling anyway")) != 1 {
+		t.Errorf("log = %s, want the skew given up on", buf)
+	}
+}
+
+func TestWaitForClockHealth(t *testing.T) {
+	forgetHealth(t)
+	clockWaiting.Store(true)
+	t.Cleanup(func() { clockWaiting.Store(false) })
+	if got := scheduleHealth(); got.Status != "down" || got.Detail != "not parsed yet, waiting for the clock check" {
+		t.Errorf("schedule = %+v, want down waiting for the clock", got)
+	}
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"net/http"
+	"runtime"
+	"testing"
+)
+
+func TestGetVersion(t *testing.T) {
+	rec := apiRequest(t, "GET", "/api/v1/version", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+	body := map[string]interface{}{}
+	decodeBody(t, rec, &body)
+	want := map[string]string{
+		"version":   "dev",
+		"commit":    "dev",
+		"buildDate": "dev",
+		"goVersion": runtime.Version(),
+		"arch":      runtime.GOARCH,
+	}
+	if len(body) != len(want) {
+		t.Errorf("fields = %v, want %v", body, want)
+	}
+	for key, value := range want {
+		if body[key] != value {
+			t.Errorf("%s = %v, want %s", key, body[key], value)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// volumeTier sets the volume for bells from After ("15:04") until the next
+// tier. Before the first tier of the day bells play at full volume.
+type volumeTier struct {
+	After  string  `json:"after"`
+	Volume float64 `json:"volume"`
+}
+
+// effectiveVolume picks the gain for evt firing at now: the event's own
+// volume wins, then audio.role-volume for its role, then the schedule's tier
+// for the time of day.
+func effectiveVolume(sch *schedule, evt *event, now time.Time) float64 {
+	if evt.Volume != nil {
+		return *evt.Volume
+	}
+	// ceremonial bells can have their own default
+	if evt.Role != "" && viper.IsSet("audio.role-volume."+evt.Role) {
+		return viper.GetFloat64("audio.role-volume." + evt.Role)
+	}
+	sch = eventSchedule(sch, evt)
+	loc, err := scheduleLocation(sch)
+	if err == nil {
+		now = now.In(loc)
+	}
+	current := now.Format("15:04")
+	volume := 1.0
+	latest := ""
+	for _, tier := range sch.VolumeTiers {
+		if len(tier.After) != 5 {
+			log.Errorf("Invalid volume tier time: %s", tier.After)
+			continue
+		}
+		if tier.After <= current && tier.After >= latest {
+			latest = tier.After
+			volume = tier.Volume
+		}
+	}
+	return volume
+}
+
+// gainReader scales 16 bit little endian samples read from r.
+type gainReader struct {
+	r    io.Reader
+	gain float64
+}
+
+func newGainReader(r io.Reader, gain float64) io.Reader {
+	if gain == 1 {
+		return r
+	}
+	return &gainReader{r: r, gain: math.Max(gain, 0)}
+}
+
+func (g *gainReader) Read(p []byte) (int, error) {
+	if len(p) < 2 {
+		return 0, io.ErrShortBuffer
+	}
+	n, err := g.r.Read(p[:len(p)&^1])
+	if n%2 == 1 {
+		// keep whole samples so the next read stays aligned
+		m, e := io.ReadFull(g.r, p[n:n+1])
+		n += m
+		if err == nil {
+			err = e
+		}
+	}
+	for i := 0; i+1 < n; i += 2 {
+		sample := float64(int16(binary.LittleEndian.Uint16(p[i:]))) * g.gain
+		binary.LittleEndian.PutUint16(p[i:], uint16(clampSample(sample)))
+	}
+	return n, err
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEffectiveVolume(t *testing.T) {
+	setConfig(t, "app.timezone", "UTC")
+	setConfig(t, "audio.role-volume.last", 0.9)
+	sch := &schedule{Name: "term", VolumeTiers: []*volumeTier{
+		{After: "18:00", Volume: 0.3},
+		{After: "07:30", Volume: 0.8},
+		{After: "22:00", Volume: 0.1},
+	}}
+	half := 0.5
+	tests := []struct {
+		name string
+		evt  *event
+		at   string
+		want float64
+	}{
+		{"before the first tier", &event{}, "06:00", 1},
+		{"at a tier", &event{}, "07:30", 0.8},
+		{"daytime", &event{}, "12:00", 0.8},
+		{"evening", &event{}, "18:30", 0.3},
+		{"night", &event{}, "23:59", 0.1},
+		{"event volume wins", &event{Volume: &half}, "23:00", 0.5},
+		{"role volume wins over tiers", &event{Role: "last"}, "23:00", 0.9},
+		{"other role keeps the tier", &event{Role: "first"}, "23:00", 0.1},
+	}
+	for _, tt := range tests {
+		at, _ := time.Parse("15:04", tt.at)
+		now := time.Date(2024, 3, 4, at.Hour(), at.Minute(), 0, 0, time.UTC)
+		if got := effectiveVolume(sch, tt.evt, now); got != tt.want {
+			t.Errorf("%s: effectiveVolume at %s = %v, want %v", tt.name, tt.at, got, tt.want)
+		}
+	}
+}
+
+func TestEffectiveVolumeTimezone(t *testing.T) {
+	setConfig(t, "app.timezone", "UTC")
+	sch := &schedule{Name: "east", Timezone: "America/New_York", VolumeTiers: []*volumeTier{{After: "18:00", Volume: 0.3}}}
+	// 18:30 in New York, 23:30 UTC
+	now := time.Date(2024, 3, 4, 23, 30, 0, 0, time.UTC)
+	if got := effectiveVolume(sch, &event{}, now); got != 0.3 {
+		t.Errorf("effectiveVolume = %v, want the evening tier of the schedule's timezone", got)
+	}
+	if got := effectiveVolume(sch, &event{}, now.Add(-6*time.Hour)); got != 1 {
+		t.Errorf("effectiveVolume = %v, want full volume before 18:00 there", got)
+	}
+}
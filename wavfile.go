@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// filePlayer writes every playback to a timestamped WAV file in dir instead
+// of a sound card, for headless machines and for checking bell content.
+type filePlayer struct {
+	dir string
+}
+
+func (f *filePlayer) Play(ctx context.Context, pcm io.Reader, rate, channels int) error {
+	data, err := io.ReadAll(pcm)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(f.dir, 0o755)
+	if err != nil {
+		return err
+	}
+	name := filepath.Join(f.dir, appClock.Now().Format("20060102-150405.000000000")+".wav")
+	err = os.WriteFile(name, wavFile(data, rate, channels), 0o644)
+	if err != nil {
+		return err
+	}
+	log.Debugf("Wrote %s", name)
+	return nil
+}
+
+// wavFile wraps 16 bit little endian pcm in a RIFF/WAVE header.
+func wavFile(pcm []byte, rate, channels int) []byte {
+	blockAlign := channels * audioBitDepth
+	var buf bytes.Buffer
+	buf.WriteString("RIFF")
+	binary.Write(&buf, binary.LittleEndian, uint32(36+len(pcm)))
+	buf.WriteString("WAVE")
+	buf.WriteString("fmt ")
+	binary.Write(&buf, binary.LittleEndian, uint32(16))
+	binary.Write(&buf, binary.LittleEndian, uint16(1))
+	binary.Write(&buf, binary.LittleEndian, uint16(channels))
+	binary.Write(&buf, binary.LittleEndian, uint32(rate))
+	binary.Write(&buf, binary.LittleEndian, uint32(rate*blockAlign))
+	binary.Write(&buf, binary.LittleEndian, uint16(blockAlign))
+	binary.Write(&buf, binary.LittleEndian, uint16(audioBitDepth*8))
+	buf.WriteString("data")
+	binary.Write(&buf, binary.LittleEndian, uint32(len(pcm)))
+	buf.Write(pcm)
+	return buf.Bytes()
+}
+
+// decodeWAV returns the samples of a 16 bit PCM WAV file as stereo, upmixing
+// mono, and its sample rate. A data size of a streamed WAV that runs past the
+// end of the file is clamped to what's there.
+func decodeWAV(data []byte) ([]byte, int, error) {
+	if len(data) < 12 || string(data[0:4]) != "RIFF" || string(data[8:12]) != "WAVE" {
+		return nil, 0, fmt.Errorf("not a wav file")
+	}
+	channels, rate, bits := 0, 0, 0
+	pos := 12
+	for pos+8 <= len(data) {
+		id := string(data[pos : pos+4])
+		size := int(binary.LittleEndian.Uint32(data[pos+4 : pos+8]))
+		body := data[pos+8:]
+		if size < 0 || size > len(body) {
+			size = len(body)
+		}
+		switch id {
+		case "fmt ":
+			if size < 16 {
+				return nil, 0, fmt.Errorf("invalid wav fmt chunk")
+			}
+			if format := binary.LittleEndian.Uint16(body[0:2]); format != 1 {
+				return nil, 0, fmt.Errorf("unsupported wav format: %d", format)
+			}
+			channels = int(binary.LittleEndian.Uint16(body[2:4]))
+			rate = int(binary.LittleEndian.Uint32(body[4:8]))
+			bits = int(binary.LittleEndian.Uint16(body[14:16]))
+		case "data":
+			if rate == 0 {
+				return nil, 0, fmt.Errorf("wav data before fmt chunk")
+			}
+			if bits != 16 || (channels != 1 && channels != 2) {
+				return nil, 0, fmt.Errorf("unsupported wav: %d bit %d channels", bits, channels)
+			}
+			samples := body[:size-size%(channels*audioBitDepth)]
+			if channels == 2 {
+				return samples, rate, nil
+			}
+			stereo := make([]byte, 0, len(samples)*2)
+			for i := 0; i < len(samples); i += audioBitDepth {
+				stereo = append(stereo, samples[i], samples[i+1], samples[i], samples[i+1])
+			}
+			return stereo, rate, nil
+		}
+		// chunks are padded to an even size
+		pos += 8 + size + size%2
+	}
+	return nil, 0, fmt.Errorf("could not find wav data")
+}
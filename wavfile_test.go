@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileBackend(t *testing.T) {
+	dir := testDir(t)
+	useClock(t, time.Date(2024, 3, 4, 8, 0, 0, 0, time.UTC))
+	useQueue(t, &filePlayer{dir: filepath.Join(dir, "recordings")}, 8)
+	job := &playJob{Sound: "bell.mp3", Done: make(chan error, 1)}
+	if err := enqueuePlay(job); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-job.Done; err != nil {
+		t.Fatal(err)
+	}
+
+	names, _ := filepath.Glob(filepath.Join(dir, "recordings", "*.wav"))
+	if len(names) != 1 || filepath.Base(names[0]) != "20240304-080000.000000000.wav" {
+		t.Fatalf("recordings = %v, want one named after the time it played", names)
+	}
+	data, err := os.ReadFile(names[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	samples, rate, err := decodeWAV(data)
+	if err != nil {
+		t.Fatalf("recording isn't a valid wav: %v", err)
+	}
+	pcm, _, err := jobPCM(&playJob{Sound: "bell.mp3"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, _ := io.ReadAll(pcm)
+	if rate != 48000 || len(samples)/frameSize != len(want)/frameSize || !bytes.Equal(samples, want) {
+		t.Errorf("recording holds %d frames at %d Hz, want the bell's %d at 48000 Hz", len(samples)/frameSize, rate, len(want)/frameSize)
+	}
+	if frames := len(samples) / frameSize; frames < 179000 || frames > 181000 {
+		t.Errorf("recording holds %d frames, want 3.744 s at 48000 Hz", frames)
+	}
+}
+
+func TestDecodeWAV(t *testing.T) {
+	mono := wavFile([]byte{1, 0, 2, 0}, 8000, 1)
+	samples, rate, err := decodeWAV(mono)
+	if err != nil || rate != 8000 || !bytes.Equal(samples, []byte{1, 0, 1, 0, 2, 0, 2, 0}) {
+		t.Errorf("mono = %v %d %v, want it upmixed to stereo at 8000 Hz", samples, rate, err)
+	}
+	if _, _, err := decodeWAV([]byte("RIFF....WAVE")); err == nil {
+		t.Error("a wav without data decoded")
+	}
+	if _, _, err := decodeWAV([]byte("ID3 not a wav")); err == nil {
+		t.Error("an mp3 decoded as wav")
+	}
+}
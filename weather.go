@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// weatherConditions are the conditions a weather sound can match.
+var weatherConditions = []string{"clear", "cloudy", "fog", "drizzle", "rain", "snow", "storm"}
+
+// weatherSound plays Sound in place of the event's while the weather is
+// Condition.
+type weatherSound struct {
+	Condition string `json:"condition"`
+	Sound     string `json:"sound"`
+}
+
+// weatherProvider tells the weather at location.latitude and
+// location.longitude as one of weatherConditions.
+type weatherProvider interface {
+	Condition(ctx context.Context) (string, error)
+}
+
+// weatherSource is where the weather is looked up.
+var weatherSource weatherProvider = &openMeteo{client: http.DefaultClient}
+
+// the last condition weatherSource told and when
+var (
+	lastWeather   string
+	lastWeatherAt time.Time
+	lastWeatherMu sync.Mutex
+)
+
+// weatherCheck is how often watchWeather sees whether the weather is due to
+// be looked up again.
+const weatherCheck = time.Minute
+
+// watchWeather keeps the weather looked up in the background, so a bell only
+// reads the last answer instead of waiting on the weather service.
+func watchWeather() {
+	for {
+		if weatherDue(appClock.Now()) {
+			refreshWeather(appClock.Now())
+		}
+		time.Sleep(weatherCheck)
+	}
+}
+
+// weatherDue reports whether the running schedule has weather sounds and the
+// last answer is weather.cache-minutes old, or there's none yet.
+func weatherDue(now time.Time) bool {
+	if !weatherInUse() {
+		return false
+	}
+	lastWeatherMu.Lock()
+	defer lastWeatherMu.Unlock()
+	cached := time.Duration(viper.GetInt("weather.cache-minutes")) * time.Minute
+	return lastWeatherAt.IsZero() || now.Sub(lastWeatherAt) >= cached
+}
+
+// weatherInUse reports whether an event of the running schedule has weather
+// sounds.
+func weatherInUse() bool {
+	scheduleMu.RLock()
+	defer scheduleMu.RUnlock()
+	for _, sch := range runningSchedules() {
+		for _, d := range sch.Days {
+			for _, evt := range d.Events {
+				if len(evt.Weather) > 0 {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// refreshWeather asks weatherSource for the weather, waiting
+// weather.timeout-ms at most, and keeps the answer as of now.
+func refreshWeather(now time.Time) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(viper.GetInt("weather.timeout-ms"))*time.Millisecond)
+	defer cancel()
+	condition, err := weatherSource.Condition(ctx)
+	if err != nil {
+		log.Warnf("Could not look up the weather: %v", err)
+		return
+	}
+	lastWeatherMu.Lock()
+	defer lastWeatherMu.Unlock()
+	lastWeather, lastWeatherAt = condition, now
+}
+
+// currentWeather is the last answer watchWeather got, until it's
+// weather.max-age-minutes old.
+func currentWeather(now time.Time) (string, error) {
+	lastWeatherMu.Lock()
+	defer lastWeatherMu.Unlock()
+	if lastWeatherAt.IsZero() {
+		return "", fmt.Errorf("the weather hasn't been looked up yet")
+	}
+	maxAge := time.Duration(viper.GetInt("weather.max-age-minutes")) * time.Minute
+	if now.Sub(lastWeatherAt) >= maxAge {
+		return "", fmt.Errorf("the last answer, from %s, is too old", lastWeatherAt.Format(time.RFC3339))
+	}
+	return lastWeather, nil
+}
+
+// weatherChoice is the sound of the first of sounds matching the weather
+// now, or base when none does or the weather can't be told.
+func weatherChoice(sounds []*weatherSound, base string, now time.Time) string {
+	condition, err := currentWeather(now)
+	if err != nil {
+		log.Warnf("Could not tell the weather, playing %s: %v", base, err)
+		return base
+	}
+	for _, w := range sounds {
+		if w.Condition == condition {
+			log.Printf("Weather is %s, playing %s", condition, w.Sound)
+			return w.Sound
+		}
+	}
+	return base
+}
+
+// checkWeatherSounds validates an event's weather sounds, found in dir.
+// Every one must be there, a missing one would only show in that weather.
+func checkWeatherSounds(dir string, sounds []*weatherSound) error {
+	if len(sounds) == 0 {
+		return nil
+	}
+	if viper.GetString("location.latitude") == "" || viper.GetString("location.longitude") == "" {
+		return fmt.Errorf("weather sounds need location.latitude and location.longitude")
+	}
+	for _, w := range sounds {
+		if !slices.Contains(weatherConditions, w.Condition) {
+			return fmt.Errorf("invalid weather condition %q, expected one of %s", w.Condition, strings.Join(weatherConditions, ", "))
+		}
+		err := checkSoundFile(dir, w.Sound)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// openMeteo reads the current weather code from weather.url, the Open-Meteo
+// forecast API by default, with {lat} and {lon} replaced by the location.
+type openMeteo struct {
+	client *http.Client
+}
+
+func (o *openMeteo) Condition(ctx context.Context) (string, error) {
+	url := strings.NewReplacer(
+		"{lat}", viper.GetString("location.latitude"),
+		"{lon}", viper.GetString("location.longitude"),
+	).Replace(viper.GetString("weather.url"))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+	body := struct {
+		Current *struct {
+			WeatherCode *int `json:"weather_code"`
+		} `json:"current"`
+	}{}
+	err = json.NewDecoder(io.LimitReader(resp.Body, 1000000)).Decode(&body)
+	if err != nil {
+		return "", fmt.Errorf("could not read the weather: %v", err)
+	}
+	if body.Current == nil || body.Current.WeatherCode == nil {
+		return "", fmt.Errorf("no current weather_code in the answer")
+	}
+	return wmoCondition(*body.Current.WeatherCode), nil
+}
+
+// wmoCondition groups a WMO weather interpretation code into one of
+// weatherConditions.
+func wmoCondition(code int) string {
+	switch {
+	case code <= 1:
+		return "clear"
+	case code <= 3:
+		return "cloudy"
+	case code == 45 || code == 48:
+		return "fog"
+	case code >= 51 && code <= 57:
+		return "drizzle"
+	case code >= 61 && code <= 67, code >= 80 && code <= 82:
+		return "rain"
+	case code >= 71 && code <= 77, code == 85 || code == 86:
+		return "snow"
+	case code >= 95:
+		return "storm"
+	}
+	return "cloudy"
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// mockWeather answers condition, or err, and counts the lookups.
+type mockWeather struct {
+	mu        sync.Mutex
+	condition string
+	err       error
+	calls     int
+}
+
+func (m *mockWeather) Condition(ctx context.Context) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls++
+	return m.condition, m.err
+}
+
+func (m *mockWeather) set(condition string, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.condition, m.err = condition, err
+}
+
+func (m *mockWeather) lookups() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.calls
+}
+
+// useWeather looks the weather up from source, with nothing cached, until
+// the test ends.
+func useWeather(t *testing.T, source weatherProvider) {
+	t.Helper()
+	forget := func() {
+		lastWeatherMu.Lock()
+		lastWeather, lastWeatherAt = "", time.Time{}
+		lastWeatherMu.Unlock()
+	}
+	forget()
+	weatherSource = source
+	t.Cleanup(func() {
+		weatherSource = &openMeteo{client: http.DefaultClient}
+		forget()
+	})
+}
+
+func TestWeatherChoice(t *testing.T) {
+	setConfig(t, "weather.max-age-minutes", 60)
+	setConfig(t, "weather.timeout-ms", 1000)
+	weather := &mockWeather{}
+	useWeather(t, weather)
+	sounds := []*weatherSound{{Condition: "snow", Sound: "snow.mp3"}, {Condition: "rain", Sound: "rain.mp3"}}
+	now := time.Date(2024, 3, 4, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		condition string
+		err       error
+		refresh   bool
+		at        time.Duration
+		want      string
+		lookups   int
+	}{
+		{"not looked up yet", "", nil, false, 0, "bell.mp3", 0},
+		{"matches", "rain", nil, true, 0, "rain.mp3", 1},
+		{"read from the last answer", "clear", nil, false, 50 * time.Minute, "rain.mp3", 1},
+		{"last answer while down", "", errors.New("timeout"), true, 55 * time.Minute, "rain.mp3", 2},
+		{"too old to use", "", nil, false, time.Hour, "bell.mp3", 2},
+		{"snow", "snow", nil, true, 2 * time.Hour, "snow.mp3", 3},
+		{"no sound for it", "clear", nil, true, 3 * time.Hour, "bell.mp3", 4},
+	}
+	for _, tt := range tests {
+		weather.set(tt.condition, tt.err)
+		if tt.refresh {
+			refreshWeather(now.Add(tt.at))
+		}
+		if got := weatherChoice(sounds, "bell.mp3", now.Add(tt.at)); got != tt.want {
+			t.Errorf("%s: weatherChoice = %s, want %s", tt.name, got, tt.want)
+		}
+		if got := weather.lookups(); got != tt.lookups {
+			t.Errorf("%s: %d lookups, want %d", tt.name, got, tt.lookups)
+		}
+	}
+}
+
+func TestOpenMeteo(t *testing.T) {
+	var answer string
+	var query string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.RawQuery
+		w.Write([]byte(answer))
+	}))
+	t.Cleanup(srv.Close)
+	setConfig(t, "location.latitude", 19.43)
+	setConfig(t, "location.longitude", -99.13)
+	setConfig(t, "weather.url", srv.URL+"/v1/forecast?latitude={lat}&longitude={lon}&current=weather_code")
+	source := &openMeteo{client: srv.Client()}
+
+	answer = `{"current": {"time": "2024-03-04T10:00", "weather_code": 63}}`
+	if got, err := source.Condition(context.Background()); err != nil || got != "rain" {
+		t.Errorf("Condition = %q, %v, want rain", got, err)
+	}
+	if query != "latitude=19.43&longitude=-99.13&current=weather_code" {
+		t.Errorf("asked %q, want the location filled in", query)
+	}
+	answer = `{"current": {}}`
+	if _, err := source.Condition(context.Background()); err == nil || !strings.Contains(err.Error(), "weather_code") {
+		t.Errorf("Condition without a code = %v, want an error", err)
+	}
+
+	codes := map[int]string{0: "clear", 2: "cloudy", 45: "fog", 53: "drizzle", 81: "rain", 75: "snow", 96: "storm"}
+	for code, want := range codes {
+		if got := wmoCondition(code); got != want {
+			t.Errorf("wmoCondition(%d) = %s, want %s", code, got, want)
+		}
+	}
+}
+
+func TestWeatherBell(t *testing.T) {
+	testDir(t)
+	sound, err := os.ReadFile("sounds/bell.mp3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, "sounds/recess.mp3", string(sound))
+	if err := checkWeatherSounds(soundsDir(), []*weatherSound{{Condition: "rain", Sound: "recess.mp3"}}); err == nil || !strings.Contains(err.Error(), "location.latitude") {
+		t.Errorf("checkWeatherSounds without a location = %v, want it asked for", err)
+	}
+
+	setConfig(t, "location.latitude", 19.43)
+	setConfig(t, "location.longitude", -99.13)
+	if err := checkWeatherSounds(soundsDir(), []*weatherSound{{Condition: "hail", Sound: "recess.mp3"}}); err == nil || !strings.Contains(err.Error(), `invalid weather condition "hail"`) {
+		t.Errorf("checkWeatherSounds(hail) = %v, want it rejected", err)
+	}
+	setConfig(t, "weather.timeout-ms", 1000)
+	setConfig(t, "weather.cache-minutes", 15)
+	setConfig(t, "weather.max-age-minutes", 120)
+	weather := &mockWeather{condition: "rain"}
+	useWeather(t, weather)
+	player := &recordingPlayer{}
+	useQueue(t, player, 4)
+	now := time.Date(2024, 3, 4, 7, 0, 0, 0, time.UTC)
+	loadSchedule(t, now, `[{"name": "term", "starts": "2024-01-01", "ends": "2024-12-31", "days": [{"name": "Monday", "events": [
+		{"time": "10:00", "sound": "bell.mp3", "weather": [{"condition": "rain", "sound": "recess.mp3"}]}
+	]}]}]`)
+
+	// looked up in the background, again once the answer is cache-minutes old
+	if !weatherDue(now) {
+		t.Error("weather not due with a weather sound and no answer yet")
+	}
+	refreshWeather(now)
+	if weatherDue(now.Add(14 * time.Minute)) {
+		t.Error("weather due again before weather.cache-minutes")
+	}
+	if !weatherDue(now.Add(15 * time.Minute)) {
+		t.Error("weather not due again after weather.cache-minutes")
+	}
+
+	// the bell doesn't wait on a lookup
+	runBell(t, "term", "10:00")
+	waitFor(t, "the rainy day bell", func() bool { return getLastPlayed() != nil })
+	if played := getLastPlayed(); played.Sound != "recess.mp3" || played.Error != "" {
+		t.Errorf("played %+v in the rain, want recess.mp3", played)
+	}
+	if weather.lookups() != 1 {
+		t.Errorf("%d lookups, want only the one before the bell", weather.lookups())
+	}
+}
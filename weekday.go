@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// parseWeekday reads a weekday as a name, "monday" or "Mon", or a number
+// counted as cron does, 0 or 7 for Sunday and 1 for Monday.
+func parseWeekday(value string) (time.Weekday, error) {
+	if n, err := strconv.Atoi(value); err == nil {
+		if n < 0 || n > 7 {
+			return 0, fmt.Errorf("invalid day: %s", value)
+		}
+		return time.Weekday(n % 7), nil
+	}
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		name := d.String()
+		if strings.EqualFold(value, name) || strings.EqualFold(value, name[0:3]) {
+			return d, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid day: %s", value)
+}
+
+// weekdayBells lists the events of the active schedules' enabled days on
+// weekday, sorted by time with cron events, which have none, last. Callers
+// must hold scheduleMu.
+func weekdayBells(weekday time.Weekday) []*entryInfo {
+	dayName := strings.ToUpper(weekday.String()[0:3])
+	bells := []*entryInfo{}
+	running := runningSchedules()
+	expanded, _ := expandPrograms(running)
+	for _, name := range activeSchedules {
+		sch := findExpanded(expanded, running, name)
+		if sch == nil {
+			continue
+		}
+		for _, d := range sch.Days {
+			if !d.isEnabled() || strings.ToUpper(d.Name[0:3]) != dayName {
+				continue
+			}
+			for _, evt := range d.Events {
+				bells = append(bells, &entryInfo{
+					Kind:     "bell",
+					Schedule: sch.Name,
+					Day:      dayName,
+					Time:     evt.Time,
+					Cron:     evt.Cron,
+					Sound:    evt.Sound,
+					Zone:     evt.Zone,
+					Label:    evt.Label,
+					Role:     evt.Role,
+				})
+			}
+		}
+	}
+	sort.SliceStable(bells, func(i, j int) bool {
+		if (bells[i].Time == "") != (bells[j].Time == "") {
+			return bells[j].Time == ""
+		}
+		return bells[i].Time < bells[j].Time
+	})
+	return bells
+}
+
+func getWeekdayHandler(w http.ResponseWriter, r *http.Request) {
+	weekday, err := parseWeekday(mux.Vars(r)["day"])
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	scheduleMu.RLock()
+	defer scheduleMu.RUnlock()
+	writeJSON(w, http.StatusOK, weekdayBells(weekday))
+}
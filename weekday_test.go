@@ -0,0 +1,78 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestParseWeekday(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Weekday
+		ok    bool
+	}{
+		{"monday", time.Monday, true},
+		{"Mon", time.Monday, true},
+		{"MON", time.Monday, true},
+		{"1", time.Monday, true},
+		{"0", time.Sunday, true},
+		{"7", time.Sunday, true},
+		{"Saturday", time.Saturday, true},
+		{"8", 0, false},
+		{"-1", 0, false},
+		{"mo", 0, false},
+		{"funday", 0, false},
+		{"", 0, false},
+	}
+	for _, tt := range tests {
+		got, err := parseWeekday(tt.value)
+		if (err == nil) != tt.ok || tt.ok && got != tt.want {
+			t.Errorf("parseWeekday(%q) = %s, %v, want %s, ok %v", tt.value, got, err, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestWeekdayHandler(t *testing.T) {
+	testDir(t)
+	loadSchedule(t, time.Date(2024, 3, 4, 7, 0, 0, 0, time.UTC), `[
+		{"name": "term", "starts": "2024-01-01", "ends": "2024-12-31", "days": [
+			{"name": "Monday", "events": [{"time": "10:00", "sound": "bell.mp3"}, {"cron": "0 */2 * * *", "sound": "bell.mp3"}, {"time": "08:00", "sound": "bell.mp3"}]},
+			{"name": "Tuesday", "enabled": false, "events": [{"time": "08:00", "sound": "bell.mp3"}]}
+		]},
+		{"name": "clubs", "starts": "2024-01-01", "ends": "2024-12-31", "days": [
+			{"name": "Monday", "events": [{"time": "09:00", "sound": "bell.mp3", "label": "Chess"}]}
+		]}
+	]`)
+
+	for _, day := range []string{"Monday", "mon", "1"} {
+		rec := apiRequest(t, "GET", "/api/v1/weekday/"+day, "")
+		bells := []*entryInfo{}
+		decodeBody(t, rec, &bells)
+		if rec.Code != http.StatusOK || len(bells) != 4 {
+			t.Fatalf("weekday %s = %d %s, want 4 bells", day, rec.Code, rec.Body)
+		}
+		got := []string{}
+		for _, b := range bells {
+			got = append(got, b.Schedule+" "+b.Time+b.Cron)
+		}
+		want := []string{"term 08:00", "clubs 09:00", "term 10:00", "term 0 */2 * * *"}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Errorf("weekday %s = %q, want %q", day, got, want)
+				break
+			}
+		}
+	}
+
+	for _, day := range []string{"tuesday", "sun"} {
+		bells := []*entryInfo{}
+		decodeBody(t, apiRequest(t, "GET", "/api/v1/weekday/"+day, ""), &bells)
+		if len(bells) != 0 {
+			t.Errorf("weekday %s = %+v, want none, it's disabled or empty", day, bells)
+		}
+	}
+	if rec := apiRequest(t, "GET", "/api/v1/weekday/funday", ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("weekday funday = %d, want 400", rec.Code)
+	}
+}
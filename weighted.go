@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// soundChoice is one of the sounds an event picks from at random, Weight
+// times as likely as a choice of weight 1.
+type soundChoice struct {
+	File   string `json:"file"`
+	Weight int    `json:"weight,omitempty"`
+}
+
+func (c *soundChoice) weight() int {
+	if c.Weight < 1 {
+		return 1
+	}
+	return c.Weight
+}
+
+// soundRand picks weighted sounds, rand.Rand isn't safe for concurrent use.
+var (
+	soundRandMu sync.Mutex
+	soundRand   = rand.New(rand.NewSource(time.Now().UnixNano()))
+)
+
+// randomSound picks one of choices by weight.
+func randomSound(choices []*soundChoice) string {
+	soundRandMu.Lock()
+	defer soundRandMu.Unlock()
+	return pickSound(choices, soundRand)
+}
+
+func pickSound(choices []*soundChoice, r *rand.Rand) string {
+	total := 0
+	for _, c := range choices {
+		total += c.weight()
+	}
+	n := r.Intn(total)
+	for _, c := range choices {
+		n -= c.weight()
+		if n < 0 {
+			return c.File
+		}
+	}
+	return choices[len(choices)-1].File
+}
+
+// eventJSON is event without its JSON methods.
+type eventJSON event
+
+// UnmarshalJSON accepts "sound" as a file name or a list of weighted
+// choices. With choices, Sound is the first one's file.
+func (e *event) UnmarshalJSON(data []byte) error {
+	aux := struct {
+		*eventJSON
+		Sound json.RawMessage `json:"sound"`
+	}{eventJSON: (*eventJSON)(e)}
+	err := json.Unmarshal(data, &aux)
+	if err != nil {
+		return err
+	}
+	e.Sound, e.Choices = "", nil
+	sound := bytes.TrimSpace(aux.Sound)
+	if len(sound) == 0 || string(sound) == "null" {
+		return nil
+	}
+	if sound[0] != '[' {
+		return json.Unmarshal(sound, &e.Sound)
+	}
+	err = json.Unmarshal(sound, &e.Choices)
+	if err != nil {
+		return err
+	}
+	if len(e.Choices) > 0 {
+		e.Sound = e.Choices[0].File
+	}
+	return nil
+}
+
+// MarshalJSON writes the choices back as "sound" when there are any.
+func (e event) MarshalJSON() ([]byte, error) {
+	aux := struct {
+		eventJSON
+		Sound interface{} `json:"sound"`
+	}{eventJSON: eventJSON(e), Sound: e.Sound}
+	if len(e.Choices) > 0 {
+		aux.Sound = e.Choices
+	}
+	return json.Marshal(aux)
+}
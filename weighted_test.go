@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPickSound(t *testing.T) {
+	choices := []*soundChoice{{File: "a.mp3", Weight: 3}, {File: "b.mp3", Weight: 1}, {File: "c.mp3"}}
+	r := rand.New(rand.NewSource(1))
+	const draws = 50000
+	counts := map[string]int{}
+	for i := 0; i < draws; i++ {
+		counts[pickSound(choices, r)]++
+	}
+	// c.mp3 has no weight, so counts as 1
+	for file, share := range map[string]float64{"a.mp3": 0.6, "b.mp3": 0.2, "c.mp3": 0.2} {
+		got := float64(counts[file]) / draws
+		if math.Abs(got-share) > 0.01 {
+			t.Errorf("%s picked %.3f of the time, want %.2f", file, got, share)
+		}
+	}
+}
+
+func TestSoundChoicesJSON(t *testing.T) {
+	evt := &event{}
+	err := json.Unmarshal([]byte(`{"time": "08:00", "sound": [{"file": "a.mp3", "weight": 3}, {"file": "b.mp3"}]}`), evt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if evt.Sound != "a.mp3" || len(evt.Choices) != 2 || evt.Choices[0].Weight != 3 {
+		t.Errorf("event = %+v, want a.mp3 and b.mp3 to choose from", evt)
+	}
+	data, err := json.Marshal(evt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"sound":[{"file":"a.mp3","weight":3},{"file":"b.mp3"}]`) {
+		t.Errorf("marshaled %s, want the choices back as sound", data)
+	}
+
+	err = json.Unmarshal([]byte(`{"time": "08:00", "sound": "bell.mp3"}`), evt)
+	if err != nil || evt.Sound != "bell.mp3" || evt.Choices != nil {
+		t.Errorf("event = %+v, %v, want bell.mp3 alone", evt, err)
+	}
+}
+
+func TestSoundChoicesChecked(t *testing.T) {
+	testDir(t)
+	loadSchedule(t, time.Date(2024, 3, 4, 7, 0, 0, 0, time.UTC), `[{"name": "term", "starts": "2024-01-01", "ends": "2024-12-31", "days": [{"name": "Monday", "events": [
+		{"time": "08:00", "sound": [{"file": "bell.mp3", "weight": 3}, {"file": "bell.mp3"}]},
+		{"time": "09:00", "sound": [{"file": "bell.mp3"}, {"file": "missing.mp3"}]}
+	]}]}]`)
+	bells := entriesOf("bell")
+	if len(bells) != 1 || bells[0].Time != "08:00" {
+		t.Errorf("bells = %+v, want only the one at 08:00", bells)
+	}
+	if len(parseErrors) != 1 || !strings.Contains(parseErrors[0].Message, "missing.mp3") {
+		t.Errorf("errors = %+v, want the missing choice rejected", parseErrors)
+	}
+}
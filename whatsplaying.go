@@ -0,0 +1,46 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// nowPlaying is the sound the worker is playing, nil when idle.
+var (
+	nowPlaying   *playRecord
+	nowPlayingMu sync.RWMutex
+)
+
+type playbackState struct {
+	Playing bool       `json:"playing"`
+	Sound   string     `json:"sound,omitempty"`
+	Zone    string     `json:"zone,omitempty"`
+	Started *time.Time `json:"started,omitempty"`
+	// Queued is how many sounds wait behind it.
+	Queued int `json:"queued"`
+}
+
+func setNowPlaying(record *playRecord) {
+	nowPlayingMu.Lock()
+	nowPlaying = record
+	nowPlayingMu.Unlock()
+}
+
+func currentPlayback() *playbackState {
+	nowPlayingMu.RLock()
+	defer nowPlayingMu.RUnlock()
+	state := &playbackState{Queued: len(playQueue)}
+	if nowPlaying != nil {
+		started := nowPlaying.At
+		state.Playing = true
+		state.Sound = nowPlaying.Sound
+		state.Zone = nowPlaying.Zone
+		state.Started = &started
+	}
+	return state
+}
+
+func getWhatsPlayingHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, currentPlayback())
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWhatsPlaying(t *testing.T) {
+	testDir(t)
+	useClock(t, time.Date(2024, 3, 4, 8, 0, 0, 0, time.UTC))
+	player := &recordingPlayer{gate: make(chan struct{})}
+	useQueue(t, player, 8)
+	playing := func() *playbackState {
+		t.Helper()
+		rec := apiRequest(t, "GET", "/api/v1/whatsplaying", "")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("whatsplaying = %d, want 200", rec.Code)
+		}
+		state := &playbackState{}
+		decodeBody(t, rec, state)
+		return state
+	}
+
+	rec := apiRequest(t, "GET", "/api/v1/whatsplaying", "")
+	if body := strings.TrimSpace(rec.Body.String()); body != `{"playing":false,"queued":0}` {
+		t.Errorf("idle = %s, want only playing false and nothing queued", body)
+	}
+
+	first := pcmJob("first.mp3", 10*time.Millisecond)
+	if err := enqueuePlay(first); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the first sound", func() bool { return playing().Playing })
+	for _, name := range []string{"second.mp3", "third.mp3"} {
+		if err := enqueuePlay(pcmJob(name, 10*time.Millisecond)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	state := playing()
+	if state.Sound != "first.mp3" || state.Zone != defaultZone || state.Queued != 2 || state.Started == nil || !state.Started.Equal(time.Date(2024, 3, 4, 8, 0, 0, 0, time.UTC)) {
+		t.Errorf("state = %+v, want first.mp3 playing since 08:00 with 2 queued", state)
+	}
+
+	close(player.gate)
+	waitFor(t, "the queue to drain", func() bool { return player.count() == 3 })
+	waitFor(t, "idle", func() bool { return !playing().Playing })
+	if state := playing(); state.Sound != "" || state.Started != nil || state.Queued != 0 {
+		t.Errorf("state = %+v after playing, want idle", state)
+	}
+}
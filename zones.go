@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// defaultZone is used by events and plays that don't name a zone.
+const defaultZone = "all"
+
+type zone struct {
+	Name   string `json:"name"`
+	Device string `json:"device,omitempty"`
+}
+
+// zones reads the zones config, a map of zone name to its output device.
+func zones() map[string]*zone {
+	configured := map[string]*zone{}
+	err := viper.UnmarshalKey("zones", &configured)
+	if err != nil {
+		log.Errorf("Could not parse zones: %v", err)
+	}
+	for name, z := range configured {
+		if z == nil {
+			z = &zone{}
+			configured[name] = z
+		}
+		z.Name = name
+	}
+	return configured
+}
+
+func resolveZone(name string) (*zone, error) {
+	configured := zones()
+	if name == "" || name == defaultZone {
+		if z, ok := configured[defaultZone]; ok {
+			return z, nil
+		}
+		return &zone{Name: defaultZone, Device: viper.GetString("audio.device")}, nil
+	}
+	z, ok := configured[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown zone: %s", name)
+	}
+	return z, nil
+}
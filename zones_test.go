@@ -0,0 +1,67 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestResolveZone(t *testing.T) {
+	setConfig(t, "audio.device", "hw:0")
+	setConfig(t, "zones", map[string]interface{}{
+		"gym":  map[string]interface{}{"device": "hw:1"},
+		"hall": nil,
+	})
+	tests := []struct {
+		name, want, device string
+	}{
+		{"", "all", "hw:0"},
+		{"all", "all", "hw:0"},
+		{"gym", "gym", "hw:1"},
+		{"hall", "hall", ""},
+	}
+	for _, tt := range tests {
+		z, err := resolveZone(tt.name)
+		if err != nil || z.Name != tt.want || z.Device != tt.device {
+			t.Errorf("resolveZone(%q) = %+v, %v, want %s on %q", tt.name, z, err, tt.want, tt.device)
+		}
+	}
+	if _, err := resolveZone("roof"); err == nil {
+		t.Error("resolveZone(roof) found an unconfigured zone")
+	}
+
+	setConfig(t, "zones", map[string]interface{}{"all": map[string]interface{}{"device": "hw:2"}})
+	if z, _ := resolveZone(""); z.Device != "hw:2" {
+		t.Errorf("configured default zone device = %q, want hw:2", z.Device)
+	}
+}
+
+func TestPlayZone(t *testing.T) {
+	testDir(t)
+	setConfig(t, "zones", map[string]interface{}{"gym": map[string]interface{}{"device": "hw:1"}})
+	useQueue(t, &recordingPlayer{}, 8)
+
+	tests := []struct {
+		body string
+		code int
+		zone string
+	}{
+		{`{"sound": "bell.mp3"}`, http.StatusAccepted, ""},
+		{`{"sound": "bell.mp3", "zone": "gym"}`, http.StatusAccepted, "gym"},
+		{`{"sound": "bell.mp3", "zone": "roof"}`, http.StatusBadRequest, ""},
+	}
+	for _, tt := range tests {
+		rec := apiRequest(t, "POST", "/api/v1/play", tt.body)
+		if rec.Code != tt.code {
+			t.Errorf("play %s = %d %s, want %d", tt.body, rec.Code, rec.Body, tt.code)
+			continue
+		}
+		if tt.code != http.StatusAccepted {
+			continue
+		}
+		job := map[string]interface{}{}
+		decodeBody(t, rec, &job)
+		if zone, _ := job["zone"].(string); zone != tt.zone {
+			t.Errorf("play %s queued on zone %q, want %q", tt.body, zone, tt.zone)
+		}
+	}
+}